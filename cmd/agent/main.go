@@ -23,8 +23,10 @@ import (
 	"net"
 	"os"
 	"polardb-sms/pkg/agent/device/dmhelper"
+	"polardb-sms/pkg/agent/device/reservation"
 	"polardb-sms/pkg/agent/meta"
 	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network"
 	"polardb-sms/pkg/version"
 	"runtime"
 	"strings"
@@ -42,7 +44,7 @@ var (
 	reportPort = flag.String("report-port", "2002", "The port for the report port on remote server")
 	address    = flag.String("address", "0.0.0.0", "The IP address for the sms agent to serve on")
 	dataDir    = flag.String("data-dir", "/var/lib/sms-agent/", "The agent data directory")
-	whiteIPs   = flag.String("white-ips", "0.0.0.0/0", "The white ip list that allowed to connect to sms agent")
+	whiteIPs   = flag.String("white-ips", "0.0.0.0/0", "The white ip list that allowed to connect to sms agent, both the message channel and the event reporter")
 	// monitor report args
 	rules              = flag.String("rules", "", "The udev rules that sms agent listening, AND is separated by comma, OR is separated by |, e.g. 'SUBSYSTEM=net|SUBSYSTEM=block'")
 	nodeId             = flag.String("node-id", "", "The node id, default is hostname")
@@ -52,6 +54,12 @@ var (
 	logLevel           = flag.String("smslog-level", "info", "The smslog level, can be debug,info,warning,error")
 	logDir             = flag.String("logDir", "/var/log/polardb-box/polardb-sms/agent/", "sms smslog dir")
 	localDiskDir       = flag.String("local-disk-dir", "/dev/local-disks/", "sms local disk or vg dir")
+	scsiPrExecutor     = flag.String("scsi-pr-executor", "mpathpersist", "The executor of scsi persistent reservation cmd, can be mpathpersist,sgio")
+	nvmePrExecutor     = flag.String("nvme-pr-executor", "nvme-cli", "The executor of nvme reservation cmd, can be nvme-cli,ioctl")
+	tlsCertFile        = flag.String("tls-cert-file", "", "The certificate of the message server, the manager connects by plain tcp if empty")
+	tlsKeyFile         = flag.String("tls-key-file", "", "The private key of the tls certificate")
+	tlsCAFile          = flag.String("tls-ca-file", "", "The CA verifying the certificate of the manager")
+	msgJournalExpiry   = flag.Duration("msg-journal-expiry", meta.DefaultJournalExpiry, "How long the response of a processed message is kept to answer its re-delivery")
 
 	pidFile = "/var/run/polar-sms-agent.pid"
 )
@@ -115,6 +123,14 @@ func buildConfig() (*Config, error) {
 	}
 	cfg.EventReporterConfig.NodeId = *nodeId
 	cfg.EventReporterConfig.NodeIp = *nodeIp
+	cfg.EventReporterConfig.DisableUdevEvent = *disableUdevEvent
+
+	if err := reservation.SetScsiPrExecutor(*scsiPrExecutor); err != nil {
+		return nil, err
+	}
+	if err := reservation.SetNvmePrExecutor(*nvmePrExecutor); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
@@ -160,8 +176,17 @@ func main() {
 	}
 
 	stopCh := signals.SetupSignalHandler()
+	go meta.GetMsgJournal().RunExpiry(*msgJournalExpiry, stopCh)
 
-	msgServer := msgserver.NewMessageServer(*nodeId, *nodeIp, *port)
+	reloader, err := network.NewCertReloader(network.TLSConfig{
+		CertFile: *tlsCertFile,
+		KeyFile:  *tlsKeyFile,
+		CAFile:   *tlsCAFile,
+	})
+	if err != nil {
+		smslog.Fatalf("load tls cert failed: %s", err.Error())
+	}
+	msgServer := msgserver.NewMessageServer(*nodeId, *nodeIp, *port, reloader, cfg.EventReporterConfig.WhiteIPs)
 	go msgServer.Run()
 	defer msgServer.Shutdown()
 
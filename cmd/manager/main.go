@@ -127,7 +127,10 @@ func main() {
 	stopCh := signals.SetupSignalHandler()
 	interfaces.Init(*NodeIp, *servePort)
 	// Connect Agent Server
-	msgServer := msgserver.NewMessageServer(config.ClusterConf.Nodes)
+	msgServer, err := msgserver.NewMessageServer(config.ClusterConf.Nodes)
+	if err != nil {
+		smslog.Fatalf("create message server failed: %s", err.Error())
+	}
 	go msgServer.Run()
 
 	// Leader Election Server
@@ -142,6 +145,8 @@ func main() {
 
 	//Add workflowEngine
 	server.AddRunner(service.GetWorkflowEngine())
+	server.AddRunner(service.GetWorkflowRetention())
+	server.AddRunner(service.GetPrReconciler())
 
 	// PureSoft CSI Server
 	cfg := anticorrosion.NewControllerConfig(stopCh, *NodeId, *NodeIp, clientSet)
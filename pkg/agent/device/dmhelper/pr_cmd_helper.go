@@ -16,8 +16,10 @@
 package dmhelper
 
 import (
+	"polardb-sms/pkg/agent/device/reservation"
 	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
 	"polardb-sms/pkg/agent/device/reservation/nvme"
+	"polardb-sms/pkg/agent/device/reservation/sgio"
 	"polardb-sms/pkg/agent/utils"
 	"polardb-sms/pkg/device"
 	smslog "polardb-sms/pkg/log"
@@ -29,9 +31,9 @@ func getPrSupportParam(name string) *device.PrSupportReport {
 	var prInfo *mpathpersist.PersistentReserve
 	var err error
 	if utils.CheckNvmeVolumeStartWith3(name) {
-		prInfo, err = nvme.GetPrInfo(devicePath)
+		prInfo, err = GetNvmePrInfo(devicePath)
 	} else {
-		prInfo, err = mpathpersist.GetPrInfo(devicePath)
+		prInfo, err = GetScsiPrInfo(devicePath)
 	}
 	if err == nil {
 		smslog.Debugf("get devicePath %s pr info %v", devicePath, prInfo)
@@ -51,7 +53,7 @@ func getPrSupportParam(name string) *device.PrSupportReport {
 	} else {
 		smslog.Infof("failed get pr info for %s, err %s", name, err.Error())
 	}
-	capability, err := mpathpersist.ReportCapabilities(devicePath)
+	capability, err := ScsiReportCapabilities(devicePath)
 	if err == nil {
 		ret.Pr7Supported = capability.Support(mpathpersist.PRC_WR_EX)
 		ret.PrCapacities = capability.String()
@@ -60,3 +62,25 @@ func getPrSupportParam(name string) *device.PrSupportReport {
 	}
 	return ret
 }
+
+//GetScsiPrInfo queries the pr info by the scsi pr executor of this node
+func GetScsiPrInfo(devicePath string) (*mpathpersist.PersistentReserve, error) {
+	if reservation.ScsiPrExecutor() == reservation.SgIoExecutor {
+		return sgio.NewClient().GetPrInfo(devicePath)
+	}
+	return mpathpersist.GetPrInfo(devicePath)
+}
+
+func ScsiReportCapabilities(devicePath string) (*mpathpersist.PRCapabilities, error) {
+	if reservation.ScsiPrExecutor() == reservation.SgIoExecutor {
+		return sgio.NewClient().ReportCapabilities(devicePath)
+	}
+	return mpathpersist.ReportCapabilities(devicePath)
+}
+
+func GetNvmePrInfo(devicePath string) (*mpathpersist.PersistentReserve, error) {
+	if reservation.NvmePrExecutor() == reservation.NvmeIoctlExecutor {
+		return nvme.NewIoctlClient().GetPrInfo(devicePath)
+	}
+	return nvme.GetPrInfo(devicePath)
+}
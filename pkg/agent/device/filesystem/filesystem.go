@@ -15,8 +15,10 @@
 
 package filesystem
 
+import "context"
+
 type Filesystem interface {
 	BrowseFilesystem(deviceName string) (int64, error)
-	FormatFilesystem(deviceName string) error
-	ExpandFilesystem(deviceName string, expandCapacity int64, originCapacity int64) error
+	FormatFilesystem(ctx context.Context, deviceName string) error
+	ExpandFilesystem(ctx context.Context, deviceName string, expandCapacity int64, originCapacity int64) error
 }
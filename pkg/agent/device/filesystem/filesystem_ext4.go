@@ -16,6 +16,7 @@
 package filesystem
 
 import (
+	"context"
 	"fmt"
 	"polardb-sms/pkg/agent/device/dmhelper"
 	"polardb-sms/pkg/agent/device/exec"
@@ -52,7 +53,7 @@ func (e *Ext4) BrowseFilesystem(deviceName string) (int64, error) {
 	return 0, nil
 }
 
-func (e *Ext4) FormatFilesystem(deviceName string) error {
+func (e *Ext4) FormatFilesystem(ctx context.Context, deviceName string) error {
 	/*
 		[root@r03.dbm-02 ~]$mkfs.ext4 -F -m0 /dev/mapper/pv-36e00084100ee7ec96ad2f05d00000cb2
 		mke2fs 1.42.9 (28-Dec-2013)
@@ -90,7 +91,7 @@ func (e *Ext4) FormatFilesystem(deviceName string) error {
 		return err
 	}
 	reqSizeIn100GiB := blockDevBytes / (100 * 1024 * 1024 * 1024)
-	stdout, stderr, err := utils.ExecCommand(ext4MkfsCmd, time.Duration(20+10*reqSizeIn100GiB)*time.Second)
+	stdout, stderr, err := utils.ExecCommandContext(ctx, ext4MkfsCmd, time.Duration(20+10*reqSizeIn100GiB)*time.Second)
 	if err != nil {
 		smslog.Debugf("mkfs %s failed, stdout: %s, stderr: %s, err: %s", deviceName, stdout, stderr, err)
 		return fmt.Errorf("failed exec command %s err %s", ext4MkfsCmd, err)
@@ -100,7 +101,7 @@ func (e *Ext4) FormatFilesystem(deviceName string) error {
 	return nil
 }
 
-func (e *Ext4) ExpandFilesystem(deviceName string, expandCapacity int64, originCapacity int64) error {
+func (e *Ext4) ExpandFilesystem(ctx context.Context, deviceName string, expandCapacity int64, originCapacity int64) error {
 	/*
 	   resize2fs ${device_path}
 	   # first resize2fs output:
@@ -120,7 +121,7 @@ func (e *Ext4) ExpandFilesystem(deviceName string, expandCapacity int64, originC
 		return err
 	}
 	resize2fsCmd := fmt.Sprintf("resize2fs %s", devicePath)
-	outInfo, stderr, err := utils.ExecCommand(resize2fsCmd, utils.CmdDefaultTimeout)
+	outInfo, stderr, err := utils.ExecCommandContext(ctx, resize2fsCmd, utils.CmdDefaultTimeout)
 	if err != nil {
 		smslog.Debugf("resize2fs %s failed, stdout: %s, stderr: %s, err: %s", devicePath, outInfo, stderr, err)
 		if strings.Contains(err.Error(), "Nothing to do") {
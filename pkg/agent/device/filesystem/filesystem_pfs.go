@@ -16,6 +16,7 @@
 package filesystem
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"polardb-sms/pkg/agent/device/dmhelper"
@@ -110,7 +111,7 @@ func (p *Pfs) BrowseFilesystem(deviceName string) (int64, error) {
 	return int64(nallSize * PfsNallNum * exec.MiB), nil
 }
 
-func (p *Pfs) FormatFilesystem(deviceName string) error {
+func (p *Pfs) FormatFilesystem(ctx context.Context, deviceName string) error {
 	/*
 		##[PFS_LOG] May 14 14:03:50.202640 INF [21514] open device cluster disk, devname mapper_xhuqvcg-polar-rwo-g55236264rg-16016, flags 0x13
 		##[PFS_LOG] May 14 14:03:50.203095 INF [21514] disk dev path: /dev/mapper/xhuqvcg-polar-rwo-g55236264rg-16016
@@ -158,7 +159,7 @@ func (p *Pfs) FormatFilesystem(deviceName string) error {
 		return err
 	}
 	reqSizeIn100GiB := blockDevBytes / (100 * 1024 * 1024 * 1024)
-	stdout, stderr, err := utils.ExecCommand(pfsMkfsCmd, time.Duration(20+10*reqSizeIn100GiB)*time.Second)
+	stdout, stderr, err := utils.ExecCommandContext(ctx, pfsMkfsCmd, time.Duration(20+10*reqSizeIn100GiB)*time.Second)
 	if err != nil {
 		smslog.Debugf("pfs mkfs %s failed, stdout: %s, stderr: %s, err: %s", deviceName, stdout, stderr, err)
 		return fmt.Errorf("failed exec command %s err %s", pfsMkfsCmd, err)
@@ -168,7 +169,7 @@ func (p *Pfs) FormatFilesystem(deviceName string) error {
 	return nil
 }
 
-func (p *Pfs) ExpandFilesystem(deviceName string, expandCapacity int64, originCapacity int64) error {
+func (p *Pfs) ExpandFilesystem(ctx context.Context, deviceName string, expandCapacity int64, originCapacity int64) error {
 	/*
 		# pfs 扩容
 		pfs -C disk growfs -o oldChunkNum -n newChunkNum mapper_${volumeName}
@@ -211,7 +212,7 @@ func (p *Pfs) ExpandFilesystem(deviceName string, expandCapacity int64, originCa
 	}
 	pfsExpandCmd := getPfsCmd(pbdName, PfsOptions{command: "growfs", oldChunkNum: oldChunkNum, newChunkNum: newChunkNum})
 	reqSizeIn100GiB := blockDevBytes / (100 * 1024 * 1024 * 1024)
-	stdout, stderr, err := utils.ExecCommand(pfsExpandCmd, time.Duration(20+10*reqSizeIn100GiB)*time.Second)
+	stdout, stderr, err := utils.ExecCommandContext(ctx, pfsExpandCmd, time.Duration(20+10*reqSizeIn100GiB)*time.Second)
 	if err != nil {
 		smslog.Debugf("pfs growfs %s failed, stdout: %s, stderr: %s, err: %s", deviceName, stdout, stderr, err)
 		return fmt.Errorf("failed exec command %s err %s", pfsExpandCmd, err)
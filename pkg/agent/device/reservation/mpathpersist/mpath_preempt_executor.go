@@ -37,9 +37,16 @@ func (e *PrPreemptExecutor) GetCmdString(cmd *message.PrCmd) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	cmdStr := fmt.Sprintf("sg_persist --out --preempt --param-sark=%s --param-rk=%s --prout-type=%d %s",
-		param.PreemptedKey, param.RegisterKey, param.ReserveType, devicePath)
-	return cmdStr, nil
+	return preemptCmdString(param, devicePath), nil
+}
+
+func preemptCmdString(param *message.PrPreemptCmdParam, devicePath string) string {
+	action := "--preempt"
+	if param.Abort {
+		action = "--preempt-abort"
+	}
+	return fmt.Sprintf("sg_persist --out %s --param-sark=%s --param-rk=%s --prout-type=%d %s",
+		action, param.PreemptedKey, param.RegisterKey, param.ReserveType, devicePath)
 }
 
 //todo refact this
@@ -77,9 +84,7 @@ func (e *PrPreemptExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration)
 		}
 		return 0, nil
 	}
-	cmdStr := fmt.Sprintf("sg_persist --out --preempt --param-sark=%s --param-rk=%s --prout-type=%d %s",
-		param.PreemptedKey, param.RegisterKey, param.ReserveType, devicePath)
-	return reservation.PrCmdExec(cmdStr, timeout)
+	return reservation.PrCmdExec(preemptCmdString(param, devicePath), timeout)
 }
 
 func (e *PrPreemptExecutor) NoNeedExec(cmd *message.PrCmd) bool {
@@ -39,6 +39,9 @@ func (e *PrRegisterExecutor) GetCmdString(cmd *message.PrCmd) (string, error) {
 		return "", err
 	}
 	cmdStr := fmt.Sprintf("mpathpersist -v %d --out --register --param-sark=%s %s", MPLogLevel, param.RegisterKey, devicePath)
+	if param.Aptpl {
+		cmdStr = fmt.Sprintf("mpathpersist -v %d --out --register --param-aptpl --param-sark=%s %s", MPLogLevel, param.RegisterKey, devicePath)
+	}
 	return cmdStr, nil
 }
 
@@ -55,6 +58,9 @@ func (e *PrRegisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration
 
 func (e *PrRegisterExecutor) NoNeedExec(cmd *message.PrCmd) bool {
 	param := cmd.CmdParam.(*message.PrRegisterCmdParam)
+	if param.Aptpl {
+		return false
+	}
 	devicePath, err := common.GetDevicePath(cmd.VolumeId)
 	if err != nil {
 		return true
@@ -64,9 +70,15 @@ func (e *PrRegisterExecutor) NoNeedExec(cmd *message.PrCmd) bool {
 		smslog.Infof("get pr info err %s, exec it", err.Error())
 		return false
 	}
-	_, ok := prKey.Keys[param.RegisterKey]
-	if ok {
-		return true
+	cnt, ok := prKey.Keys[param.RegisterKey]
+	if !ok {
+		return false
+	}
+	//the newly added paths are not registered yet
+	paths, err := reservation.ActivePathDevices(devicePath)
+	if err == nil && cnt < len(paths) {
+		smslog.Infof("key %s is registered through %d of %d paths of %s, exec it", param.RegisterKey, cnt, len(paths), devicePath)
+		return false
 	}
-	return false
+	return true
 }
@@ -0,0 +1,67 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package mpathpersist
+
+import (
+	"fmt"
+	"polardb-sms/pkg/common"
+	"time"
+
+	"polardb-sms/pkg/agent/device/reservation"
+	"polardb-sms/pkg/network/message"
+)
+
+//PrUnregisterExecutor registers and ignores with the key 0, which removes the registration of this host
+type PrUnregisterExecutor struct {
+}
+
+func NewPrUnregisterExecutor() reservation.PrCmdExecutor {
+	return &PrUnregisterExecutor{}
+}
+
+func (e *PrUnregisterExecutor) GetCmdString(cmd *message.PrCmd) (string, error) {
+	devicePath, err := common.GetDevicePath(cmd.VolumeId)
+	if err != nil {
+		return "", err
+	}
+	cmdStr := fmt.Sprintf("mpathpersist -v %d --out --register-ignore --param-sark=0 %s", MPLogLevel, devicePath)
+	return cmdStr, nil
+}
+
+func (e *PrUnregisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	if e.NoNeedExec(cmd) {
+		return 0, nil
+	}
+	cmdStr, err := e.GetCmdString(cmd)
+	if err != nil {
+		return 0, err
+	}
+	return reservation.PrCmdExec(cmdStr, timeout)
+}
+
+func (e *PrUnregisterExecutor) NoNeedExec(cmd *message.PrCmd) bool {
+	param := cmd.CmdParam.(*message.PrUnregisterCmdParam)
+	devicePath, err := common.GetDevicePath(cmd.VolumeId)
+	if err != nil {
+		return false
+	}
+	prKey, err := GetPrInfo(devicePath)
+	if err != nil {
+		return false
+	}
+	_, ok := prKey.Keys[param.RegisterKey]
+	return !ok
+}
@@ -35,6 +35,7 @@ func NewPrExecWrapper() *PrExecWrapper {
 	wrapper.executors[message.PrRegister] = NewPrRegisterExecutor()
 	wrapper.executors[message.PrReserve] = NewPrReserveExecutor()
 	wrapper.executors[message.PrRelease] = NewPrReleaseExecutor()
+	wrapper.executors[message.PrUnregister] = NewPrUnregisterExecutor()
 	wrapper.executors[message.PrClear] = NewPrClearExecutor()
 	wrapper.executors[message.PrPreempt] = NewPrPreemptExecutor()
 	wrapper.executors[message.PrPathNum] = NewPrPathNumExecutor()
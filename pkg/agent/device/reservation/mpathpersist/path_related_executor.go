@@ -78,13 +78,51 @@ func (e *PrPathCanWriteExecutor) GetCmdString(cmd *message.PrCmd) (string, error
 }
 
 func (e *PrPathCanWriteExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param, _ := cmd.CmdParam.(*message.PrCanWriteCmdParam)
+	if param != nil && param.AllPaths {
+		return e.execOnAllPaths(cmd, timeout)
+	}
 	cmdStr, err := e.GetCmdString(cmd)
 	if err != nil {
 		return 0, err
 	}
+	if param != nil && param.ReserveType.ExclusiveAccess() {
+		devicePath, _ := common.GetDevicePath(cmd.VolumeId)
+		if _, err = reservation.PrCmdExec(readCmdString(devicePath), timeout); err != nil {
+			return 0, err
+		}
+	}
 	return reservation.PrCmdExec(cmdStr, timeout)
 }
 
+func readCmdString(devicePath string) string {
+	return fmt.Sprintf("dd if=%s of=/dev/null skip=512 bs=512 count=1 iflag=direct", devicePath)
+}
+
+//execOnAllPaths writes through every active path device instead of the one chosen by the multipath selector
+func (e *PrPathCanWriteExecutor) execOnAllPaths(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	devicePath, err := common.GetDevicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	paths, err := reservation.ActivePathDevices(devicePath)
+	if err != nil {
+		return 0, err
+	}
+	failed := make([]string, 0)
+	for _, path := range paths {
+		cmdStr := fmt.Sprintf("dd if=/dev/zero of=%s seek=512 bs=512 count=1 oflag=direct", path)
+		if _, err := reservation.PrCmdExec(cmdStr, timeout); err != nil {
+			smslog.Errorf("can not write %s through path %s: %s", devicePath, path, err.Error())
+			failed = append(failed, path)
+		}
+	}
+	if len(failed) > 0 {
+		return 0, fmt.Errorf("can not write %s through paths %v of %v", devicePath, failed, paths)
+	}
+	return 0, nil
+}
+
 type PrPathCannotWriteExecutor struct {
 }
 
@@ -97,14 +135,26 @@ func (e *PrPathCannotWriteExecutor) GetCmdString(cmd *message.PrCmd) (string, er
 	if err != nil {
 		return "", err
 	}
-	cmdStr := fmt.Sprintf("dd if=/dev/zero of=%s bs=4k count=1", devicePath)
+	//the same block as the can write check, and the page cache is bypassed for the array to reject it
+	cmdStr := fmt.Sprintf("dd if=/dev/zero of=%s seek=512 bs=512 count=1 oflag=direct", devicePath)
 	return cmdStr, nil
 }
 
+//PrCmdExec succeeds only if the array rejects the write, and the read as well for exclusive access
 func (e *PrPathCannotWriteExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
 	cmdStr, err := e.GetCmdString(cmd)
 	if err != nil {
 		return 0, err
 	}
-	return reservation.PrCmdExec(cmdStr, timeout)
+	if _, err = reservation.PrCmdExec(cmdStr, timeout); err == nil {
+		return 0, fmt.Errorf("volume %s can be written without holding the reservation", cmd.VolumeId)
+	}
+	param, _ := cmd.CmdParam.(*message.PrCannotWriteCmdParam)
+	if param != nil && param.ReserveType.ExclusiveAccess() {
+		devicePath, _ := common.GetDevicePath(cmd.VolumeId)
+		if _, err = reservation.PrCmdExec(readCmdString(devicePath), timeout); err == nil {
+			return 0, fmt.Errorf("volume %s can be read without holding the %s reservation", cmd.VolumeId, param.ReserveType)
+		}
+	}
+	return 0, nil
 }
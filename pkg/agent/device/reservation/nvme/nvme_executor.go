@@ -33,7 +33,7 @@ type NvmeReservationInfo struct {
 type RegisteredController struct {
 	ControllerId      int    `json:"cntlid"`
 	ReservationStatus int    `json:"rcsts"`
-	ReservationKey    int64  `json:"rkey"`
+	ReservationKey    uint64 `json:"rkey"`
 	HostId            string `json:"hostid"`
 }
 
@@ -0,0 +1,225 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package nvme
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"polardb-sms/pkg/network/message"
+)
+
+//opcodes of the nvme reservation io commands
+const (
+	OpcodeResvRegister byte = 0x0d
+	OpcodeResvReport   byte = 0x0e
+	OpcodeResvAcquire  byte = 0x11
+	OpcodeResvRelease  byte = 0x15
+)
+
+//RREGA, RACQA and RRELA actions
+const (
+	RegisterActionRegister   byte = 0
+	RegisterActionUnregister byte = 1
+	RegisterActionReplace    byte = 2
+
+	AcquireActionAcquire         byte = 0
+	AcquireActionPreempt         byte = 1
+	AcquireActionPreemptAndAbort byte = 2
+
+	ReleaseActionRelease byte = 0
+	ReleaseActionClear   byte = 1
+)
+
+const (
+	DefaultNsid uint32 = 1
+	//status code of reservation conflict with the generic command status type
+	StatusReservationConflict uint16 = 0x83
+	//status code of host identifier inconsistent format, the host id is 128 bits but the report is not extended
+	StatusHostIdInconsistentFormat uint16 = 0x18
+
+	reportHeaderLen         = 24
+	reportExtHeaderLen      = 64
+	registeredCtrlLen       = 24
+	registeredCtrlExtLen    = 64
+	DefaultReportBufferSize = 4096
+)
+
+//nvme reservation types are numbered differently from the scsi ones used in message.PrType
+var prTypeToRType = map[message.PrType]byte{
+	message.WE:   1,
+	message.EA:   2,
+	message.WERO: 3,
+	message.EARO: 4,
+	message.WEAR: 5,
+	message.EAAR: 6,
+}
+
+func ToNvmeRType(prType message.PrType) (byte, error) {
+	rtype, ok := prTypeToRType[prType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported reservation type %d", prType)
+	}
+	return rtype, nil
+}
+
+func FromNvmeRType(rtype byte) (message.PrType, bool) {
+	for prType, t := range prTypeToRType {
+		if t == rtype {
+			return prType, true
+		}
+	}
+	return 0, false
+}
+
+//PassthruCmd is the part of struct nvme_passthru_cmd used by the reservation commands
+type PassthruCmd struct {
+	Opcode byte
+	Nsid   uint32
+	Cdw10  uint32
+	Cdw11  uint32
+}
+
+//Commander submits one nvme io command to the device, data is written for the report
+type Commander interface {
+	Submit(device string, cmd *PassthruCmd, data []byte, timeout time.Duration) error
+}
+
+//NvmeError is the nvme completion status, bits 10:8 are the status code type and 7:0 the status code
+type NvmeError struct {
+	Device string
+	Opcode byte
+	Status uint16
+}
+
+func (e *NvmeError) Error() string {
+	return fmt.Sprintf("nvme cmd %#x on %s failed: status code type %#x status code %#x",
+		e.Opcode, e.Device, e.StatusCodeType(), e.StatusCode())
+}
+
+func (e *NvmeError) StatusCodeType() uint16 {
+	return (e.Status >> 8) & 0x7
+}
+
+func (e *NvmeError) StatusCode() uint16 {
+	return e.Status & 0xff
+}
+
+func (e *NvmeError) ReservationConflict() bool {
+	return e.StatusCodeType() == 0 && e.StatusCode() == StatusReservationConflict
+}
+
+func (e *NvmeError) HostIdInconsistentFormat() bool {
+	return e.StatusCodeType() == 0 && e.StatusCode() == StatusHostIdInconsistentFormat
+}
+
+func iekeyBit(iekey bool) uint32 {
+	if iekey {
+		return 1 << 3
+	}
+	return 0
+}
+
+//CptplPersist is the CPTPL of cdw10 setting the persist through power loss state
+const CptplPersist uint32 = 3 << 30
+
+//NewRegisterCmd builds the reservation register command and its 16 bytes data of CRKEY and NRKEY
+func NewRegisterCmd(nsid uint32, action byte, iekey bool, crkey, nrkey uint64) (*PassthruCmd, []byte) {
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint64(data[0:8], crkey)
+	binary.LittleEndian.PutUint64(data[8:16], nrkey)
+	return &PassthruCmd{
+		Opcode: OpcodeResvRegister,
+		Nsid:   nsid,
+		Cdw10:  uint32(action&0x7) | iekeyBit(iekey),
+	}, data
+}
+
+//NewAcquireCmd builds the reservation acquire command and its 16 bytes data of CRKEY and PRKEY
+func NewAcquireCmd(nsid uint32, action, rtype byte, crkey, prkey uint64) (*PassthruCmd, []byte) {
+	data := make([]byte, 16)
+	binary.LittleEndian.PutUint64(data[0:8], crkey)
+	binary.LittleEndian.PutUint64(data[8:16], prkey)
+	return &PassthruCmd{
+		Opcode: OpcodeResvAcquire,
+		Nsid:   nsid,
+		Cdw10:  uint32(action&0x7) | uint32(rtype)<<8,
+	}, data
+}
+
+//NewReleaseCmd builds the reservation release command and its 8 bytes data of CRKEY
+func NewReleaseCmd(nsid uint32, action, rtype byte, crkey uint64) (*PassthruCmd, []byte) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, crkey)
+	return &PassthruCmd{
+		Opcode: OpcodeResvRelease,
+		Nsid:   nsid,
+		Cdw10:  uint32(action&0x7) | uint32(rtype)<<8,
+	}, data
+}
+
+//NewReportCmd builds the reservation report command, extended reports the 128 bits host id
+func NewReportCmd(nsid uint32, bufferSize int, extended bool) *PassthruCmd {
+	cmd := &PassthruCmd{
+		Opcode: OpcodeResvReport,
+		Nsid:   nsid,
+		Cdw10:  uint32(bufferSize/4 - 1),
+	}
+	if extended {
+		cmd.Cdw11 = 1
+	}
+	return cmd
+}
+
+//DecodeReport decodes the reservation status data structure, the controllers not fitting in data are truncated
+func DecodeReport(data []byte, extended bool) (*NvmeReservationInfo, error) {
+	headerLen, ctrlLen := reportHeaderLen, registeredCtrlLen
+	if extended {
+		headerLen, ctrlLen = reportExtHeaderLen, registeredCtrlExtLen
+	}
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("reservation report too short: %d", len(data))
+	}
+	info := &NvmeReservationInfo{
+		Generation:                   int64(binary.LittleEndian.Uint32(data[0:4])),
+		ReservationType:              int(data[4]),
+		ControllersCount:             int(binary.LittleEndian.Uint16(data[5:7])),
+		PersistThroughPowerLossState: int(data[9]),
+		Controllers:                  make([]*RegisteredController, 0),
+	}
+	for i := 0; i < info.ControllersCount; i++ {
+		start := headerLen + i*ctrlLen
+		if start+ctrlLen > len(data) {
+			break
+		}
+		ctrl := data[start : start+ctrlLen]
+		controller := &RegisteredController{
+			ControllerId:      int(binary.LittleEndian.Uint16(ctrl[0:2])),
+			ReservationStatus: int(ctrl[2] & 0x1),
+		}
+		if extended {
+			controller.ReservationKey = binary.LittleEndian.Uint64(ctrl[8:16])
+			controller.HostId = hex.EncodeToString(ctrl[16:32])
+		} else {
+			controller.HostId = hex.EncodeToString(ctrl[8:16])
+			controller.ReservationKey = binary.LittleEndian.Uint64(ctrl[16:24])
+		}
+		info.Controllers = append(info.Controllers, controller)
+	}
+	return info, nil
+}
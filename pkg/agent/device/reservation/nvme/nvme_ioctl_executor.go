@@ -0,0 +1,302 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package nvme
+
+import (
+	"fmt"
+	"time"
+
+	"polardb-sms/pkg/agent/device/reservation"
+	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
+	"polardb-sms/pkg/agent/device/reservation/sgio"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network/message"
+)
+
+//IoctlClient sends the nvme reservation commands by ioctl instead of nvme-cli
+type IoctlClient struct {
+	commander Commander
+	nsid      uint32
+}
+
+func NewIoctlClient() *IoctlClient {
+	return &IoctlClient{
+		commander: NewIoctlCommander(),
+		nsid:      DefaultNsid,
+	}
+}
+
+func (c *IoctlClient) Register(device string, action byte, iekey bool, crkey, nrkey uint64, timeout time.Duration) error {
+	cmd, data := NewRegisterCmd(c.nsid, action, iekey, crkey, nrkey)
+	return c.commander.Submit(device, cmd, data, timeout)
+}
+
+func (c *IoctlClient) Acquire(device string, action, rtype byte, crkey, prkey uint64, timeout time.Duration) error {
+	cmd, data := NewAcquireCmd(c.nsid, action, rtype, crkey, prkey)
+	return c.commander.Submit(device, cmd, data, timeout)
+}
+
+func (c *IoctlClient) Release(device string, action, rtype byte, crkey uint64, timeout time.Duration) error {
+	cmd, data := NewReleaseCmd(c.nsid, action, rtype, crkey)
+	return c.commander.Submit(device, cmd, data, timeout)
+}
+
+//RegisterKey replaces the key ignoring the existing one if this host has registered another key
+func (c *IoctlClient) RegisterKey(device string, key uint64, timeout time.Duration) error {
+	return c.registerKey(device, key, 0, timeout)
+}
+
+//RegisterKeyPtpl is the same as RegisterKey and sets the persist through power loss state
+func (c *IoctlClient) RegisterKeyPtpl(device string, key uint64, timeout time.Duration) error {
+	return c.registerKey(device, key, CptplPersist, timeout)
+}
+
+func (c *IoctlClient) registerKey(device string, key uint64, cptpl uint32, timeout time.Duration) error {
+	register := func(action byte, iekey bool) error {
+		cmd, data := NewRegisterCmd(c.nsid, action, iekey, 0, key)
+		cmd.Cdw10 |= cptpl
+		return c.commander.Submit(device, cmd, data, timeout)
+	}
+	err := register(RegisterActionRegister, false)
+	if nvmeErr, ok := err.(*NvmeError); ok && nvmeErr.ReservationConflict() {
+		return register(RegisterActionReplace, true)
+	}
+	return err
+}
+
+//Report asks for the extended data structure first, and falls back if the controller does not support it
+func (c *IoctlClient) Report(device string, timeout time.Duration) (*NvmeReservationInfo, error) {
+	info, err := c.report(device, true, timeout)
+	if err == nil {
+		return info, nil
+	}
+	smslog.Infof("extended reservation report of %s err %s, try the 64 bits host id one", device, err.Error())
+	return c.report(device, false, timeout)
+}
+
+func (c *IoctlClient) report(device string, extended bool, timeout time.Duration) (*NvmeReservationInfo, error) {
+	data := make([]byte, DefaultReportBufferSize)
+	if err := c.commander.Submit(device, NewReportCmd(c.nsid, len(data), extended), data, timeout); err != nil {
+		return nil, err
+	}
+	return DecodeReport(data, extended)
+}
+
+//GetPrInfo is the same as GetPrInfo with the reservation holder filled in
+func (c *IoctlClient) GetPrInfo(device string) (*mpathpersist.PersistentReserve, error) {
+	info, err := c.Report(device, mpathpersist.DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to report nvme reservation of %s: %v", device, err)
+	}
+	return info.ToPersistentReserve(), nil
+}
+
+//ToPersistentReserve uses the scsi type names, the reservation key is 0x0 for the all registrants types like scsi
+func (info *NvmeReservationInfo) ToPersistentReserve() *mpathpersist.PersistentReserve {
+	pr := mpathpersist.NewPersistentReserve()
+	pr.Generation = fmt.Sprintf("%#x", info.Generation)
+	for _, controller := range info.Controllers {
+		if controller.ReservationKey == 0 {
+			continue
+		}
+		pr.Keys[sgio.FormatPrKey(controller.ReservationKey)]++
+	}
+	prType, ok := FromNvmeRType(byte(info.ReservationType))
+	if !ok {
+		return pr
+	}
+	pr.ReservationType = sgio.PrTypeName(byte(prType))
+	if prType == message.WEAR || prType == message.EAAR {
+		pr.ReservationKey = sgio.FormatPrKey(0)
+		return pr
+	}
+	for _, controller := range info.Controllers {
+		if controller.ReservationStatus == 1 {
+			pr.ReservationKey = sgio.FormatPrKey(controller.ReservationKey)
+			break
+		}
+	}
+	return pr
+}
+
+type NvmeIoctlExecWrapper struct {
+	executors map[int]reservation.PrCmdExecutor
+}
+
+func NewNvmeIoctlExecWrapper() *NvmeIoctlExecWrapper {
+	return newNvmeIoctlExecWrapper(NewIoctlClient(), common.GetDevicePath)
+}
+
+func newNvmeIoctlExecWrapper(client *IoctlClient, devicePath func(string) (string, error)) *NvmeIoctlExecWrapper {
+	base := ioctlExecutor{client: client, devicePath: devicePath}
+	wrapper := &NvmeIoctlExecWrapper{executors: make(map[int]reservation.PrCmdExecutor)}
+	wrapper.executors[message.NvmeRegister] = &NvmeIoctlRegisterExecutor{base}
+	wrapper.executors[message.NvmeReserve] = &NvmeIoctlReserveExecutor{base}
+	wrapper.executors[message.NvmePreempt] = &NvmeIoctlPreemptExecutor{base}
+	wrapper.executors[message.NvmeRelease] = &NvmeIoctlReleaseExecutor{base}
+	wrapper.executors[message.NvmeClear] = &NvmeIoctlClearExecutor{base}
+	wrapper.executors[message.PrUnregister] = &NvmeIoctlUnregisterExecutor{base}
+	return wrapper
+}
+
+func (w *NvmeIoctlExecWrapper) Process(cmd *message.PrCmd) (*message.PrCheckCmdResult, error) {
+	executor, exit := w.executors[cmd.CmdType]
+	if !exit {
+		return nil, fmt.Errorf("do not support cmd type %d", cmd.CmdType)
+	}
+	return reservation.ExecuteCmd(executor, cmd)
+}
+
+type ioctlExecutor struct {
+	client     *IoctlClient
+	devicePath func(volumeId string) (string, error)
+}
+
+type NvmeIoctlRegisterExecutor struct {
+	ioctlExecutor
+}
+
+func (e *NvmeIoctlRegisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrRegisterCmdParam)
+	key, err := sgio.ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	if param.Aptpl {
+		return 0, e.client.RegisterKeyPtpl(device, key, timeout)
+	}
+	return 0, e.client.RegisterKey(device, key, timeout)
+}
+
+type NvmeIoctlReserveExecutor struct {
+	ioctlExecutor
+}
+
+func (e *NvmeIoctlReserveExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrReserveCmdParam)
+	key, err := sgio.ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	rtype, err := ToNvmeRType(param.ReserveType)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Acquire(device, AcquireActionAcquire, rtype, key, 0, timeout)
+}
+
+type NvmeIoctlPreemptExecutor struct {
+	ioctlExecutor
+}
+
+func (e *NvmeIoctlPreemptExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrPreemptCmdParam)
+	key, err := sgio.ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	preemptedKey, err := sgio.ParsePrKey(param.PreemptedKey)
+	if err != nil {
+		return 0, err
+	}
+	rtype, err := ToNvmeRType(param.ReserveType)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	info, err := e.client.Report(device, timeout)
+	if err != nil {
+		return 0, err
+	}
+	existRegisterKey, existPreemptedKey := false, false
+	for _, controller := range info.Controllers {
+		existRegisterKey = existRegisterKey || controller.ReservationKey == key
+		existPreemptedKey = existPreemptedKey || controller.ReservationKey == preemptedKey
+	}
+	if !existRegisterKey {
+		if err = e.client.RegisterKey(device, key, timeout); err != nil {
+			return 0, err
+		}
+	}
+	if !existPreemptedKey {
+		return 0, e.client.Acquire(device, AcquireActionAcquire, rtype, key, 0, timeout)
+	}
+	action := AcquireActionPreempt
+	if param.Abort {
+		action = AcquireActionPreemptAndAbort
+	}
+	return 0, e.client.Acquire(device, action, rtype, key, preemptedKey, timeout)
+}
+
+//NvmeIoctlReleaseExecutor unregisters this host like the scsi executors
+type NvmeIoctlReleaseExecutor struct {
+	ioctlExecutor
+}
+
+func (e *NvmeIoctlReleaseExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Register(device, RegisterActionUnregister, true, 0, 0, timeout)
+}
+
+//NvmeIoctlUnregisterExecutor unregisters the key of this host
+type NvmeIoctlUnregisterExecutor struct {
+	ioctlExecutor
+}
+
+func (e *NvmeIoctlUnregisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrUnregisterCmdParam)
+	key, err := sgio.ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Register(device, RegisterActionUnregister, false, key, 0, timeout)
+}
+
+type NvmeIoctlClearExecutor struct {
+	ioctlExecutor
+}
+
+func (e *NvmeIoctlClearExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrClearCmdParam)
+	key, err := sgio.ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Release(device, ReleaseActionClear, 0, key, timeout)
+}
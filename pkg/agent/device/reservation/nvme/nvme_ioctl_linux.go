@@ -0,0 +1,90 @@
+//go:build linux
+// +build linux
+
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package nvme
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+//NVME_IOCTL_IO_CMD, _IOWR('N', 0x43, struct nvme_passthru_cmd)
+const nvmeIoctlIoCmd = 0xc0484e43
+
+//passthruCmd is struct nvme_passthru_cmd of <linux/nvme_ioctl.h>
+type passthruCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+type ioctlCommander struct {
+}
+
+func NewIoctlCommander() Commander {
+	return &ioctlCommander{}
+}
+
+func (c *ioctlCommander) Submit(device string, cmd *PassthruCmd, data []byte, timeout time.Duration) error {
+	f, err := os.OpenFile(device, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	passthru := passthruCmd{
+		opcode:    cmd.Opcode,
+		nsid:      cmd.Nsid,
+		cdw10:     cmd.Cdw10,
+		cdw11:     cmd.Cdw11,
+		timeoutMs: uint32(timeout / time.Millisecond),
+	}
+	if len(data) > 0 {
+		passthru.addr = uint64(uintptr(unsafe.Pointer(&data[0])))
+		passthru.dataLen = uint32(len(data))
+	}
+	status, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), nvmeIoctlIoCmd, uintptr(unsafe.Pointer(&passthru)))
+	runtime.KeepAlive(data)
+	if errno != 0 {
+		return fmt.Errorf("nvme io cmd ioctl on %s err %v", device, errno)
+	}
+	//a positive return value is the nvme status field without the phase tag
+	if status != 0 {
+		return &NvmeError{Device: device, Opcode: cmd.Opcode, Status: uint16(status)}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package nvme
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network/message"
+)
+
+//fakeNamespace simulates the reservation of one namespace shared by the hosts
+type fakeNamespace struct {
+	generation uint32
+	hosts      []string
+	keys       map[string]uint64
+	holder     string
+	rtype      byte
+	//extendedOnly rejects the 64 bits host id report
+	extendedOnly bool
+	noExtended   bool
+	cmds         []*PassthruCmd
+}
+
+func newFakeNamespace() *fakeNamespace {
+	return &fakeNamespace{keys: make(map[string]uint64)}
+}
+
+//fakeCommander submits the commands as one host
+type fakeCommander struct {
+	ns   *fakeNamespace
+	host string
+}
+
+func (ns *fakeNamespace) commander(host string) Commander {
+	ns.hosts = append(ns.hosts, host)
+	return &fakeCommander{ns: ns, host: host}
+}
+
+func (c *fakeCommander) fail(cmd *PassthruCmd, status uint16) error {
+	return &NvmeError{Device: c.host, Opcode: cmd.Opcode, Status: status}
+}
+
+func (c *fakeCommander) Submit(device string, cmd *PassthruCmd, data []byte, timeout time.Duration) error {
+	ns := c.ns
+	ns.cmds = append(ns.cmds, cmd)
+	action := byte(cmd.Cdw10 & 0x7)
+	iekey := cmd.Cdw10&(1<<3) != 0
+	rtype := byte(cmd.Cdw10 >> 8)
+	key, registered := ns.keys[c.host]
+	switch cmd.Opcode {
+	case OpcodeResvRegister:
+		crkey := binary.LittleEndian.Uint64(data[0:8])
+		nrkey := binary.LittleEndian.Uint64(data[8:16])
+		switch action {
+		case RegisterActionRegister:
+			if registered && key != nrkey {
+				return c.fail(cmd, StatusReservationConflict)
+			}
+			ns.keys[c.host] = nrkey
+		case RegisterActionReplace, RegisterActionUnregister:
+			if !registered || (!iekey && key != crkey) {
+				return c.fail(cmd, StatusReservationConflict)
+			}
+			if action == RegisterActionReplace {
+				ns.keys[c.host] = nrkey
+			} else {
+				delete(ns.keys, c.host)
+				if ns.holder == c.host {
+					ns.holder, ns.rtype = "", 0
+				}
+			}
+		}
+		ns.generation++
+	case OpcodeResvAcquire:
+		crkey := binary.LittleEndian.Uint64(data[0:8])
+		prkey := binary.LittleEndian.Uint64(data[8:16])
+		if !registered || key != crkey {
+			return c.fail(cmd, StatusReservationConflict)
+		}
+		switch action {
+		case AcquireActionAcquire:
+			if ns.holder != "" && ns.holder != c.host {
+				return c.fail(cmd, StatusReservationConflict)
+			}
+		case AcquireActionPreempt:
+			for host, k := range ns.keys {
+				if k == prkey && host != c.host {
+					delete(ns.keys, host)
+				}
+			}
+			ns.generation++
+		}
+		ns.holder, ns.rtype = c.host, rtype
+	case OpcodeResvRelease:
+		if !registered || key != binary.LittleEndian.Uint64(data) {
+			return c.fail(cmd, StatusReservationConflict)
+		}
+		if action == ReleaseActionClear {
+			ns.keys = make(map[string]uint64)
+			ns.generation++
+		}
+		ns.holder, ns.rtype = "", 0
+	case OpcodeResvReport:
+		extended := cmd.Cdw11&1 == 1
+		if (extended && ns.noExtended) || (!extended && ns.extendedOnly) {
+			return c.fail(cmd, StatusHostIdInconsistentFormat)
+		}
+		ns.report(data, extended)
+	default:
+		return fmt.Errorf("unknown opcode %#x", cmd.Opcode)
+	}
+	return nil
+}
+
+func (ns *fakeNamespace) report(data []byte, extended bool) {
+	headerLen, ctrlLen := reportHeaderLen, registeredCtrlLen
+	if extended {
+		headerLen, ctrlLen = reportExtHeaderLen, registeredCtrlExtLen
+	}
+	binary.LittleEndian.PutUint32(data[0:4], ns.generation)
+	data[4] = ns.rtype
+	cnt := 0
+	for i, host := range ns.hosts {
+		key, ok := ns.keys[host]
+		if !ok {
+			continue
+		}
+		ctrl := data[headerLen+cnt*ctrlLen:]
+		binary.LittleEndian.PutUint16(ctrl[0:2], uint16(i+1))
+		if ns.holder == host {
+			ctrl[2] = 1
+		}
+		if extended {
+			binary.LittleEndian.PutUint64(ctrl[8:16], key)
+			copy(ctrl[16:32], host)
+		} else {
+			copy(ctrl[8:16], host)
+			binary.LittleEndian.PutUint64(ctrl[16:24], key)
+		}
+		cnt++
+	}
+	binary.LittleEndian.PutUint16(data[5:7], uint16(cnt))
+}
+
+func newTestIoctlWrapper(commander Commander) *NvmeIoctlExecWrapper {
+	client := &IoctlClient{commander: commander, nsid: DefaultNsid}
+	return newNvmeIoctlExecWrapper(client, func(volumeId string) (string, error) {
+		return "/dev/mapper/" + volumeId, nil
+	})
+}
+
+func newCmd(cmdType int, param interface{}) *message.PrCmd {
+	return &message.PrCmd{
+		CmdType:    cmdType,
+		VolumeType: common.MultipathVolume,
+		VolumeId:   "3e4e1c2b3e1a45a2b",
+		CmdParam:   param,
+	}
+}
+
+func TestNvmeRType(t *testing.T) {
+	for _, prType := range []message.PrType{message.WE, message.EA, message.WERO, message.EARO, message.WEAR, message.EAAR} {
+		rtype, err := ToNvmeRType(prType)
+		assert.NoError(t, err)
+		back, ok := FromNvmeRType(rtype)
+		assert.True(t, ok)
+		assert.Equal(t, prType, back)
+	}
+	rtype, _ := ToNvmeRType(message.WEAR)
+	assert.Equal(t, byte(5), rtype)
+	_, err := ToNvmeRType(message.PrType(2))
+	assert.Error(t, err)
+
+	cmd, data := NewAcquireCmd(1, AcquireActionPreempt, 5, 0x2, 0x1)
+	assert.Equal(t, uint32(0x501), cmd.Cdw10)
+	assert.Equal(t, []byte{2, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}, data)
+	assert.Equal(t, uint32(1023), NewReportCmd(1, 4096, true).Cdw10)
+}
+
+func TestNvmeIoctlExecWrapper(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	ns := newFakeNamespace()
+	host1 := newTestIoctlWrapper(ns.commander("host-0000000001"))
+	host2 := newTestIoctlWrapper(ns.commander("host-0000000002"))
+
+	_, err := host1.Process(newCmd(message.NvmeRegister, &message.PrRegisterCmdParam{RegisterKey: "0x1"}))
+	assert.NoError(t, err)
+	//registering another key replaces the old one
+	_, err = host1.Process(newCmd(message.NvmeRegister, &message.PrRegisterCmdParam{RegisterKey: "0x11"}))
+	assert.NoError(t, err)
+	_, err = host1.Process(newCmd(message.NvmeReserve, &message.PrReserveCmdParam{RegisterKey: "0x11", ReserveType: message.EAAR}))
+	assert.NoError(t, err)
+	assert.Equal(t, byte(6), ns.rtype)
+
+	client := &IoctlClient{commander: &fakeCommander{ns: ns, host: "host-0000000002"}, nsid: DefaultNsid}
+	pr, err := client.GetPrInfo("/dev/mapper/test")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"0x11": 1}, pr.Keys)
+	assert.Equal(t, "0x0", pr.ReservationKey)
+	assert.Equal(t, mpathpersist.PRC_EX_AC_AR, pr.ReservationType)
+
+	//host2 registers and preempts host1 in one cmd
+	_, err = host2.Process(newCmd(message.NvmePreempt, &message.PrPreemptCmdParam{RegisterKey: "0x2", PreemptedKey: "0x11", ReserveType: message.WE}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"host-0000000002": 2}, ns.keys)
+	pr, err = client.GetPrInfo("/dev/mapper/test")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x2", pr.ReservationKey)
+	assert.Equal(t, "Write Exclusive", pr.ReservationType)
+
+	_, err = host1.Process(newCmd(message.NvmeReserve, &message.PrReserveCmdParam{RegisterKey: "0x11", ReserveType: message.WE}))
+	assert.True(t, err.(*NvmeError).ReservationConflict())
+
+	_, err = host2.Process(newCmd(message.NvmeRelease, &message.PrReleaseCmdParam{RegisterKey: "0x2", ReserveType: message.WE}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ns.keys))
+	assert.Equal(t, byte(0), ns.rtype)
+
+	_, err = host1.Process(newCmd(message.NvmeRegister, &message.PrRegisterCmdParam{RegisterKey: "0x1"}))
+	assert.NoError(t, err)
+	_, err = host1.Process(newCmd(message.NvmeClear, &message.PrClearCmdParam{RegisterKey: "0x1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(ns.keys))
+}
+
+func TestNvmeReportHostId(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	ns := newFakeNamespace()
+	ns.noExtended = true
+	client := &IoctlClient{commander: ns.commander("host0001"), nsid: DefaultNsid}
+	assert.NoError(t, client.RegisterKey("/dev/mapper/test", 0xc0a80001, time.Second))
+
+	info, err := client.Report("/dev/mapper/test", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, info.ControllersCount)
+	assert.Equal(t, "686f737430303031", info.Controllers[0].HostId)
+	assert.Equal(t, uint64(0xc0a80001), info.Controllers[0].ReservationKey)
+
+	ns.noExtended, ns.extendedOnly = false, true
+	ns.hosts[0] = "host000000000001"
+	ns.keys = map[string]uint64{"host000000000001": 0xc0a80001}
+	info, err = client.Report("/dev/mapper/test", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "686f7374303030303030303030303031", info.Controllers[0].HostId)
+	assert.Equal(t, uint64(0xc0a80001), info.Controllers[0].ReservationKey)
+}
@@ -34,7 +34,12 @@ func NewNvmePreemptExecutor() reservation.PrCmdExecutor {
 
 func (e *NvmePreemptExecutor) GetCmdString(cmd *message.PrCmd) (string, error) {
 	param := cmd.CmdParam.(*message.PrPreemptCmdParam)
-	cmdStr := fmt.Sprintf("nvme resv-acquire /dev/mapper/%s -n 1 -c %s -p %s -t 5 -a 1", cmd.VolumeId, param.RegisterKey, param.PreemptedKey)
+	//racqa 1 is preempt, 2 is preempt and abort
+	racqa := 1
+	if param.Abort {
+		racqa = 2
+	}
+	cmdStr := fmt.Sprintf("nvme resv-acquire /dev/mapper/%s -n 1 -c %s -p %s -t 5 -a %d", cmd.VolumeId, param.RegisterKey, param.PreemptedKey, racqa)
 	return cmdStr, nil
 }
 
@@ -33,6 +33,10 @@ func NewNvmeRegisterExecutor() reservation.PrCmdExecutor {
 func (e *NvmeRegisterExecutor) GetCmdString(cmd *message.PrCmd) (string, error) {
 	param := cmd.CmdParam.(*message.PrRegisterCmdParam)
 	cmdStr := fmt.Sprintf("nvme resv-register /dev/mapper/%s -n 1 -k %s", cmd.VolumeId, param.RegisterKey)
+	if param.Aptpl {
+		//cptpl 3 sets the persist through power loss state
+		cmdStr = fmt.Sprintf("nvme resv-register /dev/mapper/%s -n 1 -k %s --cptpl=3", cmd.VolumeId, param.RegisterKey)
+	}
 	return cmdStr, nil
 }
 
@@ -43,3 +43,25 @@ func (e *NvmeReleaseExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duratio
 	}
 	return reservation.PrCmdExec(cmdStr, timeout)
 }
+
+type NvmeUnregisterExecutor struct {
+}
+
+func NewNvmeUnregisterExecutor() reservation.PrCmdExecutor {
+	return &NvmeUnregisterExecutor{}
+}
+
+func (e *NvmeUnregisterExecutor) GetCmdString(cmd *message.PrCmd) (string, error) {
+	param := cmd.CmdParam.(*message.PrUnregisterCmdParam)
+	//rrega 1 unregisters the current key
+	cmdStr := fmt.Sprintf("nvme resv-register /dev/mapper/%s -n 1 -c %s -r 1", cmd.VolumeId, param.RegisterKey)
+	return cmdStr, nil
+}
+
+func (e *NvmeUnregisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	cmdStr, err := e.GetCmdString(cmd)
+	if err != nil {
+		return 0, err
+	}
+	return reservation.PrCmdExec(cmdStr, timeout)
+}
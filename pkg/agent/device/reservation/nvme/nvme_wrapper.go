@@ -32,6 +32,7 @@ func NewNvmeExecWrapper() *NvmeExecWrapper {
 	wrapper.executors[message.NvmePreempt] = NewNvmePreemptExecutor()
 	wrapper.executors[message.NvmeRelease] = NewNvmeReleaseExecutor()
 	wrapper.executors[message.NvmeClear] = NewNvmeClearExecutor()
+	wrapper.executors[message.PrUnregister] = NewNvmeUnregisterExecutor()
 	return wrapper
 }
 
@@ -0,0 +1,53 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package reservation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	smslog "polardb-sms/pkg/log"
+)
+
+const sysBlockDir = "/sys/block"
+
+//ActivePathDevices returns the running scsi devices under the dm device, or the device itself if it is not a dm device
+func ActivePathDevices(device string) ([]string, error) {
+	realPath, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(realPath)
+	slaves, err := ioutil.ReadDir(filepath.Join(sysBlockDir, name, "slaves"))
+	if err != nil || len(slaves) == 0 {
+		return []string{realPath}, nil
+	}
+	paths := make([]string, 0, len(slaves))
+	for _, slave := range slaves {
+		state, err := ioutil.ReadFile(filepath.Join(sysBlockDir, slave.Name(), "device", "state"))
+		if err == nil && strings.TrimSpace(string(state)) != "running" {
+			smslog.Infof("skip path %s of %s in state %s", slave.Name(), device, strings.TrimSpace(string(state)))
+			continue
+		}
+		paths = append(paths, filepath.Join("/dev", slave.Name()))
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no active path for device %s", device)
+	}
+	return paths, nil
+}
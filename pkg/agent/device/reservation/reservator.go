@@ -27,6 +27,50 @@ const (
 	DefaultTimeout = 5 * time.Second
 )
 
+//the executors of scsi pr cmd, mpathpersist runs the sg3_utils/multipath-tools cmd, sgio sends the cdb by SG_IO ioctl
+const (
+	MpathPersistExecutor = "mpathpersist"
+	SgIoExecutor         = "sgio"
+)
+
+var scsiPrExecutor = MpathPersistExecutor
+
+func SetScsiPrExecutor(executor string) error {
+	switch executor {
+	case MpathPersistExecutor, SgIoExecutor:
+		scsiPrExecutor = executor
+		return nil
+	default:
+		return fmt.Errorf("unknown scsi pr executor %s", executor)
+	}
+}
+
+func ScsiPrExecutor() string {
+	return scsiPrExecutor
+}
+
+//the executors of nvme reservation cmd, nvme-cli runs the nvme resv-* cmd, ioctl sends the io cmd by NVME_IOCTL_IO_CMD
+const (
+	NvmeCliExecutor   = "nvme-cli"
+	NvmeIoctlExecutor = "ioctl"
+)
+
+var nvmePrExecutor = NvmeCliExecutor
+
+func SetNvmePrExecutor(executor string) error {
+	switch executor {
+	case NvmeCliExecutor, NvmeIoctlExecutor:
+		nvmePrExecutor = executor
+		return nil
+	default:
+		return fmt.Errorf("unknown nvme pr executor %s", executor)
+	}
+}
+
+func NvmePrExecutor() string {
+	return nvmePrExecutor
+}
+
 type PrCmdExecutor interface {
 	PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error)
 }
@@ -0,0 +1,106 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//operation codes and service actions of SPC-4 PERSISTENT RESERVE IN/OUT
+const (
+	PrInOpcode  byte = 0x5e
+	PrOutOpcode byte = 0x5f
+
+	PrInReadKeys           byte = 0x00
+	PrInReadReservation    byte = 0x01
+	PrInReportCapabilities byte = 0x02
+
+	PrOutRegister            byte = 0x00
+	PrOutReserve             byte = 0x01
+	PrOutRelease             byte = 0x02
+	PrOutClear               byte = 0x03
+	PrOutPreempt             byte = 0x04
+	PrOutPreemptAndAbort     byte = 0x05
+	PrOutRegisterAndIgnore   byte = 0x06
+	PrOutRegisterAndMove     byte = 0x07
+	PrOutReplaceLostReserve  byte = 0x08
+	LuScope                  byte = 0x00
+	prCdbLen                      = 10
+	prOutParamLen                 = 24
+	DefaultPrInAllocationLen      = 8192
+)
+
+//NewPrInCdb builds the 10 bytes PERSISTENT RESERVE IN cdb
+func NewPrInCdb(serviceAction byte, allocationLen uint16) []byte {
+	cdb := make([]byte, prCdbLen)
+	cdb[0] = PrInOpcode
+	cdb[1] = serviceAction & 0x1f
+	binary.BigEndian.PutUint16(cdb[7:9], allocationLen)
+	return cdb
+}
+
+//NewPrOutCdb builds the 10 bytes PERSISTENT RESERVE OUT cdb, the type is ignored by register and clear
+func NewPrOutCdb(serviceAction, scope, prType byte) []byte {
+	cdb := make([]byte, prCdbLen)
+	cdb[0] = PrOutOpcode
+	cdb[1] = serviceAction & 0x1f
+	cdb[2] = (scope&0x0f)<<4 | prType&0x0f
+	binary.BigEndian.PutUint32(cdb[5:9], prOutParamLen)
+	return cdb
+}
+
+//PrOutParam is the basic parameter list of PERSISTENT RESERVE OUT
+type PrOutParam struct {
+	ReservationKey              uint64
+	ServiceActionReservationKey uint64
+	//APTPL activates persist through power loss
+	APTPL bool
+	//AllTargetPorts registers the key on all the target ports, ATP_C must be supported
+	AllTargetPorts bool
+}
+
+func (p *PrOutParam) Bytes() []byte {
+	b := make([]byte, prOutParamLen)
+	binary.BigEndian.PutUint64(b[0:8], p.ReservationKey)
+	binary.BigEndian.PutUint64(b[8:16], p.ServiceActionReservationKey)
+	if p.AllTargetPorts {
+		b[20] |= 0x04
+	}
+	if p.APTPL {
+		b[20] |= 0x01
+	}
+	return b
+}
+
+//ParsePrKey parses the key like 0x1 used in the PrCmd params
+func ParsePrKey(key string) (uint64, error) {
+	if key == "" {
+		return 0, nil
+	}
+	k, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(key), "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pr key %s: %v", key, err)
+	}
+	return k, nil
+}
+
+//FormatPrKey formats the key as mpathpersist does, so the keys are comparable between the executors
+func FormatPrKey(key uint64) string {
+	return fmt.Sprintf("%#x", key)
+}
@@ -0,0 +1,219 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"fmt"
+	"time"
+
+	"polardb-sms/pkg/agent/device/reservation"
+	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
+	smslog "polardb-sms/pkg/log"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+)
+
+//Client issues the persistent reservation commands on the scsi path devices under a multipath device,
+//registration is done on every active path as mpathpersist does, the others on any one path
+type Client struct {
+	transport Transport
+	paths     func(device string) ([]string, error)
+}
+
+func NewClient() *Client {
+	return &Client{
+		transport: NewIoctlTransport(),
+		paths:     reservation.ActivePathDevices,
+	}
+}
+
+func (c *Client) prIn(path string, serviceAction byte, timeout time.Duration) ([]byte, error) {
+	data := make([]byte, DefaultPrInAllocationLen)
+	if err := c.transport.Exec(path, NewPrInCdb(serviceAction, DefaultPrInAllocationLen), DirFromDevice, data, timeout); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *Client) prOut(path string, serviceAction, prType byte, param *PrOutParam, timeout time.Duration) error {
+	return c.transport.Exec(path, NewPrOutCdb(serviceAction, LuScope, prType), DirToDevice, param.Bytes(), timeout)
+}
+
+//onAnyPath stops at the first path succeeded, the reservation conflict is returned at once for it is the same on all paths
+func (c *Client) onAnyPath(device string, f func(path string) error) error {
+	paths, err := c.paths(device)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, path := range paths {
+		if lastErr = f(path); lastErr == nil {
+			return nil
+		}
+		if scsiErr, ok := lastErr.(*ScsiError); ok && scsiErr.ReservationConflict() {
+			return lastErr
+		}
+		smslog.Infof("pr cmd on path %s of %s err %s, try next path", path, device, lastErr.Error())
+	}
+	return lastErr
+}
+
+func (c *Client) onAllPaths(device string, f func(path string) error) error {
+	paths, err := c.paths(device)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err = f(path); err != nil {
+			return fmt.Errorf("pr cmd on path %s of %s err %v", path, device, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) PathNum(device string) (int, error) {
+	paths, err := c.paths(device)
+	if err != nil {
+		return 0, err
+	}
+	return len(paths), nil
+}
+
+func (c *Client) ReadKeys(device string, timeout time.Duration) (*ReadKeysResponse, error) {
+	var resp *ReadKeysResponse
+	err := c.onAnyPath(device, func(path string) error {
+		data, err := c.prIn(path, PrInReadKeys, timeout)
+		if err != nil {
+			return err
+		}
+		resp, err = DecodeReadKeys(data)
+		return err
+	})
+	return resp, err
+}
+
+func (c *Client) ReadReservation(device string, timeout time.Duration) (*ReadReservationResponse, error) {
+	var resp *ReadReservationResponse
+	err := c.onAnyPath(device, func(path string) error {
+		data, err := c.prIn(path, PrInReadReservation, timeout)
+		if err != nil {
+			return err
+		}
+		resp, err = DecodeReadReservation(data)
+		return err
+	})
+	return resp, err
+}
+
+func (c *Client) getPrInfo(device string) (*mpathpersist.PersistentReserve, error) {
+	keys, err := c.ReadKeys(device, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pr keys of %s: %v", device, err)
+	}
+	reservation, err := c.ReadReservation(device, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pr reservation of %s: %v", device, err)
+	}
+	return ToPersistentReserve(keys, reservation)
+}
+
+//GetPrInfo is the same as mpathpersist.GetPrInfo without parsing the command output
+func (c *Client) GetPrInfo(device string) (*mpathpersist.PersistentReserve, error) {
+	pr, err := c.getPrInfo(device)
+	if err == mpathpersist.ErrGenerationChanged {
+		time.Sleep(1 * time.Second)
+		return c.getPrInfo(device)
+	}
+	return pr, err
+}
+
+//ReportCapabilities should be run on the physical device, the first active path is used for the multipath device
+func (c *Client) ReportCapabilities(device string) (*mpathpersist.PRCapabilities, error) {
+	var capabilities *mpathpersist.PRCapabilities
+	err := c.onAnyPath(device, func(path string) error {
+		data, err := c.prIn(path, PrInReportCapabilities, DefaultTimeout)
+		if err != nil {
+			return err
+		}
+		capabilities, err = DecodeReportCapabilities(data)
+		return err
+	})
+	return capabilities, err
+}
+
+//Register registers the key on all the active paths, the existing key of the path is replaced
+func (c *Client) Register(device string, key uint64, timeout time.Duration) error {
+	return c.register(device, &PrOutParam{ServiceActionReservationKey: key}, timeout)
+}
+
+//RegisterAptpl is the same as Register with APTPL set, the array keeps the keys and reservation through power loss then
+func (c *Client) RegisterAptpl(device string, key uint64, timeout time.Duration) error {
+	return c.register(device, &PrOutParam{ServiceActionReservationKey: key, APTPL: true}, timeout)
+}
+
+func (c *Client) register(device string, param *PrOutParam, timeout time.Duration) error {
+	return c.onAllPaths(device, func(path string) error {
+		return c.prOut(path, PrOutRegisterAndIgnore, 0, param, timeout)
+	})
+}
+
+//Unregister removes the registrations of this host on all the active paths
+func (c *Client) Unregister(device string, timeout time.Duration) error {
+	param := &PrOutParam{}
+	return c.onAllPaths(device, func(path string) error {
+		return c.prOut(path, PrOutRegisterAndIgnore, 0, param, timeout)
+	})
+}
+
+func (c *Client) Reserve(device string, key uint64, prType byte, timeout time.Duration) error {
+	param := &PrOutParam{ReservationKey: key}
+	return c.onAnyPath(device, func(path string) error {
+		return c.prOut(path, PrOutReserve, prType, param, timeout)
+	})
+}
+
+func (c *Client) Release(device string, key uint64, prType byte, timeout time.Duration) error {
+	param := &PrOutParam{ReservationKey: key}
+	return c.onAnyPath(device, func(path string) error {
+		return c.prOut(path, PrOutRelease, prType, param, timeout)
+	})
+}
+
+func (c *Client) Clear(device string, key uint64, timeout time.Duration) error {
+	param := &PrOutParam{ReservationKey: key}
+	return c.onAnyPath(device, func(path string) error {
+		return c.prOut(path, PrOutClear, 0, param, timeout)
+	})
+}
+
+//Preempt removes the registrations of preemptedKey and takes the reservation with key
+func (c *Client) Preempt(device string, key, preemptedKey uint64, prType byte, timeout time.Duration) error {
+	return c.preempt(device, PrOutPreempt, key, preemptedKey, prType, timeout)
+}
+
+//PreemptAndAbort preempts like Preempt, and aborts the commands queued by preemptedKey
+func (c *Client) PreemptAndAbort(device string, key, preemptedKey uint64, prType byte, timeout time.Duration) error {
+	return c.preempt(device, PrOutPreemptAndAbort, key, preemptedKey, prType, timeout)
+}
+
+func (c *Client) preempt(device string, serviceAction byte, key, preemptedKey uint64, prType byte, timeout time.Duration) error {
+	param := &PrOutParam{ReservationKey: key, ServiceActionReservationKey: preemptedKey}
+	return c.onAnyPath(device, func(path string) error {
+		return c.prOut(path, serviceAction, prType, param, timeout)
+	})
+}
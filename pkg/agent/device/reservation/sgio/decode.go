@@ -0,0 +1,172 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
+	"polardb-sms/pkg/network/message"
+)
+
+//PrTypeName returns the type name printed by sg_persist/mpathpersist, kept for the callers comparing with them
+func PrTypeName(prType byte) string {
+	return message.PrType(prType).String()
+}
+
+type ReadKeysResponse struct {
+	Generation uint32
+	Keys       []uint64
+}
+
+//DecodeReadKeys decodes the READ KEYS parameter data
+func DecodeReadKeys(data []byte) (*ReadKeysResponse, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("read keys response too short: %d", len(data))
+	}
+	resp := &ReadKeysResponse{
+		Generation: binary.BigEndian.Uint32(data[0:4]),
+		Keys:       make([]uint64, 0),
+	}
+	addLen := int(binary.BigEndian.Uint32(data[4:8]))
+	if addLen%8 != 0 {
+		return nil, fmt.Errorf("invalid read keys additional length %d", addLen)
+	}
+	//the keys not fitting in the allocation length are truncated
+	end := 8 + addLen
+	if end > len(data) {
+		end = len(data) - (len(data)-8)%8
+	}
+	for i := 8; i+8 <= end; i += 8 {
+		resp.Keys = append(resp.Keys, binary.BigEndian.Uint64(data[i:i+8]))
+	}
+	return resp, nil
+}
+
+type ReadReservationResponse struct {
+	Generation uint32
+	Reserved   bool
+	Key        uint64
+	Scope      byte
+	Type       byte
+}
+
+//DecodeReadReservation decodes the READ RESERVATION parameter data
+func DecodeReadReservation(data []byte) (*ReadReservationResponse, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("read reservation response too short: %d", len(data))
+	}
+	resp := &ReadReservationResponse{
+		Generation: binary.BigEndian.Uint32(data[0:4]),
+	}
+	addLen := binary.BigEndian.Uint32(data[4:8])
+	if addLen == 0 {
+		return resp, nil
+	}
+	if addLen < 16 || len(data) < 24 {
+		return nil, fmt.Errorf("invalid read reservation additional length %d, data length %d", addLen, len(data))
+	}
+	resp.Reserved = true
+	resp.Key = binary.BigEndian.Uint64(data[8:16])
+	resp.Scope = data[21] >> 4
+	resp.Type = data[21] & 0x0f
+	return resp, nil
+}
+
+//DecodeReportCapabilities decodes the REPORT CAPABILITIES parameter data to the same keys and "0"/"1" values
+//as mpathpersist.ParseCapabilities
+func DecodeReportCapabilities(data []byte) (*mpathpersist.PRCapabilities, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("report capabilities response too short: %d", len(data))
+	}
+	bit := func(b byte, mask byte) string {
+		if b&mask != 0 {
+			return "1"
+		}
+		return "0"
+	}
+	capabilities := mpathpersist.PRCapabilities{
+		mpathpersist.PRC_CRH:                     bit(data[2], 0x10),
+		mpathpersist.PRC_SIP_C:                   bit(data[2], 0x08),
+		mpathpersist.PRC_ATP_C:                   bit(data[2], 0x04),
+		mpathpersist.PRC_PTPL_C:                  bit(data[2], 0x01),
+		"Type Mask Valid(TMV)":                   bit(data[3], 0x80),
+		"Allow Commands":                         fmt.Sprintf("%d", (data[3]>>4)&0x07),
+		mpathpersist.PRC_PTPL_A:                  bit(data[3], 0x01),
+		mpathpersist.PRC_WR_EX:                   bit(data[4], 0x80),
+		mpathpersist.PRCapability(PrTypeName(6)): bit(data[4], 0x40),
+		mpathpersist.PRCapability(PrTypeName(5)): bit(data[4], 0x20),
+		mpathpersist.PRCapability(PrTypeName(3)): bit(data[4], 0x08),
+		mpathpersist.PRCapability(PrTypeName(1)): bit(data[4], 0x02),
+		mpathpersist.PRC_EX_AC_AR:                bit(data[5], 0x01),
+	}
+	return &capabilities, nil
+}
+
+//typeMaskBits are the persistent reservation type mask bits of REPORT CAPABILITIES, byte 4 and 5
+var typeMaskBits = []struct {
+	prType message.PrType
+	index  int
+	mask   byte
+}{
+	{message.WE, 4, 0x02},
+	{message.EA, 4, 0x08},
+	{message.WERO, 4, 0x20},
+	{message.EARO, 4, 0x40},
+	{message.WEAR, 4, 0x80},
+	{message.EAAR, 5, 0x01},
+}
+
+//DecodePathCapability decodes the REPORT CAPABILITIES parameter data of one path,
+//the reservation types are left empty if the type mask is not valid
+func DecodePathCapability(data []byte) (*message.PrPathCapability, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("report capabilities response too short: %d", len(data))
+	}
+	capability := &message.PrPathCapability{
+		ReservationTypes: make([]message.PrType, 0),
+		PtplCapable:      data[2]&0x01 != 0,
+		PtplActive:       data[3]&0x01 != 0,
+		AtpCapable:       data[2]&0x04 != 0,
+	}
+	if data[3]&0x80 == 0 {
+		return capability, nil
+	}
+	for _, b := range typeMaskBits {
+		if data[b.index]&b.mask != 0 {
+			capability.ReservationTypes = append(capability.ReservationTypes, b.prType)
+		}
+	}
+	return capability, nil
+}
+
+//ToPersistentReserve merges the keys and reservation like mpathpersist.ParsePrRegister
+func ToPersistentReserve(keys *ReadKeysResponse, reservation *ReadReservationResponse) (*mpathpersist.PersistentReserve, error) {
+	if keys.Generation != reservation.Generation {
+		return nil, mpathpersist.ErrGenerationChanged
+	}
+	pr := mpathpersist.NewPersistentReserve()
+	pr.Generation = fmt.Sprintf("%#x", keys.Generation)
+	for _, k := range keys.Keys {
+		pr.Keys[FormatPrKey(k)]++
+	}
+	if reservation.Reserved {
+		pr.ReservationKey = FormatPrKey(reservation.Key)
+		pr.ReservationType = PrTypeName(reservation.Type)
+	}
+	return pr, nil
+}
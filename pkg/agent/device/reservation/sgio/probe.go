@@ -0,0 +1,130 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"fmt"
+	"time"
+
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network/message"
+)
+
+const (
+	ProbeStepRegister = "register"
+	ProbeStepReserve  = "reserve"
+	ProbeStepPreempt  = "preempt"
+	ProbeStepRelease  = "release"
+	ProbeStepClear    = "clear"
+
+	//probePeerKeyMask makes the key registered on the peer path differ from the probing key
+	probePeerKeyMask uint64 = 0x5353 << 48
+)
+
+//ProbeCapabilities runs REGISTER/RESERVE/PREEMPT/RELEASE/CLEAR on every active path of the device and reports
+//the capabilities of each path. The path registers and reserves with key, then the next path preempts it
+//with a peer key, so the preemption across I_T nexuses is checked too; with one path it preempts itself.
+//The device must be a scratch lun: it is refused if any key is registered, and all the keys are cleared at last.
+func (c *Client) ProbeCapabilities(device string, key uint64, prType byte, timeout time.Duration) ([]*message.PrPathCapability, error) {
+	if key == 0 {
+		return nil, fmt.Errorf("probe key of %s should not be zero", device)
+	}
+	paths, err := c.paths(device)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.ReadKeys(device, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys.Keys) > 0 {
+		return nil, fmt.Errorf("device %s is not a scratch lun, %d keys registered", device, len(keys.Keys))
+	}
+	capabilities := make([]*message.PrPathCapability, 0, len(paths))
+	for i, path := range paths {
+		capability := c.probePath(path, paths[(i+1)%len(paths)], key, prType, timeout)
+		capabilities = append(capabilities, capability)
+	}
+	return capabilities, nil
+}
+
+func (c *Client) probePath(path, peerPath string, key uint64, prType byte, timeout time.Duration) *message.PrPathCapability {
+	capability := &message.PrPathCapability{}
+	if data, err := c.prIn(path, PrInReportCapabilities, timeout); err != nil {
+		smslog.Infof("report capabilities on path %s err %s", path, err.Error())
+	} else if capability, err = DecodePathCapability(data); err != nil {
+		smslog.Infof("decode capabilities of path %s err %s", path, err.Error())
+		capability = &message.PrPathCapability{}
+	}
+	capability.Path = path
+	capability.Steps = make([]*message.PrStepResult, 0)
+
+	peerKey := key
+	if peerPath != path {
+		peerKey = key ^ probePeerKeyMask
+	}
+	steps := []struct {
+		name string
+		f    func() error
+	}{
+		{ProbeStepRegister, func() error {
+			return c.prOut(path, PrOutRegisterAndIgnore, 0, &PrOutParam{ServiceActionReservationKey: key}, timeout)
+		}},
+		{ProbeStepReserve, func() error {
+			return c.prOut(path, PrOutReserve, prType, &PrOutParam{ReservationKey: key}, timeout)
+		}},
+		{ProbeStepPreempt, func() error {
+			if peerPath != path {
+				err := c.prOut(peerPath, PrOutRegisterAndIgnore, 0, &PrOutParam{ServiceActionReservationKey: peerKey}, timeout)
+				if err != nil {
+					return fmt.Errorf("register peer path %s err %v", peerPath, err)
+				}
+			}
+			return c.prOut(peerPath, PrOutPreempt, prType, &PrOutParam{ReservationKey: peerKey, ServiceActionReservationKey: key}, timeout)
+		}},
+		{ProbeStepRelease, func() error {
+			return c.prOut(peerPath, PrOutRelease, prType, &PrOutParam{ReservationKey: peerKey}, timeout)
+		}},
+		{ProbeStepClear, func() error {
+			return c.prOut(peerPath, PrOutClear, 0, &PrOutParam{ReservationKey: peerKey}, timeout)
+		}},
+	}
+	failed := false
+	for _, step := range steps {
+		result := &message.PrStepResult{Step: step.name, Success: true}
+		if err := step.f(); err != nil {
+			failed = true
+			result.Success = false
+			result.ErrMsg = err.Error()
+		}
+		capability.Steps = append(capability.Steps, result)
+	}
+	if failed {
+		c.cleanProbe(path, key, timeout)
+	}
+	return capability
+}
+
+//cleanProbe registers the key again and clears, so the next path starts from a lun without any key
+func (c *Client) cleanProbe(path string, key uint64, timeout time.Duration) {
+	err := c.prOut(path, PrOutRegisterAndIgnore, 0, &PrOutParam{ServiceActionReservationKey: key}, timeout)
+	if err == nil {
+		err = c.prOut(path, PrOutClear, 0, &PrOutParam{ReservationKey: key}, timeout)
+	}
+	if err != nil {
+		smslog.Errorf("clean the probe keys on path %s err %s", path, err.Error())
+	}
+}
@@ -0,0 +1,232 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"fmt"
+	"time"
+
+	"polardb-sms/pkg/agent/device/reservation"
+	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network/message"
+)
+
+type PrExecWrapper struct {
+	executors map[int]reservation.PrCmdExecutor
+}
+
+func NewPrExecWrapper() *PrExecWrapper {
+	return newPrExecWrapper(NewClient(), common.GetDevicePath)
+}
+
+func newPrExecWrapper(client *Client, devicePath func(string) (string, error)) *PrExecWrapper {
+	base := prExecutor{client: client, devicePath: devicePath}
+	wrapper := &PrExecWrapper{executors: make(map[int]reservation.PrCmdExecutor)}
+	wrapper.executors[message.PrRegister] = &PrRegisterExecutor{base}
+	wrapper.executors[message.PrReserve] = &PrReserveExecutor{base}
+	wrapper.executors[message.PrRelease] = &PrReleaseExecutor{base}
+	wrapper.executors[message.PrUnregister] = &PrUnregisterExecutor{base}
+	wrapper.executors[message.PrClear] = &PrClearExecutor{base}
+	wrapper.executors[message.PrPreempt] = &PrPreemptExecutor{base}
+	wrapper.executors[message.PrPathNum] = &PrPathNumExecutor{base}
+	wrapper.executors[message.PathCanWrite] = mpathpersist.NewPrPathCanWriteExecutor()
+	wrapper.executors[message.PathCannotWrite] = mpathpersist.NewPrPathCannotWriteExecutor()
+	return wrapper
+}
+
+func (w *PrExecWrapper) Process(cmd *message.PrCmd) (*message.PrCheckCmdResult, error) {
+	executor, exit := w.executors[cmd.CmdType]
+	if !exit {
+		return nil, fmt.Errorf("do not support cmd type %d", cmd.CmdType)
+	}
+	return reservation.ExecuteCmd(executor, cmd)
+}
+
+type prExecutor struct {
+	client     *Client
+	devicePath func(volumeId string) (string, error)
+}
+
+//prInfo returns nil if failed, the caller should exec the cmd then
+func (e *prExecutor) prInfo(device string) *mpathpersist.PersistentReserve {
+	pr, err := e.client.GetPrInfo(device)
+	if err != nil {
+		smslog.Infof("get pr info of %s err %s, exec it", device, err.Error())
+		return nil
+	}
+	return pr
+}
+
+func keyCount(pr *mpathpersist.PersistentReserve, key uint64) int {
+	cnt := 0
+	for k, v := range pr.Keys {
+		if prKey, err := ParsePrKey(k); err == nil && prKey == key {
+			cnt += v
+		}
+	}
+	return cnt
+}
+
+type PrRegisterExecutor struct {
+	prExecutor
+}
+
+func (e *PrRegisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrRegisterCmdParam)
+	key, err := ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	//registering again is needed for aptpl, for it is not known if the existing registrations set it
+	if param.Aptpl {
+		return 0, e.client.RegisterAptpl(device, key, timeout)
+	}
+	//the key should be registered through every active path
+	if pr := e.prInfo(device); pr != nil {
+		pathNum, err := e.client.PathNum(device)
+		if err == nil && keyCount(pr, key) >= pathNum {
+			return 0, nil
+		}
+	}
+	return 0, e.client.Register(device, key, timeout)
+}
+
+type PrReserveExecutor struct {
+	prExecutor
+}
+
+func (e *PrReserveExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrReserveCmdParam)
+	key, err := ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Reserve(device, key, byte(param.ReserveType), timeout)
+}
+
+//PrReleaseExecutor unregisters this host as mpathpersist --register-ignore does
+type PrReleaseExecutor struct {
+	prExecutor
+}
+
+func (e *PrReleaseExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Unregister(device, timeout)
+}
+
+//PrUnregisterExecutor removes the registrations of this host unless the key is not registered any more
+type PrUnregisterExecutor struct {
+	prExecutor
+}
+
+func (e *PrUnregisterExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrUnregisterCmdParam)
+	key, err := ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	if pr := e.prInfo(device); pr != nil && keyCount(pr, key) == 0 {
+		return 0, nil
+	}
+	return 0, e.client.Unregister(device, timeout)
+}
+
+type PrClearExecutor struct {
+	prExecutor
+}
+
+func (e *PrClearExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrClearCmdParam)
+	key, err := ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return 0, e.client.Clear(device, key, timeout)
+}
+
+type PrPreemptExecutor struct {
+	prExecutor
+}
+
+func (e *PrPreemptExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	param := cmd.CmdParam.(*message.PrPreemptCmdParam)
+	key, err := ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return 0, err
+	}
+	preemptedKey, err := ParsePrKey(param.PreemptedKey)
+	if err != nil {
+		return 0, err
+	}
+	prType := byte(param.ReserveType)
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	pr, err := e.client.GetPrInfo(device)
+	if err != nil {
+		return 0, err
+	}
+	if pr.ReservationKey != "" && pr.ReservationType == PrTypeName(prType) &&
+		len(pr.Keys) == 1 && keyCount(pr, key) > 0 {
+		return 0, nil
+	}
+	if keyCount(pr, key) == 0 {
+		if err = e.client.Register(device, key, timeout); err != nil {
+			return 0, err
+		}
+	}
+	if keyCount(pr, preemptedKey) == 0 {
+		return 0, e.client.Reserve(device, key, prType, timeout)
+	}
+	if param.Abort {
+		return 0, e.client.PreemptAndAbort(device, key, preemptedKey, prType, timeout)
+	}
+	return 0, e.client.Preempt(device, key, preemptedKey, prType, timeout)
+}
+
+type PrPathNumExecutor struct {
+	prExecutor
+}
+
+func (e *PrPathNumExecutor) PrCmdExec(cmd *message.PrCmd, timeout time.Duration) (int, error) {
+	device, err := e.devicePath(cmd.VolumeId)
+	if err != nil {
+		return 0, err
+	}
+	return e.client.PathNum(device)
+}
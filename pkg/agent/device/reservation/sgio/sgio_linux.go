@@ -0,0 +1,119 @@
+//go:build linux
+// +build linux
+
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	sgIoIoctl        = 0x2285
+	sgInterfaceId    = 'S'
+	sgDxferNone      = -1
+	sgDxferToDev     = -2
+	sgDxferFromDev   = -3
+	senseBufferLen   = 64
+	sgDriverSenseBit = 0x08
+)
+
+//sgIoHdr is struct sg_io_hdr of <scsi/sg.h>
+type sgIoHdr struct {
+	interfaceId    int32
+	dxferDirection int32
+	cmdLen         uint8
+	mxSbLen        uint8
+	iovecCount     uint16
+	dxferLen       uint32
+	dxferp         unsafe.Pointer
+	cmdp           unsafe.Pointer
+	sbp            unsafe.Pointer
+	timeout        uint32
+	flags          uint32
+	packId         int32
+	usrPtr         unsafe.Pointer
+	status         uint8
+	maskedStatus   uint8
+	msgStatus      uint8
+	sbLenWr        uint8
+	hostStatus     uint16
+	driverStatus   uint16
+	resid          int32
+	duration       uint32
+	info           uint32
+}
+
+type ioctlTransport struct {
+}
+
+func NewIoctlTransport() Transport {
+	return &ioctlTransport{}
+}
+
+func (t *ioctlTransport) Exec(device string, cdb []byte, dir DataDirection, data []byte, timeout time.Duration) error {
+	f, err := os.OpenFile(device, os.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sense := make([]byte, senseBufferLen)
+	hdr := sgIoHdr{
+		interfaceId: sgInterfaceId,
+		cmdLen:      uint8(len(cdb)),
+		mxSbLen:     senseBufferLen,
+		cmdp:        unsafe.Pointer(&cdb[0]),
+		sbp:         unsafe.Pointer(&sense[0]),
+		timeout:     uint32(timeout / time.Millisecond),
+	}
+	switch dir {
+	case DirToDevice:
+		hdr.dxferDirection = sgDxferToDev
+	case DirFromDevice:
+		hdr.dxferDirection = sgDxferFromDev
+	default:
+		hdr.dxferDirection = sgDxferNone
+	}
+	if dir != DirNone && len(data) > 0 {
+		hdr.dxferLen = uint32(len(data))
+		hdr.dxferp = unsafe.Pointer(&data[0])
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), sgIoIoctl, uintptr(unsafe.Pointer(&hdr)))
+	runtime.KeepAlive(cdb)
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(sense)
+	if errno != 0 {
+		return fmt.Errorf("SG_IO ioctl on %s err %v", device, errno)
+	}
+	//the driver sense bit only tells the sense buffer is filled
+	if hdr.status == ScsiStatusGood && hdr.hostStatus == 0 && hdr.driverStatus&^sgDriverSenseBit == 0 {
+		return nil
+	}
+	return &ScsiError{
+		Device:       device,
+		Status:       hdr.status,
+		HostStatus:   hdr.hostStatus,
+		DriverStatus: hdr.driverStatus,
+		Sense:        sense[:hdr.sbLenWr],
+	}
+}
@@ -0,0 +1,325 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network/message"
+)
+
+//fakeLun simulates the persistent reservation of one lun, every path is an I_T nexus
+type fakeLun struct {
+	generation   uint32
+	registered   map[string]uint64
+	reserved     bool
+	reserveKey   uint64
+	reserveType  byte
+	aptpl        bool
+	failedPaths  map[string]bool
+	capabilities []byte
+	cdbs         [][]byte
+}
+
+func newFakeLun() *fakeLun {
+	return &fakeLun{
+		registered:   make(map[string]uint64),
+		failedPaths:  make(map[string]bool),
+		capabilities: []byte{0, 8, 0x11, 0x81, 0xea, 0x01, 0, 0},
+	}
+}
+
+func (l *fakeLun) conflict(device string) error {
+	return &ScsiError{Device: device, Status: ScsiStatusReservationConflict}
+}
+
+func (l *fakeLun) Exec(device string, cdb []byte, dir DataDirection, data []byte, timeout time.Duration) error {
+	l.cdbs = append(l.cdbs, cdb)
+	if l.failedPaths[device] {
+		return fmt.Errorf("path %s failed", device)
+	}
+	switch cdb[0] {
+	case PrInOpcode:
+		for i := range data {
+			data[i] = 0
+		}
+		binary.BigEndian.PutUint32(data[0:4], l.generation)
+		switch cdb[1] {
+		case PrInReadKeys:
+			paths := make([]string, 0)
+			for path := range l.registered {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			binary.BigEndian.PutUint32(data[4:8], uint32(8*len(paths)))
+			for i, path := range paths {
+				binary.BigEndian.PutUint64(data[8+8*i:], l.registered[path])
+			}
+		case PrInReadReservation:
+			if l.reserved {
+				binary.BigEndian.PutUint32(data[4:8], 16)
+				binary.BigEndian.PutUint64(data[8:16], l.reserveKey)
+				data[21] = l.reserveType
+			}
+		case PrInReportCapabilities:
+			copy(data, l.capabilities)
+		}
+		return nil
+	case PrOutOpcode:
+		rk := binary.BigEndian.Uint64(data[0:8])
+		sark := binary.BigEndian.Uint64(data[8:16])
+		prType := cdb[2] & 0x0f
+		registeredKey, registered := l.registered[device]
+		switch cdb[1] {
+		case PrOutRegisterAndIgnore:
+			l.aptpl = data[20]&0x01 != 0
+			if sark == 0 {
+				delete(l.registered, device)
+			} else {
+				l.registered[device] = sark
+			}
+			l.generation++
+			return nil
+		}
+		if !registered || registeredKey != rk {
+			return l.conflict(device)
+		}
+		switch cdb[1] {
+		case PrOutReserve:
+			if l.reserved && l.reserveKey != rk {
+				return l.conflict(device)
+			}
+			l.reserved, l.reserveKey, l.reserveType = true, rk, prType
+		case PrOutPreempt:
+			for path, key := range l.registered {
+				if key == sark {
+					delete(l.registered, path)
+				}
+			}
+			l.reserved, l.reserveKey, l.reserveType = true, rk, prType
+			l.generation++
+		case PrOutRelease:
+			if l.reserved && l.reserveKey == rk {
+				l.reserved = false
+			}
+		case PrOutClear:
+			l.registered = make(map[string]uint64)
+			l.reserved = false
+			l.generation++
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown opcode %#x", cdb[0])
+}
+
+func newCmd(cmdType int, param interface{}) *message.PrCmd {
+	return &message.PrCmd{
+		CmdType:    cmdType,
+		VolumeType: common.MultipathVolume,
+		VolumeId:   "36e00084100ee7ec9",
+		CmdParam:   param,
+	}
+}
+
+func newTestWrapper(lun *fakeLun, paths []string) *PrExecWrapper {
+	client := &Client{
+		transport: lun,
+		paths: func(device string) ([]string, error) {
+			return paths, nil
+		},
+	}
+	return newPrExecWrapper(client, func(volumeId string) (string, error) {
+		return "/dev/mapper/" + volumeId, nil
+	})
+}
+
+func TestPrCdb(t *testing.T) {
+	assert.Equal(t, []byte{0x5e, 0x01, 0, 0, 0, 0, 0, 0x20, 0, 0}, NewPrInCdb(PrInReadReservation, 8192))
+	assert.Equal(t, []byte{0x5f, 0x04, 0x07, 0, 0, 0, 0, 0, 24, 0}, NewPrOutCdb(PrOutPreempt, LuScope, 7))
+
+	param := (&PrOutParam{ReservationKey: 0x1, ServiceActionReservationKey: 0xa0b, APTPL: true}).Bytes()
+	assert.Equal(t, 24, len(param))
+	assert.Equal(t, byte(0x01), param[7])
+	assert.Equal(t, byte(0x0b), param[15])
+	assert.Equal(t, byte(0x0a), param[14])
+	assert.Equal(t, byte(0x01), param[20])
+
+	key, err := ParsePrKey("0xC0A80001")
+	assert.NoError(t, err)
+	assert.Equal(t, "0xc0a80001", FormatPrKey(key))
+	_, err = ParsePrKey("0xzz")
+	assert.Error(t, err)
+}
+
+func TestDecode(t *testing.T) {
+	data := make([]byte, 28)
+	binary.BigEndian.PutUint32(data[0:4], 0x85)
+	binary.BigEndian.PutUint32(data[4:8], 24)
+	binary.BigEndian.PutUint64(data[8:], 1)
+	binary.BigEndian.PutUint64(data[16:], 2)
+	keys, err := DecodeReadKeys(data)
+	assert.NoError(t, err)
+	//the third key is truncated
+	assert.Equal(t, []uint64{1, 2}, keys.Keys)
+
+	data = make([]byte, 24)
+	binary.BigEndian.PutUint32(data[0:4], 0x85)
+	binary.BigEndian.PutUint32(data[4:8], 16)
+	binary.BigEndian.PutUint64(data[8:], 1)
+	data[21] = 0x01
+	reservation, err := DecodeReadReservation(data)
+	assert.NoError(t, err)
+
+	pr, err := ToPersistentReserve(keys, reservation)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x1", pr.ReservationKey)
+	assert.Equal(t, "Write Exclusive", pr.ReservationType)
+	assert.Equal(t, 1, pr.Keys["0x2"])
+
+	reservation.Generation++
+	_, err = ToPersistentReserve(keys, reservation)
+	assert.Equal(t, mpathpersist.ErrGenerationChanged, err)
+
+	capabilities, err := DecodeReportCapabilities(newFakeLun().capabilities)
+	assert.NoError(t, err)
+	assert.True(t, capabilities.Support(mpathpersist.PRC_WR_EX))
+	assert.True(t, capabilities.Support(mpathpersist.PRC_EX_AC_AR))
+	assert.True(t, capabilities.Support(mpathpersist.PRC_PTPL_C))
+	assert.False(t, capabilities.Support(mpathpersist.PRC_ATP_C))
+}
+
+func TestPrExecWrapper(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	lun := newFakeLun()
+	paths := []string{"/dev/sda", "/dev/sdb"}
+	wrapper := newTestWrapper(lun, paths)
+	cmd := newCmd(message.PrRegister, &message.PrRegisterCmdParam{RegisterKey: "0x1"})
+	_, err := wrapper.Process(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"/dev/sda": 1, "/dev/sdb": 1}, lun.registered)
+
+	//registered on all paths, nothing to do
+	cdbs := len(lun.cdbs)
+	_, err = wrapper.Process(cmd)
+	assert.NoError(t, err)
+	for _, cdb := range lun.cdbs[cdbs:] {
+		assert.Equal(t, PrInOpcode, cdb[0])
+	}
+	//registered again with aptpl
+	_, err = wrapper.Process(newCmd(message.PrRegister, &message.PrRegisterCmdParam{RegisterKey: "0x1", Aptpl: true}))
+	assert.NoError(t, err)
+	assert.True(t, lun.aptpl)
+	assert.Equal(t, map[string]uint64{"/dev/sda": 1, "/dev/sdb": 1}, lun.registered)
+
+	cmd = newCmd(message.PrReserve, &message.PrReserveCmdParam{RegisterKey: "0x1", ReserveType: message.WEAR})
+	_, err = wrapper.Process(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), lun.reserveKey)
+	assert.Equal(t, byte(message.WEAR), lun.reserveType)
+
+	//the other host preempts with its key
+	lun.registered = map[string]uint64{"/dev/sda": 1}
+	cmd, _ = message.NewPrPreemptCmd(cmd.VolumeId, common.MultipathVolume, "0x2", "0x1", message.WEAR)
+	_, err = wrapper.Process(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"/dev/sda": 2, "/dev/sdb": 2}, lun.registered)
+	assert.Equal(t, uint64(2), lun.reserveKey)
+
+	//reservation conflict is not retried on the other path
+	cdbs = len(lun.cdbs)
+	cmd = newCmd(message.PrReserve, &message.PrReserveCmdParam{RegisterKey: "0x3", ReserveType: message.WEAR})
+	_, err = wrapper.Process(cmd)
+	assert.Error(t, err)
+	assert.True(t, err.(*ScsiError).ReservationConflict())
+	assert.Equal(t, 1, len(lun.cdbs)-cdbs)
+
+	cmd = newCmd(message.PrRelease, &message.PrReleaseCmdParam{RegisterKey: "0x2", ReserveType: message.WEAR})
+	_, err = wrapper.Process(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(lun.registered))
+
+	cmd, _ = message.NewCheckPathNumCmd(cmd.VolumeId, common.MultipathVolume)
+	ret, err := wrapper.Process(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, ret.CheckResult)
+}
+
+func TestClientFailover(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	lun := newFakeLun()
+	lun.failedPaths["/dev/sda"] = true
+	client := &Client{
+		transport: lun,
+		paths: func(device string) ([]string, error) {
+			return []string{"/dev/sda", "/dev/sdb"}, nil
+		},
+	}
+	lun.registered["/dev/sdb"] = 5
+	pr, err := client.GetPrInfo("/dev/mapper/test")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pr.Keys["0x5"])
+
+	//registration must succeed on every path
+	assert.Error(t, client.Register("/dev/mapper/test", 6, DefaultTimeout))
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	lun := newFakeLun()
+	client := &Client{
+		transport: lun,
+		paths: func(device string) ([]string, error) {
+			return []string{"/dev/sda", "/dev/sdb"}, nil
+		},
+	}
+	capabilities, err := client.ProbeCapabilities("/dev/mapper/test", 0xa, 7, DefaultTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(capabilities))
+	for _, capability := range capabilities {
+		assert.Equal(t, []message.PrType{message.WE, message.EA, message.WERO, message.EARO, message.WEAR, message.EAAR},
+			capability.ReservationTypes)
+		assert.True(t, capability.PtplCapable)
+		assert.False(t, capability.AtpCapable)
+		assert.Equal(t, 5, len(capability.Steps))
+		for _, step := range capability.Steps {
+			assert.True(t, step.Success, step.Step)
+		}
+	}
+	assert.Equal(t, 0, len(lun.registered))
+	assert.False(t, lun.reserved)
+
+	//the preempt from the failed peer path fails, the keys are still cleared
+	lun.failedPaths["/dev/sdb"] = true
+	capabilities, err = client.ProbeCapabilities("/dev/mapper/test", 0xa, 7, DefaultTimeout)
+	assert.NoError(t, err)
+	assert.True(t, capabilities[0].Steps[1].Success)
+	assert.False(t, capabilities[0].Steps[2].Success)
+	assert.Equal(t, 0, len(lun.registered))
+
+	lun.failedPaths = map[string]bool{}
+	lun.registered["/dev/sda"] = 5
+	_, err = client.ProbeCapabilities("/dev/mapper/test", 0xa, 7, DefaultTimeout)
+	assert.Error(t, err)
+}
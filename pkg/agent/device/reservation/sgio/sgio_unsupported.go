@@ -0,0 +1,35 @@
+//go:build !linux
+// +build !linux
+
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"fmt"
+	"time"
+)
+
+type ioctlTransport struct {
+}
+
+func NewIoctlTransport() Transport {
+	return &ioctlTransport{}
+}
+
+func (t *ioctlTransport) Exec(device string, cdb []byte, dir DataDirection, data []byte, timeout time.Duration) error {
+	return fmt.Errorf("SG_IO is only supported on linux")
+}
@@ -0,0 +1,75 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package sgio
+
+import (
+	"fmt"
+	"time"
+)
+
+type DataDirection int
+
+const (
+	DirNone DataDirection = iota
+	DirToDevice
+	DirFromDevice
+)
+
+const (
+	ScsiStatusGood                = 0x00
+	ScsiStatusCheckCondition      = 0x02
+	ScsiStatusReservationConflict = 0x18
+)
+
+//Transport sends one scsi command to the device, data is filled in for DirFromDevice
+type Transport interface {
+	Exec(device string, cdb []byte, dir DataDirection, data []byte, timeout time.Duration) error
+}
+
+type ScsiError struct {
+	Device       string
+	Status       byte
+	HostStatus   uint16
+	DriverStatus uint16
+	Sense        []byte
+}
+
+func (e *ScsiError) Error() string {
+	key, asc, ascq := e.SenseCode()
+	return fmt.Sprintf("scsi cmd on %s failed: status %#x host status %#x driver status %#x sense key %#x asc %#x ascq %#x",
+		e.Device, e.Status, e.HostStatus, e.DriverStatus, key, asc, ascq)
+}
+
+func (e *ScsiError) ReservationConflict() bool {
+	return e.Status == ScsiStatusReservationConflict
+}
+
+//SenseCode decodes both the fixed and descriptor format sense data
+func (e *ScsiError) SenseCode() (key, asc, ascq byte) {
+	if len(e.Sense) < 4 {
+		return
+	}
+	switch e.Sense[0] & 0x7f {
+	case 0x70, 0x71:
+		key = e.Sense[2] & 0x0f
+		if len(e.Sense) >= 14 {
+			asc, ascq = e.Sense[12], e.Sense[13]
+		}
+	case 0x72, 0x73:
+		key, asc, ascq = e.Sense[1]&0x0f, e.Sense[2], e.Sense[3]
+	}
+	return
+}
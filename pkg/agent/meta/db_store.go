@@ -86,6 +86,9 @@ func (s *DBStore) List() (map[string]*DMTableRecord, error) {
 	var ret = map[string]*DMTableRecord{}
 	err := s.View(func(tx *bolt.Tx) error {
 		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if string(name) == JournalBucket {
+				return nil
+			}
 			data := b.Get([]byte(DataKey))
 			if data == nil {
 				return fmt.Errorf("can not find record data for %s", name)
@@ -0,0 +1,142 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+package meta
+
+import (
+	"encoding/binary"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	smslog "polardb-sms/pkg/log"
+	"time"
+)
+
+const (
+	//JournalBucket is reserved in the meta db, dm device names never start with the underscore
+	JournalBucket = "__msg_journal__"
+	//DefaultJournalExpiry should cover all retries of a stage on the manager
+	DefaultJournalExpiry = time.Hour
+	journalTimeLen       = 8
+)
+
+//MsgJournal keeps the responses of the processed messages by msg id,
+//a re-delivered message gets the same response without running again
+type MsgJournal interface {
+	//Get returns nil if msgId is not journaled
+	Get(msgId string) ([]byte, error)
+
+	Put(msgId string, response []byte) error
+
+	//Expire removes the entries journaled before the given time
+	Expire(before time.Time) (int, error)
+}
+
+type DBJournal struct {
+	db *bolt.DB
+}
+
+func (j *DBJournal) Get(msgId string) ([]byte, error) {
+	var ret []byte
+	err := j.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(JournalBucket))
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(msgId))
+		if value == nil {
+			return nil
+		}
+		if len(value) < journalTimeLen {
+			return fmt.Errorf("broken journal entry of %s", msgId)
+		}
+		//the value is only valid in the transaction
+		ret = append([]byte{}, value[journalTimeLen:]...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (j *DBJournal) Put(msgId string, response []byte) error {
+	value := make([]byte, journalTimeLen+len(response))
+	binary.BigEndian.PutUint64(value, uint64(time.Now().UnixNano()))
+	copy(value[journalTimeLen:], response)
+	return j.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(JournalBucket))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(msgId), value)
+	})
+}
+
+func (j *DBJournal) Expire(before time.Time) (int, error) {
+	var expired [][]byte
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(JournalBucket))
+		if bucket == nil {
+			return nil
+		}
+		err := bucket.ForEach(func(k, v []byte) error {
+			if len(v) < journalTimeLen || int64(binary.BigEndian.Uint64(v)) < before.UnixNano() {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err = bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+//RunExpiry drops the entries older than expiry until stopCh is closed
+func (j *DBJournal) RunExpiry(expiry time.Duration, stopCh <-chan struct{}) {
+	if expiry <= 0 {
+		smslog.Infof("msg journal never expires")
+		return
+	}
+	ticker := time.NewTicker(expiry / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			n, err := j.Expire(time.Now().Add(-expiry))
+			if err != nil {
+				smslog.Errorf("expire msg journal err: %s", err.Error())
+				continue
+			}
+			if n > 0 {
+				smslog.Debugf("expired %d entries of msg journal", n)
+			}
+		}
+	}
+}
+
+func NewDBJournal(db *bolt.DB) *DBJournal {
+	return &DBJournal{db: db}
+}
@@ -56,13 +56,23 @@ type DMTableStore interface {
 }
 
 var _dmStore DMTableStore
+var _msgJournal *DBJournal
 
+//CreateDmStore also creates the msg journal, which shares the db of the dm tables
 func CreateDmStore(dir string) error {
-	var err error
-	_dmStore, err = NewDBStore(dir)
-	return err
+	store, err := NewDBStore(dir)
+	if err != nil {
+		return err
+	}
+	_dmStore = store
+	_msgJournal = NewDBJournal(store.DB)
+	return nil
 }
 
 func GetDmStore() DMTableStore {
 	return _dmStore
 }
+
+func GetMsgJournal() *DBJournal {
+	return _msgJournal
+}
@@ -16,10 +16,9 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"polardb-sms/pkg/agent/device/dmhelper"
-	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
-	"polardb-sms/pkg/agent/device/reservation/nvme"
 	"polardb-sms/pkg/agent/utils"
 	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
@@ -34,8 +33,8 @@ type BatchPrExecReqHandler struct {
 
 func NewBatchPrExecReqHandler() *BatchPrExecReqHandler {
 	return &BatchPrExecReqHandler{
-		nvmeExecWrapper: nvme.NewNvmeExecWrapper(),
-		prExecWrapper:   mpathpersist.NewPrExecWrapper(),
+		nvmeExecWrapper: newNvmeExecWrapper(),
+		prExecWrapper:   newScsiPrExecWrapper(),
 	}
 }
 
@@ -87,7 +86,7 @@ func (h *BatchPrExecReqHandler) execPrCmdForLv(prCmd *message.PrCmd) ([]*message
 	}
 }
 
-func (h *BatchPrExecReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *BatchPrExecReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var prCmds = &message.BatchPrCheckCmd{}
 	err := common.BytesToStruct(msg.Body.Content, prCmds)
 	if err != nil {
@@ -99,11 +98,23 @@ func (h *BatchPrExecReqHandler) Handle(msg *message.SmsMessage) *message.SmsMess
 
 	err = common.RunWithRetry(3, 1*time.Second, func(retryTimes int) error {
 		var tempResults []*message.PrCheckCmdResult
+		//the attempt done the most cmds is reported on failure, so the manager only compensates those
+		defer func() {
+			if len(tempResults) > len(results.Results) {
+				results.Results = tempResults
+			}
+		}()
 		for _, prCmd := range prCmds.Cmds {
+			//the remaining cmds are skipped once the manager cancels the batch
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			smslog.Infof("exec prCmd %v", *prCmd)
 			var result *message.PrCheckCmdResult
 			var err error
-			if h.nvmeExecWrapper != nil && utils.CheckNvmeVolumeStartWith3(prCmd.VolumeId) {
+			if prCmd.CmdType == message.PrQuery {
+				result, err = queryPrInfo(prCmd)
+			} else if h.nvmeExecWrapper != nil && utils.CheckNvmeVolumeStartWith3(prCmd.VolumeId) {
 				result, err = h.nvmeExecWrapper.Process(prCmd)
 			} else {
 				result, err = h.prExecWrapper.Process(prCmd)
@@ -113,12 +124,11 @@ func (h *BatchPrExecReqHandler) Handle(msg *message.SmsMessage) *message.SmsMess
 			}
 			tempResults = append(tempResults, result)
 		}
-		results.Results = tempResults
 		return nil
 	})
 
 	if err != nil {
-		return message.FailRespMessage(message.SmsMessageHead_CMD_PR_BATCH_RESP, msg.Head.MsgId, err.Error())
+		return failBatchRespMessage(msg.Head.MsgId, err.Error(), results)
 	}
 
 	contents, err := common.StructToBytes(results)
@@ -127,3 +137,12 @@ func (h *BatchPrExecReqHandler) Handle(msg *message.SmsMessage) *message.SmsMess
 	}
 	return message.SuccessRespMessage(message.SmsMessageHead_CMD_PR_BATCH_RESP, msg.Head.MsgId, contents)
 }
+
+//failBatchRespMessage carries the results of the cmds succeeded before the failure
+func failBatchRespMessage(ackMsgId, errMsg string, results *message.PrBatchCheckCmdResult) *message.SmsMessage {
+	resp := message.FailRespMessage(message.SmsMessageHead_CMD_PR_BATCH_RESP, ackMsgId, errMsg)
+	if contents, err := common.StructToBytes(results); err == nil {
+		resp.Body.Content = contents
+	}
+	return resp
+}
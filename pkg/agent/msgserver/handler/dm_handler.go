@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"polardb-sms/pkg/agent/device/devicemapper"
 	"polardb-sms/pkg/agent/device/dmhelper"
@@ -32,7 +33,7 @@ type DmCreateReqHandler struct {
 /*
    msg.Content: `{"dm_lines":"0 1048576 linear /dev/loop0 8  　\n    1048576 1048576 linear /dev/loop1 8"}`
 */
-func (h *DmCreateReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *DmCreateReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err       error
 		dmType    string
@@ -88,7 +89,7 @@ func (h *DmCreateReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage
 type DmExpandReqHandler struct {
 }
 
-func (h *DmExpandReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *DmExpandReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err       error
 		dmCommand message.DmExecCommand
@@ -124,7 +125,7 @@ func (h *DmExpandReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage
 type DmRemoveReqHandler struct {
 }
 
-func (h *DmRemoveReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *DmRemoveReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err       error
 		dmCommand message.DmExecCommand
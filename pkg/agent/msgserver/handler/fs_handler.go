@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -48,7 +49,7 @@ func unlock(volumeId string) {
 type FsExpandReqHandler struct {
 }
 
-func (h *FsExpandReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *FsExpandReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err           error
 		fs            filesystem.Filesystem
@@ -71,7 +72,7 @@ func (h *FsExpandReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage
 		return message.FailRespMessage(message.SmsMessageHead_CMD_EXPAND_FS_RESP, msg.Head.MsgId, fmt.Sprintf("not found filesystem type - (%s)", expandCommand.FsType))
 	}
 
-	if err = fs.ExpandFilesystem(expandCommand.VolumeId, expandCommand.ReqSize, expandCommand.OriginSize); err != nil {
+	if err = fs.ExpandFilesystem(ctx, expandCommand.VolumeId, expandCommand.ReqSize, expandCommand.OriginSize); err != nil {
 		return message.FailRespMessage(message.SmsMessageHead_CMD_EXPAND_FS_RESP, msg.Head.MsgId, err.Error())
 	}
 	return message.SuccessRespMessage(message.SmsMessageHead_CMD_EXPAND_FS_RESP, msg.Head.MsgId, nil)
@@ -80,7 +81,7 @@ func (h *FsExpandReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage
 type FsFormatReqHandler struct {
 }
 
-func (h *FsFormatReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *FsFormatReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err           error
 		fs            filesystem.Filesystem
@@ -104,7 +105,7 @@ func (h *FsFormatReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage
 		return message.FailRespMessage(message.SmsMessageHead_CMD_FORMAT_FS_RESP, msg.Head.MsgId, fmt.Sprintf("not found filesystem type - (%s)", formatCommand.FsType))
 	}
 
-	if err = fs.FormatFilesystem(formatCommand.VolumeId); err != nil {
+	if err = fs.FormatFilesystem(ctx, formatCommand.VolumeId); err != nil {
 		return message.FailRespMessage(message.SmsMessageHead_CMD_FORMAT_FS_RESP, msg.Head.MsgId, err.Error())
 	}
 	return message.SuccessRespMessage(message.SmsMessageHead_CMD_EXPAND_FS_RESP, msg.Head.MsgId, nil)
@@ -0,0 +1,29 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package handler
+
+import (
+	"context"
+	"polardb-sms/pkg/network/message"
+)
+
+//PingReqHandler answers the manager keepalive, the manager measures the rtt with it
+type PingReqHandler struct {
+}
+
+func (h *PingReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
+	return message.SuccessRespMessage(message.SmsMessageHead_DUMMY_RESP, msg.Head.MsgId, nil)
+}
@@ -16,8 +16,13 @@
 package handler
 
 import (
+	"context"
+	"fmt"
+	"polardb-sms/pkg/agent/device/dmhelper"
+	"polardb-sms/pkg/agent/device/reservation"
 	mpath "polardb-sms/pkg/agent/device/reservation/mpathpersist"
 	"polardb-sms/pkg/agent/device/reservation/nvme"
+	"polardb-sms/pkg/agent/device/reservation/sgio"
 	"polardb-sms/pkg/agent/utils"
 	"polardb-sms/pkg/common"
 	"polardb-sms/pkg/network/message"
@@ -27,6 +32,78 @@ type Processor interface {
 	Process(cmd *message.PrCmd) (*message.PrCheckCmdResult, error)
 }
 
+//newScsiPrExecWrapper returns the scsi pr cmd processor chosen for this node
+func newScsiPrExecWrapper() Processor {
+	if reservation.ScsiPrExecutor() == reservation.SgIoExecutor {
+		return sgio.NewPrExecWrapper()
+	}
+	return mpath.NewPrExecWrapper()
+}
+
+func newNvmeExecWrapper() Processor {
+	if reservation.NvmePrExecutor() == reservation.NvmeIoctlExecutor {
+		return nvme.NewNvmeIoctlExecWrapper()
+	}
+	return nvme.NewNvmeExecWrapper()
+}
+
+//queryPrInfo answers the PrQuery cmd with the pr executors chosen for this node
+func queryPrInfo(prCmd *message.PrCmd) (*message.PrCheckCmdResult, error) {
+	device, err := common.GetDevicePath(prCmd.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	var prInfo *mpath.PersistentReserve
+	if utils.CheckNvmeVolumeStartWith3(prCmd.VolumeId) {
+		prInfo, err = dmhelper.GetNvmePrInfo(device)
+	} else {
+		prInfo, err = dmhelper.GetScsiPrInfo(device)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message.PrCheckCmdResult{
+		CheckType:  prCmd.CmdType,
+		VolumeType: prCmd.VolumeType,
+		Name:       prCmd.VolumeId,
+		PrInfo: &message.PrQueryInfo{
+			Generation:      prInfo.Generation,
+			Keys:            prInfo.Keys,
+			ReservationKey:  prInfo.ReservationKey,
+			ReservationType: prInfo.ReservationType,
+		},
+	}, nil
+}
+
+//probePrCapability answers the PrCapability cmd, the sg io client is always used for it sends the cmds path by path
+func probePrCapability(prCmd *message.PrCmd) (*message.PrCheckCmdResult, error) {
+	if utils.CheckNvmeVolumeStartWith3(prCmd.VolumeId) {
+		return nil, fmt.Errorf("pr capability probe does not support the nvme volume %s", prCmd.VolumeId)
+	}
+	param, ok := prCmd.CmdParam.(*message.PrCapabilityCmdParam)
+	if !ok {
+		return nil, fmt.Errorf("invalid pr capability cmd param %v", prCmd.CmdParam)
+	}
+	key, err := sgio.ParsePrKey(param.RegisterKey)
+	if err != nil {
+		return nil, err
+	}
+	device, err := common.GetDevicePath(prCmd.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	capability, err := sgio.NewClient().ProbeCapabilities(device, key, byte(param.ReserveType), sgio.DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &message.PrCheckCmdResult{
+		CheckType:  prCmd.CmdType,
+		VolumeType: prCmd.VolumeType,
+		Name:       prCmd.VolumeId,
+		Capability: capability,
+	}, nil
+}
+
 type PrExecReqHandler struct {
 	nvmeExecWrapper  Processor
 	mpathExecWrapper Processor
@@ -34,12 +111,12 @@ type PrExecReqHandler struct {
 
 func NewPrExecReqHandler() *PrExecReqHandler {
 	return &PrExecReqHandler{
-		nvme.NewNvmeExecWrapper(),
-		mpath.NewPrExecWrapper(),
+		newNvmeExecWrapper(),
+		newScsiPrExecWrapper(),
 	}
 }
 
-func (h *PrExecReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *PrExecReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err    error
 		prCmd  = &message.PrCmd{}
@@ -50,7 +127,11 @@ func (h *PrExecReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
 		return message.FailRespMessage(message.SmsMessageHead_CMD_PR_EXEC_RESP, msg.Head.MsgId, err.Error())
 	}
 
-	if h.nvmeExecWrapper != nil && utils.CheckNvmeVolume(prCmd.VolumeId) {
+	if prCmd.CmdType == message.PrQuery {
+		result, err = queryPrInfo(prCmd)
+	} else if prCmd.CmdType == message.PrCapability {
+		result, err = probePrCapability(prCmd)
+	} else if h.nvmeExecWrapper != nil && utils.CheckNvmeVolume(prCmd.VolumeId) {
 		result, err = h.nvmeExecWrapper.Process(prCmd)
 	} else {
 		result, err = h.mpathExecWrapper.Process(prCmd)
@@ -16,12 +16,13 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"polardb-sms/pkg/agent/device/dmhelper"
 	"polardb-sms/pkg/agent/device/filesystem"
 	"polardb-sms/pkg/agent/device/reservation/mpathpersist"
-	"polardb-sms/pkg/agent/device/reservation/nvme"
 	"polardb-sms/pkg/agent/utils"
 	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
@@ -35,7 +36,7 @@ type PvcCreateHandler struct {
 
 func NewPvcCreateHandler(nodeIp string) ReqHandler {
 	return &PvcCreateHandler{
-		prExecProcessor: mpathpersist.NewPrExecWrapper(),
+		prExecProcessor: newScsiPrExecWrapper(),
 		nodeIp:          nodeIp,
 	}
 }
@@ -55,7 +56,7 @@ func cleanOldCsiMultipathConf(volumeId string) {
 	}
 }
 
-func (h *PvcCreateHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *PvcCreateHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err          error
 		pvcCreateCmd message.PvcCreateCommand
@@ -72,16 +73,20 @@ func (h *PvcCreateHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
 	defer unlock(pvcCreateCmd.VolumeId)
 
 	cleanOldCsiMultipathConf(pvcCreateCmd.VolumeId)
-	_ = ClearLunPrInfo(pvcCreateCmd.VolumeId, h.nodeIp, h.prExecProcessor)
+	prKey := pvcCreateCmd.PrKey
+	if prKey == "" {
+		prKey = common.IpV4ToPrKey(h.nodeIp)
+	}
+	_ = ClearLunPrInfo(pvcCreateCmd.VolumeId, prKey, h.prExecProcessor)
 	if pvcCreateCmd.Format {
 		switch pvcCreateCmd.FsType {
 		case common.Pfs:
-			err = filesystem.NewPfs().FormatFilesystem(pvcCreateCmd.VolumeId)
+			err = filesystem.NewPfs().FormatFilesystem(ctx, pvcCreateCmd.VolumeId)
 			if err != nil {
 				return message.FailRespMessage(message.SmsMessageHead_CMD_PVC_CREATE_RESP, ackMsgId, err.Error())
 			}
 		case common.Ext4:
-			err = filesystem.NewExt4().FormatFilesystem(pvcCreateCmd.VolumeId)
+			err = filesystem.NewExt4().FormatFilesystem(ctx, pvcCreateCmd.VolumeId)
 			if err != nil {
 				return message.FailRespMessage(message.SmsMessageHead_CMD_PVC_CREATE_RESP, ackMsgId, err.Error())
 			}
@@ -93,18 +98,20 @@ func (h *PvcCreateHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
 type PvcReleaseHandler struct {
 	prExecProcessor     Processor
 	nvmePRExecProcessor Processor
+	nodeId              string
 	nodeIp              string
 }
 
-func NewPvcReleaseHandler(nodeIp string) ReqHandler {
+func NewPvcReleaseHandler(nodeId, nodeIp string) ReqHandler {
 	return &PvcReleaseHandler{
-		prExecProcessor:     mpathpersist.NewPrExecWrapper(),
-		nvmePRExecProcessor: nvme.NewNvmeExecWrapper(),
+		prExecProcessor:     newScsiPrExecWrapper(),
+		nvmePRExecProcessor: newNvmeExecWrapper(),
+		nodeId:              nodeId,
 		nodeIp:              nodeIp,
 	}
 }
 
-func (h *PvcReleaseHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *PvcReleaseHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err           error
 		ackMsgId      = msg.Head.MsgId
@@ -122,7 +129,7 @@ func (h *PvcReleaseHandler) Handle(msg *message.SmsMessage) *message.SmsMessage
 	defer unlock(pvcReleaseCmd.VolumeId)
 
 	cleanOldCsiMultipathConf(pvcReleaseCmd.VolumeId)
-	if err = h.cleanLunPrInfo(pvcReleaseCmd.VolumeId); err != nil {
+	if err = h.cleanLunPrInfo(pvcReleaseCmd.VolumeId, h.prKey(&pvcReleaseCmd)); err != nil {
 		smslog.Infof("cleanLunPrInfo err %s", err.Error())
 		return message.FailRespMessage(message.SmsMessageHead_CMD_PVC_RELEASE_RESP,
 			ackMsgId, err.Error())
@@ -146,15 +153,23 @@ func (h *PvcReleaseHandler) cleanSoftLinkPoint(pvName string) error {
 	return nil
 }
 
-func (h *PvcReleaseHandler) cleanLunPrInfo(volumeId string) error {
+//prKey is the key the manager allocated to this node, or the ip derived key for the old managers
+func (h *PvcReleaseHandler) prKey(cmd *message.PvcReleaseCommand) string {
+	if key, ok := cmd.PrKeys[h.nodeId]; ok && key != "" {
+		return key
+	}
+	return common.IpV4ToPrKey(h.nodeIp)
+}
+
+func (h *PvcReleaseHandler) cleanLunPrInfo(volumeId, prKey string) error {
 	if h.nvmePRExecProcessor != nil && utils.CheckNvmeVolumeStartWith3(volumeId) {
-		return ClearLunPrInfo(volumeId, h.nodeIp, h.nvmePRExecProcessor)
+		return ClearLunPrInfo(volumeId, prKey, h.nvmePRExecProcessor)
 	} else {
-		return ClearLunPrInfo(volumeId, h.nodeIp, h.prExecProcessor)
+		return ClearLunPrInfo(volumeId, prKey, h.prExecProcessor)
 	}
 }
 
-func ClearLunPrInfo(volumeId, nodeIp string, processor Processor) error {
+func ClearLunPrInfo(volumeId, thisNodePrKey string, processor Processor) error {
 	device, err := common.GetDevicePath(volumeId)
 	if err != nil {
 		if common.PathNotFoundError(err) {
@@ -165,9 +180,9 @@ func ClearLunPrInfo(volumeId, nodeIp string, processor Processor) error {
 	}
 	var prInfo *mpathpersist.PersistentReserve
 	if utils.CheckNvmeVolumeStartWith3(volumeId) {
-		prInfo, err = nvme.GetPrInfo(device)
+		prInfo, err = dmhelper.GetNvmePrInfo(device)
 	} else {
-		prInfo, err = mpathpersist.GetPrInfo(device)
+		prInfo, err = dmhelper.GetScsiPrInfo(device)
 	}
 	if err != nil {
 		smslog.Errorf("cleanLunPrInfo: failed for get device %s pr info %s", device, err.Error())
@@ -179,10 +194,9 @@ func ClearLunPrInfo(volumeId, nodeIp string, processor Processor) error {
 		return nil
 	}
 
-	thisNodePrKey := common.IpV4ToPrKey(nodeIp)
 	var alreadyRegistered = false
 	for key, _ := range prInfo.Keys {
-		if key == thisNodePrKey {
+		if common.NormalizePrKey(key) == common.NormalizePrKey(thisNodePrKey) {
 			alreadyRegistered = true
 			break
 		}
@@ -16,20 +16,37 @@
 package handler
 
 import (
+	"context"
 	"fmt"
+	"google.golang.org/protobuf/proto"
+	"polardb-sms/pkg/agent/meta"
+	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/network/message"
+	"sync"
+	"time"
 )
 
 type ReqHandler interface {
-	Handle(msg *message.SmsMessage) *message.SmsMessage
+	Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage
 }
 
 type ReqMsgHandlerService interface {
 	Process(msg *message.SmsMessage) (*message.SmsMessage, error)
+	//Cancel aborts the processing of msgId, false if it is not running
+	Cancel(msgId string) bool
 }
 
 type ReqMsgHandleServiceImpl struct {
 	handlers map[message.SmsMessageHead_SmsMsgType]ReqHandler
+	//journal is nil if the responses are not kept
+	journal meta.MsgJournal
+	lock    sync.Mutex
+	running map[string]*runningMsg
+}
+
+type runningMsg struct {
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func (s *ReqMsgHandleServiceImpl) Register(msgType message.SmsMessageHead_SmsMsgType, handler ReqHandler) {
@@ -41,7 +58,98 @@ func (s *ReqMsgHandleServiceImpl) Process(msg *message.SmsMessage) (*message.Sms
 	if !ok {
 		return nil, fmt.Errorf("can not find the handler for msg %v", msg)
 	}
-	return handler.Handle(msg), nil
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if deadline, ok := message.Deadline(msg.Head, time.Now()); ok {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, deadline)
+		defer cancelDeadline()
+	}
+	msgId := msg.Head.MsgId
+	var r *runningMsg
+	for r == nil {
+		if resp := s.journaled(msg); resp != nil {
+			smslog.WithContext(msg.Head.TraceContext).Infof("msg %s is processed already, reply the journaled response", msgId)
+			return resp, nil
+		}
+		s.lock.Lock()
+		origin, ok := s.running[msgId]
+		if !ok {
+			r = &runningMsg{cancel: cancel, done: make(chan struct{})}
+			s.running[msgId] = r
+		}
+		s.lock.Unlock()
+		if ok {
+			//the re-delivered msg waits for the original one instead of running twice
+			smslog.WithContext(msg.Head.TraceContext).Infof("msg %s is running, wait for it", msgId)
+			select {
+			case <-origin.done:
+			case <-ctx.Done():
+				return nil, fmt.Errorf("msg %s is still running: %v", msgId, ctx.Err())
+			}
+		}
+	}
+	defer func() {
+		s.lock.Lock()
+		delete(s.running, msgId)
+		s.lock.Unlock()
+		close(r.done)
+	}()
+	resp := handler.Handle(ctx, msg)
+	s.record(msg, resp)
+	return resp, nil
+}
+
+func journalable(msg *message.SmsMessage) bool {
+	//the ping is never re-delivered
+	return msg.Head.MsgType != message.SmsMessageHead_DUMMY_REQ
+}
+
+func (s *ReqMsgHandleServiceImpl) journaled(msg *message.SmsMessage) *message.SmsMessage {
+	if s.journal == nil || !journalable(msg) {
+		return nil
+	}
+	data, err := s.journal.Get(msg.Head.MsgId)
+	if err != nil {
+		smslog.WithContext(msg.Head.TraceContext).Errorf("failed to get the journal of msg %s: %v", msg.Head.MsgId, err)
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	resp := &message.SmsMessage{}
+	if err = proto.Unmarshal(data, resp); err != nil {
+		smslog.WithContext(msg.Head.TraceContext).Errorf("failed to parse the journal of msg %s: %v", msg.Head.MsgId, err)
+		return nil
+	}
+	return resp
+}
+
+//record only keeps the success, a failed msg is run again when it is re-delivered
+func (s *ReqMsgHandleServiceImpl) record(msg, resp *message.SmsMessage) {
+	if s.journal == nil || !journalable(msg) || resp == nil || !resp.Body.IsSuccess() {
+		return
+	}
+	data, err := proto.Marshal(resp)
+	if err == nil {
+		err = s.journal.Put(msg.Head.MsgId, data)
+	}
+	if err != nil {
+		smslog.WithContext(msg.Head.TraceContext).Errorf("failed to journal msg %s: %v", msg.Head.MsgId, err)
+	}
+}
+
+func (s *ReqMsgHandleServiceImpl) Cancel(msgId string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r, ok := s.running[msgId]
+	if !ok {
+		return false
+	}
+	smslog.Infof("cancel the processing of msg %s", msgId)
+	//keep it running until the handler returns, so a re-delivered msg still waits for it
+	r.cancel()
+	return true
 }
 
 /*
@@ -56,9 +164,10 @@ func (s *ReqMsgHandleServiceImpl) Process(msg *message.SmsMessage) (*message.Sms
 	SmsMessageHead_CMD_LUN_CREATE_REQ  SmsMessageHead_SmsMsgType = 600
 	SmsMessageHead_CMD_LUN_EXPAND_REQ  SmsMessageHead_SmsMsgType = 700
 */
-func NewReqMsgHandlerService(nodeIp string) ReqMsgHandlerService {
-	service := &ReqMsgHandleServiceImpl{
-		make(map[message.SmsMessageHead_SmsMsgType]ReqHandler),
+func NewReqMsgHandlerService(nodeId, nodeIp string) ReqMsgHandlerService {
+	service := newReqMsgHandleService(nil)
+	if journal := meta.GetMsgJournal(); journal != nil {
+		service.journal = journal
 	}
 	//TODO fixme
 	service.Register(message.SmsMessageHead_CMD_PR_EXEC_REQ, NewPrExecReqHandler())
@@ -70,6 +179,15 @@ func NewReqMsgHandlerService(nodeIp string) ReqMsgHandlerService {
 	service.Register(message.SmsMessageHead_CMD_EXPAND_FS_REQ, &FsExpandReqHandler{})
 	service.Register(message.SmsMessageHead_CMD_FORMAT_FS_REQ, &FsFormatReqHandler{})
 	service.Register(message.SmsMessageHead_CMD_PVC_CREATE_REQ, NewPvcCreateHandler(nodeIp))
-	service.Register(message.SmsMessageHead_CMD_PVC_RELEASE_REQ, NewPvcReleaseHandler(nodeIp))
+	service.Register(message.SmsMessageHead_CMD_PVC_RELEASE_REQ, NewPvcReleaseHandler(nodeId, nodeIp))
+	service.Register(message.SmsMessageHead_DUMMY_REQ, &PingReqHandler{})
 	return service
 }
+
+func newReqMsgHandleService(journal meta.MsgJournal) *ReqMsgHandleServiceImpl {
+	return &ReqMsgHandleServiceImpl{
+		handlers: make(map[message.SmsMessageHead_SmsMsgType]ReqHandler),
+		journal:  journal,
+		running:  make(map[string]*runningMsg),
+	}
+}
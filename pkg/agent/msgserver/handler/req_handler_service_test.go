@@ -0,0 +1,125 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package handler
+
+import (
+	"context"
+	"polardb-sms/pkg/agent/meta"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network/message"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+type blockingReqHandler struct {
+	started chan struct{}
+}
+
+func (h *blockingReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
+	close(h.started)
+	<-ctx.Done()
+	return message.FailRespMessage(message.SmsMessageHead_DUMMY_RESP, msg.Head.MsgId, ctx.Err().Error())
+}
+
+func TestReqMsgHandleServiceCancel(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	testCase := assert.New(t)
+	service := newReqMsgHandleService(nil)
+	h := &blockingReqHandler{started: make(chan struct{})}
+	service.Register(message.SmsMessageHead_DUMMY_REQ, h)
+
+	msg := message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_DUMMY_REQ).Build()
+	done := make(chan *message.SmsMessage)
+	go func() {
+		resp, _ := service.Process(msg)
+		done <- resp
+	}()
+	<-h.started
+	testCase.True(service.Cancel(msg.Head.MsgId))
+	resp := <-done
+	testCase.Equal(context.Canceled.Error(), resp.Body.ErrMsg)
+	testCase.False(service.Cancel(msg.Head.MsgId))
+
+	//the timeout in the head bounds the processing
+	h = &blockingReqHandler{started: make(chan struct{})}
+	service.Register(message.SmsMessageHead_DUMMY_REQ, h)
+	msg = message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_DUMMY_REQ).Build()
+	message.SetTimeout(msg.Head, 50*time.Millisecond)
+	resp, err := service.Process(msg)
+	testCase.NoError(err)
+	testCase.Equal(context.DeadlineExceeded.Error(), resp.Body.ErrMsg)
+}
+
+type countingReqHandler struct {
+	count   int32
+	release chan struct{}
+}
+
+func (h *countingReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
+	atomic.AddInt32(&h.count, 1)
+	<-h.release
+	return message.SuccessRespMessage(message.SmsMessageHead_CMD_DM_CREAT_RESP, msg.Head.MsgId, []byte("created"))
+}
+
+func TestReqMsgHandleServiceJournal(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	testCase := assert.New(t)
+	store, err := meta.NewDBStore(t.TempDir() + "/")
+	testCase.NoError(err)
+	defer store.Close()
+	journal := meta.NewDBJournal(store.DB)
+	service := newReqMsgHandleService(journal)
+	h := &countingReqHandler{release: make(chan struct{})}
+	service.Register(message.SmsMessageHead_CMD_DM_CREAT_REQ, h)
+
+	msg := message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_CMD_DM_CREAT_REQ).Build()
+	//the re-delivered msg waits for the running one
+	done := make(chan *message.SmsMessage, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, _ := service.Process(msg)
+			done <- resp
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(h.release)
+	first, second := <-done, <-done
+	testCase.Equal(int32(1), atomic.LoadInt32(&h.count))
+	testCase.Equal(first.Head.MsgId, second.Head.MsgId)
+	testCase.Equal([]byte("created"), second.Body.Content)
+
+	//the journaled msg is not run again
+	resp, err := service.Process(msg)
+	testCase.NoError(err)
+	testCase.Equal(first.Head.MsgId, resp.Head.MsgId)
+	testCase.Equal(int32(1), atomic.LoadInt32(&h.count))
+
+	//the journal bucket is not a dm table
+	records, err := store.List()
+	testCase.NoError(err)
+	testCase.Empty(records)
+
+	n, err := journal.Expire(time.Now())
+	testCase.NoError(err)
+	testCase.Equal(1, n)
+	_, err = service.Process(msg)
+	testCase.NoError(err)
+	testCase.Equal(int32(2), atomic.LoadInt32(&h.count))
+}
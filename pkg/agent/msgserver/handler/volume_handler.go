@@ -16,6 +16,7 @@
 package handler
 
 import (
+	"context"
 	"polardb-sms/pkg/agent/device/devicemapper"
 	"polardb-sms/pkg/network/message"
 )
@@ -29,7 +30,7 @@ type ScsiReqHandler struct {
   Rescan Specific SCSI Device
   ## echo 1 > /sys/block/$DEVICE/device/rescan
 */
-func (h *ScsiReqHandler) Handle(msg *message.SmsMessage) *message.SmsMessage {
+func (h *ScsiReqHandler) Handle(ctx context.Context, msg *message.SmsMessage) *message.SmsMessage {
 	var (
 		err error
 		dm  = devicemapper.GetDeviceMapper()
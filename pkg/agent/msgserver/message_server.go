@@ -16,14 +16,16 @@
 package msgserver
 
 import (
-	"bufio"
 	"io"
 	"math/rand"
 	"net"
 	"polardb-sms/pkg/agent/msgserver/handler"
+	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/network"
+	"polardb-sms/pkg/network/message"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,25 +36,47 @@ type MessageServer struct {
 	nodeIp     string
 	port       string
 	clients    map[string]*network.SmsConnection
+	lock       sync.Mutex
 	msgService handler.ReqMsgHandlerService
 	listener   net.Listener
+	//reloader is nil for the plain tcp
+	reloader *network.CertReloader
+	//whiteIPs are the networks the manager may connect from
+	whiteIPs []*net.IPNet
 }
 
-func NewMessageServer(nodeId, nodeIp, port string) *MessageServer {
+func NewMessageServer(nodeId, nodeIp, port string, reloader *network.CertReloader, whiteIPs []*net.IPNet) *MessageServer {
 	server = &MessageServer{
 		nodeId:     nodeId,
 		nodeIp:     nodeIp,
 		port:       port,
 		clients:    make(map[string]*network.SmsConnection, 0),
-		msgService: handler.NewReqMsgHandlerService(nodeIp),
+		msgService: handler.NewReqMsgHandlerService(nodeId, nodeIp),
+		reloader:   reloader,
+		whiteIPs:   whiteIPs,
 	}
 	return server
 }
 
+func (s *MessageServer) allowed(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, item := range s.whiteIPs {
+		if item.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
 func PickOneClientIp() string {
 	if server == nil {
 		return ""
 	}
+	server.lock.Lock()
+	defer server.lock.Unlock()
 	if len(server.clients) == 0 {
 		return ""
 	}
@@ -71,7 +95,7 @@ func PickOneClientIp() string {
 func (s *MessageServer) Run() {
 	defer smslog.LogPanic()
 	for {
-		l, err := net.Listen("tcp", s.nodeIp+":"+s.port)
+		l, err := network.Listen(s.nodeIp+":"+s.port, s.reloader)
 		if err != nil {
 			smslog.Error("error when listen:  " + err.Error())
 			time.Sleep(2 * time.Second)
@@ -80,37 +104,50 @@ func (s *MessageServer) Run() {
 		s.listener = l
 		break
 	}
-	smslog.Infof("Agent server %s:%s starting...", s.nodeIp, s.port)
+	smslog.Infof("Agent server %s:%s starting, tls %v...", s.nodeIp, s.port, s.reloader != nil)
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
 			smslog.Errorf("fatal error when listen %s", err.Error())
 			continue
 		}
-		clientAddr := conn.RemoteAddr().String()
-		existConn, ok := s.clients[clientAddr]
-		if ok && existConn != nil {
-			smslog.Debugf("Close exist connection %v", existConn)
-			existConn.Close()
-		}
-		s.clients[clientAddr] = &network.SmsConnection{
-			Conn: conn,
-			Receiver: &network.SmsMessageReceiver{
-				Reader: bufio.NewReader(conn),
-			},
-			Sender: &network.SmsMessageSender{
-				Writer: bufio.NewWriter(conn),
-			},
-		}
-		go s.receiveAndHandleMessage(s.clients[clientAddr])
-		smslog.Infof("accept connection from request %s", clientAddr)
+		go s.accept(conn)
+	}
+}
+
+//accept rejects the peer out of the white ips or failing the mutual tls handshake, the dangerous cmds are never read from it
+func (s *MessageServer) accept(conn net.Conn) {
+	defer smslog.LogPanic()
+	clientAddr := conn.RemoteAddr().String()
+	if !s.allowed(conn.RemoteAddr()) {
+		smslog.Errorf("reject connection from %s not in white ip list", clientAddr)
+		_ = conn.Close()
+		return
+	}
+	if err := network.Handshake(conn); err != nil {
+		smslog.Errorf("reject unauthenticated connection from %s: %v", clientAddr, err)
+		_ = conn.Close()
+		return
 	}
+	s.lock.Lock()
+	existConn, ok := s.clients[clientAddr]
+	if ok && existConn != nil {
+		smslog.Debugf("Close exist connection %v", existConn)
+		existConn.Close()
+	}
+	smsConn := network.NewSmsConnection(conn)
+	s.clients[clientAddr] = smsConn
+	s.lock.Unlock()
+	go s.receiveAndHandleMessage(smsConn)
+	smslog.Infof("accept connection from request %s", clientAddr)
 }
 
 func (s *MessageServer) Shutdown() {
+	s.lock.Lock()
 	for _, conn := range s.clients {
 		_ = conn.Conn.Close()
 	}
+	s.lock.Unlock()
 	err := s.listener.Close()
 	if err != nil {
 		smslog.Fatal("Server forced to shutdown:", err)
@@ -119,7 +156,18 @@ func (s *MessageServer) Shutdown() {
 	smslog.Infof("Server exiting")
 }
 
-//单线程模式
+//cancel is not answered, the manager already dropped the request
+func (s *MessageServer) cancel(msg *message.SmsMessage) {
+	var cancelCmd message.CancelCommand
+	if err := common.BytesToStruct(msg.Body.Content, &cancelCmd); err != nil {
+		smslog.WithContext(msg.Head.TraceContext).Errorf("failed to parse cancel msg %s: %v", msg.Head.MsgId, err)
+		return
+	}
+	if !s.msgService.Cancel(cancelCmd.MsgId) {
+		smslog.WithContext(msg.Head.TraceContext).Infof("msg %s to cancel is not running", cancelCmd.MsgId)
+	}
+}
+
 func (s *MessageServer) receiveAndHandleMessage(conn *network.SmsConnection) {
 	defer smslog.LogPanic()
 	for {
@@ -127,13 +175,19 @@ func (s *MessageServer) receiveAndHandleMessage(conn *network.SmsConnection) {
 		if err != nil {
 			if err == io.EOF {
 				smslog.Errorf("conn %v is closed, received message err: %v", conn.Conn.RemoteAddr().String(), err)
+				s.lock.Lock()
 				delete(s.clients, conn.Conn.RemoteAddr().String())
+				s.lock.Unlock()
 				break
 			}
 			smslog.Errorf("received message err: %v", err)
 			continue
 		}
 		smslog.Infof("received message: [%v]", msg)
+		if msg.Head.MsgType == message.SmsMessageHead_CMD_CANCEL_REQ {
+			s.cancel(msg)
+			continue
+		}
 		go func() {
 			defer smslog.LogPanic()
 			result, err := s.msgService.Process(msg)
@@ -54,6 +54,8 @@ type EventReporterConfig struct {
 	ReportPort string
 	Address    string
 	WhiteIPs   []*net.IPNet
+	//DisableUdevEvent stops watching the paths of the multipath devices
+	DisableUdevEvent bool
 }
 type EventReporter interface {
 	Report(event *protocol.Event) error
@@ -88,6 +90,9 @@ func (s *EventReporterServer) Run(stopCh <-chan struct{}) {
 
 	go s.DeltaReportLoop(stopCh)
 	go s.Heartbeat(stopCh)
+	if !s.cfg.DisableUdevEvent {
+		go NewPathWatcher(s.reporter, s.cfg.NodeId, s.cfg.NodeIp).Run(stopCh, deviceMap)
+	}
 
 	<-stopCh
 	smslog.Infof("Shutting down Agent Server")
@@ -37,8 +37,34 @@ type LunTransformer struct {
 }
 
 func (t *LunTransformer) Transform(d *device.DmDevice, eventType protocol.EventType) interface{} {
+	lun := t.lun(d)
+	body, err := json.Marshal(lun)
+	if err != nil {
+		smslog.Errorf("event lun - (%s) marshal body %v: %v", device.Multipath, lun, err)
+		return nil
+	}
+	return protocol.NewEvent(string(body), eventType)
+}
+
+//TransformSubPath returns the LunSubPathAdd or LunSubPathRemove event of the path
+func (t *LunTransformer) TransformSubPath(d *device.DmDevice, subPath string, eventType protocol.EventType) *protocol.Event {
+	var event interface{}
+	if eventType == protocol.LunSubPathAdd {
+		event = &protocol.LunSubPathAddEvent{Lun: *t.lun(d), SubPath: subPath}
+	} else {
+		event = &protocol.LunSubPathRemoveEvent{Lun: *t.lun(d), SubPath: subPath}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		smslog.Errorf("event lun sub path - (%s) marshal body %v: %v", device.Multipath, event, err)
+		return nil
+	}
+	return protocol.NewEvent(string(body), eventType)
+}
+
+func (t *LunTransformer) lun(d *device.DmDevice) *protocol.Lun {
 	mt := d.DmTarget.(*device.MultipathDeviceTarget)
-	lun := &protocol.Lun{
+	return &protocol.Lun{
 		Name:         mt.Name,
 		VolumeId:     mt.Wwid,
 		Paths:        mt.Paths,
@@ -56,12 +82,6 @@ func (t *LunTransformer) Transform(d *device.DmDevice, eventType protocol.EventT
 		Product:      mt.Product,
 		SerialNumber: d.SerialNumber,
 	}
-	body, err := json.Marshal(lun)
-	if err != nil {
-		smslog.Errorf("event lun - (%s) marshal body %v: %v", device.Multipath, lun, err)
-		return nil
-	}
-	return protocol.NewEvent(string(body), eventType)
 }
 
 type StripLvTransformer struct {
@@ -0,0 +1,156 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"sort"
+	"time"
+
+	"polardb-sms/pkg/agent/device/dmhelper"
+	"polardb-sms/pkg/device"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/protocol"
+)
+
+//PathSettleDelay is waited after the last path uevent, for multipathd reloads the map after the disk uevent
+const PathSettleDelay = 5 * time.Second
+
+//PathWatcher reports the paths added to or removed from the multipath devices,
+//by comparing the paths before and after the uevents
+type PathWatcher struct {
+	reporter    EventReporter
+	transformer *LunTransformer
+	query       func() (map[string]*device.DmDevice, error)
+	snapshot    map[string]*device.DmDevice
+}
+
+func NewPathWatcher(reporter EventReporter, nodeId, nodeIp string) *PathWatcher {
+	return &PathWatcher{
+		reporter:    reporter,
+		transformer: getLunTransformer(nodeId, nodeIp).(*LunTransformer),
+		query:       dmhelper.QueryDMDevices,
+	}
+}
+
+func (w *PathWatcher) Run(stopCh <-chan struct{}, devices map[string]*device.DmDevice) {
+	smslog.Infof("path watcher starting")
+	defer smslog.LogPanic()
+	events, err := ListenUEvents(stopCh)
+	if err != nil {
+		smslog.Errorf("path watcher can not listen uevents: %s", err.Error())
+		return
+	}
+	w.snapshot = multipathDevices(devices)
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-stopCh:
+			smslog.Infof("path watcher stopped")
+			return
+		case e, ok := <-events:
+			if !ok {
+				smslog.Infof("path watcher uevent channel closed")
+				return
+			}
+			if e.IsPathEvent() {
+				smslog.Infof("path uevent %s %s", e.Action, e.DevName)
+				settle = time.After(PathSettleDelay)
+			}
+		case <-settle:
+			settle = nil
+			w.rescan()
+		}
+	}
+}
+
+func (w *PathWatcher) rescan() {
+	devices, err := w.query()
+	if err != nil {
+		smslog.Errorf("path watcher failed to query dm devices: %s", err.Error())
+		return
+	}
+	current := multipathDevices(devices)
+	for _, event := range w.diffPaths(w.snapshot, current) {
+		if err := w.reporter.Report(event); err != nil {
+			smslog.Errorf("report path event %v err %s", event, err.Error())
+		}
+	}
+	w.snapshot = current
+}
+
+//diffPaths returns the sub path events of the multipath devices existing both before and after,
+//the devices added or removed are left to the lun events
+func (w *PathWatcher) diffPaths(before, after map[string]*device.DmDevice) []*protocol.Event {
+	names := make([]string, 0, len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	events := make([]*protocol.Event, 0)
+	for _, name := range names {
+		old, ok := before[name]
+		if !ok {
+			continue
+		}
+		d := after[name]
+		oldPaths, newPaths := pathsOf(old), pathsOf(d)
+		for _, path := range subtract(newPaths, oldPaths) {
+			smslog.Infof("path %s is added to %s", path, name)
+			if event := w.transformer.TransformSubPath(d, path, protocol.LunSubPathAdd); event != nil {
+				events = append(events, event)
+			}
+		}
+		for _, path := range subtract(oldPaths, newPaths) {
+			smslog.Infof("path %s is removed from %s", path, name)
+			if event := w.transformer.TransformSubPath(d, path, protocol.LunSubPathRemove); event != nil {
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+func multipathDevices(devices map[string]*device.DmDevice) map[string]*device.DmDevice {
+	ret := make(map[string]*device.DmDevice)
+	for name, d := range devices {
+		if d.DeviceType != device.Multipath {
+			continue
+		}
+		if _, ok := d.DmTarget.(*device.MultipathDeviceTarget); ok {
+			ret[name] = d
+		}
+	}
+	return ret
+}
+
+func pathsOf(d *device.DmDevice) []string {
+	return d.DmTarget.(*device.MultipathDeviceTarget).Paths
+}
+
+//subtract returns the items of a not in b
+func subtract(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, item := range b {
+		in[item] = true
+	}
+	ret := make([]string, 0)
+	for _, item := range a {
+		if !in[item] {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,85 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"polardb-sms/pkg/device"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/protocol"
+)
+
+func TestParseUEvent(t *testing.T) {
+	e, err := ParseUEvent([]byte("add@/devices/platform/host3/block/sdc\x00ACTION=add\x00DEVPATH=/devices/platform/host3/block/sdc\x00" +
+		"SUBSYSTEM=block\x00DEVNAME=sdc\x00DEVTYPE=disk\x00SEQNUM=4321\x00"))
+	assert.NoError(t, err)
+	assert.Equal(t, "add", e.Action)
+	assert.Equal(t, "sdc", e.DevName)
+	assert.Equal(t, "4321", e.Env["SEQNUM"])
+	assert.True(t, e.IsPathEvent())
+
+	e, err = ParseUEvent([]byte("add@/devices/platform/host3/block/sdc/sdc1\x00ACTION=add\x00SUBSYSTEM=block\x00DEVNAME=sdc1\x00DEVTYPE=partition\x00"))
+	assert.NoError(t, err)
+	assert.False(t, e.IsPathEvent())
+
+	e, err = ParseUEvent([]byte("change@/devices/virtual/block/dm-3\x00ACTION=change\x00SUBSYSTEM=block\x00DEVNAME=dm-3\x00DEVTYPE=disk\x00"))
+	assert.NoError(t, err)
+	assert.True(t, e.IsPathEvent())
+
+	_, err = ParseUEvent([]byte("libudev\x00\xfe\xed\xca\xfe"))
+	assert.Error(t, err)
+}
+
+func TestDiffPaths(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	mpath := func(name string, paths ...string) *device.DmDevice {
+		return &device.DmDevice{
+			Name:       name,
+			DeviceType: device.Multipath,
+			DmTarget:   &device.MultipathDeviceTarget{Name: name, Wwid: name, Paths: paths, PathNum: len(paths)},
+		}
+	}
+	w := &PathWatcher{transformer: &LunTransformer{NodeInfo{nodeId: "node1", nodeIp: "10.0.0.1"}}}
+	before := map[string]*device.DmDevice{
+		"36e0001": mpath("36e0001", "sdb", "sdc"),
+		"36e0002": mpath("36e0002", "sdd"),
+	}
+	after := map[string]*device.DmDevice{
+		"36e0001": mpath("36e0001", "sdc", "sde"),
+		"36e0002": mpath("36e0002", "sdd"),
+		"36e0003": mpath("36e0003", "sdf"),
+	}
+	events := w.diffPaths(before, after)
+	assert.Len(t, events, 2)
+
+	assert.Equal(t, protocol.LunSubPathAdd, events[0].EventType)
+	added := protocol.LunSubPathAddEvent{}
+	assert.NoError(t, protocol.Decode(events[0].Body, &added))
+	assert.Equal(t, "sde", added.SubPath)
+	assert.Equal(t, "36e0001", added.VolumeId)
+	assert.Equal(t, "node1", added.NodeId)
+	assert.Equal(t, []string{"sdc", "sde"}, added.Paths)
+
+	assert.Equal(t, protocol.LunSubPathRemove, events[1].EventType)
+	removed := protocol.LunSubPathRemoveEvent{}
+	assert.NoError(t, protocol.Decode(events[1].Body, &removed))
+	assert.Equal(t, "sdb", removed.SubPath)
+
+	assert.Empty(t, w.diffPaths(after, after))
+}
@@ -0,0 +1,72 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+//UEvent is the kernel uevent received from the netlink socket
+type UEvent struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	DevName   string
+	DevType   string
+	Env       map[string]string
+}
+
+//ParseUEvent parses the kernel uevent message "action@devpath\0KEY=VALUE\0...",
+//the messages of udevd starting with "libudev" are not supported
+func ParseUEvent(msg []byte) (*UEvent, error) {
+	fields := bytes.Split(msg, []byte{0})
+	header := strings.SplitN(string(fields[0]), "@", 2)
+	if len(header) != 2 {
+		return nil, fmt.Errorf("invalid uevent header %q", fields[0])
+	}
+	e := &UEvent{
+		Action:  header[0],
+		DevPath: header[1],
+		Env:     make(map[string]string),
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(string(field), "=", 2)
+		if len(kv) == 2 {
+			e.Env[kv[0]] = kv[1]
+		}
+	}
+	e.Subsystem = e.Env["SUBSYSTEM"]
+	e.DevName = e.Env["DEVNAME"]
+	e.DevType = e.Env["DEVTYPE"]
+	return e, nil
+}
+
+//IsPathEvent returns whether a scsi or nvme disk is added or removed, or a dm device is changed,
+//as multipathd reloads the map after the path is added or removed
+func (e *UEvent) IsPathEvent() bool {
+	if e.Subsystem != "block" || e.DevType != "disk" {
+		return false
+	}
+	switch e.Action {
+	case "add", "remove":
+		return strings.HasPrefix(e.DevName, "sd") || strings.HasPrefix(e.DevName, "nvme")
+	case "change":
+		return strings.HasPrefix(e.DevName, "dm-")
+	}
+	return false
+}
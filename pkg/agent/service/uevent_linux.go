@@ -0,0 +1,84 @@
+//go:build linux
+// +build linux
+
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"syscall"
+	"time"
+
+	smslog "polardb-sms/pkg/log"
+)
+
+const (
+	kernelEventGroup    = 1
+	uEventBufferSize    = 64 * 1024
+	uEventReadTimeout   = time.Second
+	uEventChannelLength = 100
+)
+
+//ListenUEvents receives the kernel uevents until stopCh is closed
+func ListenUEvents(stopCh <-chan struct{}) (<-chan *UEvent, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: kernelEventGroup}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	//the blocked read is not woken up by closing the fd, so it times out to check stopCh
+	tv := syscall.NsecToTimeval(uEventReadTimeout.Nanoseconds())
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	events := make(chan *UEvent, uEventChannelLength)
+	go func() {
+		defer smslog.LogPanic()
+		defer syscall.Close(fd)
+		defer close(events)
+		buf := make([]byte, uEventBufferSize)
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EAGAIN || err == syscall.EINTR {
+					continue
+				}
+				smslog.Errorf("receive uevent err %s, stop listening", err.Error())
+				return
+			}
+			e, err := ParseUEvent(buf[:n])
+			if err != nil {
+				smslog.Debugf("ignore uevent: %s", err.Error())
+				continue
+			}
+			select {
+			case events <- e:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -36,7 +36,12 @@ const (
 )
 
 func ExecCommand(args string, timeout time.Duration) (string, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return ExecCommandContext(context.Background(), args, timeout)
+}
+
+//ExecCommandContext kills the command once ctx is done, e.g. the request is cancelled by the manager
+func ExecCommandContext(ctx context.Context, args string, timeout time.Duration) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	return execPriorityCommand(ctx, args, CmdDefaultPriority)
 }
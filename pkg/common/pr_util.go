@@ -16,7 +16,9 @@
 package common
 
 import (
+	"fmt"
 	"net"
+	"strconv"
 	"strings"
 )
 
@@ -52,3 +54,12 @@ func PrKeyToIpV4(hexStr string) string {
 	}
 	return net.IPv4(s[0], s[1], s[2], s[3]).String()
 }
+
+//NormalizePrKey drops the leading zeros to compare the keys formatted by the different executors
+func NormalizePrKey(key string) string {
+	value, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(key), "0x"), 16, 64)
+	if err != nil {
+		return key
+	}
+	return fmt.Sprintf("%#x", value)
+}
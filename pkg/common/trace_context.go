@@ -25,6 +25,18 @@ func (c TraceContext) String() string {
 	return string(bytes)
 }
 
+//Copy returns a new context with the same values, the message built with it writes its ids into the copy
+func (c TraceContext) Copy() TraceContext {
+	if c == nil {
+		return nil
+	}
+	ret := make(TraceContext, len(c))
+	for k, v := range c {
+		ret[k] = v
+	}
+	return ret
+}
+
 func NewTraceContext(value map[string]string) TraceContext {
 	return value
 }
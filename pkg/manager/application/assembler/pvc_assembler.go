@@ -23,6 +23,7 @@ import (
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain/k8spvc"
 	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"sort"
 	"strconv"
 )
@@ -135,10 +136,9 @@ func (a *PvcAssemblerImpl) ToPvcResponse(pvc *k8spvc.PersistVolumeClaimEntity) *
 }
 
 func (a *PvcAssemblerImpl) ToPvcVolumePermTopo(prKey string) *view.PvcVolumePermissionTopoResponse {
-	prNodeIp := common.PrKeyToIpV4(prKey)
-	prNode := config.GetNodeByIp(prNodeIp)
+	prNode := prkey.NodeOf(prKey)
 	if prNode == nil {
-		smslog.Infof("PrKey: %s, can not find the prNode by ip %s", prKey, prNodeIp)
+		smslog.Infof("PrKey: %s, can not find the prNode", prKey)
 		return nil
 	}
 	prNodeId := prNode.Name
@@ -18,6 +18,8 @@ package assembler
 import (
 	"polardb-sms/pkg/manager/application/view"
 	"polardb-sms/pkg/manager/domain/workflow"
+	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"strconv"
 )
 
 type WorkflowAssembler interface {
@@ -25,6 +27,7 @@ type WorkflowAssembler interface {
 	ToWorkflowEntities(vs []*view.WorkflowResponse) []*workflow.WorkflowEntity
 	ToWorkflowView(e *workflow.WorkflowEntity) *view.WorkflowResponse
 	ToWorkflowViews(es []*workflow.WorkflowEntity) []*view.WorkflowResponse
+	ToWorkflowPlanView(e *workflow.WorkflowEntity) *view.WorkflowPlanResponse
 }
 
 type WorkflowAssemblerImpl struct {
@@ -55,16 +58,44 @@ func (as *WorkflowAssemblerImpl) ToWorkflowEntities(vs []*view.WorkflowResponse)
 
 func (as *WorkflowAssemblerImpl) ToWorkflowView(e *workflow.WorkflowEntity) *view.WorkflowResponse {
 	v := view.WorkflowResponse{
-		WorkflowId: e.Id,
-		Type:       int(e.WflType),
-		Step:       e.Step,
-		Status:     int(e.Status),
-		Mode:       int(e.Mode),
+		WorkflowId:  e.Id,
+		Type:        int(e.WflType),
+		Step:        e.Step,
+		Status:      int(e.Status),
+		Mode:        int(e.Mode),
+		VolumeId:    e.VolumeId,
+		VolumeClass: e.VolumeClass,
+		LastErrMsg:  e.LastErrMsg,
+		CreateTime:  strconv.FormatInt(e.CreateTime.Unix(), 10),
+		Canceled:    e.Canceled,
+	}
+	for _, s := range e.Stages {
+		sv := toStageView(s)
+		sv.Attempts = s.GetAttempts()
+		sv.MaxAttempts = s.GetRetryPolicy().MaxAttempts
+		if group, ok := s.(*stage.ParallelGroupStageRunner); ok {
+			for _, child := range group.Children {
+				sv.Children = append(sv.Children, toStageView(child))
+			}
+		}
+		v.StageDetails = append(v.StageDetails, sv)
 	}
-	// TODO stages
 	return &v
 }
 
+func toStageView(s stage.ChildRunner) *view.StageResponse {
+	sv := &view.StageResponse{
+		StageType: string(s.StageType()),
+	}
+	if ret := s.GetExecResult(); ret != nil {
+		sv.Executed = true
+		sv.Success = ret.IsSuccess()
+		sv.ErrMsg = ret.ErrMsg
+		sv.ErrClass = string(ret.ErrClass)
+	}
+	return sv
+}
+
 func (as *WorkflowAssemblerImpl) ToWorkflowViews(es []*workflow.WorkflowEntity) []*view.WorkflowResponse {
 	var vs []*view.WorkflowResponse
 	for _, e := range es {
@@ -74,6 +105,32 @@ func (as *WorkflowAssemblerImpl) ToWorkflowViews(es []*workflow.WorkflowEntity)
 	return vs
 }
 
+func (as *WorkflowAssemblerImpl) ToWorkflowPlanView(e *workflow.WorkflowEntity) *view.WorkflowPlanResponse {
+	v := &view.WorkflowPlanResponse{
+		Type:        int(e.WflType),
+		VolumeId:    e.VolumeId,
+		VolumeClass: e.VolumeClass,
+		Stages:      make([]*view.StagePlanResponse, 0),
+	}
+	for _, s := range e.Stages {
+		v.Stages = append(v.Stages, toStagePlanView(stage.Plan(s)))
+	}
+	return v
+}
+
+func toStagePlanView(p *stage.StagePlan) *view.StagePlanResponse {
+	pv := &view.StagePlanResponse{
+		StageType:   string(p.StageType),
+		TargetNodes: p.TargetNodes,
+		Content:     p.Content,
+		DmTable:     p.DmTable,
+	}
+	for _, child := range p.Children {
+		pv.Children = append(pv.Children, toStagePlanView(child))
+	}
+	return pv
+}
+
 func NewWorkflowAssembler() WorkflowAssembler {
 	as := &WorkflowAssemblerImpl{}
 	return as
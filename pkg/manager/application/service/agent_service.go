@@ -19,8 +19,10 @@ import (
 	"fmt"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/application/assembler"
+	"polardb-sms/pkg/manager/application/view"
 	globalConfig "polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain/agent"
+	"polardb-sms/pkg/manager/msgserver"
 	"time"
 )
 
@@ -52,6 +54,50 @@ func (s *AgentService) Heartbeat(req *assembler.HeartbeatRequest) (string, error
 	return "update successful", nil
 }
 
+func (s *AgentService) QueryAgentStatuses() ([]*view.AgentStatus, error) {
+	if msgserver.MsgServer == nil {
+		return nil, fmt.Errorf("message server is not started")
+	}
+	statuses := make([]*view.AgentStatus, 0)
+	for _, status := range msgserver.MsgServer.AgentStatuses() {
+		statuses = append(statuses, toAgentStatusView(status))
+	}
+	return statuses, nil
+}
+
+func (s *AgentService) QueryAgentStatus(nodeId string) (*view.AgentStatus, error) {
+	if msgserver.MsgServer == nil {
+		return nil, fmt.Errorf("message server is not started")
+	}
+	status, ok := msgserver.MsgServer.AgentStatus(nodeId)
+	if !ok {
+		return nil, fmt.Errorf("agent %s is not configured", nodeId)
+	}
+	return toAgentStatusView(status), nil
+}
+
+func toAgentStatusView(status msgserver.AgentStatus) *view.AgentStatus {
+	v := &view.AgentStatus{
+		NodeId:       status.NodeId,
+		Addr:         status.Addr,
+		State:        string(status.State),
+		Since:        status.Since,
+		FrameVersion: int(status.FrameVersion),
+		RttMs:        float64(status.Rtt) / float64(time.Millisecond),
+		PingFailures: status.PingFailures,
+		LastError:    status.LastError,
+		InFlight:     status.InFlight,
+		Reconnects:   status.Reconnects,
+	}
+	if !status.LastPing.IsZero() {
+		v.LastPing = &status.LastPing
+	}
+	if !status.LastErrorAt.IsZero() {
+		v.LastErrorAt = &status.LastErrorAt
+	}
+	return v
+}
+
 func NewAgentService() *AgentService {
 	return &AgentService{
 		agentRepo: agent.GetClusterAgentRepository(),
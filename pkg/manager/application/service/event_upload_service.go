@@ -23,7 +23,10 @@ import (
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/manager/domain/pv"
+	"polardb-sms/pkg/manager/domain/workflow"
+	"polardb-sms/pkg/manager/domain/workflow/stage"
 	"polardb-sms/pkg/protocol"
 	"strings"
 )
@@ -47,6 +50,8 @@ func NewEventUploadService() *EventUploadService {
 	es.register(protocol.LunAdd, es.HandleLunAddEvent)
 	es.register(protocol.LunUpdate, es.HandleLunUpdateEvent)
 	es.register(protocol.LunRemove, es.HandleLunRemoveEvent)
+	es.register(protocol.LunSubPathAdd, es.HandleLunSubPathAddEvent)
+	es.register(protocol.LunSubPathRemove, es.HandleLunSubPathRemoveEvent)
 	es.register(protocol.LvAdd, es.HandleLvAddEvent)
 	es.register(protocol.LvUpdate, es.HandleLvUpdateEvent)
 	es.register(protocol.LvRemove, es.HandleLvRemoveEvent)
@@ -216,6 +221,93 @@ func (s *EventUploadService) HandleLunRemoveEvent(e string) error {
 	return nil
 }
 
+func (s *EventUploadService) HandleLunSubPathAddEvent(e string) error {
+	event := protocol.LunSubPathAddEvent{}
+	if err := protocol.Decode(e, &event); err != nil {
+		smslog.Errorf("LunSubPathAddEvent: could not decode event %s: %v", e, err)
+		return err
+	}
+	smslog.Infof("LunSubPathAddEvent: path %s is added to lun %s on node %s", event.SubPath, event.VolumeId, event.NodeId)
+	return s.handleLunSubPathEvent(&event.Lun)
+}
+
+func (s *EventUploadService) HandleLunSubPathRemoveEvent(e string) error {
+	event := protocol.LunSubPathRemoveEvent{}
+	if err := protocol.Decode(e, &event); err != nil {
+		smslog.Errorf("LunSubPathRemoveEvent: could not decode event %s: %v", e, err)
+		return err
+	}
+	smslog.Infof("LunSubPathRemoveEvent: path %s is removed from lun %s on node %s", event.SubPath, event.VolumeId, event.NodeId)
+	return s.handleLunSubPathEvent(&event.Lun)
+}
+
+//handleLunSubPathEvent saves the paths of the lun, then the writer registers on the new paths and checks every path
+func (s *EventUploadService) handleLunSubPathEvent(event *protocol.Lun) error {
+	if event.VolumeId == "" {
+		return nil
+	}
+	lunEntity, err := s.pvRepo.FindByVolumeIdAndNodeId(event.VolumeId, event.NodeId)
+	if err != nil {
+		smslog.Errorf("find lun by id %s err %s", event.VolumeId, err.Error())
+		return err
+	}
+	if lunEntity != nil {
+		lunEntity.PathNum = event.PathNum
+		lunEntity.Paths = event.Paths
+		if _, err = s.pvRepo.Save(lunEntity); err != nil {
+			smslog.Errorf("update lun %s err %s", lunEntity.GetVolumeId(), err.Error())
+			return err
+		}
+	}
+	return s.verifyPaths(event.VolumeId, event.NodeId)
+}
+
+//verifyPaths submits the workflow if the node is the writer of the volume holding the lun,
+//the readers hold no registration so nothing is to do on them
+func (s *EventUploadService) verifyPaths(lunId, nodeId string) error {
+	lvs, err := s.lvRepo.QueryAll()
+	if err != nil {
+		return err
+	}
+	for _, lvEntity := range lvs {
+		if lvEntity.PrKey == "" || !hasLun(lvEntity, lunId) {
+			continue
+		}
+		writer := prkey.NodeOf(lvEntity.PrKey)
+		if writer == nil || writer.Name != nodeId {
+			smslog.Infof("node %s is not the writer of volume %s, no need to verify paths of lun %s", nodeId, lvEntity.VolumeId, lunId)
+			return nil
+		}
+		if err = prkey.CheckNotFenced(nodeId); err != nil {
+			smslog.Warnf("skip verifying paths of lun %s: %v", lunId, err)
+			return nil
+		}
+		runner, err := stage.NewVerifyPathsCmdStage(*writer, lunId, common.MultipathVolume, lvEntity.PrKey, lvEntity.ReserveType(), lvEntity.Aptpl())
+		if err != nil {
+			return err
+		}
+		wfl := workflow.NewWflBuilder().WithType(workflow.PrPathVerify).WithStageRunner(runner).Build()
+		wfl.SetVolumeClass(string(lvEntity.LvType.ToVolumeClass()))
+		wfl.SetVolumeId(lvEntity.VolumeId)
+		if err = GetWorkflowEngine().Submit(wfl); err != nil {
+			smslog.Errorf("submit path verify workflow for lun %s of volume %s err %s", lunId, lvEntity.VolumeId, err.Error())
+			return err
+		}
+		smslog.Infof("submit path verify workflow %s for lun %s of volume %s", wfl.Id, lunId, lvEntity.VolumeId)
+		return nil
+	}
+	return nil
+}
+
+func hasLun(lvEntity *lv.LogicalVolumeEntity, lunId string) bool {
+	for _, id := range luns(lvEntity) {
+		if id == lunId {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *EventUploadService) createLvByEvent(event *protocol.LvAddEvent) error {
 	var lvType common.LvType
 	if event.VolumeType == string(common.DmStripVolume) {
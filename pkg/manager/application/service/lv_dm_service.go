@@ -18,19 +18,24 @@ package service
 import (
 	"fmt"
 	"polardb-sms/pkg/common"
+	"polardb-sms/pkg/device"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/application/assembler"
 	"polardb-sms/pkg/manager/application/view"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prcap"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/manager/domain/workflow"
 	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"polardb-sms/pkg/network/message"
 )
 
 //TODO merge with lv multipath
 type ClusterLvService struct {
 	lvRepo        lv.LvRepository
+	profileRepo   prcap.PrCapabilityProfileRepository
 	volumeService *VolumeService
 	clusterLvAsm  assembler.ClusterLvAssembler
 }
@@ -38,6 +43,7 @@ type ClusterLvService struct {
 func NewClusterLvService() *ClusterLvService {
 	return &ClusterLvService{
 		lvRepo:        lv.GetLvRepository(),
+		profileRepo:   prcap.GetPrCapabilityProfileRepository(),
 		volumeService: NewVolumeService(),
 		clusterLvAsm:  assembler.NewClusterLvAssembler(),
 	}
@@ -74,14 +80,20 @@ func (s *ClusterLvService) Create(ctx common.TraceContext, v *view.ClusterLvCrea
 	}
 
 	lvEntity = s.clusterLvAsm.ToClusterLvEntity(v)
-	if err = s.create(lvEntity); err != nil {
-		return nil, err
+	if !v.DryRun {
+		if err = s.create(lvEntity); err != nil {
+			return nil, err
+		}
 	}
 
 	wfl, err := s.genWorkflow(lvEntity, workflow.ClusterLvCreate)
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lvEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
 	if err = GetWorkflowEngine().Submit(wfl); err != nil {
@@ -111,9 +123,13 @@ func (s *ClusterLvService) Format(ctx common.TraceContext, v *view.ClusterLvForm
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lvEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+	if err = s.volumeService.submitWorkflow(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{
@@ -137,9 +153,13 @@ func (s *ClusterLvService) Expand(ctx common.TraceContext, v *view.ClusterLvExpa
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lvEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+	if err = s.volumeService.submitWorkflow(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -170,9 +190,13 @@ func (s *ClusterLvService) FsExpand(ctx common.TraceContext, v *view.ClusterLvFs
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lvEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+	if err = s.volumeService.submitWorkflow(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -198,7 +222,7 @@ func (s *ClusterLvService) Delete(ctx common.TraceContext, volumeId string) (*vi
 	}
 
 	wfl.SetTraceContext(ctx)
-	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+	if err = s.volumeService.submitWorkflow(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -216,6 +240,116 @@ func needExpand(tgt, src *lv.LogicalVolumeEntity) bool {
 	return true
 }
 
+//SetAptpl changes the aptpl option of the lv, the writer registers its key again to apply it on the array
+func (s *ClusterLvService) SetAptpl(ctx common.TraceContext, v *view.ClusterLvAptplRequest) (*view.WorkflowIdResponse, error) {
+	lvEntity, err := s.lvRepo.FindByVolumeId(v.VolumeId)
+	if err != nil || lvEntity == nil {
+		return nil, fmt.Errorf("aptpl: can not find lv with id %v", v.VolumeId)
+	}
+	if v.Aptpl {
+		err = s.checkProfiles(lvEntity, func(profile *prcap.PrCapabilityProfileEntity) error {
+			if !profile.PtplCapable {
+				return fmt.Errorf("aptpl: %s %s is not ptpl capable", profile.Vendor, profile.Product)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	lvEntity.SetAptpl(v.Aptpl)
+	return s.applyToWriter(ctx, lvEntity, func(writer config.Node, lunId string) (workflow.StageRunner, error) {
+		return stage.NewRegisterCmdStage(writer, lunId, common.MultipathVolume, lvEntity.PrKey, lvEntity.ReserveType(), v.Aptpl)
+	})
+}
+
+//SetReserveType changes the reservation type of the lv, the writer preempts itself to change the type on the array
+func (s *ClusterLvService) SetReserveType(ctx common.TraceContext, v *view.ClusterLvReserveTypeRequest) (*view.WorkflowIdResponse, error) {
+	lvEntity, err := s.lvRepo.FindByVolumeId(v.VolumeId)
+	if err != nil || lvEntity == nil {
+		return nil, fmt.Errorf("reserve type: can not find lv with id %v", v.VolumeId)
+	}
+	reserveType := message.PrType(v.ReserveType)
+	if err = s.CheckReserveType(lvEntity, reserveType); err != nil {
+		return nil, err
+	}
+	lvEntity.SetReserveType(reserveType)
+	return s.applyToWriter(ctx, lvEntity, func(writer config.Node, lunId string) (workflow.StageRunner, error) {
+		return stage.NewRegAndPreemptCmdStage(writer, lunId, common.MultipathVolume, lvEntity.PrKey, lvEntity.PrKey, reserveType)
+	})
+}
+
+//CheckReserveType allows only the all registrants types, for the writer is the only registrant and
+//the lock is transferred by preempting, and the type should be supported by the probed profiles
+func (s *ClusterLvService) CheckReserveType(lvEntity *lv.LogicalVolumeEntity, reserveType message.PrType) error {
+	if !reserveType.AllRegistrants() {
+		return fmt.Errorf("reserve type: %s is not supported, use %s or %s", reserveType, message.WEAR, message.EAAR)
+	}
+	return s.checkProfiles(lvEntity, func(profile *prcap.PrCapabilityProfileEntity) error {
+		if !profile.Supports(reserveType) {
+			return fmt.Errorf("reserve type: %s is not supported by %s %s", reserveType, profile.Vendor, profile.Product)
+		}
+		return nil
+	})
+}
+
+//checkProfiles checks the probed profiles of the lun vendor and product, the luns not probed pass
+func (s *ClusterLvService) checkProfiles(lvEntity *lv.LogicalVolumeEntity, check func(profile *prcap.PrCapabilityProfileEntity) error) error {
+	for _, lunId := range luns(lvEntity) {
+		lunEntity, err := s.lvRepo.FindByVolumeId(lunId)
+		if err != nil || lunEntity == nil {
+			return fmt.Errorf("can not find lun %s", lunId)
+		}
+		profile, err := s.profileRepo.FindByVendorAndProduct(lunEntity.Vendor, lunEntity.Product)
+		if err != nil {
+			return err
+		}
+		if profile == nil {
+			continue
+		}
+		if err = check(profile); err != nil {
+			return fmt.Errorf("lun %s: %v", lunId, err)
+		}
+	}
+	return nil
+}
+
+//applyToWriter saves the extend of the lv, and submits the stages built for each lun to run on the writer if any
+func (s *ClusterLvService) applyToWriter(ctx common.TraceContext, lvEntity *lv.LogicalVolumeEntity,
+	build func(writer config.Node, lunId string) (workflow.StageRunner, error)) (*view.WorkflowIdResponse, error) {
+	if _, err := s.lvRepo.UpdateExtend(lvEntity); err != nil {
+		return nil, err
+	}
+	if lvEntity.PrKey == "" {
+		return &view.WorkflowIdResponse{}, nil
+	}
+	writer := prkey.NodeOf(lvEntity.PrKey)
+	if writer == nil {
+		smslog.Warnf("extend of lv %s is saved, the writer of key %s is not available to apply it", lvEntity.VolumeId, lvEntity.PrKey)
+		return &view.WorkflowIdResponse{}, nil
+	}
+	if err := prkey.CheckNotFenced(writer.Name); err != nil {
+		smslog.Warnf("extend of lv %s is saved, the writer can not apply it: %v", lvEntity.VolumeId, err)
+		return &view.WorkflowIdResponse{}, nil
+	}
+	wb := workflow.NewWflBuilder().WithType(workflow.PrRepair)
+	for _, lunId := range luns(lvEntity) {
+		runner, err := build(*writer, lunId)
+		if err != nil {
+			return nil, err
+		}
+		wb.WithStageRunner(runner)
+	}
+	wfl := wb.Build()
+	wfl.SetVolumeClass(string(lvEntity.LvType.ToVolumeClass()))
+	wfl.SetVolumeId(lvEntity.VolumeId)
+	wfl.SetTraceContext(ctx)
+	if err := GetWorkflowEngine().Submit(wfl); err != nil {
+		return nil, err
+	}
+	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
+}
+
 func (s *ClusterLvService) getLvUsedStageRunners(lvEntity *lv.LogicalVolumeEntity, byName string, byType domain.UsedByType) ([]workflow.StageRunner, error) {
 	if lvEntity.LvType.ToVolumeClass() == common.LunClass {
 		item, err := s.lvRepo.FindByVolumeId(lvEntity.GetVolumeId())
@@ -257,58 +391,103 @@ func (s *ClusterLvService) getLvUsedStageRunners(lvEntity *lv.LogicalVolumeEntit
 	return runners, nil
 }
 
-func (s *ClusterLvService) getLvLockStageRunners(lvEntity *lv.LogicalVolumeEntity, prNode config.Node, currentIp string) ([]workflow.StageRunner, error) {
+//getLvLockStageRunners transfers the write lock to prNode, the fence generation of the lv
+//is bumped by the lock stage if the writer changes, and lvEntity is updated to the new writer
+func (s *ClusterLvService) getLvLockStageRunners(lvEntity *lv.LogicalVolumeEntity, prNode config.Node, currentPrKey string) ([]workflow.StageRunner, error) {
+	return s.lockStageRunners(lvEntity, prNode, currentPrKey, false)
+}
+
+//getLvTakeoverStageRunners transfers the write lock from the fenced writer to prNode like getLvLockStageRunners,
+//and the commands queued by the fenced writer are aborted
+func (s *ClusterLvService) getLvTakeoverStageRunners(lvEntity *lv.LogicalVolumeEntity, prNode config.Node) ([]workflow.StageRunner, error) {
+	return s.lockStageRunners(lvEntity, prNode, lvEntity.PrKey, true)
+}
+
+func (s *ClusterLvService) lockStageRunners(lvEntity *lv.LogicalVolumeEntity, prNode config.Node, currentPrKey string, abort bool) ([]workflow.StageRunner, error) {
 	runners := make([]workflow.StageRunner, 0)
-	if lvEntity.LvType.ToVolumeClass() == common.LunClass {
-		item, err := s.lvRepo.FindByVolumeId(lvEntity.GetVolumeId())
+	generation := lvEntity.NextFenceGeneration(prNode)
+	fence, err := newFenceRecord(lvEntity, prNode, generation)
+	if err != nil {
+		return nil, err
+	}
+	lock := func(item *lv.LogicalVolumeEntity, volumeId, currentPrKey string) error {
+		stageRunner, err := stage.NewPrLockStage(prNode, volumeId, currentPrKey, generation, lvEntity.LvType, lvEntity.ReserveType())
 		if err != nil {
-			return nil, fmt.Errorf("can not fine lun for %v: %v", lvEntity.GetVolumeId(), err)
+			return err
 		}
-		currentPrIp := common.If(item.PrKey != "", common.PrKeyToIpV4(item.PrKey), "")
-		if currentPrIp == prNode.Ip {
-			smslog.Warnf("lun %s current pr %s already exist on node %s", item.PrKey, prNode.Ip)
-			return []workflow.StageRunner{}, nil
+		if abort {
+			stageRunner.WithAbort()
 		}
-		stageRunner, err := stage.NewPrLockStage(prNode, prNode.Ip, lvEntity.VolumeId, currentIp, lvEntity.LvType)
-		if err != nil {
-			return nil, err
+		//the first preempt claims the generation of the lv
+		if fence != nil {
+			stageRunner.WithFence(fence)
+			fence = nil
 		}
-		runners = append(runners, stageRunner)
+		runners = append(runners, stageRunner.WithAptpl(lvEntity.Aptpl()))
 
-		item.PrKey = common.IpV4ToPrKey(prNode.Ip)
+		if err = item.FenceTo(prNode, generation); err != nil {
+			return err
+		}
 		updatePrStageRunner, err := stage.NewDBPersistLvPrStage(item)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		runners = append(runners, updatePrStageRunner)
-		return runners, nil
+		return nil
 	}
-	for _, child := range lvEntity.Children.Items {
-		item, err := s.lvRepo.FindByVolumeId(child.GetVolumeId())
+	if lvEntity.LvType.ToVolumeClass() == common.LunClass {
+		item, err := s.lvRepo.FindByVolumeId(lvEntity.GetVolumeId())
 		if err != nil {
-			return nil, fmt.Errorf("can not fine lun for %v: %v", child.GetVolumeId(), err)
+			return nil, fmt.Errorf("can not fine lun for %v: %v", lvEntity.GetVolumeId(), err)
 		}
-		currentPrIp := common.If(item.PrKey != "", common.PrKeyToIpV4(item.PrKey), "")
-		if currentPrIp == prNode.Ip {
-			smslog.Warnf("lun %s current pr %s already exist on node %s", item.PrKey, prNode.Ip)
-			continue
+		if generation == item.FenceGeneration {
+			smslog.Warnf("lun %s current pr %s already exist on node %s", item.VolumeId, item.PrKey, prNode.Name)
+			return []workflow.StageRunner{}, nil
 		}
-		stageRunner, err := stage.NewPrLockStage(prNode, prNode.Ip, child.GetVolumeId(), currentPrIp.(string), lvEntity.LvType)
-		if err != nil {
+		if err = lock(item, lvEntity.VolumeId, currentPrKey); err != nil {
 			return nil, err
 		}
-		runners = append(runners, stageRunner)
-
-		item.PrKey = common.IpV4ToPrKey(prNode.Ip)
-		updatePrStageRunner, err := stage.NewDBPersistLvPrStage(item)
-		if err != nil {
-			return nil, err
+	} else {
+		for _, child := range lvEntity.Children.Items {
+			item, err := s.lvRepo.FindByVolumeId(child.GetVolumeId())
+			if err != nil {
+				return nil, fmt.Errorf("can not fine lun for %v: %v", child.GetVolumeId(), err)
+			}
+			if holder := prkey.NodeOf(item.PrKey); holder != nil && holder.Name == prNode.Name && item.FenceGeneration == generation {
+				smslog.Warnf("lun %s current pr %s already exist on node %s", item.VolumeId, item.PrKey, prNode.Name)
+				continue
+			}
+			if err = lock(item, child.GetVolumeId(), item.PrKey); err != nil {
+				return nil, err
+			}
 		}
-		runners = append(runners, updatePrStageRunner)
+	}
+	if len(runners) == 0 || generation == lvEntity.FenceGeneration {
+		return runners, nil
+	}
+	if err = lvEntity.FenceTo(prNode, generation); err != nil {
+		return nil, err
 	}
 	return runners, nil
 }
 
+//newFenceRecord is the record of the generation transferred to prNode, nil if the generation is kept
+func newFenceRecord(lvEntity *lv.LogicalVolumeEntity, prNode config.Node, generation int64) (*lv.FenceRecordEntity, error) {
+	if generation == lvEntity.FenceGeneration {
+		return nil, nil
+	}
+	nodeKey, err := prkey.KeyOf(prNode)
+	if err != nil {
+		return nil, err
+	}
+	return &lv.FenceRecordEntity{
+		VolumeId:   lvEntity.VolumeId,
+		Generation: generation,
+		NodeId:     prNode.Name,
+		PrKey:      prkey.FencedKey(nodeKey, generation),
+	}, nil
+}
+
 func (s *ClusterLvService) getLvUnLockStageRunners(lvEntity *lv.LogicalVolumeEntity, pvName string) []workflow.StageRunner {
 	runners := make([]workflow.StageRunner, 0)
 	if lvEntity.LvType.ToVolumeClass() == common.LunClass {
@@ -387,9 +566,6 @@ func (s *ClusterLvService) genFormatWorkflow(lvEntity *lv.LogicalVolumeEntity, w
 	if wrNode.Name == "" && wrNode.Ip == "" {
 		return fmt.Errorf("get empty node from lvEntity %v", lvEntity)
 	}
-	if err := s.volumeService.updateVolumeStatus(lvEntity, domain.Formatting); err != nil {
-		return err
-	}
 	stageRunner := stage.NewFsFormatStage(lvEntity.VolumeId,
 		lvEntity.LvType,
 		lvEntity.FsType,
@@ -412,9 +588,6 @@ func (s *ClusterLvService) genExpandWorkflow(lvEntity *lv.LogicalVolumeEntity, w
 	if err != nil {
 		return err
 	}
-	if err := s.volumeService.updateVolumeStatus(lvEntity, domain.Expanding); err != nil {
-		return err
-	}
 
 	lvUsedStageRunners, err := s.getLvUsedStageRunners(lvEntity, lvEntity.GetVolumeName(), domain.LvUsed)
 	if err != nil {
@@ -422,7 +595,11 @@ func (s *ClusterLvService) genExpandWorkflow(lvEntity *lv.LogicalVolumeEntity, w
 	}
 	wb.WithStageRunners(lvUsedStageRunners)
 
-	stageRunner := stage.NewLvExpandStage(dmDeviceCore)
+	var originDeviceCore *device.DmDeviceCore
+	if curLvEntity, err := s.lvRepo.FindByVolumeId(lvEntity.VolumeId); err == nil && curLvEntity != nil {
+		originDeviceCore, _ = curLvEntity.GetDmDeviceCore()
+	}
+	stageRunner := stage.NewLvExpandStage(dmDeviceCore, originDeviceCore)
 	wb.WithStageRunner(stageRunner)
 
 	lvEntity.Status.StatusValue = domain.Success
@@ -441,10 +618,6 @@ func (s *ClusterLvService) genFsExpandWorkflow(lvEntity *lv.LogicalVolumeEntity,
 		return fmt.Errorf("get empty node from lvEntity %v", lvEntity)
 	}
 
-	if err := s.volumeService.updateVolumeStatus(lvEntity, domain.Expanding); err != nil {
-		return err
-	}
-
 	stageRunner := stage.NewFsExpandStage(lvEntity.VolumeId, lvEntity.LvType, common.Pfs, lvEntity.Size, lvEntity.FsSize, &wrNode)
 	wb.WithStageRunner(stageRunner)
 
@@ -459,10 +632,6 @@ func (s *ClusterLvService) genFsExpandWorkflow(lvEntity *lv.LogicalVolumeEntity,
 }
 
 func (s *ClusterLvService) genDeleteWorkflow(lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
-	if err := s.volumeService.updateVolumeStatus(lvEntity, domain.Deleting); err != nil {
-		return err
-	}
-
 	dmDeviceCore, err := lvEntity.GetDmDeviceCore()
 	if err != nil {
 		return err
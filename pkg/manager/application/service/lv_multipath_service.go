@@ -24,6 +24,7 @@ import (
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/manager/domain/workflow"
 	"polardb-sms/pkg/manager/domain/workflow/stage"
 )
@@ -70,19 +71,24 @@ func (s *LvForOldLunService) FormatAndLock(ctx common.TraceContext, v *view.Clus
 		return nil, fmt.Errorf("can not find nodeIp %s from nodes %v", v.RwNodeIp, config.GetAvailableNodes())
 	}
 
-	if lunEntity.PrKey == rwNodeConf.Name {
-		smslog.WithContext(ctx).Infof("wwid % disk already has write permission, but continue", v.Wwid)
+	if holder := prkey.NodeOf(lunEntity.PrKey); holder != nil && holder.Name == rwNodeConf.Name {
+		smslog.WithContext(ctx).Infof("wwid %s disk already has write permission, but continue", v.Wwid)
 	}
 	wfl, err := s.genFormatAndLockWorkflow(lunEntity, rwNodeConf, options)
 	if err != nil {
 		return nil, err
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 	wfl.SetTraceContext(ctx)
 	if err = GetWorkflowEngine().Submit(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{
-		WorkflowId: wfl.Id,
+		WorkflowId:      wfl.Id,
+		FenceGeneration: lunEntity.FenceGeneration,
 	}, nil
 }
 
@@ -100,31 +106,65 @@ func (s *LvForOldLunService) SetAccessPermission(ctx common.TraceContext, v *vie
 		return nil, fmt.Errorf("can not find nodeIp %s from nodes %v", v.RwNodeIp, config.GetAvailableNodes())
 	}
 
-	if lunEntity.PrKey == rwNodeConf.Name {
-		smslog.WithContext(ctx).Infof("wwid % disk already has write permission", v.Wwid)
+	if holder := prkey.NodeOf(lunEntity.PrKey); holder != nil && holder.Name == rwNodeConf.Name {
+		smslog.WithContext(ctx).Infof("wwid %s disk already has write permission", v.Wwid)
 		return nil, nil
 	}
-	wfl, err := s.genPrLockWorkflow(rwNodeConf, v.Wwid, lunEntity.PrKey)
+	wfl, err := s.genPrLockWorkflow(lunEntity, rwNodeConf)
 	if err != nil {
 		return nil, err
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 	wfl.SetTraceContext(ctx)
 	if err := GetWorkflowEngine().Submit(wfl); err != nil {
 
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{
-		WorkflowId: wfl.Id,
+		WorkflowId:      wfl.Id,
+		FenceGeneration: lunEntity.FenceGeneration,
 	}, nil
 }
 
-func (s *LvForOldLunService) genPrLockWorkflow(prNode *config.Node, wwid string, existPrKey string) (*workflow.WorkflowEntity, error) {
+//genLunLockStageRunners transfers the write lock of the lun to prNode, the lock stage bumps the fence generation
+//if the writer changes. lun is updated to the new writer but not persisted
+func genLunLockStageRunners(lun *lv.LogicalVolumeEntity, prNode config.Node) ([]workflow.StageRunner, error) {
+	generation := lun.NextFenceGeneration(prNode)
+	lockStageRunner, err := stage.NewPrLockStage(prNode, lun.VolumeId, lun.PrKey, generation, common.MultipathVolume, lun.ReserveType())
+	if err != nil {
+		return nil, err
+	}
+	runners := []workflow.StageRunner{lockStageRunner.WithAptpl(lun.Aptpl())}
+	fence, err := newFenceRecord(lun, prNode, generation)
+	if err != nil {
+		return nil, err
+	}
+	if fence == nil {
+		return runners, nil
+	}
+	lockStageRunner.WithFence(fence)
+	if err = lun.FenceTo(prNode, generation); err != nil {
+		return nil, err
+	}
+	return runners, nil
+}
+
+func (s *LvForOldLunService) genPrLockWorkflow(lun *lv.LogicalVolumeEntity, prNode *config.Node) (*workflow.WorkflowEntity, error) {
 	wb := workflow.NewWflBuilder().WithType(workflow.PrLock)
-	prStage, err := stage.NewPrLockStage(*prNode, prNode.Ip, wwid, existPrKey, common.MultipathVolume)
+	lockStageRunners, err := genLunLockStageRunners(lun, *prNode)
 	if err != nil {
 		return nil, err
 	}
-	wb.WithStageRunner(prStage)
+	wb.WithStageRunners(lockStageRunners)
+
+	updatePrStageRunner, err := stage.NewDBPersistLvPrStage(lun)
+	if err != nil {
+		return nil, err
+	}
+	wb.WithStageRunner(updatePrStageRunner)
 	return wb.Build(), nil
 }
 
@@ -136,11 +176,11 @@ func (s *LvForOldLunService) genFormatAndLockWorkflow(lun *lv.LogicalVolumeEntit
 	formatStageRunner := stage.NewFsFormatStage(lun.VolumeId, common.MultipathVolume, fsType, fsSize, prNode)
 	wb.WithStageRunner(formatStageRunner)
 
-	lockStageRunner, err := stage.NewPrLockStage(*prNode, prNode.Ip, lun.VolumeId, lun.PrKey, common.MultipathVolume)
+	lockStageRunners, err := genLunLockStageRunners(lun, *prNode)
 	if err != nil {
 		return nil, err
 	}
-	wb.WithStageRunner(lockStageRunner)
+	wb.WithStageRunners(lockStageRunners)
 
 	lun.FsSize = fsSize
 	lun.FsType = common.FsType(fsType)
@@ -189,6 +229,10 @@ func (s *LvForOldLunService) Create(ctx common.TraceContext, v *view.ClusterLunC
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lunEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
 	if err = GetWorkflowEngine().Submit(wfl); err != nil {
@@ -219,9 +263,13 @@ func (s *LvForOldLunService) Format(ctx common.TraceContext, v *view.ClusterLunF
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lunEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+	if err = s.volumeService.submitWorkflow(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -237,6 +285,10 @@ func (s *LvForOldLunService) Expand(ctx common.TraceContext, v *view.ClusterLunC
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lunEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
 	if err = GetWorkflowEngine().Submit(wfl); err != nil {
@@ -269,9 +321,13 @@ func (s *LvForOldLunService) FsExpand(ctx common.TraceContext, v *view.ClusterLu
 	if err != nil {
 		return nil, fmt.Errorf("can not create workflow for entity %v, err %v", lunEntity, err)
 	}
+	if v.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(v.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+	if err = s.volumeService.submitWorkflow(wfl); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -306,21 +362,16 @@ func (s *LvForOldLunService) LunsFromSameSan(req *view.ClusterLunSameSanRequest)
 }
 
 func (s *LvForOldLunService) genFsExpandWorkflow(lv *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
-	prNodeIp := common.PrKeyToIpV4(lv.PrKey)
 	var prNode *config.Node
-	if prNodeIp == "" {
+	if lv.PrKey == "" {
 		prNode = config.GetOneNode()
 	} else {
-		prNode = config.GetNodeByIp(prNodeIp)
+		prNode = prkey.NodeOf(lv.PrKey)
 	}
 	if prNode == nil {
 		return fmt.Errorf("can not get prNode for lun %v", lv)
 	}
 
-	if err := s.volumeService.updateVolumeStatus(lv, domain.Expanding); err != nil {
-		return err
-	}
-
 	fsExpandStageRunner := stage.NewFsExpandStage(lv.VolumeId, common.MultipathVolume, common.Pfs, lv.Size, lv.FsSize, prNode)
 	wb.WithStageRunner(fsExpandStageRunner)
 
@@ -337,10 +388,6 @@ func (s *LvForOldLunService) genFsExpandWorkflow(lv *lv.LogicalVolumeEntity, wb
 }
 
 func (s *LvForOldLunService) genFormatWorkflow(lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
-	if err := s.volumeService.updateVolumeStatus(lvEntity, domain.Formatting); err != nil {
-		return err
-	}
-
 	wrNode := lvEntity.GetCanWriteNode()
 	if wrNode.Name == "" && wrNode.Ip == "" {
 		return fmt.Errorf("get empty node from lvEntity %v", lvEntity)
@@ -0,0 +1,267 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/application/view"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
+	"polardb-sms/pkg/manager/domain/workflow"
+	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"polardb-sms/pkg/network/message"
+)
+
+//NodeFenceService cuts a suspected dead node off the shared volumes
+type NodeFenceService struct {
+	lvRepo    lv.LvRepository
+	fenceRepo prkey.NodeFenceRepository
+	lvService *ClusterLvService
+	query     func(node config.Node, lunId string) (*message.PrQueryInfo, error)
+}
+
+func NewNodeFenceService() *NodeFenceService {
+	return &NodeFenceService{
+		lvRepo:    lv.GetLvRepository(),
+		fenceRepo: prkey.GetNodeFenceRepository(),
+		lvService: NewClusterLvService(),
+		query:     queryPrInfo,
+	}
+}
+
+//lunKeys are the keys of the fenced node registered on the lun
+type lunKeys struct {
+	lunId string
+	keys  []string
+}
+
+//Fence records the node fenced to stop it registering again, then submits a workflow for each in use volume
+//the node registered: the registrations of a reader are preempted with abort by the writer, and a writer is
+//preempted with abort by the takeover node which becomes the writer, for the reservation fences off
+//the other nodes only if it is held. The volumes not in use hold no reservation, nothing to fence there.
+func (s *NodeFenceService) Fence(ctx common.TraceContext, nodeId string, req *view.NodeFenceRequest) (*view.NodeFenceResponse, error) {
+	node := config.GetClusterNode(nodeId)
+	if node == nil {
+		return nil, fmt.Errorf("fence: can not find node %s in clusterConf", nodeId)
+	}
+	nodeKey, err := prkey.KeyOf(*node)
+	if err != nil {
+		return nil, err
+	}
+	healthy := healthyNodes(nodeId)
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("fence: no available node other than %s", nodeId)
+	}
+	takeover := &healthy[0]
+	if req.TakeoverNodeId != "" {
+		if takeover = config.GetNodeById(req.TakeoverNodeId); takeover == nil || takeover.Name == nodeId {
+			return nil, fmt.Errorf("fence: takeover node %s is not available", req.TakeoverNodeId)
+		}
+	}
+	lvs, err := s.lvRepo.QueryAll()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &view.NodeFenceResponse{
+		NodeId:    nodeId,
+		PrKey:     nodeKey,
+		Workflows: make([]*view.NodeFenceWorkflow, 0),
+		Errors:    make([]*view.PrAuditError, 0),
+	}
+	plans := make(map[string][]*lunKeys)
+	volumes := make([]*lv.LogicalVolumeEntity, 0)
+	for _, lvEntity := range inUseVolumes(lvs) {
+		fenced := make([]*lunKeys, 0)
+		for _, lunId := range luns(lvEntity) {
+			info, err := s.queryOnNodes(healthy, lunId)
+			if err != nil {
+				smslog.Errorf("fence: query pr of lun %s of volume %s err %s", lunId, lvEntity.VolumeId, err.Error())
+				resp.Errors = append(resp.Errors, &view.PrAuditError{VolumeId: lvEntity.VolumeId, LunId: lunId, ErrMsg: err.Error()})
+				continue
+			}
+			if keys := registeredKeysOf(info, nodeKey); len(keys) > 0 {
+				fenced = append(fenced, &lunKeys{lunId: lunId, keys: keys})
+			}
+		}
+		if len(fenced) > 0 {
+			plans[lvEntity.VolumeId] = fenced
+			volumes = append(volumes, lvEntity)
+		}
+	}
+
+	record := &prkey.NodeFenceRecordEntity{
+		NodeId:  nodeId,
+		PrKey:   nodeKey,
+		Action:  prkey.FenceActionFence,
+		Reason:  req.Reason,
+		Volumes: make([]string, 0, len(volumes)),
+	}
+	for _, lvEntity := range volumes {
+		record.Volumes = append(record.Volumes, lvEntity.VolumeId)
+	}
+	if _, err = s.fenceRepo.Create(record); err != nil {
+		return nil, fmt.Errorf("fence: can not record the fence of node %s: %v", nodeId, err)
+	}
+	smslog.Infof("fence: node %s with key %s is fenced for %s, volumes %v", nodeId, nodeKey, req.Reason, record.Volumes)
+
+	for _, lvEntity := range volumes {
+		wfl, err := s.fenceWorkflow(lvEntity, plans[lvEntity.VolumeId], nodeKey, *takeover)
+		if err == nil {
+			wfl.SetTraceContext(ctx)
+			err = GetWorkflowEngine().Submit(wfl)
+		}
+		if err != nil {
+			smslog.Errorf("fence: fence node %s off volume %s err %s", nodeId, lvEntity.VolumeId, err.Error())
+			resp.Errors = append(resp.Errors, &view.PrAuditError{VolumeId: lvEntity.VolumeId, ErrMsg: err.Error()})
+			continue
+		}
+		resp.Workflows = append(resp.Workflows, &view.NodeFenceWorkflow{VolumeId: lvEntity.VolumeId, WorkflowId: wfl.Id})
+	}
+	return resp, nil
+}
+
+//Unfence lets the node register again, its keys are registered by the next lock workflow
+func (s *NodeFenceService) Unfence(nodeId string) error {
+	fenced, err := s.fenceRepo.IsFenced(nodeId)
+	if err != nil {
+		return err
+	}
+	if !fenced {
+		return fmt.Errorf("unfence: node %s is not fenced", nodeId)
+	}
+	record := &prkey.NodeFenceRecordEntity{
+		NodeId: nodeId,
+		Action: prkey.FenceActionUnfence,
+	}
+	if node := config.GetClusterNode(nodeId); node != nil {
+		record.PrKey, _ = prkey.KeyOf(*node)
+	}
+	if _, err = s.fenceRepo.Create(record); err != nil {
+		return err
+	}
+	smslog.Infof("unfence: node %s is unfenced", nodeId)
+	return nil
+}
+
+func (s *NodeFenceService) QueryFenceHistory(nodeId string) ([]*prkey.NodeFenceRecordEntity, error) {
+	return s.fenceRepo.QueryByNodeId(nodeId)
+}
+
+func (s *NodeFenceService) fenceWorkflow(lvEntity *lv.LogicalVolumeEntity, fenced []*lunKeys, nodeKey string, takeover config.Node) (*workflow.WorkflowEntity, error) {
+	wb := workflow.NewWflBuilder().WithType(workflow.NodeFence)
+	writerKey := common.NormalizePrKey(lvEntity.PrKey)
+	writer := prkey.NodeOf(lvEntity.PrKey)
+	if prkey.IsNodeKey(lvEntity.PrKey, nodeKey) {
+		runners, err := s.lvService.getLvTakeoverStageRunners(lvEntity, takeover)
+		if err != nil {
+			return nil, err
+		}
+		wb.WithStageRunners(runners)
+		updatePrStageRunner, err := stage.NewDBPersistLvPrStage(lvEntity)
+		if err != nil {
+			return nil, err
+		}
+		wb.WithStageRunner(updatePrStageRunner)
+		writer = &takeover
+	} else if writer == nil {
+		return nil, fmt.Errorf("the writer node of key %s is not available", lvEntity.PrKey)
+	}
+	//the other keys of the fenced node, the writer key is preempted by the takeover stages
+	for _, l := range fenced {
+		for _, key := range l.keys {
+			if key == writerKey {
+				continue
+			}
+			runner, err := stage.NewRegAndPreemptCmdStage(*writer, l.lunId, common.MultipathVolume, lvEntity.PrKey, key, lvEntity.ReserveType())
+			if err != nil {
+				return nil, err
+			}
+			wb.WithStageRunner(runner.WithAbort().WithAptpl(lvEntity.Aptpl()))
+		}
+	}
+	wfl := wb.Build()
+	wfl.SetVolumeClass(string(lvEntity.LvType.ToVolumeClass()))
+	wfl.SetVolumeId(lvEntity.VolumeId)
+	return wfl, nil
+}
+
+//queryOnNodes queries the pr on the nodes in order until one succeeds
+func (s *NodeFenceService) queryOnNodes(nodes []config.Node, lunId string) (*message.PrQueryInfo, error) {
+	err := fmt.Errorf("no available node")
+	for _, node := range nodes {
+		var info *message.PrQueryInfo
+		if info, err = s.query(node, lunId); err == nil {
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+//healthyNodes returns the available nodes except nodeId, the ones with heartbeat first
+func healthyNodes(nodeId string) []config.Node {
+	nodes := make([]config.Node, 0)
+	for _, node := range config.GetAvailableNodes() {
+		if node.Name != nodeId {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Active() != nodes[j].Active() {
+			return nodes[i].Active()
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
+
+//inUseVolumes returns the in use volumes, except the luns of the in use lvs which are fenced with their lv
+func inUseVolumes(lvs []*lv.LogicalVolumeEntity) []*lv.LogicalVolumeEntity {
+	children := make(map[string]bool)
+	for _, lvEntity := range lvs {
+		if lvEntity.LvType == common.MultipathVolume || lvEntity.Children == nil {
+			continue
+		}
+		for _, child := range lvEntity.Children.Items {
+			children[child.GetVolumeId()] = true
+		}
+	}
+	volumes := make([]*lv.LogicalVolumeEntity, 0)
+	for _, lvEntity := range lvs {
+		if lvEntity.UsedByType != domain.DBUsed || lvEntity.PrKey == "" || children[lvEntity.VolumeId] {
+			continue
+		}
+		volumes = append(volumes, lvEntity)
+	}
+	return volumes
+}
+
+//registeredKeysOf returns the registered keys of the node key, including the ones fenced by a generation
+func registeredKeysOf(info *message.PrQueryInfo, nodeKey string) []string {
+	keys := make([]string, 0)
+	for key := range info.Keys {
+		if prkey.IsNodeKey(key, nodeKey) {
+			keys = append(keys, common.NormalizePrKey(key))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+package service
+
+import (
+	"polardb-sms/pkg/common"
+	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/network/message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFenceTargets(t *testing.T) {
+	newLun := func(volumeId, prKey string) *lv.LogicalVolumeEntity {
+		return &lv.LogicalVolumeEntity{
+			VolumeInfo: domain.VolumeInfo{VolumeId: volumeId},
+			LvType:     common.MultipathVolume,
+			PrKey:      prKey,
+			UsedByType: domain.DBUsed,
+		}
+	}
+	lun1, lun2, lun3 := newLun("lun-1", "0x10a000001"), newLun("lun-2", "0x10a000001"), newLun("lun-3", "0x0a000002")
+	lv1 := newLun("lv-1", "0x10a000001")
+	lv1.LvType = common.DmLinearVolume
+	lv1.Children = &lv.Children{}
+	lv1.Children.AddChild(lun1)
+	lv1.Children.AddChild(lun2)
+	unused := newLun("lun-4", "")
+
+	volumes := inUseVolumes([]*lv.LogicalVolumeEntity{lun1, lv1, lun2, lun3, unused})
+	ids := make([]string, 0)
+	for _, v := range volumes {
+		ids = append(ids, v.VolumeId)
+	}
+	//the luns of lv-1 are fenced with it
+	assert.Equal(t, []string{"lv-1", "lun-3"}, ids)
+
+	info := &message.PrQueryInfo{
+		Keys: map[string]int{"0x10a000001": 2, "0x0a000001": 1, "0x0a000002": 2},
+	}
+	assert.Equal(t, []string{"0x10a000001", "0xa000001"}, registeredKeysOf(info, "0x0a000001"))
+	assert.Empty(t, registeredKeysOf(info, "0x0a000003"))
+}
@@ -22,6 +22,8 @@ import (
 	"polardb-sms/pkg/manager/application/view"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prcap"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/manager/domain/pv"
 	"polardb-sms/pkg/manager/domain/workflow"
 	"polardb-sms/pkg/manager/domain/workflow/stage"
@@ -29,16 +31,18 @@ import (
 )
 
 type PrCheckService struct {
-	lvRepo  lv.LvRepository
-	pvRepo  pv.PhysicalVolumeRepository
-	wflRepo workflow.WorkflowRepository
+	lvRepo      lv.LvRepository
+	pvRepo      pv.PhysicalVolumeRepository
+	wflRepo     workflow.WorkflowRepository
+	profileRepo prcap.PrCapabilityProfileRepository
 }
 
 func NewPrCheckService() *PrCheckService {
 	return &PrCheckService{
-		lvRepo:  lv.GetLvRepository(),
-		pvRepo:  pv.GetPhysicalVolumeRepository(),
-		wflRepo: workflow.NewWorkflowRepository(),
+		lvRepo:      lv.GetLvRepository(),
+		pvRepo:      pv.GetPhysicalVolumeRepository(),
+		wflRepo:     workflow.NewWorkflowRepository(),
+		profileRepo: prcap.GetPrCapabilityProfileRepository(),
 	}
 }
 
@@ -80,15 +84,15 @@ func (s *PrCheckService) CheckDetail(v *view.PrCheckRequest) (string, error) {
 
 	var wb = workflow.NewWflBuilder().WithType(workflow.PrCheck)
 	var nodeList = make([]config.Node, 0)
-	//Check PathNum
 	for _, node := range config.GetAvailableNodes() {
 		nodeList = append(nodeList, node)
-		stageRunner, err := stage.NewCheckPathNumCmdStage(node, lvEntity.VolumeId, lvEntity.LvType)
-		if err != nil {
-			return "", err
-		}
-		wb.WithStageRunner(stageRunner)
 	}
+	//Check PathNum
+	pathNumStageRunner, err := stage.NewCheckPathNumGroupStage(nodeList, lvEntity.VolumeId, lvEntity.LvType)
+	if err != nil {
+		return "", err
+	}
+	wb.WithStageRunner(pathNumStageRunner)
 
 	if len(nodeList)%2 != 0 {
 		nodeList = append(nodeList, nodeList[0])
@@ -140,11 +144,98 @@ func (s *PrCheckService) CheckDetailResponse(volumeId string, volumeClass string
 	return nil, nil
 }
 
+//CheckCapability probes the scratch lun node by node, for the probes of two nodes on the same lun conflict,
+//and saves the result as the profile of the lun vendor and product
+func (s *PrCheckService) CheckCapability(v *view.PrCapabilityRequest) (*prcap.PrCapabilityProfileEntity, error) {
+	lunEntity, err := s.lvRepo.FindByVolumeId(v.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	if lunEntity == nil || lunEntity.LvType != common.MultipathVolume {
+		return nil, fmt.Errorf("can not find lun %s", v.VolumeId)
+	}
+	if lunEntity.IsUsed() || lunEntity.PrKey != "" {
+		return nil, fmt.Errorf("lun %s is in use, only the scratch lun can be probed", v.VolumeId)
+	}
+	if lunEntity.Vendor == "" || lunEntity.Product == "" {
+		return nil, fmt.Errorf("vendor or product of lun %s is unknown", v.VolumeId)
+	}
+	reserveType := message.WEAR
+	if v.ReserveType != 0 {
+		reserveType = message.PrType(v.ReserveType)
+	}
+
+	var nodes = make([]config.Node, 0)
+	if len(v.NodeIds) == 0 {
+		for _, node := range config.GetAvailableNodes() {
+			nodes = append(nodes, node)
+		}
+	}
+	for _, nodeId := range v.NodeIds {
+		node := config.GetNodeById(nodeId)
+		if node == nil {
+			return nil, fmt.Errorf("can not find node %s", nodeId)
+		}
+		nodes = append(nodes, *node)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no available node")
+	}
+
+	var results = make([]*prcap.NodeCapability, 0, len(nodes))
+	for _, node := range nodes {
+		result := &prcap.NodeCapability{NodeId: node.Name}
+		if result.Paths, err = probeCapability(node, v.VolumeId, reserveType); err != nil {
+			smslog.Errorf("probe pr capability of lun %s on node %s err %s", v.VolumeId, node.Name, err.Error())
+			result.ErrMsg = err.Error()
+		}
+		results = append(results, result)
+	}
+	profile := prcap.NewProfile(lunEntity.Vendor, lunEntity.Product, v.VolumeId, reserveType, results)
+	if _, err = s.profileRepo.Save(profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *PrCheckService) QueryCapabilityProfiles() ([]*prcap.PrCapabilityProfileEntity, error) {
+	return s.profileRepo.QueryAll()
+}
+
+func probeCapability(node config.Node, lunId string, reserveType message.PrType) ([]*message.PrPathCapability, error) {
+	prKey, err := prkey.RegisterKeyOf(node)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := stage.NewPrCapabilityStage(node, lunId, common.MultipathVolume, prKey, reserveType)
+	if err != nil {
+		return nil, err
+	}
+	ret := runner.Run(common.TraceContext{"lun": lunId})
+	if !ret.IsSuccess() {
+		return nil, fmt.Errorf("probe on node %s err %s", node.Name, ret.ErrMsg)
+	}
+	result := &message.PrCheckCmdResult{}
+	if err := common.BytesToStruct(ret.Content, result); err != nil {
+		return nil, err
+	}
+	if result.Capability == nil {
+		return nil, fmt.Errorf("agent on node %s does not support pr capability probe", node.Name)
+	}
+	return result.Capability, nil
+}
+
 //pair(left, right) pr check stage
 func (s *PrCheckService) genPairCheckStages(v *lv.LogicalVolumeEntity, leftNode, rightNode config.Node) ([]workflow.StageRunner, error) {
-	prReserveType := message.WEAR
-	leftNodePrKey := common.IpV4ToPrKey(leftNode.Ip)
-	rightNodePrKey := common.IpV4ToPrKey(rightNode.Ip)
+	prReserveType := v.ReserveType()
+	leftNodePrKey, err := prkey.RegisterKeyOf(leftNode)
+	if err != nil {
+		return nil, err
+	}
+	rightNodePrKey, err := prkey.RegisterKeyOf(rightNode)
+	if err != nil {
+		return nil, err
+	}
 	var stages []workflow.StageRunner
 
 	leftRegAndReserveRunner, err := stage.NewRegisterAndReserveCmdStage(leftNode, v.VolumeId, v.LvType, leftNodePrKey, prReserveType)
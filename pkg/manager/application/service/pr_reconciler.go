@@ -0,0 +1,397 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/application/view"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
+	"polardb-sms/pkg/manager/domain/workflow"
+	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"polardb-sms/pkg/network/message"
+)
+
+//the drifts between the pr state of the array and LogicalVolumeEntity.PrKey
+const (
+	//DriftStaleKey is the key registered by a node not available in the cluster
+	DriftStaleKey = "stale_key"
+	//DriftMissingKey is the writer key not registered
+	DriftMissingKey = "missing_key"
+	//DriftMissingReservation is no reservation on the lun
+	DriftMissingReservation = "missing_reservation"
+	//DriftUnexpectedType is the reservation of a type other than the one the workflows take
+	DriftUnexpectedType = "unexpected_type"
+	//DriftUnexpectedHolder is another node holding the reservation, or able to write for the all registrants types
+	DriftUnexpectedHolder = "unexpected_holder"
+)
+
+var driftTypes = []string{DriftStaleKey, DriftMissingKey, DriftMissingReservation, DriftUnexpectedType, DriftUnexpectedHolder}
+
+var _reconciler *PrReconciler
+var _reconcilerOnce sync.Once
+
+//PrReconciler audits the pr state of the in use volumes against the db, it is run by the leader only
+type PrReconciler struct {
+	lvRepo      lv.LvRepository
+	wflRepo     workflow.WorkflowRepository
+	query       func(node config.Node, lunId string) (*message.PrQueryInfo, error)
+	nodeOf      func(prKey string) *config.Node
+	submit      func(wfl *workflow.WorkflowEntity) error
+	innerStopCh chan struct{}
+
+	lock          sync.Mutex
+	reconcileLock sync.Mutex
+	report        *view.PrDriftReport
+	runs          int64
+	repairs       int64
+}
+
+func (r *PrReconciler) Run() {
+	defer smslog.LogPanic()
+	stopCh := make(chan struct{})
+	r.innerStopCh = stopCh
+	interval := config.ReservationConf.ReconcileIntervalMinutes
+	if interval == 0 {
+		smslog.Info("pr reconcile is disabled")
+		<-stopCh
+		return
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			smslog.Info("stop prReconciler")
+			return
+		case <-ticker.C:
+			r.Reconcile(config.ReservationConf.ReconcileRepair)
+		}
+	}
+}
+
+func (r *PrReconciler) Stop() {
+	smslog.Infof("Stop PrReconciler")
+	if r.innerStopCh != nil {
+		close(r.innerStopCh)
+		r.innerStopCh = nil
+	}
+}
+
+func (r *PrReconciler) Identify() string {
+	return "prReconciler"
+}
+
+//LastReport returns nil if not reconciled yet
+func (r *PrReconciler) LastReport() *view.PrDriftReport {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.report
+}
+
+//Reconcile audits all the in use volumes, the volumes busy with a workflow are skipped for their pr state is changing.
+//The volumes lost their keys are restored even if repair is false when RestoreLostPr is set
+func (r *PrReconciler) Reconcile(repair bool) (*view.PrDriftReport, error) {
+	return r.reconcile(func(drifts []*view.PrDrift) bool {
+		return repair || (config.ReservationConf.RestoreLostPr && isLostPr(drifts))
+	})
+}
+
+//Restore is run after the array restarts, only the volumes lost their keys are repaired:
+//the writer recorded in the db registers and reserves again, no other key is preempted
+func (r *PrReconciler) Restore() (*view.PrDriftReport, error) {
+	return r.reconcile(isLostPr)
+}
+
+//isLostPr returns whether only the writer key or the reservation is lost, as the array restarted without aptpl
+func isLostPr(drifts []*view.PrDrift) bool {
+	for _, drift := range drifts {
+		if drift.DriftType != DriftMissingKey && drift.DriftType != DriftMissingReservation {
+			return false
+		}
+	}
+	return len(drifts) > 0
+}
+
+func (r *PrReconciler) reconcile(needRepair func(drifts []*view.PrDrift) bool) (*view.PrDriftReport, error) {
+	r.reconcileLock.Lock()
+	defer r.reconcileLock.Unlock()
+	report := &view.PrDriftReport{
+		StartTime:       time.Now(),
+		Drifts:          make([]*view.PrDrift, 0),
+		Errors:          make([]*view.PrAuditError, 0),
+		RepairWorkflows: make([]string, 0),
+	}
+	lvs, err := r.lvRepo.QueryAll()
+	if err != nil {
+		smslog.Errorf("pr reconcile: query lvs err %s", err.Error())
+		return nil, err
+	}
+	for _, lvEntity := range lvs {
+		if lvEntity.UsedByType != domain.DBUsed || lvEntity.PrKey == "" {
+			continue
+		}
+		unfinished, err := r.wflRepo.FindUnfinished(lvEntity.VolumeId)
+		if err != nil || len(unfinished) > 0 {
+			continue
+		}
+		report.Volumes++
+		drifts := r.audit(lvEntity, report)
+		report.Drifts = append(report.Drifts, drifts...)
+		if len(drifts) > 0 && needRepair(drifts) {
+			wflId, err := r.repair(lvEntity, drifts)
+			if err != nil {
+				smslog.Errorf("pr reconcile: repair volume %s err %s", lvEntity.VolumeId, err.Error())
+				report.Errors = append(report.Errors, &view.PrAuditError{VolumeId: lvEntity.VolumeId, ErrMsg: err.Error()})
+				continue
+			}
+			report.RepairWorkflows = append(report.RepairWorkflows, wflId)
+		}
+	}
+	report.FinishTime = time.Now()
+	smslog.Infof("pr reconcile: audited %d volumes, %d drifts, %d errors, %d repair workflows",
+		report.Volumes, len(report.Drifts), len(report.Errors), len(report.RepairWorkflows))
+
+	r.lock.Lock()
+	r.report = report
+	r.runs++
+	r.repairs += int64(len(report.RepairWorkflows))
+	r.lock.Unlock()
+	return report, nil
+}
+
+//luns returns the luns holding the pr of the volume
+func luns(lvEntity *lv.LogicalVolumeEntity) []string {
+	if lvEntity.LvType == common.MultipathVolume || lvEntity.Children == nil {
+		return []string{lvEntity.VolumeId}
+	}
+	ids := make([]string, 0)
+	for _, child := range lvEntity.Children.Items {
+		ids = append(ids, child.GetVolumeId())
+	}
+	return ids
+}
+
+func (r *PrReconciler) audit(lvEntity *lv.LogicalVolumeEntity, report *view.PrDriftReport) []*view.PrDrift {
+	drifts := make([]*view.PrDrift, 0)
+	for _, lunId := range luns(lvEntity) {
+		info, err := r.queryOnAnyNode(lvEntity.PrKey, lunId)
+		if err != nil {
+			smslog.Errorf("pr reconcile: query pr of lun %s of volume %s err %s", lunId, lvEntity.VolumeId, err.Error())
+			report.Errors = append(report.Errors, &view.PrAuditError{VolumeId: lvEntity.VolumeId, LunId: lunId, ErrMsg: err.Error()})
+			continue
+		}
+		drifts = append(drifts, r.checkPrDrift(lvEntity.VolumeId, lunId, lvEntity.PrKey, lvEntity.ReserveType(), info)...)
+	}
+	return drifts
+}
+
+//queryOnAnyNode prefers the writer node, and tries the others if it fails
+func (r *PrReconciler) queryOnAnyNode(prKey, lunId string) (*message.PrQueryInfo, error) {
+	nodes := make([]config.Node, 0)
+	writer := r.nodeOf(prKey)
+	if writer != nil {
+		nodes = append(nodes, *writer)
+	}
+	for _, node := range config.GetAvailableNodes() {
+		if writer == nil || node.Name != writer.Name {
+			nodes = append(nodes, node)
+		}
+	}
+	err := fmt.Errorf("no available node")
+	for _, node := range nodes {
+		var info *message.PrQueryInfo
+		if info, err = r.query(node, lunId); err == nil {
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+func queryPrInfo(node config.Node, lunId string) (*message.PrQueryInfo, error) {
+	runner, err := stage.NewPrQueryStage(node, lunId, common.MultipathVolume)
+	if err != nil {
+		return nil, err
+	}
+	ret := runner.Run(common.TraceContext{"lun": lunId})
+	if !ret.IsSuccess() {
+		return nil, fmt.Errorf("query pr on node %s err %s", node.Name, ret.ErrMsg)
+	}
+	result := &message.PrCheckCmdResult{}
+	if err := common.BytesToStruct(ret.Content, result); err != nil {
+		return nil, err
+	}
+	if result.PrInfo == nil {
+		return nil, fmt.Errorf("agent on node %s does not support pr query", node.Name)
+	}
+	return result.PrInfo, nil
+}
+
+func isAllRegistrantsType(typeName string) bool {
+	return typeName == message.WEAR.String() || typeName == message.EAAR.String()
+}
+
+//checkPrDrift compares the pr state with prKey holding the reservation of expectedPrType the lock workflows take
+func (r *PrReconciler) checkPrDrift(volumeId, lunId, prKey string, expectedPrType message.PrType, info *message.PrQueryInfo) []*view.PrDrift {
+	var (
+		drifts      = make([]*view.PrDrift, 0)
+		expectedKey = common.NormalizePrKey(prKey)
+		keys        = make([]string, 0)
+	)
+	newDrift := func(driftType, actualKey, detail string) {
+		drifts = append(drifts, &view.PrDrift{
+			VolumeId:    volumeId,
+			LunId:       lunId,
+			DriftType:   driftType,
+			ExpectedKey: expectedKey,
+			ActualKey:   actualKey,
+			Detail:      detail,
+		})
+	}
+	for key := range info.Keys {
+		keys = append(keys, common.NormalizePrKey(key))
+	}
+	sort.Strings(keys)
+	registered := false
+	for _, key := range keys {
+		if key == expectedKey {
+			registered = true
+			continue
+		}
+		if r.nodeOf(key) == nil {
+			newDrift(DriftStaleKey, key, "the node of the key is not available")
+		} else if isAllRegistrantsType(info.ReservationType) {
+			newDrift(DriftUnexpectedHolder, key, fmt.Sprintf("the registrant can write with %s", info.ReservationType))
+		}
+	}
+	if !registered {
+		newDrift(DriftMissingKey, "", "the writer key is not registered")
+	}
+	if info.ReservationType == "" {
+		newDrift(DriftMissingReservation, "", "no reservation")
+		return drifts
+	}
+	if info.ReservationType != expectedPrType.String() {
+		newDrift(DriftUnexpectedType, "", fmt.Sprintf("the reservation type is %s", info.ReservationType))
+	}
+	if !isAllRegistrantsType(info.ReservationType) && common.NormalizePrKey(info.ReservationKey) != expectedKey {
+		newDrift(DriftUnexpectedHolder, common.NormalizePrKey(info.ReservationKey), "the reservation is held by another key")
+	}
+	return drifts
+}
+
+//repair lets the writer preempt the other keys, or register and reserve if there is no other key
+func (r *PrReconciler) repair(lvEntity *lv.LogicalVolumeEntity, drifts []*view.PrDrift) (string, error) {
+	writer := r.nodeOf(lvEntity.PrKey)
+	if writer == nil {
+		return "", fmt.Errorf("the writer node of key %s is not available", lvEntity.PrKey)
+	}
+	if err := prkey.CheckNotFenced(writer.Name); err != nil {
+		return "", err
+	}
+	wb := workflow.NewWflBuilder().WithType(workflow.PrRepair)
+	expectedPrType := lvEntity.ReserveType()
+	planned := make(map[string]bool)
+	for _, drift := range drifts {
+		var (
+			runner *stage.PrBatchStageRunner
+			err    error
+		)
+		//one stage for each key to preempt, or for reserving the lun
+		plan := drift.LunId + "#" + drift.ActualKey
+		if planned[plan] {
+			continue
+		}
+		planned[plan] = true
+		switch {
+		case drift.ActualKey != "":
+			runner, err = stage.NewRegAndPreemptCmdStage(*writer, drift.LunId, common.MultipathVolume, lvEntity.PrKey, drift.ActualKey, expectedPrType)
+		case drift.DriftType == DriftUnexpectedType:
+			//preempting itself changes the reservation type
+			runner, err = stage.NewRegAndPreemptCmdStage(*writer, drift.LunId, common.MultipathVolume, lvEntity.PrKey, lvEntity.PrKey, expectedPrType)
+		default:
+			runner, err = stage.NewRegisterAndReserveCmdStage(*writer, drift.LunId, common.MultipathVolume, lvEntity.PrKey, expectedPrType)
+		}
+		if err != nil {
+			return "", err
+		}
+		wb.WithStageRunner(runner.WithAptpl(lvEntity.Aptpl()))
+	}
+	wfl := wb.Build()
+	wfl.SetVolumeClass(string(lvEntity.LvType.ToVolumeClass()))
+	wfl.SetVolumeId(lvEntity.VolumeId)
+	if err := r.submit(wfl); err != nil {
+		return "", err
+	}
+	smslog.Infof("pr reconcile: submit repair workflow %s for volume %s", wfl.Id, lvEntity.VolumeId)
+	return wfl.Id, nil
+}
+
+//WriteMetrics writes the reconcile metrics in the prometheus text format
+func (r *PrReconciler) WriteMetrics(w io.Writer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	fmt.Fprintf(w, "# HELP sms_pr_reconcile_runs_total Times the pr state is reconciled.\n")
+	fmt.Fprintf(w, "# TYPE sms_pr_reconcile_runs_total counter\n")
+	fmt.Fprintf(w, "sms_pr_reconcile_runs_total %d\n", r.runs)
+	fmt.Fprintf(w, "# HELP sms_pr_repair_workflows_total Pr repair workflows submitted.\n")
+	fmt.Fprintf(w, "# TYPE sms_pr_repair_workflows_total counter\n")
+	fmt.Fprintf(w, "sms_pr_repair_workflows_total %d\n", r.repairs)
+	if r.report == nil {
+		return
+	}
+	counts := make(map[string]int)
+	for _, drift := range r.report.Drifts {
+		counts[drift.DriftType]++
+	}
+	fmt.Fprintf(w, "# HELP sms_pr_drifts Pr drifts found by the last reconcile.\n")
+	fmt.Fprintf(w, "# TYPE sms_pr_drifts gauge\n")
+	for _, driftType := range driftTypes {
+		fmt.Fprintf(w, "sms_pr_drifts{type=%q} %d\n", driftType, counts[driftType])
+	}
+	fmt.Fprintf(w, "# HELP sms_pr_audited_volumes Volumes audited by the last reconcile.\n")
+	fmt.Fprintf(w, "# TYPE sms_pr_audited_volumes gauge\n")
+	fmt.Fprintf(w, "sms_pr_audited_volumes %d\n", r.report.Volumes)
+	fmt.Fprintf(w, "# HELP sms_pr_audit_errors Luns failed to audit by the last reconcile.\n")
+	fmt.Fprintf(w, "# TYPE sms_pr_audit_errors gauge\n")
+	fmt.Fprintf(w, "sms_pr_audit_errors %d\n", len(r.report.Errors))
+	fmt.Fprintf(w, "# HELP sms_pr_reconcile_timestamp_seconds Finish time of the last reconcile.\n")
+	fmt.Fprintf(w, "# TYPE sms_pr_reconcile_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "sms_pr_reconcile_timestamp_seconds %d\n", r.report.FinishTime.Unix())
+}
+
+func GetPrReconciler() *PrReconciler {
+	_reconcilerOnce.Do(
+		func() {
+			_reconciler = &PrReconciler{
+				lvRepo:  lv.GetLvRepository(),
+				wflRepo: workflow.NewWorkflowRepository(),
+				query:   queryPrInfo,
+				nodeOf:  prkey.NodeOf,
+				submit:  GetWorkflowEngine().Submit,
+			}
+		})
+	return _reconciler
+}
@@ -0,0 +1,96 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/application/view"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/network/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func driftSummary(drifts []*view.PrDrift) []string {
+	types := make([]string, 0)
+	for _, drift := range drifts {
+		types = append(types, drift.DriftType+":"+drift.ActualKey)
+	}
+	return types
+}
+
+func TestCheckPrDrift(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	oldNodes := config.ClusterConf.Nodes
+	defer func() {
+		config.ClusterConf.Nodes = oldNodes
+	}()
+	config.ClusterConf.Nodes = map[string]config.Node{
+		"node1": {Name: "node1", Ip: "10.0.0.1", LastHeartbeatTime: time.Now()},
+		"node2": {Name: "node2", Ip: "10.0.0.2", LastHeartbeatTime: time.Now()},
+	}
+	writer, reader, stale := common.IpV4ToPrKey("10.0.0.1"), common.IpV4ToPrKey("10.0.0.2"), common.IpV4ToPrKey("10.0.0.3")
+	wear := message.WEAR.String()
+
+	r := &PrReconciler{nodeOf: func(prKey string) *config.Node {
+		return config.GetNodeByIp(common.PrKeyToIpV4(prKey))
+	}}
+	drifts := r.checkPrDrift("vol", "lun", writer, message.WEAR, &message.PrQueryInfo{
+		Keys:            map[string]int{writer: 2},
+		ReservationKey:  "0x0",
+		ReservationType: wear,
+	})
+	assert.Empty(t, drifts)
+
+	drifts = r.checkPrDrift("vol", "lun", writer, message.EAAR, &message.PrQueryInfo{
+		Keys:            map[string]int{writer: 2},
+		ReservationKey:  "0x0",
+		ReservationType: wear,
+	})
+	assert.Equal(t, []string{DriftUnexpectedType + ":"}, driftSummary(drifts))
+
+	drifts = r.checkPrDrift("vol", "lun", writer, message.WEAR, &message.PrQueryInfo{
+		Keys:            map[string]int{writer: 2, reader: 2, stale: 2},
+		ReservationKey:  "0x0",
+		ReservationType: wear,
+	})
+	assert.Equal(t, []string{
+		DriftUnexpectedHolder + ":0xa000002",
+		DriftStaleKey + ":0xa000003",
+	}, driftSummary(drifts))
+
+	drifts = r.checkPrDrift("vol", "lun", writer, message.WEAR, &message.PrQueryInfo{
+		Keys: map[string]int{reader: 2},
+	})
+	assert.Equal(t, []string{DriftMissingKey + ":", DriftMissingReservation + ":"}, driftSummary(drifts))
+	assert.True(t, isLostPr(drifts))
+
+	drifts = r.checkPrDrift("vol", "lun", writer, message.WEAR, &message.PrQueryInfo{
+		Keys:            map[string]int{writer: 2, reader: 2},
+		ReservationKey:  reader,
+		ReservationType: message.WE.String(),
+	})
+	assert.Equal(t, []string{
+		DriftUnexpectedType + ":",
+		DriftUnexpectedHolder + ":0xa000002",
+	}, driftSummary(drifts))
+	assert.False(t, isLostPr(drifts))
+	assert.False(t, isLostPr(nil))
+}
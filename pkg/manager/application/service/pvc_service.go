@@ -25,8 +25,10 @@ import (
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/k8spvc"
 	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/manager/domain/workflow"
 	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"polardb-sms/pkg/network/message"
 )
 
 type PvcService struct {
@@ -36,6 +38,8 @@ type PvcService struct {
 	pvcAsm     assembler.PvcAssembler
 	lunService *LvForOldLunService
 	lvService  *ClusterLvService
+	//volumeService sets the status of the volume when the workflow is submitted
+	volumeService *VolumeService
 }
 
 func (s *PvcService) PvcExpandFs(ctx common.TraceContext, request *view.PvcExpandFsRequest) (*view.WorkflowIdResponse, error) {
@@ -75,9 +79,13 @@ func (s *PvcService) PvcExpandFs(ctx common.TraceContext, request *view.PvcExpan
 	if err != nil {
 		return nil, err
 	}
+	if request.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(request.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err := GetWorkflowEngine().Submit(wfl); err != nil {
+	if err := s.submitWorkflow(pvcEntity, wfl, false); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -116,7 +124,9 @@ func (s *PvcService) CreatePvcWithVolume(ctx common.TraceContext, pvcCreateView
 		return nil, fmt.Errorf("the lv device wwid: %s  status is useable %v", lvEntity.VolumeId, lvEntity.Status)
 	}
 
-	if err := s.createPvc(pvcEntity, lvEntity); err != nil {
+	if pvcCreateView.DryRun {
+		pvcEntity.SetRequestSize(int64(lvEntity.SectorSize) * lvEntity.Sectors)
+	} else if err := s.createPvc(pvcEntity, lvEntity); err != nil {
 		return nil, err
 	}
 
@@ -124,6 +134,10 @@ func (s *PvcService) CreatePvcWithVolume(ctx common.TraceContext, pvcCreateView
 	if err != nil {
 		return nil, err
 	}
+	if pvcCreateView.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(pvcCreateView.CallbackUrl)
 	wfl.SetTraceContext(ctx)
 	if err := GetWorkflowEngine().Submit(wfl); err != nil {
 		return nil, err
@@ -131,18 +145,88 @@ func (s *PvcService) CreatePvcWithVolume(ctx common.TraceContext, pvcCreateView
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
 }
 
-func (s *PvcService) updatePvcStatus(pvcEntity *k8spvc.PersistVolumeClaimEntity, status domain.VolumeStatusValue) error {
-	oldStatus := pvcEntity.PvcStatus
-	newStatus := domain.VolumeStatus{
-		StatusValue: status,
+//pvcBusyStatus is the status of the pvc while the workflow of type t runs
+func pvcBusyStatus(t workflow.WflType) (domain.VolumeStatusValue, bool) {
+	switch t {
+	case workflow.PvcDelete:
+		return domain.Deleting, true
+	case workflow.PvcRelease:
+		return domain.Releasing, true
+	case workflow.PrLock, workflow.PvcFormatAndLock:
+		return domain.PrLocking, true
+	case workflow.PvcFsExpand:
+		return domain.Expanding, true
+	case workflow.PvcFormat:
+		return domain.Formatting, true
 	}
-	if oldStatus == newStatus {
-		return nil
+	return 0, false
+}
+
+func (s *PvcService) updatePvcStatus(pvcEntity *k8spvc.PersistVolumeClaimEntity, status domain.VolumeStatus) error {
+	//the entity is kept as it is, the stages of the workflow are built from it
+	update := *pvcEntity
+	update.PvcStatus = status
+	if _, err := s.pvcRepo.UpdateStatus(&update); err != nil {
+		return fmt.Errorf("failed update VolumeStatus[-> %v] pvc with volumeId %s, err %v", status, pvcEntity.DiskStatus.VolumeId, err)
 	}
+	return nil
+}
 
-	pvcEntity.PvcStatus = newStatus
-	if _, err := s.pvcRepo.UpdateStatus(pvcEntity); err != nil {
-		return fmt.Errorf("failed update VolumeStatus[%v -> %v] pvc with volumeId %s, err %v", oldStatus, newStatus, pvcEntity.DiskStatus.VolumeId, err)
+//markPvcBusy returns the func restoring the status if the workflow is rejected
+func (s *PvcService) markPvcBusy(pvcEntity *k8spvc.PersistVolumeClaimEntity, t workflow.WflType) (func(), error) {
+	status, ok := pvcBusyStatus(t)
+	if !ok {
+		return func() {}, nil
+	}
+	origin, err := s.pvcRepo.FindByPvcName(pvcEntity.Name, pvcEntity.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if origin == nil {
+		return nil, fmt.Errorf("can not find pvc %s/%s", pvcEntity.Namespace, pvcEntity.Name)
+	}
+	busy := domain.VolumeStatus{StatusValue: status}
+	if origin.PvcStatus == busy {
+		return func() {}, nil
+	}
+	if err = s.updatePvcStatus(pvcEntity, busy); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := s.updatePvcStatus(pvcEntity, origin.PvcStatus); err != nil {
+			smslog.Errorf("restore the status of pvc %s err %s", pvcEntity.Name, err.Error())
+		}
+	}, nil
+}
+
+//submitWorkflow marks the pvc and its volume busy and locks the pvc to wfl if lock, on the real submit only.
+//all of them are undone if the engine rejects wfl, so nothing is left to a workflow that never exists
+func (s *PvcService) submitWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, wfl *workflow.WorkflowEntity, lock bool) error {
+	restoreVolume, err := s.volumeService.markVolumeBusy(wfl)
+	if err != nil {
+		return err
+	}
+	restorePvc, err := s.markPvcBusy(pvcEntity, wfl.WflType)
+	if err != nil {
+		restoreVolume()
+		return err
+	}
+	if lock {
+		if err = pvcEntity.Lock(wfl.Id); err != nil {
+			restorePvc()
+			restoreVolume()
+			return err
+		}
+	}
+	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+		if lock {
+			if uerr := pvcEntity.UnLock(); uerr != nil {
+				smslog.Errorf("unlock pvc %s from rejected workflow %s err %s", pvcEntity.Name, wfl.Id, uerr.Error())
+			}
+		}
+		restorePvc()
+		restoreVolume()
+		return err
 	}
 	return nil
 }
@@ -174,9 +258,13 @@ func (s *PvcService) DeletePvc(ctx common.TraceContext, pvcRequest *view.PvcRequ
 	if err != nil {
 		return nil, err
 	}
+	if pvcRequest.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(pvcRequest.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err := GetWorkflowEngine().Submit(wfl); err != nil {
+	if err := s.submitWorkflow(pvcEntity, wfl, false); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -201,9 +289,13 @@ func (s *PvcService) ReleasePvc(ctx common.TraceContext, pvcRequest *view.PvcReq
 	if err != nil {
 		return nil, err
 	}
+	if pvcRequest.DryRun {
+		return planWorkflow(wfl), nil
+	}
+	wfl.SetCallbackUrl(pvcRequest.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err := GetWorkflowEngine().Submit(wfl); err != nil {
+	if err := s.submitWorkflow(pvcEntity, wfl, false); err != nil {
 		return nil, err
 	}
 	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
@@ -256,7 +348,10 @@ func (s *PvcService) ForceFormatAndLock(ctx common.TraceContext, request *view.P
 		}
 	}
 
-	prKey := common.IpV4ToPrKey(prNode.Ip)
+	prKey, err := prkey.RegisterKeyOf(*prNode)
+	if err != nil {
+		return nil, err
+	}
 	pvcEntity.SetRequestPrKey(prKey)
 	wfl, err = s.genWorkflow(pvcEntity, lvEntity, workflow.PvcFormatAndLock)
 	if err != nil {
@@ -265,14 +360,17 @@ func (s *PvcService) ForceFormatAndLock(ctx common.TraceContext, request *view.P
 
 	wfl.SetVolumeClass(volumeClass)
 	wfl.SetVolumeId(pvcEntity.GetVolumeId())
-
-	if err := GetWorkflowEngine().Submit(wfl); err != nil {
-		return nil, err
+	if request.DryRun {
+		return planWorkflow(wfl), nil
 	}
+	wfl.SetCallbackUrl(request.CallbackUrl)
 
-	err = pvcEntity.Lock(wfl.Id)
-	if err != nil {
-		smslog.WithContext(ctx).Errorf("can not lock the pvc for %s", err.Error())
+	//the force format goes on even if the pvc is locked by another workflow
+	if pvcEntity.IsLocked() {
+		smslog.WithContext(ctx).Errorf("can not lock the pvc %s, now locked by %s", pvcEntity.Name, pvcEntity.GetLockedWorkflow())
+	}
+	if err := s.submitWorkflow(pvcEntity, wfl, !pvcEntity.IsLocked()); err != nil {
+		return nil, err
 	}
 
 	return &view.WorkflowIdResponse{
@@ -318,14 +416,13 @@ func (s *PvcService) PvcFsFormat(ctx common.TraceContext, formatRequest *view.Pv
 	if err != nil {
 		return nil, err
 	}
-
-	err = pvcEntity.Lock(wfl.Id)
-	if err != nil {
-		return nil, err
+	if formatRequest.DryRun {
+		return planWorkflow(wfl), nil
 	}
+	wfl.SetCallbackUrl(formatRequest.CallbackUrl)
 
 	wfl.SetTraceContext(ctx)
-	if err := GetWorkflowEngine().Submit(wfl); err != nil {
+	if err := s.submitWorkflow(pvcEntity, wfl, true); err != nil {
 		return nil, err
 	}
 
@@ -341,12 +438,15 @@ func (s *PvcService) SetVolumeWriteLock(ctx common.TraceContext, lockRequest *vi
 	if node == nil {
 		return nil, fmt.Errorf("can not find NodeId %s in clusterConf", lockRequest.WriteLockNodeId)
 	}
-	prKey := common.IpV4ToPrKey(node.Ip)
+	prKey, err := prkey.RegisterKeyOf(*node)
+	if err != nil {
+		return nil, err
+	}
 	pvcEntity.SetRequestPrKey(prKey)
-	return s.setVolumeWriteLock(ctx, pvcEntity)
+	return s.setVolumeWriteLock(ctx, pvcEntity, &lockRequest.PvcRequest)
 }
 
-func (s *PvcService) setVolumeWriteLock(ctx common.TraceContext, pvcEntity *k8spvc.PersistVolumeClaimEntity) (*view.WorkflowIdResponse, error) {
+func (s *PvcService) setVolumeWriteLock(ctx common.TraceContext, pvcEntity *k8spvc.PersistVolumeClaimEntity, req *view.PvcRequest) (*view.WorkflowIdResponse, error) {
 	//已经锁住的pvc, 不允许新建workflow
 	//TODO 优化，允许新加workflow, 需要增加一个queue对于同一个pvc
 	if pvcEntity.IsLocked() {
@@ -360,24 +460,25 @@ func (s *PvcService) setVolumeWriteLock(ctx common.TraceContext, pvcEntity *k8sp
 		return nil, fmt.Errorf("can not find the lun for wwid: %s", pvcEntity.DiskStatus.VolumeId)
 	}
 
-	if lvEntity.PrKey != "" && lvEntity.PrKey == pvcEntity.ExpectedDiskStatus.PrKey {
-		return &view.WorkflowIdResponse{WorkflowId: domain.DummyWorkflowId}, nil
+	holder, expected := prkey.NodeOf(lvEntity.PrKey), prkey.NodeOf(pvcEntity.ExpectedDiskStatus.PrKey)
+	if holder != nil && expected != nil && holder.Name == expected.Name {
+		return &view.WorkflowIdResponse{WorkflowId: domain.DummyWorkflowId, FenceGeneration: lvEntity.FenceGeneration}, nil
 	}
 
 	wfl, err := s.genWorkflow(pvcEntity, lvEntity, workflow.PrLock)
 	if err != nil {
 		return nil, err
 	}
-
-	err = pvcEntity.Lock(wfl.Id)
-	if err != nil {
-		return nil, err
+	if req.DryRun {
+		return planWorkflow(wfl), nil
 	}
+	wfl.SetCallbackUrl(req.CallbackUrl)
+
 	wfl.SetTraceContext(ctx)
-	if err := GetWorkflowEngine().Submit(wfl); err != nil {
+	if err := s.submitWorkflow(pvcEntity, wfl, true); err != nil {
 		return nil, err
 	}
-	return &view.WorkflowIdResponse{WorkflowId: wfl.Id}, nil
+	return &view.WorkflowIdResponse{WorkflowId: wfl.Id, FenceGeneration: lvEntity.FenceGeneration}, nil
 }
 
 func (s *PvcService) PvcIsReady(pvcName, namespace, workflowId string) (*view.PvcIsReadyResponse, error) {
@@ -581,9 +682,37 @@ func (s *PvcService) genPvcBindWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEnti
 		return err
 	}
 	wb.WithStageRunner(lvUpdateRunner)
+	changed, err := s.applyStorageClass(pvcEntity, lvEntity)
+	if err != nil {
+		return err
+	}
+	if changed {
+		lvExtendRunner, err := stage.NewDBPersistLvExtendStage(lvEntity)
+		if err != nil {
+			return err
+		}
+		wb.WithStageRunner(lvExtendRunner)
+	}
 	return nil
 }
 
+//applyStorageClass sets the pr options of the storage class to the lv, returns whether the extend is changed
+func (s *PvcService) applyStorageClass(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvEntity *lv.LogicalVolumeEntity) (bool, error) {
+	changed := false
+	if config.ReservationConf.AptplFor(pvcEntity.StorageClassName) {
+		lvEntity.SetAptpl(true)
+		changed = true
+	}
+	if config.ReservationConf.ExclusiveAccessFor(pvcEntity.StorageClassName) {
+		if err := s.lvService.CheckReserveType(lvEntity, message.EAAR); err != nil {
+			return false, err
+		}
+		lvEntity.SetReserveType(message.EAAR)
+		changed = true
+	}
+	return changed, nil
+}
+
 func (s *PvcService) genPvcCreateWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
 	format := pvcEntity.ExpectedDiskStatus.NeedFormat
 	var fsType = common.Pfs
@@ -613,6 +742,9 @@ func (s *PvcService) genPvcCreateWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEn
 	wb.WithStageRunner(pvPersistStageRunner)
 	//update lun/lv
 	lvEntity.SetUsedBy(pvcEntity.Name, domain.DBUsed)
+	if _, err = s.applyStorageClass(pvcEntity, lvEntity); err != nil {
+		return err
+	}
 	lvUpdateRunner, err := stage.NewDBPersistLvUpdateStage(lvEntity)
 	if err != nil {
 		return err
@@ -632,10 +764,6 @@ func (s *PvcService) genPvcCreateWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEn
 }
 
 func (s *PvcService) genPvcDeleteWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
-	err := s.updatePvcStatus(pvcEntity, domain.Deleting)
-	if err != nil {
-		return err
-	}
 	clearPrLockStageRunners := s.lvService.getLvUnLockStageRunners(lvEntity, pvcEntity.PvName)
 	wb.WithStageRunners(clearPrLockStageRunners)
 
@@ -656,10 +784,6 @@ func (s *PvcService) genPvcDeleteWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEn
 }
 
 func (s *PvcService) genPvcReleaseWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
-	err := s.updatePvcStatus(pvcEntity, domain.Releasing)
-	if err != nil {
-		return err
-	}
 	clearPrLockStageRunners := s.lvService.getLvUnLockStageRunners(lvEntity, pvcEntity.PvName)
 	wb.WithStageRunners(clearPrLockStageRunners)
 
@@ -685,32 +809,21 @@ func (s *PvcService) genPvcReleaseWorkflow(pvcEntity *k8spvc.PersistVolumeClaimE
 }
 
 func (s *PvcService) genPvcLockWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
-	prNodeIp := common.PrKeyToIpV4(pvcEntity.ExpectedDiskStatus.PrKey)
-	prNode := config.GetNodeByIp(prNodeIp)
+	prNode := prkey.NodeOf(pvcEntity.ExpectedDiskStatus.PrKey)
 	if prNode == nil {
 		err := fmt.Errorf("can not find the prNode for PrKey %s", pvcEntity.ExpectedDiskStatus.PrKey)
 		smslog.Infof(err.Error())
 		return err
 	}
-	var currentNodeIp string
-	if lvEntity.PrKey != "" {
-		currentNodeIp = common.PrKeyToIpV4(lvEntity.PrKey)
-	}
-
-	err := s.updatePvcStatus(pvcEntity, domain.PrLocking)
-	if err != nil {
-		return err
-	}
 
 	//lock lv
-	prLockStageRunners, err := s.lvService.getLvLockStageRunners(lvEntity, *prNode, currentNodeIp)
+	prLockStageRunners, err := s.lvService.getLvLockStageRunners(lvEntity, *prNode, lvEntity.PrKey)
 	if err != nil {
 		return err
 	}
 	wb.WithStageRunners(prLockStageRunners)
 
-	//update lun
-	lvEntity.PrKey = pvcEntity.ExpectedDiskStatus.PrKey
+	//update lun, the pr key and fence generation are set by getLvLockStageRunners
 	lvUpdateStageRunner, err := stage.NewDBPersistLvUpdateStage(lvEntity)
 	if err != nil {
 		return err
@@ -739,17 +852,12 @@ func (s *PvcService) genPvcLockWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEnti
 func (s *PvcService) genPvcExpandFsWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvEntity *lv.LogicalVolumeEntity, wb *workflow.WflBuilder) error {
 	//expand fs
 	//update lun fs size
-	err := s.updatePvcStatus(pvcEntity, domain.Expanding)
-	if err != nil {
-		return err
-	}
 
-	prNodeIp := common.PrKeyToIpV4(pvcEntity.DiskStatus.PrKey)
 	var prNode *config.Node
-	if prNodeIp == "" {
+	if pvcEntity.DiskStatus.PrKey == "" {
 		prNode = config.GetOneNode()
 	} else {
-		prNode = config.GetNodeByIp(prNodeIp)
+		prNode = prkey.NodeOf(pvcEntity.DiskStatus.PrKey)
 	}
 	if prNode == nil {
 		return fmt.Errorf("can not get prNode for lun %v", lvEntity)
@@ -826,11 +934,6 @@ func (s *PvcService) genPvcFormatWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEn
 	)
 	volumeClass := pvcEntity.GetVolumeType().ToVolumeClass()
 
-	err = s.updatePvcStatus(pvcEntity, domain.Formatting)
-	if err != nil {
-		return err
-	}
-
 	if volumeClass == common.LunClass {
 		err = s.lunService.genFormatWorkflow(lvEntity, wb)
 	}
@@ -890,11 +993,12 @@ func (s *PvcService) genWorkflow(pvcEntity *k8spvc.PersistVolumeClaimEntity, lvE
 
 func NewPvcService() *PvcService {
 	return &PvcService{
-		lvRepo:     lv.GetLvRepository(),
-		wflRepo:    workflow.NewWorkflowRepository(),
-		pvcRepo:    k8spvc.GetPvcRepository(),
-		pvcAsm:     assembler.NewPvcAssembler(),
-		lunService: NewLvForOldLunService(),
-		lvService:  NewClusterLvService(),
+		lvRepo:        lv.GetLvRepository(),
+		wflRepo:       workflow.NewWorkflowRepository(),
+		pvcRepo:       k8spvc.GetPvcRepository(),
+		pvcAsm:        assembler.NewPvcAssembler(),
+		lunService:    NewLvForOldLunService(),
+		lvService:     NewClusterLvService(),
+		volumeService: NewVolumeService(),
 	}
 }
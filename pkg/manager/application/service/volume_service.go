@@ -17,6 +17,7 @@ package service
 
 import (
 	"fmt"
+	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/application/view"
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/lv"
@@ -59,6 +60,60 @@ func (s *VolumeService) updateVolumeStatus(lvEntity *lv.LogicalVolumeEntity, sta
 	return nil
 }
 
+//volumeBusyStatus is the status of the volume while the workflow of type t runs
+func volumeBusyStatus(t workflow.WflType) (domain.VolumeStatusValue, bool) {
+	switch t {
+	case workflow.ClusterLvFormat, workflow.ClusterLunFormat, workflow.PvcFormat, workflow.PvcFormatAndLock:
+		return domain.Formatting, true
+	case workflow.ClusterLvExpand, workflow.ClusterLvFsExpand, workflow.ClusterLunFsExpand:
+		return domain.Expanding, true
+	case workflow.ClusterLvDelete:
+		return domain.Deleting, true
+	}
+	return 0, false
+}
+
+//markVolumeBusy is called on the real submit only, so that the plan of a dry run has no side effect.
+//the returned func restores the status if the workflow is rejected
+func (s *VolumeService) markVolumeBusy(wfl *workflow.WorkflowEntity) (func(), error) {
+	status, ok := volumeBusyStatus(wfl.WflType)
+	if !ok {
+		return func() {}, nil
+	}
+	origin, err := s.lvRepo.FindByVolumeId(wfl.VolumeId)
+	if err != nil {
+		return nil, err
+	}
+	if origin == nil {
+		return nil, fmt.Errorf("can not find the volume %s", wfl.VolumeId)
+	}
+	if err = s.updateVolumeStatus(origin, status); err != nil {
+		return nil, err
+	}
+	return func() {
+		busy := &lv.LogicalVolumeEntity{
+			VolumeInfo: domain.VolumeInfo{VolumeId: origin.VolumeId},
+			Status:     domain.VolumeStatus{StatusValue: status},
+		}
+		if err := s.updateVolumeStatus(busy, origin.Status.StatusValue); err != nil {
+			smslog.Errorf("restore the status of volume %s err %s", origin.VolumeId, err.Error())
+		}
+	}, nil
+}
+
+//submitWorkflow submits the workflow on the volume with the busy status set
+func (s *VolumeService) submitWorkflow(wfl *workflow.WorkflowEntity) error {
+	restore, err := s.markVolumeBusy(wfl)
+	if err != nil {
+		return err
+	}
+	if err = GetWorkflowEngine().Submit(wfl); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
+
 func NewVolumeService() *VolumeService {
 	return &VolumeService{
 		lvRepo: lv.GetLvRepository(),
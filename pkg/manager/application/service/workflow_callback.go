@@ -0,0 +1,125 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain/workflow"
+	"strconv"
+	"time"
+)
+
+const (
+	CallbackSignatureHeader = "X-Sms-Signature"
+	callbackTimeout         = 10 * time.Second
+)
+
+var (
+	callbackClient        = &http.Client{Timeout: callbackTimeout}
+	callbackRetryInterval = 2 * time.Second
+)
+
+type WorkflowCallback struct {
+	WorkflowId string `json:"workflow_id"`
+	Type       int    `json:"type"`
+	VolumeId   string `json:"volume_id"`
+	Status     int    `json:"status"`
+	Mode       int    `json:"mode"`
+	LastErrMsg string `json:"last_err_msg"`
+	FinishTime string `json:"finish_time"`
+}
+
+func callbackUrl(wfl *workflow.WorkflowEntity) string {
+	if wfl.CallbackUrl != "" {
+		return wfl.CallbackUrl
+	}
+	return config.WorkflowConf.CallbackUrl
+}
+
+//signCallback returns the hex HMAC-SHA256 of the body, the receiver verifies it with the shared secret
+func signCallback(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//notifyCallback posts the final status of the workflow, the failure of callback does not affect the workflow
+func notifyCallback(wfl *workflow.WorkflowEntity) {
+	url := callbackUrl(wfl)
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(&WorkflowCallback{
+		WorkflowId: wfl.Id,
+		Type:       int(wfl.WflType),
+		VolumeId:   wfl.VolumeId,
+		Status:     int(wfl.Status),
+		Mode:       int(wfl.Mode),
+		LastErrMsg: wfl.LastErrMsg,
+		FinishTime: strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	if err != nil {
+		smslog.WithContext(wfl.TraceContext).Errorf("could not marshal callback of workflow %s: %s", wfl.Id, err)
+		return
+	}
+	//sent in background, so the processor is not blocked by the slow receiver
+	go sendCallback(wfl.TraceContext, wfl.Id, url, body)
+}
+
+func sendCallback(ctx common.TraceContext, workflowId, url string, body []byte) {
+	defer smslog.LogPanic()
+	retries := config.WorkflowConf.CallbackRetries
+	if retries <= 0 {
+		retries = 1
+	}
+	err := common.RunWithRetry(retries, callbackRetryInterval, func(retryTimes int) error {
+		return postCallback(url, config.WorkflowConf.CallbackSecret, body)
+	})
+	if err != nil {
+		smslog.WithContext(ctx).Errorf("could not callback %s for workflow %s: %s", url, workflowId, err)
+		return
+	}
+	smslog.WithContext(ctx).Infof("callback %s for workflow %s", url, workflowId)
+}
+
+func postCallback(url, secret string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(CallbackSignatureHeader, signCallback(secret, body))
+	}
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("callback %s response status %d", url, resp.StatusCode)
+	}
+	return nil
+}
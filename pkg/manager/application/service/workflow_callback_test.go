@@ -0,0 +1,61 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSendCallback(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	oldConf, oldInterval := config.WorkflowConf, callbackRetryInterval
+	defer func() {
+		config.WorkflowConf, callbackRetryInterval = oldConf, oldInterval
+	}()
+	config.WorkflowConf.CallbackSecret = "secret"
+	config.WorkflowConf.CallbackRetries = 3
+	callbackRetryInterval = time.Millisecond
+
+	calls := 0
+	var received WorkflowCallback
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, signCallback("secret", body), r.Header.Get(CallbackSignatureHeader))
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert.NoError(t, json.Unmarshal(body, &received))
+	}))
+	defer server.Close()
+
+	body, _ := json.Marshal(&WorkflowCallback{WorkflowId: "wfl-1", Status: 4, LastErrMsg: "no path"})
+	sendCallback(nil, "wfl-1", server.URL, body)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "wfl-1", received.WorkflowId)
+	assert.Equal(t, "no path", received.LastErrMsg)
+}
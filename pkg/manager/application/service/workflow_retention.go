@@ -0,0 +1,108 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package service
+
+import (
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain/workflow"
+	"sync"
+	"time"
+)
+
+//workflows archived in one transaction
+const archiveBatchSize = 100
+
+var _retention *WflRetention
+var _retentionOnce sync.Once
+
+//WflRetention archives the finished workflows by the retention policy, it is run by the leader only
+type WflRetention struct {
+	wflRepo     workflow.WorkflowRepository
+	innerStopCh chan struct{}
+}
+
+func (r *WflRetention) Run() {
+	defer smslog.LogPanic()
+	stopCh := make(chan struct{})
+	r.innerStopCh = stopCh
+	ticker := time.NewTicker(time.Duration(config.WorkflowConf.RetentionIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			smslog.Info("stop wflRetention")
+			return
+		case <-ticker.C:
+			r.Archive()
+		}
+	}
+}
+
+//Archive applies the age and count per volume retention policies
+func (r *WflRetention) Archive() {
+	conf := config.WorkflowConf
+	if conf.RetentionDays > 0 {
+		before := time.Now().AddDate(0, 0, -conf.RetentionDays)
+		total := r.archiveInBatches(func() (int64, error) {
+			return r.wflRepo.ArchiveFinishedBefore(before, archiveBatchSize)
+		})
+		smslog.Infof("archived %d workflows created before %v", total, before)
+	}
+	if conf.RetentionPerVolume > 0 {
+		total := r.archiveInBatches(func() (int64, error) {
+			return r.wflRepo.ArchiveFinishedOverCount(conf.RetentionPerVolume, archiveBatchSize)
+		})
+		smslog.Infof("archived %d workflows exceeding %d per volume", total, conf.RetentionPerVolume)
+	}
+}
+
+func (r *WflRetention) archiveInBatches(archive func() (int64, error)) int64 {
+	var total int64
+	for {
+		affected, err := archive()
+		total += affected
+		if err != nil {
+			smslog.Errorf("archive workflows err %s", err.Error())
+			return total
+		}
+		if affected == 0 {
+			return total
+		}
+	}
+}
+
+func (r *WflRetention) Stop() {
+	smslog.Infof("Stop WflRetention")
+	if r.innerStopCh != nil {
+		close(r.innerStopCh)
+		r.innerStopCh = nil
+	}
+}
+
+func (r *WflRetention) Identify() string {
+	return "workflowRetention"
+}
+
+func GetWorkflowRetention() *WflRetention {
+	_retentionOnce.Do(
+		func() {
+			_retention = &WflRetention{
+				wflRepo: workflow.NewWorkflowRepository(),
+			}
+		})
+	return _retention
+}
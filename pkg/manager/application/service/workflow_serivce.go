@@ -16,9 +16,13 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/application/assembler"
+	"polardb-sms/pkg/manager/application/view"
+	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/k8spvc"
 	"polardb-sms/pkg/manager/domain/lv"
@@ -36,6 +40,33 @@ var _engineOnce sync.Once
 var wflProcessingMap = make(map[string]bool, 0)
 var processingLock sync.Mutex
 
+//processingVolumes maps the volume id to the workflow processing on it,
+//the workflows of one volume are processed one by one in creation order
+var processingVolumes = make(map[string]string, 0)
+
+//acquireVolume should be called with processingLock held
+func acquireVolume(wfl *workflow.WorkflowEntity) bool {
+	if wfl.VolumeId == "" {
+		return true
+	}
+	if wflId, ok := processingVolumes[wfl.VolumeId]; ok && wflId != wfl.Id {
+		return false
+	}
+	processingVolumes[wfl.VolumeId] = wfl.Id
+	return true
+}
+
+func releaseVolume(wfl *workflow.WorkflowEntity) {
+	processingLock.Lock()
+	defer processingLock.Unlock()
+	if processingVolumes[wfl.VolumeId] == wfl.Id {
+		delete(processingVolumes, wfl.VolumeId)
+	}
+}
+
+//cancelCheckInterval is how often the cancel of a workflow is checked while it backs off
+const cancelCheckInterval = time.Second
+
 type WflProcessor struct {
 	wflCh      chan *workflow.WorkflowEntity
 	callbackCh chan interface{}
@@ -43,39 +74,63 @@ type WflProcessor struct {
 	stopChan   chan struct{}
 }
 
+//rollbackWorkflow compensates the stages from the current step back to the first one
 func (p *WflProcessor) rollbackWorkflow(wfl *workflow.WorkflowEntity) {
-	for {
+	wfl.Mode = workflow.Rollback
+	//the workflow is not finished until all the stages are compensated
+	wfl.Status = workflow.Started
+	if wfl.Step >= len(wfl.Stages) {
+		wfl.Step = len(wfl.Stages) - 1
+	}
+	if err := p.Save(wfl); err != nil {
+		smslog.WithContext(wfl.TraceContext).Errorf("could not save workflow %s on rollback start: %s", wfl.Id, err)
+	}
+	p.publish(workflow.WorkflowRollback, wfl)
+	for wfl.Step >= 0 {
+		//the stage without result has never been run
+		if wfl.Stages[wfl.Step].GetExecResult() == nil {
+			wfl.Step--
+			continue
+		}
 		ret := p.Rollback(wfl)
 		if !ret.IsSuccess() {
-			smslog.Errorf("Error for rollback the stages: %v", ret)
+			smslog.WithContext(wfl.TraceContext).Errorf("Error for rollback the stages: %v", ret)
 			wfl.Status = workflow.FailRollback
-			break
+			wfl.LastErrMsg = fmt.Sprintf("%s, rollback step %d err %s", wfl.LastErrMsg, wfl.Step, ret.ErrMsg)
+			return
 		}
+		wfl.Stages[wfl.Step].ResetResult()
 		wfl.Step--
-		if wfl.Step < 0 {
-			smslog.Infof("workflow %s rollback finished", wfl.Id)
-			wfl.Status = workflow.SuccessRollback
-			break
-		}
+		p.saveProgress(wfl)
 	}
+	smslog.WithContext(wfl.TraceContext).Infof("workflow %s rollback finished", wfl.Id)
+	wfl.Status = workflow.SuccessRollback
 }
 
 func (p *WflProcessor) runWorkflow(wfl *workflow.WorkflowEntity) {
-	for {
+	for wfl.Step < len(wfl.Stages) {
+		if p.canceled(wfl) {
+			smslog.WithContext(wfl.TraceContext).Infof("workflow %s canceled at step %d", wfl.Id, wfl.Step)
+			wfl.Status = workflow.Fail
+			wfl.LastErrMsg = "workflow canceled"
+			return
+		}
 		ret := p.Run(wfl)
 		if !ret.IsSuccess() {
 			smslog.WithContext(wfl.TraceContext).Errorf("Error for run the stages: %v", ret)
+			if p.stopped() {
+				//left started, the next leader resumes it
+				return
+			}
 			wfl.Status = workflow.Fail
 			wfl.LastErrMsg = ret.ErrMsg
-			break
+			return
 		}
 		wfl.Step++
-		if wfl.Step >= len(wfl.Stages) {
-			smslog.WithContext(wfl.TraceContext).Infof("workflow %s run finished", wfl.Id)
-			wfl.Status = workflow.Success
-			break
-		}
+		p.saveProgress(wfl)
 	}
+	smslog.WithContext(wfl.TraceContext).Infof("workflow %s run finished", wfl.Id)
+	wfl.Status = workflow.Success
 }
 
 func (p *WflProcessor) run() {
@@ -89,6 +144,10 @@ func (p *WflProcessor) run() {
 			smslog.WithContext(wfl.TraceContext).Infof("start to process workflow %s", wfl.Id)
 			if err := p.preProcess(wfl); err != nil {
 				smslog.WithContext(wfl.TraceContext).Infof("preprocess workflow %s err %s", wfl.Id, err.Error())
+				processingLock.Lock()
+				delete(wflProcessingMap, wfl.Id)
+				processingLock.Unlock()
+				releaseVolume(wfl)
 				continue
 			}
 			processingLock.Lock()
@@ -97,14 +156,25 @@ func (p *WflProcessor) run() {
 			switch wfl.Mode {
 			case workflow.Run:
 				p.runWorkflow(wfl)
+				if wfl.Failed() {
+					p.rollbackWorkflow(wfl)
+				}
 			case workflow.Rollback:
-				p.Rollback(wfl)
+				p.rollbackWorkflow(wfl)
 			default:
+				releaseVolume(wfl)
 				continue
 			}
+			if p.stopped() && wfl.Status == workflow.Started {
+				smslog.WithContext(wfl.TraceContext).Infof("stop wflProcessor, workflow %s is left to the next leader", wfl.Id)
+				releaseVolume(wfl)
+				return
+			}
 			if err := p.postProcess(wfl); err != nil {
 				smslog.WithContext(wfl.TraceContext).Infof("postprocess workflow %s err %s", wfl.Id, err.Error())
 			}
+			p.publish(workflow.WorkflowFinished, wfl)
+			releaseVolume(wfl)
 		}
 	}
 }
@@ -116,15 +186,95 @@ func (p *WflProcessor) Save(w *workflow.WorkflowEntity) error {
 	})
 }
 
+//canceled checks the cancel request from the db, which may be accepted by any manager
+func (p *WflProcessor) canceled(w *workflow.WorkflowEntity) bool {
+	if w.Canceled {
+		return true
+	}
+	latest, err := p.wflRepo.FindByWorkflowId(w.Id)
+	if err != nil {
+		smslog.WithContext(w.TraceContext).Errorf("could not check cancel of workflow %s: %s", w.Id, err)
+		return false
+	}
+	w.Canceled = latest.Canceled
+	return w.Canceled
+}
+
+//saveProgress persists the stage results and step, so that the workflow can be resumed by the new leader
+func (p *WflProcessor) saveProgress(w *workflow.WorkflowEntity) {
+	if err := p.Save(w); err != nil {
+		smslog.WithContext(w.TraceContext).Errorf("could not save progress of workflow %s step %d: %s", w.Id, w.Step, err)
+	}
+}
+
+func (p *WflProcessor) publish(eventType workflow.WorkflowEventType, w *workflow.WorkflowEntity) {
+	workflow.GetWorkflowEventBroker().Publish(workflow.NewWorkflowEvent(eventType, w))
+}
+
+//Run runs the current stage, and retries it by the retry policy of the stage
 func (p *WflProcessor) Run(w *workflow.WorkflowEntity) *stage.StageExecResult {
 	s := w.Stages[w.Step]
-	ret := s.Run(w.TraceContext)
-	return ret
+	policy := s.GetRetryPolicy()
+	p.publish(workflow.StageStarted, w)
+	ctx := w.GetTraceContext()
+	ctx[stage.StageTraceKey] = fmt.Sprintf("%s/%d", w.Id, w.Step)
+	defer delete(ctx, stage.StageTraceKey)
+	//the attempts of the stage are kept through rollback for the report, the retry budget counts this run only
+	for tries := 1; ; tries++ {
+		attempts := s.AddAttempt()
+		ret := s.Run(w.TraceContext)
+		if !policy.Retryable(ret, tries) {
+			workflow.GetWorkflowEventBroker().Publish(workflow.NewStageFinishedEvent(w, ret))
+			return ret
+		}
+		backoff := policy.Backoff(tries)
+		smslog.WithContext(w.TraceContext).Infof("workflow %s step %d attempt %d failed with %s err %s, retry after %v",
+			w.Id, w.Step, attempts, ret.ErrClass, ret.ErrMsg, backoff)
+		p.saveProgress(w)
+		if !p.backoff(w, backoff) {
+			smslog.WithContext(w.TraceContext).Infof("workflow %s step %d stops retrying for stop or cancel", w.Id, w.Step)
+			workflow.GetWorkflowEventBroker().Publish(workflow.NewStageFinishedEvent(w, ret))
+			return ret
+		}
+	}
+}
+
+//backoff waits d before the next attempt of w, it returns false once the processor is stopped or w is canceled
+func (p *WflProcessor) backoff(w *workflow.WorkflowEntity, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(cancelCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case <-p.stopChan:
+			return false
+		case <-ticker.C:
+			if p.canceled(w) {
+				return false
+			}
+		}
+	}
+}
+
+func (p *WflProcessor) stopped() bool {
+	select {
+	case <-p.stopChan:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *WflProcessor) Rollback(w *workflow.WorkflowEntity) *stage.StageExecResult {
 	s := w.Stages[w.Step]
+	p.publish(workflow.StageStarted, w)
+	//the compensation is not deduplicated with the stage it undoes
+	delete(w.GetTraceContext(), stage.StageTraceKey)
 	ret := s.Rollback(w.TraceContext)
+	workflow.GetWorkflowEventBroker().Publish(workflow.NewStageFinishedEvent(w, ret))
 	return ret
 }
 
@@ -143,12 +293,15 @@ func (p *WflProcessor) postProcess(wfl *workflow.WorkflowEntity) error {
 		smslog.WithContext(wfl.TraceContext).Errorf("could not save workflow %v to database: %s", wfl.Id, err)
 	}
 	smslog.WithContext(wfl.TraceContext).Debugf("successfully save workflow %s", wfl.Id)
-
-	//todo failed callback update entity status
-	if wfl.Failed() {
-
+	if wfl.VolumeId != "" {
+		//the lock is taken over by the next workflow anyway, releasing it only keeps the table small
+		if _, err := p.wflRepo.UnlockVolume(wfl); err != nil {
+			smslog.WithContext(wfl.TraceContext).Errorf("could not unlock volume %s from workflow %s: %s", wfl.VolumeId, wfl.Id, err)
+		}
 	}
 
+	notifyCallback(wfl)
+
 	switch wfl.WflType {
 	case workflow.PrLock, workflow.PvcFormatAndLock, workflow.PvcFormat:
 		return releasePvc(wfl)
@@ -169,6 +322,11 @@ func (e *WflEngine) Run() {
 	defer smslog.LogPanic()
 	e.innerStopCh = make(chan struct{})
 	e.wflCh = make(chan *workflow.WorkflowEntity)
+	//drop the state left by the last term as leader
+	processingLock.Lock()
+	wflProcessingMap = make(map[string]bool, 0)
+	processingVolumes = make(map[string]string, 0)
+	processingLock.Unlock()
 	//start pNum processors
 	for i := 0; i < e.pNum; i++ {
 		p := &WflProcessor{
@@ -179,6 +337,7 @@ func (e *WflEngine) Run() {
 		}
 		go p.run()
 	}
+	e.Resume()
 	//ticker to fetch job from db
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -202,6 +361,7 @@ func (e *WflEngine) Run() {
 					processingLock.Lock()
 					delete(wflProcessingMap, w.Id)
 					processingLock.Unlock()
+					releaseVolume(w)
 				}
 			}
 		}
@@ -225,6 +385,27 @@ func (e *WflEngine) Identify() string {
 }
 
 func (e *WflEngine) Submit(w *workflow.WorkflowEntity) error {
+	//the stages are built at submission, a workflow depending on the state of the volume must not wait behind
+	//another one which may change the state, so it is rejected on a busy volume in the queue policy too
+	exclusive := config.WorkflowConf.VolumeConflict == config.ConflictReject || !w.Queueable()
+	if w.VolumeId != "" && exclusive {
+		unfinished, err := e.wflRepo.FindUnfinished(w.VolumeId)
+		if err != nil {
+			return err
+		}
+		if len(unfinished) > 0 {
+			return fmt.Errorf("volume %s is busy with workflow %s of type %d, submit again after it finishes",
+				w.VolumeId, unfinished[0].Id, unfinished[0].WflType)
+		}
+		//the check above is only a fast path, the lock of the volume is taken with the creation atomically
+		if _, err = e.wflRepo.CreateExclusive(w); err != nil {
+			if errors.Is(err, workflow.ErrVolumeBusy) {
+				return fmt.Errorf("%v, submit again after it finishes", err)
+			}
+			return err
+		}
+		return nil
+	}
 	_, err := e.wflRepo.Create(w)
 	if err != nil {
 		return err
@@ -232,6 +413,27 @@ func (e *WflEngine) Submit(w *workflow.WorkflowEntity) error {
 	return nil
 }
 
+//Resume reloads the workflows started but interrupted by the previous leader
+func (e *WflEngine) Resume() {
+	wfls, err := e.wflRepo.FindByStatus(int(workflow.Started))
+	if err != nil {
+		smslog.Errorf("Resume error from DB %v", err)
+		return
+	}
+	for _, w := range wfls {
+		w.Resume()
+		smslog.WithContext(w.TraceContext).Infof("resume workflow %s mode %d from step %d", w.Id, w.Mode, w.Step)
+		processingLock.Lock()
+		if !acquireVolume(w) {
+			smslog.WithContext(w.TraceContext).Warnf("resume workflow %s while volume %s is processed by workflow %s",
+				w.Id, w.VolumeId, processingVolumes[w.VolumeId])
+		}
+		wflProcessingMap[w.Id] = true
+		processingLock.Unlock()
+		e.wflCh <- w
+	}
+}
+
 func (e *WflEngine) Pick() []*workflow.WorkflowEntity {
 	for {
 		processingLock.Lock()
@@ -243,7 +445,13 @@ func (e *WflEngine) Pick() []*workflow.WorkflowEntity {
 		processingLock.Unlock()
 		break
 	}
-	wfls, err := e.wflRepo.FindByStatusAndLimit(int(workflow.NotStarted), 10)
+	processingLock.Lock()
+	busyVolumes := make([]string, 0, len(processingVolumes))
+	for volumeId := range processingVolumes {
+		busyVolumes = append(busyVolumes, volumeId)
+	}
+	processingLock.Unlock()
+	wfls, err := e.wflRepo.FindByStatusExcludingVolumesAndLimit(int(workflow.NotStarted), busyVolumes, 10)
 	if err != nil {
 		smslog.Infof("Pick error from DB %v", err)
 		return nil
@@ -251,10 +459,16 @@ func (e *WflEngine) Pick() []*workflow.WorkflowEntity {
 	smslog.Debugf("pick workflow from db result %v", wfls)
 	processingLock.Lock()
 	defer processingLock.Unlock()
+	var picked []*workflow.WorkflowEntity
 	for _, wfl := range wfls {
+		if !acquireVolume(wfl) {
+			smslog.Debugf("workflow %s is queued behind workflow %s on volume %s", wfl.Id, processingVolumes[wfl.VolumeId], wfl.VolumeId)
+			continue
+		}
 		wflProcessingMap[wfl.Id] = true
+		picked = append(picked, wfl)
 	}
-	return wfls
+	return picked
 }
 
 func releasePvc(wfl *workflow.WorkflowEntity) error {
@@ -297,31 +511,50 @@ func updateLvForPrResult(lvEntity *lv.LogicalVolumeEntity, stages []workflow.Sta
 
 func updatePrSupportStatus(prInfo *lv.PrInfo, stages []workflow.StageRunner) error {
 	for _, s := range stages {
-		switch s.StageType() {
-		case stage.PrStage:
-			var prExecResult = &message.PrCheckCmdResult{}
-			err := common.BytesToStruct(s.GetExecResult().Content, prExecResult)
-			if err != nil {
-				smslog.Errorf("BytesToStruct err %s for [%s] stage is [%v]", err.Error(), string(s.GetExecResult().Content), s.(*stage.PrStageRunner).Content)
-				return err
-			}
-			//todo
-			//updateCapabilityByCmdResult(prInfo.GetPrCheckListByKey(s.(*stage.PrStageRunner).TargetNode.VolumeId), prExecResult)
-		case stage.PrBatchStage:
-			var prBatchExecResult = &message.PrBatchCheckCmdResult{}
-			err := common.BytesToStruct(s.GetExecResult().Content, prBatchExecResult)
-			if err != nil {
-				smslog.Errorf("updatePrSupportStatus err %s ", err.Error())
+		if err := updatePrSupportStatusByStage(prInfo, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//prResultStage is either a stage of the workflow or a child of the parallel group
+type prResultStage interface {
+	StageType() stage.StageType
+	GetExecResult() *stage.StageExecResult
+}
+
+func updatePrSupportStatusByStage(prInfo *lv.PrInfo, s prResultStage) error {
+	switch s.StageType() {
+	case stage.PrStage:
+		var prExecResult = &message.PrCheckCmdResult{}
+		err := common.BytesToStruct(s.GetExecResult().Content, prExecResult)
+		if err != nil {
+			smslog.Errorf("BytesToStruct err %s for [%s] stage is [%v]", err.Error(), string(s.GetExecResult().Content), s.(*stage.PrStageRunner).Content)
+			return err
+		}
+		//todo
+		//updateCapabilityByCmdResult(prInfo.GetPrCheckListByKey(s.(*stage.PrStageRunner).TargetNode.VolumeId), prExecResult)
+	case stage.PrBatchStage:
+		var prBatchExecResult = &message.PrBatchCheckCmdResult{}
+		err := common.BytesToStruct(s.GetExecResult().Content, prBatchExecResult)
+		if err != nil {
+			smslog.Errorf("updatePrSupportStatus err %s ", err.Error())
+			return err
+		}
+		for _, prResult := range prBatchExecResult.Results {
+			tgtNode := s.(*stage.PrBatchStageRunner).TargetNode
+			checkList := prInfo.GetPrCheckListByKey(tgtNode.Name)
+			updateCapabilityByCmdResult(checkList, prResult)
+		}
+	case stage.ParallelGroupStage:
+		for _, child := range s.(*stage.ParallelGroupStageRunner).Children {
+			if err := updatePrSupportStatusByStage(prInfo, child); err != nil {
 				return err
 			}
-			for _, prResult := range prBatchExecResult.Results {
-				tgtNode := s.(*stage.PrBatchStageRunner).TargetNode
-				checkList := prInfo.GetPrCheckListByKey(tgtNode.Name)
-				updateCapabilityByCmdResult(checkList, prResult)
-			}
-		default:
-			return fmt.Errorf("do not support get pr info from stage: %v", s)
 		}
+	default:
+		return fmt.Errorf("do not support get pr info from stage: %v", s)
 	}
 	return nil
 }
@@ -398,8 +631,115 @@ const (
 	WorkflowCheckInterval time.Duration = 1    //1 second
 )
 
+const (
+	defaultWorkflowPageSize = 20
+	maxWorkflowPageSize     = 100
+)
+
 type WorkflowService struct {
 	wflRepo workflow.WorkflowRepository
+	wflAsm  assembler.WorkflowAssembler
+}
+
+func (s *WorkflowService) QueryWorkflows(req *view.WorkflowQueryRequest) (*view.WorkflowListResponse, error) {
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultWorkflowPageSize
+	}
+	if pageSize > maxWorkflowPageSize {
+		pageSize = maxWorkflowPageSize
+	}
+	if req.PageNum < 0 {
+		return nil, fmt.Errorf("invalid page num %d", req.PageNum)
+	}
+	q := &workflow.WorkflowQuery{
+		Type:     req.Type,
+		Status:   req.Status,
+		VolumeId: req.VolumeId,
+	}
+	if req.StartTime > 0 {
+		q.StartTime = time.Unix(req.StartTime, 0)
+	}
+	if req.EndTime > 0 {
+		q.EndTime = time.Unix(req.EndTime, 0)
+	}
+	wfls, total, err := s.wflRepo.FindByQueryAndPage(q, req.PageNum, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &view.WorkflowListResponse{
+		Total:     total,
+		Workflows: s.wflAsm.ToWorkflowViews(wfls),
+	}, nil
+}
+
+//QueryVolumeQueues returns the workflow queues of all the busy volumes, or of the given one
+func (s *WorkflowService) QueryVolumeQueues(volumeId string) ([]*view.VolumeWorkflowQueueResponse, error) {
+	wfls, err := s.wflRepo.FindUnfinished(volumeId)
+	if err != nil {
+		return nil, err
+	}
+	queues := make([]*view.VolumeWorkflowQueueResponse, 0)
+	queueMap := make(map[string]*view.VolumeWorkflowQueueResponse)
+	for _, wfl := range wfls {
+		if wfl.VolumeId == "" {
+			continue
+		}
+		queue, ok := queueMap[wfl.VolumeId]
+		if !ok {
+			queue = &view.VolumeWorkflowQueueResponse{
+				VolumeId: wfl.VolumeId,
+				Queued:   make([]*view.WorkflowResponse, 0),
+			}
+			queueMap[wfl.VolumeId] = queue
+			queues = append(queues, queue)
+		}
+		if wfl.Status == workflow.Started {
+			queue.Processing = s.wflAsm.ToWorkflowView(wfl)
+		} else {
+			queue.Queued = append(queue.Queued, s.wflAsm.ToWorkflowView(wfl))
+		}
+	}
+	return queues, nil
+}
+
+//CancelWorkflow marks the workflow canceled, the processor stops it before the next stage and rolls back
+func (s *WorkflowService) CancelWorkflow(workflowId string) error {
+	wfl, err := s.wflRepo.FindByWorkflowId(workflowId)
+	if err != nil {
+		return err
+	}
+	if wfl.IsFinished() {
+		return fmt.Errorf("workflow %s is already finished: %s", workflowId, wfl.GetExecResult())
+	}
+	_, err = s.wflRepo.Cancel(workflowId)
+	return err
+}
+
+//RetryWorkflow submits a new workflow continuing the failed one from the failing step
+func (s *WorkflowService) RetryWorkflow(workflowId string) (*view.WorkflowIdResponse, error) {
+	wfl, err := s.wflRepo.FindByWorkflowId(workflowId)
+	if err != nil {
+		return nil, err
+	}
+	retry, err := wfl.Retry()
+	if err != nil {
+		return nil, err
+	}
+	if err := GetWorkflowEngine().Submit(retry); err != nil {
+		return nil, err
+	}
+	smslog.WithContext(retry.TraceContext).Infof("retry workflow %s from step %d as %s", workflowId, retry.Step, retry.Id)
+	return &view.WorkflowIdResponse{WorkflowId: retry.Id}, nil
+}
+
+//FindArchivedWorkflow returns the workflow removed from the workflow table by the retention policy
+func (s *WorkflowService) FindArchivedWorkflow(workflowId string) (*view.WorkflowResponse, error) {
+	wfl, err := s.wflRepo.FindArchivedByWorkflowId(workflowId)
+	if err != nil {
+		return nil, err
+	}
+	return s.wflAsm.ToWorkflowView(wfl), nil
 }
 
 func (s *WorkflowService) WaitUntilWorkflowFinish(workflowId string) error {
@@ -424,14 +764,22 @@ func (s *WorkflowService) WaitUntilWorkflowFinish(workflowId string) error {
 }
 
 func workflowExecSuccess(wfl *workflow.WorkflowEntity) error {
-	if wfl.Failed() || wfl.SuccessfullyRollback() {
+	if wfl.Failed() || wfl.SuccessfullyRollback() || wfl.FailedRollback() {
 		return fmt.Errorf("workflow execute err %s", wfl.GetExecResult())
 	}
 	return nil
 }
 
+//planWorkflow is used by dry run requests, the workflow is neither persisted nor executed
+func planWorkflow(wfl *workflow.WorkflowEntity) *view.WorkflowIdResponse {
+	return &view.WorkflowIdResponse{
+		Plan: assembler.NewWorkflowAssembler().ToWorkflowPlanView(wfl),
+	}
+}
+
 func NewWorkflowService() *WorkflowService {
 	return &WorkflowService{
 		wflRepo: workflow.NewWorkflowRepository(),
+		wflAsm:  assembler.NewWorkflowAssembler(),
 	}
 }
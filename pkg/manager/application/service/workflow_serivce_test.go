@@ -18,9 +18,15 @@ package service
 import (
 	"fmt"
 	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/application/view"
+	"polardb-sms/pkg/manager/domain/workflow"
+	"polardb-sms/pkg/manager/domain/workflow/stage"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestWflEngine_Submit(t *testing.T) {
@@ -57,3 +63,77 @@ func TestCloseChan(t *testing.T) {
 	go testFun()
 	time.Sleep(5 * time.Second)
 }
+
+type fakeWflRepo struct {
+	workflow.WorkflowRepository
+}
+
+func (r *fakeWflRepo) Save(w *workflow.WorkflowEntity) (int64, error) {
+	return 1, nil
+}
+
+type fakeStage struct {
+	*stage.Stage
+	rolledBack bool
+}
+
+func (s *fakeStage) Run(ctx common.TraceContext) *stage.StageExecResult {
+	s.Result = stage.StageExecSuccess(nil)
+	return s.Result
+}
+
+func (s *fakeStage) Rollback(ctx common.TraceContext) *stage.StageExecResult {
+	s.rolledBack = true
+	return stage.StageExecSuccess(nil)
+}
+
+func TestWflProcessor_RollbackWorkflow(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	stages := []*fakeStage{
+		{Stage: &stage.Stage{Result: stage.StageExecSuccess(nil)}},
+		{Stage: &stage.Stage{Result: stage.StageExecFail("agent err")}},
+		{Stage: &stage.Stage{}},
+	}
+	wfl := &workflow.WorkflowEntity{Id: "wfl", Step: 2}
+	for _, s := range stages {
+		wfl.Stages = append(wfl.Stages, s)
+	}
+	p := &WflProcessor{wflRepo: &fakeWflRepo{}}
+	p.rollbackWorkflow(wfl)
+
+	assert.Equal(t, workflow.SuccessRollback, wfl.Status)
+	assert.True(t, stages[0].rolledBack)
+	assert.True(t, stages[1].rolledBack)
+	assert.False(t, stages[2].rolledBack)
+	for _, s := range stages {
+		assert.Nil(t, s.GetExecResult())
+	}
+}
+
+func TestWflProcessor_Backoff(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	p := &WflProcessor{wflRepo: &fakeWflRepo{}, stopChan: make(chan struct{})}
+	wfl := &workflow.WorkflowEntity{Id: "wfl"}
+	assert.True(t, p.backoff(wfl, 10*time.Millisecond))
+
+	//the canceled workflow stops waiting on the next check
+	wfl.Canceled = true
+	start := time.Now()
+	assert.False(t, p.backoff(wfl, time.Minute))
+	assert.True(t, time.Since(start) < 2*cancelCheckInterval)
+
+	wfl.Canceled = false
+	close(p.stopChan)
+	assert.False(t, p.backoff(wfl, time.Minute))
+	assert.True(t, p.stopped())
+}
+
+func TestWflProcessor_RollbackKeepsAttempts(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	s := &fakeStage{Stage: &stage.Stage{Result: stage.StageExecSuccess(nil), Attempts: 3}}
+	wfl := &workflow.WorkflowEntity{Id: "wfl", Step: 0, Stages: []workflow.StageRunner{s}}
+	p := &WflProcessor{wflRepo: &fakeWflRepo{}}
+	p.rollbackWorkflow(wfl)
+	assert.Nil(t, s.GetExecResult())
+	assert.Equal(t, 3, s.GetAttempts())
+}
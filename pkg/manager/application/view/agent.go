@@ -0,0 +1,35 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package view
+
+import "time"
+
+//AgentStatus is the connection of the manager to one agent
+type AgentStatus struct {
+	NodeId       string    `json:"node_id"`
+	Addr         string    `json:"addr"`
+	State        string    `json:"state"`
+	Since        time.Time `json:"since"`
+	FrameVersion int       `json:"frame_version"`
+	//RttMs is 0 before the first answered ping
+	RttMs        float64    `json:"rtt_ms"`
+	LastPing     *time.Time `json:"last_ping,omitempty"`
+	PingFailures int        `json:"ping_failures"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	InFlight     int        `json:"in_flight"`
+	Reconnects   int        `json:"reconnects"`
+}
@@ -34,6 +34,8 @@ type ClusterLunCreateRequest struct {
 	ClusterId       int           `json:"cluster_id"`
 	PrSupportStatus string        `json:"pr_support_status"`
 	Desc            string        `json:"desc"`
+	DryRun          bool          `json:"dry_run"`
+	CallbackUrl     string        `json:"callback_url"`
 }
 
 type ClusterLunSameSanRequest struct {
@@ -41,10 +43,12 @@ type ClusterLunSameSanRequest struct {
 }
 
 type ClusterLunFormatRequest struct {
-	Name   string        `json:"name"`
-	Wwid   string        `json:"wwid"`
-	FsType common.FsType `json:"fs_type"`
-	FsSize int64         `json:"fs_size"`
+	Name        string        `json:"name"`
+	Wwid        string        `json:"wwid"`
+	FsType      common.FsType `json:"fs_type"`
+	FsSize      int64         `json:"fs_size"`
+	DryRun      bool          `json:"dry_run"`
+	CallbackUrl string        `json:"callback_url"`
 }
 
 type ClusterLunFsExpandRequest struct {
@@ -53,21 +57,27 @@ type ClusterLunFsExpandRequest struct {
 	FsType       common.FsType `json:"fs_type"`
 	ExpandFsSize int64         `json:"fs_size"`
 	PvName       string        `json:"pv_name"`
+	DryRun       bool          `json:"dry_run"`
+	CallbackUrl  string        `json:"callback_url"`
 }
 
 type LunAccessPermissionRequest struct {
-	Wwid      string   `json:"wwid"`
-	RwNodeIp  string   `json:"rw_node"`
-	RoNodesIp []string `json:"ro_nodes"`
+	Wwid        string   `json:"wwid"`
+	RwNodeIp    string   `json:"rw_node"`
+	RoNodesIp   []string `json:"ro_nodes"`
+	DryRun      bool     `json:"dry_run"`
+	CallbackUrl string   `json:"callback_url"`
 }
 
 type ClusterLunFormatAndLockRequest struct {
-	Name      string        `json:"name"`
-	Wwid      string        `json:"wwid"`
-	FsType    common.FsType `json:"fs_type"`
-	FsSize    int64         `json:"fs_size"`
-	RwNodeIp  string        `json:"rw_node"`
-	RoNodesIp []string      `json:"ro_nodes"`
+	Name        string        `json:"name"`
+	Wwid        string        `json:"wwid"`
+	FsType      common.FsType `json:"fs_type"`
+	FsSize      int64         `json:"fs_size"`
+	RwNodeIp    string        `json:"rw_node"`
+	RoNodesIp   []string      `json:"ro_nodes"`
+	DryRun      bool          `json:"dry_run"`
+	CallbackUrl string        `json:"callback_url"`
 }
 
 type LvMultipathStatus struct {
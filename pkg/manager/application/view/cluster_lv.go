@@ -29,14 +29,16 @@ type MultipathVolumeView struct {
 }
 
 type ClusterLvCreateRequest struct {
-	Name       string                `json:"name"`
-	Vendor     string                `json:"vendor"`
-	Luns       []MultipathVolumeView `json:"luns"`
-	Mode       string                `json:"mode"`
-	Size       int64                 `json:"size"`
-	SectorSize int                   `json:"sector_size"`
-	SectorNum  int64                 `json:"sector_num"`
-	DmTable    string                `json:"dm_table"`
+	Name        string                `json:"name"`
+	Vendor      string                `json:"vendor"`
+	Luns        []MultipathVolumeView `json:"luns"`
+	Mode        string                `json:"mode"`
+	Size        int64                 `json:"size"`
+	SectorSize  int                   `json:"sector_size"`
+	SectorNum   int64                 `json:"sector_num"`
+	DmTable     string                `json:"dm_table"`
+	DryRun      bool                  `json:"dry_run"`
+	CallbackUrl string                `json:"callback_url"`
 }
 
 type ClusterLvExpandRequest struct {
@@ -44,17 +46,31 @@ type ClusterLvExpandRequest struct {
 }
 
 type ClusterLvFormatRequest struct {
-	VolumeName string        `json:"volume_name"`
-	VolumeId   string        `json:"volume_id"`
-	FsType     common.FsType `json:"fs_type"`
-	FsSize     int64         `json:"fs_size"`
+	VolumeName  string        `json:"volume_name"`
+	VolumeId    string        `json:"volume_id"`
+	FsType      common.FsType `json:"fs_type"`
+	FsSize      int64         `json:"fs_size"`
+	DryRun      bool          `json:"dry_run"`
+	CallbackUrl string        `json:"callback_url"`
 }
 
 type ClusterLvFsExpandRequest struct {
-	VolumeName string        `json:"volume_name"`
-	VolumeId   string        `json:"volume_id"`
-	FsType     common.FsType `json:"fs_type"`
-	ReqSize    int64         `json:"req_size"`
+	VolumeName  string        `json:"volume_name"`
+	VolumeId    string        `json:"volume_id"`
+	FsType      common.FsType `json:"fs_type"`
+	ReqSize     int64         `json:"req_size"`
+	DryRun      bool          `json:"dry_run"`
+	CallbackUrl string        `json:"callback_url"`
+}
+
+type ClusterLvAptplRequest struct {
+	VolumeId string `json:"volume_id"`
+	Aptpl    bool   `json:"aptpl"`
+}
+
+type ClusterLvReserveTypeRequest struct {
+	VolumeId    string `json:"volume_id"`
+	ReserveType int    `json:"reserve_type"`
 }
 
 type LvDmDeviceStatus struct {
@@ -19,6 +19,7 @@ import (
 	"polardb-sms/pkg/common"
 	"polardb-sms/pkg/device"
 	"polardb-sms/pkg/manager/domain/lv"
+	"time"
 )
 
 type PrCheckRequest struct {
@@ -28,6 +29,13 @@ type PrCheckRequest struct {
 	NodeId      string             `json:"node_id"`
 }
 
+//PrCapabilityRequest probes the scratch lun VolumeId on the nodes, all the available nodes if NodeIds is empty
+type PrCapabilityRequest struct {
+	VolumeId    string   `json:"volume_id"`
+	NodeIds     []string `json:"node_ids"`
+	ReserveType int      `json:"reserve_type"`
+}
+
 type PrCheckResponse struct {
 	PrInfo lv.PrInfo `json:"pr_info"`
 }
@@ -35,3 +43,50 @@ type PrCheckResponse struct {
 type PrCheckOverallResponse struct {
 	PrInfo *device.PrSupportReport `json:"pr_info"`
 }
+
+type PrDrift struct {
+	VolumeId string `json:"volume_id"`
+	//LunId is the lun queried, the same as VolumeId for the multipath volume
+	LunId       string `json:"lun_id"`
+	DriftType   string `json:"drift_type"`
+	ExpectedKey string `json:"expected_key"`
+	ActualKey   string `json:"actual_key,omitempty"`
+	Detail      string `json:"detail"`
+}
+
+type PrAuditError struct {
+	VolumeId string `json:"volume_id"`
+	LunId    string `json:"lun_id"`
+	ErrMsg   string `json:"err_msg"`
+}
+
+type PrDriftReport struct {
+	StartTime       time.Time       `json:"start_time"`
+	FinishTime      time.Time       `json:"finish_time"`
+	Volumes         int             `json:"volumes"`
+	Drifts          []*PrDrift      `json:"drifts"`
+	Errors          []*PrAuditError `json:"errors"`
+	RepairWorkflows []string        `json:"repair_workflows"`
+}
+
+type PrReconcileRequest struct {
+	Repair bool `json:"repair"`
+}
+
+type NodeFenceRequest struct {
+	//TakeoverNodeId takes the write lock of the volumes the fenced node writes, any available node if empty
+	TakeoverNodeId string `json:"takeover_node_id"`
+	Reason         string `json:"reason"`
+}
+
+type NodeFenceWorkflow struct {
+	VolumeId   string `json:"volume_id"`
+	WorkflowId string `json:"workflow_id"`
+}
+
+type NodeFenceResponse struct {
+	NodeId    string               `json:"node_id"`
+	PrKey     string               `json:"pr_key"`
+	Workflows []*NodeFenceWorkflow `json:"workflows"`
+	Errors    []*PrAuditError      `json:"errors"`
+}
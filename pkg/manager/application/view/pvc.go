@@ -21,8 +21,10 @@ import (
 )
 
 type PvcRequest struct {
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	DryRun      bool   `json:"dry_run"`
+	CallbackUrl string `json:"callback_url"`
 }
 
 type PvcCreateRequest struct {
@@ -16,14 +16,75 @@
 package view
 
 type WorkflowResponse struct {
-	WorkflowId string `json:"workflow_id"`
-	Type       int    `json:"type"`
-	Step       int    `json:"step"`
-	Stages     string `json:"stages"`
-	Status     int    `json:"status"`
-	Mode       int    `json:"mode"`
+	WorkflowId  string `json:"workflow_id"`
+	Type        int    `json:"type"`
+	Step        int    `json:"step"`
+	Stages      string `json:"stages"`
+	Status      int    `json:"status"`
+	Mode        int    `json:"mode"`
+	VolumeId    string `json:"volume_id"`
+	VolumeClass string `json:"volume_class"`
+	LastErrMsg  string `json:"last_err_msg"`
+	CreateTime  string `json:"create_time"`
+	Canceled    bool   `json:"canceled"`
+
+	StageDetails []*StageResponse `json:"stage_details"`
+}
+
+type StageResponse struct {
+	StageType   string `json:"stage_type"`
+	Executed    bool   `json:"executed"`
+	Success     bool   `json:"success"`
+	ErrMsg      string `json:"err_msg"`
+	ErrClass    string `json:"err_class"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+
+	Children []*StageResponse `json:"children,omitempty"`
+}
+
+//WorkflowQueryRequest is bound from the query string, start_time and end_time are unix seconds
+type WorkflowQueryRequest struct {
+	PageNum   int    `form:"page_num"`
+	PageSize  int    `form:"page_size"`
+	Type      *int   `form:"type"`
+	Status    *int   `form:"status"`
+	VolumeId  string `form:"volume_id"`
+	StartTime int64  `form:"start_time"`
+	EndTime   int64  `form:"end_time"`
+}
+
+//VolumeWorkflowQueueResponse is the unfinished workflows of one volume, which are processed one by one
+type VolumeWorkflowQueueResponse struct {
+	VolumeId   string              `json:"volume_id"`
+	Processing *WorkflowResponse   `json:"processing"`
+	Queued     []*WorkflowResponse `json:"queued"`
+}
+
+type WorkflowListResponse struct {
+	Total     int64               `json:"total"`
+	Workflows []*WorkflowResponse `json:"workflows"`
 }
 
 type WorkflowIdResponse struct {
 	WorkflowId string `json:"workflow_id"`
+	//only set for dry run requests, the workflow is not submitted
+	Plan *WorkflowPlanResponse `json:"plan,omitempty"`
+	//only set for write lock requests, the fence generation of the volume once the workflow succeeds
+	FenceGeneration int64 `json:"fence_generation,omitempty"`
+}
+
+type WorkflowPlanResponse struct {
+	Type        int                  `json:"type"`
+	VolumeId    string               `json:"volume_id"`
+	VolumeClass string               `json:"volume_class"`
+	Stages      []*StagePlanResponse `json:"stages"`
+}
+
+type StagePlanResponse struct {
+	StageType   string               `json:"stage_type"`
+	TargetNodes []string             `json:"target_nodes"`
+	Content     interface{}          `json:"content"`
+	DmTable     string               `json:"dm_table,omitempty"`
+	Children    []*StagePlanResponse `json:"children,omitempty"`
 }
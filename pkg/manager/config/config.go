@@ -24,6 +24,8 @@ import (
 	"math/rand"
 	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/network"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,30 +34,61 @@ import (
 )
 
 const (
-	ConfigPath             = "/var/lib/polardb-sms/manager/manager.conf"
-	LogFile                = "/var/log/polardb-sms/manager/manager.log"
-	DefaultPort            = "2002"
-	ServerSection          = "server"
-	AppPort                = "port"
-	ServerId               = "id"
-	LogSection             = "log"
-	LogLevel               = "level"
-	FastHA                 = "fastHA"
-	DBSection              = "database"
-	DBUser                 = "user"
-	DBPassword             = "password"
-	DBHost                 = "host"
-	DBPort                 = "port"
-	DBSchema               = "schema"
-	DBSchemaValue          = "polardb_sms"
-	LocalHost              = "localhost"
-	Separator              = ":"
-	DBConnStrFormat        = "%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local"
-	ClusterSection         = "cluster"
-	Mode                   = "mode"
-	Vip                    = "vip"
-	Nodes                  = "nodes"
-	HeartbeatMissTolerance = 180 * time.Second
+	ConfigPath                    = "/var/lib/polardb-sms/manager/manager.conf"
+	LogFile                       = "/var/log/polardb-sms/manager/manager.log"
+	DefaultPort                   = "2002"
+	ServerSection                 = "server"
+	AppPort                       = "port"
+	ServerId                      = "id"
+	LogSection                    = "log"
+	LogLevel                      = "level"
+	FastHA                        = "fastHA"
+	DBSection                     = "database"
+	DBUser                        = "user"
+	DBPassword                    = "password"
+	DBHost                        = "host"
+	DBPort                        = "port"
+	DBSchema                      = "schema"
+	DBSchemaValue                 = "polardb_sms"
+	LocalHost                     = "localhost"
+	Separator                     = ":"
+	DBConnStrFormat               = "%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local"
+	ClusterSection                = "cluster"
+	Mode                          = "mode"
+	Vip                           = "vip"
+	Nodes                         = "nodes"
+	HeartbeatMissTolerance        = 180 * time.Second
+	WorkflowSection               = "workflow"
+	VolumeConflict                = "volumeConflict"
+	ConflictQueue                 = "queue"
+	ConflictReject                = "reject"
+	RetentionDays                 = "retentionDays"
+	RetentionPerVolume            = "retentionPerVolume"
+	RetentionInterval             = "retentionIntervalMinutes"
+	DefaultRetentionMin           = 60
+	CallbackUrl                   = "callbackUrl"
+	CallbackSecret                = "callbackSecret"
+	CallbackRetries               = "callbackRetries"
+	DefaultCallbackRetries        = 3
+	ReservationSection            = "reservation"
+	ReconcileInterval             = "reconcileIntervalMinutes"
+	DefaultReconcileMin           = 10
+	ReconcileRepair               = "reconcileRepair"
+	PrKeyScheme                   = "prKeyScheme"
+	PrKeyGeneration               = "prKeyGeneration"
+	PrKeySchemeIp                 = "ip"
+	PrKeySchemeNodeId             = "node-id"
+	PrKeySchemeManager            = "manager"
+	DefaultPrKeyGeneration        = 1
+	MaxPrKeyGeneration            = 0xffff
+	AptplStorageClasses           = "aptplStorageClasses"
+	RestoreLostPr                 = "restoreLostPr"
+	ExclusiveAccessStorageClasses = "exclusiveAccessStorageClasses"
+	TLSSection                    = "tls"
+	TLSCertFile                   = "certFile"
+	TLSKeyFile                    = "keyFile"
+	TLSCAFile                     = "caFile"
+	TLSServerName                 = "serverName"
 )
 
 type DBConfig struct {
@@ -78,6 +111,60 @@ type LogConfig struct {
 	Level string
 }
 
+type WorkflowConfig struct {
+	//VolumeConflict is the policy for the workflow submitted on a volume busy with another one, queue or reject,
+	//the workflows depending on the pr keys or the writer of the volume are always rejected since their stages would be stale
+	VolumeConflict string
+	//the finished workflows older than RetentionDays are archived, 0 to disable
+	RetentionDays int
+	//only the latest RetentionPerVolume finished workflows of a volume are kept, 0 to disable
+	RetentionPerVolume       int
+	RetentionIntervalMinutes int
+	//CallbackUrl is notified when the workflows without their own callback url finish
+	CallbackUrl string
+	//CallbackSecret signs the callback body with HMAC-SHA256, not signed if empty
+	CallbackSecret  string
+	CallbackRetries int
+}
+
+type ReservationConfig struct {
+	//the pr state of the in use volumes is audited every ReconcileIntervalMinutes, 0 to disable
+	ReconcileIntervalMinutes int
+	//ReconcileRepair submits a PrRepair workflow for the volume drifted
+	ReconcileRepair bool
+	//PrKeyScheme decides how the pr key of a new node is allocated: ip, node-id or manager.
+	//only the 32 bits ip keys carry the fence generation to the lun, the 64 bits node-id and manager keys
+	//have no room for it, so the generation is only recorded in the db and the lun can not tell a stale writer
+	PrKeyScheme string
+	//PrKeyGeneration is the prefix of the manager assigned keys, to tell the managers sharing an array apart
+	PrKeyGeneration int
+	//the volumes of AptplStorageClasses register with aptpl, so the keys persist through the array power loss
+	AptplStorageClasses []string
+	//RestoreLostPr re-registers the writer and reserves when all the keys of a volume are lost,
+	//as the array restarted without aptpl, even if ReconcileRepair is false
+	RestoreLostPr bool
+	//the volumes of ExclusiveAccessStorageClasses are reserved with Exclusive Access, All Registrants
+	//instead of Write Exclusive, All Registrants, so the other nodes can not read the stale data either
+	ExclusiveAccessStorageClasses []string
+}
+
+func (c *ReservationConfig) AptplFor(storageClass string) bool {
+	return containsString(c.AptplStorageClasses, storageClass)
+}
+
+func (c *ReservationConfig) ExclusiveAccessFor(storageClass string) bool {
+	return containsString(c.ExclusiveAccessStorageClasses, storageClass)
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
 type Node struct {
 	Name              string    `json:"name"`
 	Ip                string    `json:"ip"`
@@ -119,6 +206,15 @@ func GetNodeById(nodeId string) *Node {
 	return nil
 }
 
+//GetClusterNode returns the node in the cluster conf even if it is not available
+func GetClusterNode(nodeId string) *Node {
+	n, ok := ClusterConf.Nodes[nodeId]
+	if ok {
+		return &n
+	}
+	return nil
+}
+
 func GetOneNode() *Node {
 	nodes := GetAvailableNodes()
 	idx := rand.Intn(len(nodes))
@@ -158,12 +254,15 @@ func AvailableNodes() int {
 }
 
 var (
-	ServerConf     ServerConfig
-	DBConf         DBConfig
-	LogConf        LogConfig
-	ClusterConf    ClusterConfig
-	ClientSet      kubernetes.Interface
-	processingLock sync.Mutex
+	ServerConf      ServerConfig
+	DBConf          DBConfig
+	LogConf         LogConfig
+	WorkflowConf    = WorkflowConfig{VolumeConflict: ConflictQueue, RetentionIntervalMinutes: DefaultRetentionMin, CallbackRetries: DefaultCallbackRetries}
+	ReservationConf = ReservationConfig{ReconcileIntervalMinutes: DefaultReconcileMin, PrKeyScheme: PrKeySchemeIp, PrKeyGeneration: DefaultPrKeyGeneration, RestoreLostPr: true}
+	TLSConf         network.TLSConfig
+	ClusterConf     ClusterConfig
+	ClientSet       kubernetes.Interface
+	processingLock  sync.Mutex
 )
 
 func Init(confPath, metaDbConfStr, agentPort string, clientSet kubernetes.Interface) {
@@ -254,6 +353,19 @@ func parse(conf *goconfig.ConfigFile) {
 	} else {
 		parseLogConf(logConf)
 	}
+
+	wflConf, err := conf.GetSection(WorkflowSection)
+	if err == nil {
+		parseWorkflowConf(wflConf)
+	}
+	prConf, err := conf.GetSection(ReservationSection)
+	if err == nil {
+		parseReservationConf(prConf)
+	}
+	tlsConf, err := conf.GetSection(TLSSection)
+	if err == nil {
+		parseTLSConf(tlsConf)
+	}
 }
 
 func parseServerConf(confMap map[string]string) {
@@ -271,6 +383,86 @@ func parseLogConf(confMap map[string]string) {
 	smslog.Infof("Log config is %v", LogConf)
 }
 
+func parseWorkflowConf(confMap map[string]string) {
+	WorkflowConf = WorkflowConfig{VolumeConflict: ConflictQueue, RetentionIntervalMinutes: DefaultRetentionMin, CallbackRetries: DefaultCallbackRetries}
+	if policy, ok := confMap[VolumeConflict]; ok && policy == ConflictReject {
+		WorkflowConf.VolumeConflict = ConflictReject
+	}
+	WorkflowConf.RetentionDays = parseNonNegativeInt(confMap, RetentionDays, 0)
+	WorkflowConf.RetentionPerVolume = parseNonNegativeInt(confMap, RetentionPerVolume, 0)
+	if interval := parseNonNegativeInt(confMap, RetentionInterval, DefaultRetentionMin); interval > 0 {
+		WorkflowConf.RetentionIntervalMinutes = interval
+	}
+	WorkflowConf.CallbackUrl = strings.TrimSpace(confMap[CallbackUrl])
+	WorkflowConf.CallbackSecret = confMap[CallbackSecret]
+	WorkflowConf.CallbackRetries = parseNonNegativeInt(confMap, CallbackRetries, DefaultCallbackRetries)
+	smslog.Infof("Workflow config is volumeConflict %s retentionDays %d retentionPerVolume %d callbackUrl %s",
+		WorkflowConf.VolumeConflict, WorkflowConf.RetentionDays, WorkflowConf.RetentionPerVolume, WorkflowConf.CallbackUrl)
+}
+
+func parseReservationConf(confMap map[string]string) {
+	ReservationConf = ReservationConfig{
+		ReconcileIntervalMinutes:      parseNonNegativeInt(confMap, ReconcileInterval, DefaultReconcileMin),
+		ReconcileRepair:               strings.TrimSpace(confMap[ReconcileRepair]) == "true",
+		PrKeyScheme:                   PrKeySchemeIp,
+		PrKeyGeneration:               parseNonNegativeInt(confMap, PrKeyGeneration, DefaultPrKeyGeneration),
+		AptplStorageClasses:           parseList(confMap[AptplStorageClasses]),
+		RestoreLostPr:                 strings.TrimSpace(confMap[RestoreLostPr]) != "false",
+		ExclusiveAccessStorageClasses: parseList(confMap[ExclusiveAccessStorageClasses]),
+	}
+	switch scheme := strings.TrimSpace(confMap[PrKeyScheme]); scheme {
+	case "", PrKeySchemeIp:
+	case PrKeySchemeNodeId, PrKeySchemeManager:
+		ReservationConf.PrKeyScheme = scheme
+		smslog.Warnf("%s %s keys have no room for the fence generation, it is recorded in the db only", PrKeyScheme, scheme)
+	default:
+		smslog.Errorf("invalid %s %s, use default %s", PrKeyScheme, scheme, PrKeySchemeIp)
+	}
+	if ReservationConf.PrKeyGeneration > MaxPrKeyGeneration {
+		smslog.Errorf("invalid %s %d, use default %d", PrKeyGeneration, ReservationConf.PrKeyGeneration, DefaultPrKeyGeneration)
+		ReservationConf.PrKeyGeneration = DefaultPrKeyGeneration
+	}
+	smslog.Infof("Reservation config is reconcileIntervalMinutes %d reconcileRepair %v prKeyScheme %s prKeyGeneration %d aptplStorageClasses %v restoreLostPr %v exclusiveAccessStorageClasses %v",
+		ReservationConf.ReconcileIntervalMinutes, ReservationConf.ReconcileRepair, ReservationConf.PrKeyScheme, ReservationConf.PrKeyGeneration,
+		ReservationConf.AptplStorageClasses, ReservationConf.RestoreLostPr, ReservationConf.ExclusiveAccessStorageClasses)
+}
+
+//parseTLSConf reads the mutual tls to the agents, the manager connects to the agents by plain tcp if the cert is empty
+func parseTLSConf(confMap map[string]string) {
+	TLSConf = network.TLSConfig{
+		CertFile:   strings.TrimSpace(confMap[TLSCertFile]),
+		KeyFile:    strings.TrimSpace(confMap[TLSKeyFile]),
+		CAFile:     strings.TrimSpace(confMap[TLSCAFile]),
+		ServerName: strings.TrimSpace(confMap[TLSServerName]),
+	}
+	smslog.Infof("TLS config is certFile %s keyFile %s caFile %s serverName %s",
+		TLSConf.CertFile, TLSConf.KeyFile, TLSConf.CAFile, TLSConf.ServerName)
+}
+
+//parseList splits the comma separated values, the empty ones are dropped
+func parseList(str string) []string {
+	ret := make([]string, 0)
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func parseNonNegativeInt(confMap map[string]string, key string, defaultValue int) int {
+	str, ok := confMap[key]
+	if !ok {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(str))
+	if err != nil || value < 0 {
+		smslog.Errorf("invalid %s %s, use default %d", key, str, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func parseClusterConf(confMap map[string]string) {
 	//parse cluster config
 	ClusterConf = ClusterConfig{
@@ -29,27 +29,28 @@ type LvConverter struct {
 func (l LvConverter) ToModel(t interface{}) (interface{}, error) {
 	lvEntity := t.(*LogicalVolumeEntity)
 	return &LogicalVolume{
-		VolumeId:     lvEntity.VolumeId,
-		VolumeName:   lvEntity.VolumeName,
-		Children:     lvEntity.GetChildrenString(),
-		LvType:       string(lvEntity.LvType),
-		NodeIds:      strings.Join(lvEntity.NodeIds, ","),
-		RelatedPvc:   lvEntity.GetPvcName(),
-		FsSize:       lvEntity.FsSize,
-		FsType:       string(lvEntity.FsType),
-		SectorNum:    lvEntity.Sectors,
-		SectorSize:   lvEntity.SectorSize,
-		Size:         lvEntity.Size,
-		UsedSize:     lvEntity.UsedSize,
-		Status:       lvEntity.Status.String(),
-		PrStatus:     lvEntity.PrInfo.String(),
-		PrNodeId:     lvEntity.PrKey,
-		Vendor:       lvEntity.Vendor,
-		Product:      lvEntity.Product,
-		Extend:       lvEntity.Extend.String(),
-		UsedByType:   int(lvEntity.UsedByType),
-		UsedByName:   lvEntity.UsedByName,
-		SerialNumber: lvEntity.SerialNumber,
+		VolumeId:        lvEntity.VolumeId,
+		VolumeName:      lvEntity.VolumeName,
+		Children:        lvEntity.GetChildrenString(),
+		LvType:          string(lvEntity.LvType),
+		NodeIds:         strings.Join(lvEntity.NodeIds, ","),
+		RelatedPvc:      lvEntity.GetPvcName(),
+		FsSize:          lvEntity.FsSize,
+		FsType:          string(lvEntity.FsType),
+		SectorNum:       lvEntity.Sectors,
+		SectorSize:      lvEntity.SectorSize,
+		Size:            lvEntity.Size,
+		UsedSize:        lvEntity.UsedSize,
+		Status:          lvEntity.Status.String(),
+		PrStatus:        lvEntity.PrInfo.String(),
+		PrNodeId:        lvEntity.PrKey,
+		FenceGeneration: lvEntity.FenceGeneration,
+		Vendor:          lvEntity.Vendor,
+		Product:         lvEntity.Product,
+		Extend:          lvEntity.Extend.String(),
+		UsedByType:      int(lvEntity.UsedByType),
+		UsedByName:      lvEntity.UsedByName,
+		SerialNumber:    lvEntity.SerialNumber,
 	}, nil
 }
 
@@ -70,16 +71,17 @@ func (l LvConverter) ToEntity(t interface{}) (interface{}, error) {
 			UsedSize:     lvModel.UsedSize,
 			SerialNumber: lvModel.SerialNumber,
 		},
-		LvType:     common.LvType(lvModel.LvType),
-		ClusterId:  lvModel.ClusterId,
-		PrKey:      lvModel.PrNodeId,
-		Status:     domain.ParseVolumeStatus(lvModel.Status),
-		Children:   &Children{Items: ParseChildren(lvModel.Children)},
-		PrInfo:     ParsePrInfo(lvModel.PrStatus),
-		Extend:     ParseExtend(lvModel.Extend),
-		NodeIds:    strings.Split(lvModel.NodeIds, ","),
-		UsedByType: domain.UsedByType(lvModel.UsedByType),
-		UsedByName: lvModel.UsedByName,
+		LvType:          common.LvType(lvModel.LvType),
+		ClusterId:       lvModel.ClusterId,
+		PrKey:           lvModel.PrNodeId,
+		FenceGeneration: lvModel.FenceGeneration,
+		Status:          domain.ParseVolumeStatus(lvModel.Status),
+		Children:        &Children{Items: ParseChildren(lvModel.Children)},
+		PrInfo:          ParsePrInfo(lvModel.PrStatus),
+		Extend:          ParseExtend(lvModel.Extend),
+		NodeIds:         strings.Split(lvModel.NodeIds, ","),
+		UsedByType:      domain.UsedByType(lvModel.UsedByType),
+		UsedByName:      lvModel.UsedByName,
 	}
 	return ret, nil
 }
@@ -22,7 +22,9 @@ import (
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/manager/domain/pv"
+	"polardb-sms/pkg/network/message"
 	"strings"
 )
 
@@ -149,6 +151,28 @@ func (e Extend) GetDmDevice() *device.DmDevice {
 	return e[DmDeviceKey].(*device.DmDevice)
 }
 
+//AptplKey is true in Extend if the volume registers with aptpl
+const AptplKey = "Aptpl"
+
+func (e Extend) Aptpl() bool {
+	aptpl, ok := e[AptplKey].(bool)
+	return ok && aptpl
+}
+
+//ReserveTypeKey is the reservation type in Extend the volume is locked with, WEAR if not set
+const ReserveTypeKey = "ReserveType"
+
+func (e Extend) ReserveType() message.PrType {
+	//it is float64 after parsed from the db
+	switch t := e[ReserveTypeKey].(type) {
+	case float64:
+		return message.PrType(t)
+	case int:
+		return message.PrType(t)
+	}
+	return message.WEAR
+}
+
 func ParseExtend(str string) Extend {
 	var ret = map[string]interface{}{}
 	err := common.BytesToStruct([]byte(str), &ret)
@@ -174,6 +198,8 @@ type LogicalVolumeEntity struct {
 	NodeIds    []string            `json:"node_ids"`
 	UsedByType domain.UsedByType   `json:"used_by_type"`
 	UsedByName string              `json:"used_by_name"`
+	//FenceGeneration is bumped on every transfer of the write lock
+	FenceGeneration int64 `json:"fence_generation"`
 }
 
 type PrCheckList struct {
@@ -185,6 +211,30 @@ type PrCheckList struct {
 	SupportPrClear    bool `json:"support_pr_clear"`
 }
 
+//Aptpl returns whether the registrations of the volume persist through the array power loss
+func (e *LogicalVolumeEntity) Aptpl() bool {
+	return e.Extend.Aptpl()
+}
+
+func (e *LogicalVolumeEntity) SetAptpl(aptpl bool) {
+	if e.Extend == nil {
+		e.Extend = Extend{}
+	}
+	e.Extend[AptplKey] = aptpl
+}
+
+//ReserveType returns the reservation type the writer of the volume holds
+func (e *LogicalVolumeEntity) ReserveType() message.PrType {
+	return e.Extend.ReserveType()
+}
+
+func (e *LogicalVolumeEntity) SetReserveType(reserveType message.PrType) {
+	if e.Extend == nil {
+		e.Extend = Extend{}
+	}
+	e.Extend[ReserveTypeKey] = int(reserveType)
+}
+
 func (e *LogicalVolumeEntity) GetPvcName() string {
 	if e.UsedByType == domain.DBUsed {
 		return e.UsedByName
@@ -249,9 +299,29 @@ func (e *LogicalVolumeEntity) ClearPrKey() {
 	e.PrKey = ""
 }
 
+//FenceTo records the node as the writer of the generation, the key is fenced by the generation
+func (e *LogicalVolumeEntity) FenceTo(node config.Node, generation int64) error {
+	nodeKey, err := prkey.KeyOf(node)
+	if err != nil {
+		return err
+	}
+	e.FenceGeneration = generation
+	e.PrKey = prkey.FencedKey(nodeKey, generation)
+	return nil
+}
+
+//NextFenceGeneration is the generation for the write lock transferred to the node,
+//it keeps the current generation if the node holds the lock already
+func (e *LogicalVolumeEntity) NextFenceGeneration(node config.Node) int64 {
+	if holder := prkey.NodeOf(e.PrKey); holder != nil && holder.Name == node.Name {
+		return e.FenceGeneration
+	}
+	return e.FenceGeneration + 1
+}
+
 func (e *LogicalVolumeEntity) GetCanWriteNode() config.Node {
 	if e.PrKey != "" {
-		ret := config.GetNodeByIp(common.PrKeyToIpV4(e.PrKey))
+		ret := prkey.NodeOf(e.PrKey)
 		if ret != nil {
 			return *ret
 		}
@@ -0,0 +1,158 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package lv
+
+import (
+	"errors"
+	"fmt"
+	"polardb-sms/pkg/manager/domain/repository"
+	"sync"
+	"time"
+)
+
+//LvFenceHistory records the writer of each fence generation of a volume
+type LvFenceHistory struct {
+	Id         int       `xorm:"not null pk autoincr INT"`
+	VolumeId   string    `xorm:"unique(volume_generation_UNIQUE) VARCHAR(45)"`
+	Generation int64     `xorm:"unique(volume_generation_UNIQUE) BIGINT"`
+	NodeId     string    `xorm:"VARCHAR(128)"`
+	PrKey      string    `xorm:"VARCHAR(45)"`
+	Created    time.Time `xorm:"DATETIME created"`
+}
+
+type FenceRecordEntity struct {
+	VolumeId   string    `json:"volume_id"`
+	Generation int64     `json:"generation"`
+	NodeId     string    `json:"node_id"`
+	PrKey      string    `json:"pr_key"`
+	Created    time.Time `json:"created"`
+}
+
+//ErrFenceConflict is returned by Claim if the generation is taken by the other write lock transfer
+var ErrFenceConflict = errors.New("fence generation conflict")
+
+type FenceHistoryRepository interface {
+	Create(record *FenceRecordEntity) (int64, error)
+	Delete(record *FenceRecordEntity) (int64, error)
+	Claim(record *FenceRecordEntity) error
+	Release(record *FenceRecordEntity) error
+	QueryByVolumeId(volumeId string) ([]*FenceRecordEntity, error)
+}
+
+type FenceHistoryRepositoryImpl struct {
+	*repository.BaseDB
+}
+
+func (r *FenceHistoryRepositoryImpl) Create(record *FenceRecordEntity) (int64, error) {
+	return r.Engine.Insert(&LvFenceHistory{
+		VolumeId:   record.VolumeId,
+		Generation: record.Generation,
+		NodeId:     record.NodeId,
+		PrKey:      record.PrKey,
+	})
+}
+
+func (r *FenceHistoryRepositoryImpl) Delete(record *FenceRecordEntity) (int64, error) {
+	return r.Engine.Where("volume_id=? and generation=?", record.VolumeId, record.Generation).
+		Delete(&LvFenceHistory{})
+}
+
+//Claim bumps the fence generation of the volume to record.Generation and records the writer in one transaction.
+//the generation is compared and set on the lv row, and the unique key of the history fails the racing claims
+func (r *FenceHistoryRepositoryImpl) Claim(record *FenceRecordEntity) error {
+	session := r.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	affected, err := session.Table(&LogicalVolume{}).
+		Where("volume_id=? and fence_generation=?", record.VolumeId, record.Generation-1).
+		Update(map[string]interface{}{"fence_generation": record.Generation})
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	if affected == 0 {
+		_ = session.Rollback()
+		return fmt.Errorf("%w: generation %d of volume %s is not the next one", ErrFenceConflict, record.Generation, record.VolumeId)
+	}
+	if _, err = session.Insert(&LvFenceHistory{
+		VolumeId:   record.VolumeId,
+		Generation: record.Generation,
+		NodeId:     record.NodeId,
+		PrKey:      record.PrKey,
+	}); err != nil {
+		_ = session.Rollback()
+		return fmt.Errorf("%w: record generation %d of volume %s: %v", ErrFenceConflict, record.Generation, record.VolumeId, err)
+	}
+	return session.Commit()
+}
+
+//Release gives back the generation taken by Claim, the lv row is kept if it has moved on
+func (r *FenceHistoryRepositoryImpl) Release(record *FenceRecordEntity) error {
+	session := r.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if _, err := session.Table(&LogicalVolume{}).
+		Where("volume_id=? and fence_generation=?", record.VolumeId, record.Generation).
+		Update(map[string]interface{}{"fence_generation": record.Generation - 1}); err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	if _, err := session.Where("volume_id=? and generation=? and node_id=?", record.VolumeId, record.Generation, record.NodeId).
+		Delete(&LvFenceHistory{}); err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+//QueryByVolumeId returns the records from the latest generation
+func (r *FenceHistoryRepositoryImpl) QueryByVolumeId(volumeId string) ([]*FenceRecordEntity, error) {
+	var histories []*LvFenceHistory
+	if err := r.Engine.Where("volume_id=?", volumeId).Desc("generation").Find(&histories); err != nil {
+		return nil, err
+	}
+	records := make([]*FenceRecordEntity, 0, len(histories))
+	for _, h := range histories {
+		records = append(records, &FenceRecordEntity{
+			VolumeId:   h.VolumeId,
+			Generation: h.Generation,
+			NodeId:     h.NodeId,
+			PrKey:      h.PrKey,
+			Created:    h.Created,
+		})
+	}
+	return records, nil
+}
+
+func GetFenceHistoryRepository() FenceHistoryRepository {
+	_fenceRepoOnce.Do(func() {
+		if _fenceRepo == nil {
+			_fenceRepo = &FenceHistoryRepositoryImpl{
+				BaseDB: repository.GetBaseDB(),
+			}
+		}
+	})
+	return _fenceRepo
+}
+
+var (
+	_fenceRepo     FenceHistoryRepository
+	_fenceRepoOnce sync.Once
+)
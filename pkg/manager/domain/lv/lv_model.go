@@ -18,30 +18,31 @@ package lv
 import "time"
 
 type LogicalVolume struct {
-	Id           int       `xorm:"not null pk autoincr INT"`
-	VolumeId     string    `xorm:"VARCHAR(45)"`
-	VolumeName   string    `xorm:"not null unique VARCHAR(45)"`
-	Children     string    `xorm:"TEXT"`
-	LvType       string    `xorm:"VARCHAR(45)"`
-	NodeIds      string    `xorm:"TEXT"`
-	RelatedPvc   string    `xorm:"VARCHAR(45)"`
-	FsSize       int64     `xorm:"BIGINT"`
-	FsType       string    `xorm:"INT"`
-	SectorNum    int64     `xorm:"BIGINT"`
-	SectorSize   int       `xorm:"INT"`
-	Size         int64     `xorm:"BIGINT"`
-	UsedSize     int64     `xorm:"BIGINT"`
-	Status       string    `xorm:"VARCHAR(45)"`
-	PrStatus     string    `xorm:"MEDIUMTEXT"`
-	PrNodeId     string    `xorm:"VARCHAR(45)"`
-	Vendor       string    `xorm:"VARCHAR(45)"`
-	Product      string    `xorm:"VARCHAR(45)"`
-	Extend       string    `xorm:"MEDIUMTEXT"`
-	ClusterId    int       `xorm:"INT"`
-	UsedByType   int       `xorm:"INT"`
-	UsedByName   string    `xorm:"VARCHAR(45)"`
-	SerialNumber string    `xorm:"VARCHAR(45)"`
-	Updated      time.Time `xorm:"DATETIME updated"`
-	Created      time.Time `xorm:"DATETIME created"`
-	DeletedAt    time.Time `xorm:"DATETIME deleted"`
+	Id              int       `xorm:"not null pk autoincr INT"`
+	VolumeId        string    `xorm:"VARCHAR(45)"`
+	VolumeName      string    `xorm:"not null unique VARCHAR(45)"`
+	Children        string    `xorm:"TEXT"`
+	LvType          string    `xorm:"VARCHAR(45)"`
+	NodeIds         string    `xorm:"TEXT"`
+	RelatedPvc      string    `xorm:"VARCHAR(45)"`
+	FsSize          int64     `xorm:"BIGINT"`
+	FsType          string    `xorm:"INT"`
+	SectorNum       int64     `xorm:"BIGINT"`
+	SectorSize      int       `xorm:"INT"`
+	Size            int64     `xorm:"BIGINT"`
+	UsedSize        int64     `xorm:"BIGINT"`
+	Status          string    `xorm:"VARCHAR(45)"`
+	PrStatus        string    `xorm:"MEDIUMTEXT"`
+	PrNodeId        string    `xorm:"VARCHAR(45)"`
+	FenceGeneration int64     `xorm:"BIGINT"`
+	Vendor          string    `xorm:"VARCHAR(45)"`
+	Product         string    `xorm:"VARCHAR(45)"`
+	Extend          string    `xorm:"MEDIUMTEXT"`
+	ClusterId       int       `xorm:"INT"`
+	UsedByType      int       `xorm:"INT"`
+	UsedByName      string    `xorm:"VARCHAR(45)"`
+	SerialNumber    string    `xorm:"VARCHAR(45)"`
+	Updated         time.Time `xorm:"DATETIME updated"`
+	Created         time.Time `xorm:"DATETIME created"`
+	DeletedAt       time.Time `xorm:"DATETIME deleted"`
 }
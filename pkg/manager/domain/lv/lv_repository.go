@@ -54,6 +54,20 @@ func (c *LvRepositoryImpl) UpdateUsed(lvEntity *LogicalVolumeEntity) (int64, err
 	return 0, nil
 }
 
+func (c *LvRepositoryImpl) UpdateExtend(lvEntity *LogicalVolumeEntity) (int64, error) {
+	lvModelInf, err := c.dataConverter.ToModel(lvEntity)
+	if err != nil {
+		return 0, err
+	}
+	lvModel := lvModelInf.(*LogicalVolume)
+	if _, err := c.Engine.Alias("a").
+		Where("a.volume_id=?", lvModel.VolumeId).Cols("extend").
+		Update(lvModel); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
 func (c *LvRepositoryImpl) UpdatePr(lvEntity *LogicalVolumeEntity) (int64, error) {
 	lvModelInf, err := c.dataConverter.ToModel(lvEntity)
 	if err != nil {
@@ -61,7 +75,7 @@ func (c *LvRepositoryImpl) UpdatePr(lvEntity *LogicalVolumeEntity) (int64, error
 	}
 	lvModel := lvModelInf.(*LogicalVolume)
 	if _, err := c.Engine.Alias("a").
-		Where("a.volume_id=?", lvModel.VolumeId).Cols("pr_node_id").
+		Where("a.volume_id=?", lvModel.VolumeId).Cols("pr_node_id", "fence_generation").
 		Update(lvModel); err != nil {
 		return 0, err
 	}
@@ -238,6 +252,7 @@ type LvRepository interface {
 	Save(clusterLun *LogicalVolumeEntity) (int64, error)
 	UpdateUsed(clusterLun *LogicalVolumeEntity) (int64, error)
 	UpdatePr(clusterLun *LogicalVolumeEntity) (int64, error)
+	UpdateExtend(clusterLun *LogicalVolumeEntity) (int64, error)
 	FindByName(name string) (*LogicalVolumeEntity, error)
 	FindByVolumeId(volumeId string) (*LogicalVolumeEntity, error)
 	FindByVolumeIds(volumeIds []string) ([]*LogicalVolumeEntity, error)
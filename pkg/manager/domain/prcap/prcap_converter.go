@@ -0,0 +1,110 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prcap
+
+import (
+	"encoding/json"
+	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/network/message"
+	"strconv"
+	"strings"
+)
+
+var _ domain.Converter = &PrCapabilityProfileConverter{}
+
+type PrCapabilityProfileConverter struct {
+}
+
+func formatTypes(types []message.PrType) string {
+	ts := make([]string, 0, len(types))
+	for _, t := range types {
+		ts = append(ts, strconv.Itoa(int(t)))
+	}
+	return strings.Join(ts, ",")
+}
+
+func parseTypes(s string) []message.PrType {
+	types := make([]message.PrType, 0)
+	for _, t := range strings.Split(s, ",") {
+		if v, err := strconv.Atoi(t); err == nil {
+			types = append(types, message.PrType(v))
+		}
+	}
+	return types
+}
+
+func (converter *PrCapabilityProfileConverter) ToModel(t interface{}) (interface{}, error) {
+	e := t.(*PrCapabilityProfileEntity)
+	steps, err := json.Marshal(e.Steps)
+	if err != nil {
+		return nil, err
+	}
+	report, err := json.Marshal(e.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	m := PrCapabilityProfile{
+		Vendor:           e.Vendor,
+		Product:          e.Product,
+		VolumeId:         e.VolumeId,
+		ProbedType:       int(e.ProbedType),
+		ReservationTypes: formatTypes(e.ReservationTypes),
+		PtplCapable:      e.PtplCapable,
+		AtpCapable:       e.AtpCapable,
+		Steps:            string(steps),
+		Report:           string(report),
+	}
+	return &m, nil
+}
+
+func (converter *PrCapabilityProfileConverter) ToEntity(t interface{}) (interface{}, error) {
+	m := t.(*PrCapabilityProfile)
+	e := PrCapabilityProfileEntity{
+		Vendor:           m.Vendor,
+		Product:          m.Product,
+		VolumeId:         m.VolumeId,
+		ProbedType:       message.PrType(m.ProbedType),
+		ReservationTypes: parseTypes(m.ReservationTypes),
+		PtplCapable:      m.PtplCapable,
+		AtpCapable:       m.AtpCapable,
+		Steps:            make(map[string]bool),
+		Nodes:            make([]*NodeCapability, 0),
+		Updated:          m.Updated,
+	}
+	if err := json.Unmarshal([]byte(m.Steps), &e.Steps); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(m.Report), &e.Nodes); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (converter *PrCapabilityProfileConverter) ToEntities(ds []interface{}) ([]interface{}, error) {
+	var es []interface{}
+	for _, t := range ds {
+		e, err := converter.ToEntity(t.(*PrCapabilityProfile))
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e.(*PrCapabilityProfileEntity))
+	}
+	return es, nil
+}
+
+func NewPrCapabilityProfileConverter() domain.Converter {
+	return &PrCapabilityProfileConverter{}
+}
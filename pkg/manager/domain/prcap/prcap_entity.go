@@ -0,0 +1,103 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prcap
+
+import (
+	"polardb-sms/pkg/network/message"
+	"time"
+)
+
+//NodeCapability is the probe result of the paths seen by one node
+type NodeCapability struct {
+	NodeId string                      `json:"node_id"`
+	Paths  []*message.PrPathCapability `json:"paths"`
+	ErrMsg string                      `json:"err_msg,omitempty"`
+}
+
+//PrCapabilityProfileEntity keeps what is supported on every path of every node probed,
+//the raw results are kept in Nodes
+type PrCapabilityProfileEntity struct {
+	Vendor           string            `json:"vendor"`
+	Product          string            `json:"product"`
+	VolumeId         string            `json:"volume_id"`
+	ProbedType       message.PrType    `json:"probed_type"`
+	ReservationTypes []message.PrType  `json:"reservation_types"`
+	PtplCapable      bool              `json:"ptpl_c"`
+	AtpCapable       bool              `json:"atp_c"`
+	Steps            map[string]bool   `json:"steps"`
+	Nodes            []*NodeCapability `json:"nodes"`
+	Updated          time.Time         `json:"updated"`
+}
+
+//NewProfile merges the node results, a node failed to probe makes nothing supported
+func NewProfile(vendor, product, volumeId string, probedType message.PrType, nodes []*NodeCapability) *PrCapabilityProfileEntity {
+	e := &PrCapabilityProfileEntity{
+		Vendor:           vendor,
+		Product:          product,
+		VolumeId:         volumeId,
+		ProbedType:       probedType,
+		ReservationTypes: make([]message.PrType, 0),
+		Steps:            make(map[string]bool),
+		Nodes:            nodes,
+	}
+	paths := make([]*message.PrPathCapability, 0)
+	for _, node := range nodes {
+		if node.ErrMsg != "" || len(node.Paths) == 0 {
+			return e
+		}
+		paths = append(paths, node.Paths...)
+	}
+	if len(paths) == 0 {
+		return e
+	}
+	e.PtplCapable, e.AtpCapable = true, true
+	typeCnt := make(map[message.PrType]int)
+	stepCnt := make(map[string]int)
+	for _, path := range paths {
+		e.PtplCapable = e.PtplCapable && path.PtplCapable
+		e.AtpCapable = e.AtpCapable && path.AtpCapable
+		for _, t := range path.ReservationTypes {
+			typeCnt[t]++
+		}
+		for _, step := range path.Steps {
+			if _, ok := stepCnt[step.Step]; !ok {
+				stepCnt[step.Step] = 0
+			}
+			if step.Success {
+				stepCnt[step.Step]++
+			}
+		}
+	}
+	for _, t := range []message.PrType{message.WE, message.EA, message.WERO, message.EARO, message.WEAR, message.EAAR} {
+		if typeCnt[t] == len(paths) {
+			e.ReservationTypes = append(e.ReservationTypes, t)
+		}
+	}
+	for step, cnt := range stepCnt {
+		e.Steps[step] = cnt == len(paths)
+	}
+	return e
+}
+
+//Supports returns whether the reservation type is reported by all the paths
+func (e *PrCapabilityProfileEntity) Supports(prType message.PrType) bool {
+	for _, t := range e.ReservationTypes {
+		if t == prType {
+			return true
+		}
+	}
+	return false
+}
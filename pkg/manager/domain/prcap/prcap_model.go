@@ -0,0 +1,34 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prcap
+
+import "time"
+
+//PrCapabilityProfile is the pr compatibility of one (vendor, product), probed on a scratch lun
+type PrCapabilityProfile struct {
+	Id               int       `xorm:"not null pk autoincr INT"`
+	Vendor           string    `xorm:"unique(vendor_product_UNIQUE) VARCHAR(45)"`
+	Product          string    `xorm:"unique(vendor_product_UNIQUE) VARCHAR(45)"`
+	VolumeId         string    `xorm:"VARCHAR(45)"`
+	ProbedType       int       `xorm:"INT"`
+	ReservationTypes string    `xorm:"VARCHAR(45)"`
+	PtplCapable      bool      `xorm:"BOOL"`
+	AtpCapable       bool      `xorm:"BOOL"`
+	Steps            string    `xorm:"TEXT"`
+	Report           string    `xorm:"MEDIUMTEXT"`
+	Created          time.Time `xorm:"DATETIME created"`
+	Updated          time.Time `xorm:"DATETIME updated"`
+}
@@ -0,0 +1,106 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prcap
+
+import (
+	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/manager/domain/repository"
+	"sync"
+)
+
+type PrCapabilityProfileRepository interface {
+	Save(profile *PrCapabilityProfileEntity) (int64, error)
+	FindByVendorAndProduct(vendor, product string) (*PrCapabilityProfileEntity, error)
+	QueryAll() ([]*PrCapabilityProfileEntity, error)
+}
+
+type PrCapabilityProfileRepositoryImpl struct {
+	dataConverter domain.Converter
+	*repository.BaseDB
+}
+
+//Save replaces the profile of the same vendor and product
+func (r *PrCapabilityProfileRepositoryImpl) Save(profile *PrCapabilityProfileEntity) (int64, error) {
+	m, err := r.dataConverter.ToModel(profile)
+	if err != nil {
+		return 0, err
+	}
+	profileModel := m.(*PrCapabilityProfile)
+	exist, err := r.Engine.Where("vendor=? and product=?", profile.Vendor, profile.Product).Exist(&PrCapabilityProfile{})
+	if err != nil {
+		return 0, err
+	}
+	if exist {
+		return r.Engine.Where("vendor=? and product=?", profile.Vendor, profile.Product).AllCols().Update(profileModel)
+	}
+	return r.Engine.Insert(profileModel)
+}
+
+func (r *PrCapabilityProfileRepositoryImpl) FindByVendorAndProduct(vendor, product string) (*PrCapabilityProfileEntity, error) {
+	profileModel := &PrCapabilityProfile{}
+	exist, err := r.Engine.Where("vendor=? and product=?", vendor, product).Get(profileModel)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, nil
+	}
+	e, err := r.dataConverter.ToEntity(profileModel)
+	if err != nil {
+		return nil, err
+	}
+	return e.(*PrCapabilityProfileEntity), nil
+}
+
+func (r *PrCapabilityProfileRepositoryImpl) QueryAll() ([]*PrCapabilityProfileEntity, error) {
+	var profiles []*PrCapabilityProfile
+	err := r.Engine.Find(&profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var ps = make([]interface{}, len(profiles))
+	for i, p := range profiles {
+		ps[i] = p
+	}
+
+	var es = make([]*PrCapabilityProfileEntity, 0)
+	esi, err := r.dataConverter.ToEntities(ps)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range esi {
+		es = append(es, e.(*PrCapabilityProfileEntity))
+	}
+	return es, nil
+}
+
+func GetPrCapabilityProfileRepository() PrCapabilityProfileRepository {
+	_profileRepoOnce.Do(func() {
+		if _profileRepo == nil {
+			_profileRepo = &PrCapabilityProfileRepositoryImpl{
+				dataConverter: NewPrCapabilityProfileConverter(),
+				BaseDB:        repository.GetBaseDB(),
+			}
+		}
+	})
+	return _profileRepo
+}
+
+var (
+	_profileRepo     PrCapabilityProfileRepository
+	_profileRepoOnce sync.Once
+)
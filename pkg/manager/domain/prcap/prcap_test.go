@@ -0,0 +1,69 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prcap
+
+import (
+	"polardb-sms/pkg/network/message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPath(path string, types []message.PrType, failedStep string) *message.PrPathCapability {
+	steps := make([]*message.PrStepResult, 0)
+	for _, step := range []string{"register", "reserve", "preempt", "release", "clear"} {
+		steps = append(steps, &message.PrStepResult{Step: step, Success: step != failedStep})
+	}
+	return &message.PrPathCapability{
+		Path:             path,
+		ReservationTypes: types,
+		PtplCapable:      true,
+		AtpCapable:       true,
+		Steps:            steps,
+	}
+}
+
+func TestNewProfile(t *testing.T) {
+	nodes := []*NodeCapability{
+		{NodeId: "node-1", Paths: []*message.PrPathCapability{
+			newPath("/dev/sda", []message.PrType{message.WE, message.WEAR}, ""),
+			newPath("/dev/sdb", []message.PrType{message.WE, message.WEAR, message.EAAR}, ""),
+		}},
+		{NodeId: "node-2", Paths: []*message.PrPathCapability{
+			newPath("/dev/sdc", []message.PrType{message.WEAR, message.EAAR}, "preempt"),
+		}},
+	}
+	profile := NewProfile("HUAWEI", "XSG1", "36e00084100ee7ec9", message.WEAR, nodes)
+	assert.Equal(t, []message.PrType{message.WEAR}, profile.ReservationTypes)
+	assert.True(t, profile.Supports(message.WEAR))
+	assert.False(t, profile.Supports(message.WE))
+	assert.True(t, profile.PtplCapable)
+	assert.True(t, profile.Steps["register"])
+	assert.False(t, profile.Steps["preempt"])
+
+	m, err := NewPrCapabilityProfileConverter().ToModel(profile)
+	assert.NoError(t, err)
+	e, err := NewPrCapabilityProfileConverter().ToEntity(m)
+	assert.NoError(t, err)
+	assert.Equal(t, profile.ReservationTypes, e.(*PrCapabilityProfileEntity).ReservationTypes)
+	assert.Equal(t, profile.Steps, e.(*PrCapabilityProfileEntity).Steps)
+	assert.Equal(t, 2, len(e.(*PrCapabilityProfileEntity).Nodes))
+
+	nodes[1].ErrMsg = "timeout"
+	profile = NewProfile("HUAWEI", "XSG1", "36e00084100ee7ec9", message.WEAR, nodes)
+	assert.Equal(t, 0, len(profile.ReservationTypes))
+	assert.False(t, profile.PtplCapable)
+}
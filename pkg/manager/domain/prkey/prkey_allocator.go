@@ -0,0 +1,172 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"polardb-sms/pkg/common"
+	"polardb-sms/pkg/manager/config"
+	"strconv"
+	"strings"
+)
+
+const (
+	//the manager assigned key is generation(16 bits) + sequence(48 bits)
+	generationShift = 48
+	sequenceMask    = uint64(1)<<generationShift - 1
+	maxHashRetries  = 16
+	//a 32 bits key is fenced by the generation in its high 32 bits
+	fenceShift = 32
+	fenceMask  = uint64(1)<<fenceShift - 1
+)
+
+//Allocator allocates the pr key of a node, the key must not be any of the allocated keys
+type Allocator interface {
+	Scheme() string
+	Generation() int
+	Allocate(node config.Node, allocated map[string]bool) (string, error)
+}
+
+func NewAllocator(scheme string, generation int) (Allocator, error) {
+	switch scheme {
+	case "", config.PrKeySchemeIp:
+		return &ipAllocator{}, nil
+	case config.PrKeySchemeNodeId:
+		return &nodeIdAllocator{}, nil
+	case config.PrKeySchemeManager:
+		if generation < 0 || generation > config.MaxPrKeyGeneration {
+			return nil, fmt.Errorf("invalid pr key generation %d", generation)
+		}
+		return &managerAllocator{generation: uint64(generation)}, nil
+	default:
+		return nil, fmt.Errorf("unknown pr key scheme %s", scheme)
+	}
+}
+
+func parseKey(key string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(strings.ToLower(key), "0x"), 16, 64)
+}
+
+func formatKey(value uint64) string {
+	return fmt.Sprintf("%#x", value)
+}
+
+//ipAllocator derives the key from the node ip, the ipv4 key is the same as common.IpV4ToPrKey
+//and the ipv6 key is the interface identifier
+type ipAllocator struct {
+}
+
+func (a *ipAllocator) Scheme() string {
+	return config.PrKeySchemeIp
+}
+
+func (a *ipAllocator) Generation() int {
+	return 0
+}
+
+func (a *ipAllocator) Allocate(node config.Node, allocated map[string]bool) (string, error) {
+	ip := net.ParseIP(node.Ip)
+	if ip == nil {
+		return "", fmt.Errorf("invalid ip %s of node %s", node.Ip, node.Name)
+	}
+	var key string
+	if ip.To4() != nil {
+		key = common.IpV4ToPrKey(node.Ip)
+	} else {
+		key = formatKey(binary.BigEndian.Uint64(ip.To16()[8:]))
+	}
+	if value, _ := parseKey(key); value == 0 {
+		return "", fmt.Errorf("ip %s of node %s can not be a pr key", node.Ip, node.Name)
+	}
+	if allocated[common.NormalizePrKey(key)] {
+		return "", fmt.Errorf("the key %s derived from ip %s of node %s is allocated to another node", key, node.Ip, node.Name)
+	}
+	return key, nil
+}
+
+//nodeIdAllocator hashes the node id, rehashing on collision
+type nodeIdAllocator struct {
+}
+
+func (a *nodeIdAllocator) Scheme() string {
+	return config.PrKeySchemeNodeId
+}
+
+func (a *nodeIdAllocator) Generation() int {
+	return 0
+}
+
+func (a *nodeIdAllocator) Allocate(node config.Node, allocated map[string]bool) (string, error) {
+	for i := 0; i < maxHashRetries; i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(node.Name))
+		if i > 0 {
+			_, _ = h.Write([]byte(strconv.Itoa(i)))
+		}
+		value := h.Sum64()
+		if value == 0 {
+			continue
+		}
+		if key := formatKey(value); !allocated[key] {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("can not hash a free key for node %s", node.Name)
+}
+
+//managerAllocator assigns the next sequence of its generation
+type managerAllocator struct {
+	generation uint64
+}
+
+func (a *managerAllocator) Scheme() string {
+	return config.PrKeySchemeManager
+}
+
+func (a *managerAllocator) Generation() int {
+	return int(a.generation)
+}
+
+func (a *managerAllocator) Allocate(node config.Node, allocated map[string]bool) (string, error) {
+	var maxSeq uint64
+	for key := range allocated {
+		value, err := parseKey(key)
+		if err != nil || value>>generationShift != a.generation {
+			continue
+		}
+		if seq := value & sequenceMask; seq > maxSeq {
+			maxSeq = seq
+		}
+	}
+	if maxSeq == sequenceMask {
+		return "", fmt.Errorf("the keys of generation %d are exhausted", a.generation)
+	}
+	return formatKey(a.generation<<generationShift | (maxSeq + 1)), nil
+}
+
+//FencedKey encodes the fence generation of the volume into the node key.
+//only the 32 bits keys have room for it, the 64 bits keys are returned as is
+//and the generation is only kept with the volume
+func FencedKey(nodeKey string, generation int64) string {
+	value, err := parseKey(nodeKey)
+	if err != nil || generation <= 0 || value > fenceMask {
+		return nodeKey
+	}
+	return formatKey(uint64(generation)&fenceMask<<fenceShift | value)
+}
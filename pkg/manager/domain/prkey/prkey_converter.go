@@ -0,0 +1,61 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import (
+	"polardb-sms/pkg/manager/domain"
+)
+
+var _ domain.Converter = &NodePrKeyConverter{}
+
+type NodePrKeyConverter struct {
+}
+
+func (converter *NodePrKeyConverter) ToModel(t interface{}) (interface{}, error) {
+	e := t.(*NodePrKeyEntity)
+	m := NodePrKey{
+		NodeId:     e.NodeId,
+		PrKey:      e.PrKey,
+		Scheme:     e.Scheme,
+		Generation: e.Generation,
+	}
+	return &m, nil
+}
+
+func (converter *NodePrKeyConverter) ToEntity(t interface{}) (interface{}, error) {
+	m := t.(*NodePrKey)
+	e := NodePrKeyEntity{
+		NodeId:     m.NodeId,
+		PrKey:      m.PrKey,
+		Scheme:     m.Scheme,
+		Generation: m.Generation,
+		Created:    m.Created,
+	}
+	return &e, nil
+}
+
+func (converter *NodePrKeyConverter) ToEntities(ds []interface{}) ([]interface{}, error) {
+	var es []interface{}
+	for _, t := range ds {
+		e, _ := converter.ToEntity(t.(*NodePrKey))
+		es = append(es, e.(*NodePrKeyEntity))
+	}
+	return es, nil
+}
+
+func NewNodePrKeyConverter() domain.Converter {
+	return &NodePrKeyConverter{}
+}
@@ -0,0 +1,156 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import (
+	"fmt"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain/repository"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FenceActionFence   = "fence"
+	FenceActionUnfence = "unfence"
+)
+
+//NodeFenceHistory records the fence and unfence of a node, the node is fenced if its latest record is a fence
+type NodeFenceHistory struct {
+	Id      int       `xorm:"not null pk autoincr INT"`
+	NodeId  string    `xorm:"index VARCHAR(128)"`
+	PrKey   string    `xorm:"VARCHAR(45)"`
+	Action  string    `xorm:"VARCHAR(16)"`
+	Reason  string    `xorm:"VARCHAR(255)"`
+	Volumes string    `xorm:"TEXT"`
+	Created time.Time `xorm:"DATETIME created"`
+}
+
+type NodeFenceRecordEntity struct {
+	NodeId  string    `json:"node_id"`
+	PrKey   string    `json:"pr_key"`
+	Action  string    `json:"action"`
+	Reason  string    `json:"reason"`
+	Volumes []string  `json:"volumes"`
+	Created time.Time `json:"created"`
+}
+
+func (e *NodeFenceRecordEntity) Fenced() bool {
+	return e.Action == FenceActionFence
+}
+
+type NodeFenceRepository interface {
+	Create(record *NodeFenceRecordEntity) (int64, error)
+	//QueryByNodeId returns the records from the latest
+	QueryByNodeId(nodeId string) ([]*NodeFenceRecordEntity, error)
+	IsFenced(nodeId string) (bool, error)
+}
+
+type NodeFenceRepositoryImpl struct {
+	*repository.BaseDB
+}
+
+func (r *NodeFenceRepositoryImpl) Create(record *NodeFenceRecordEntity) (int64, error) {
+	return r.Engine.Insert(&NodeFenceHistory{
+		NodeId:  record.NodeId,
+		PrKey:   record.PrKey,
+		Action:  record.Action,
+		Reason:  record.Reason,
+		Volumes: strings.Join(record.Volumes, ","),
+	})
+}
+
+func (r *NodeFenceRepositoryImpl) QueryByNodeId(nodeId string) ([]*NodeFenceRecordEntity, error) {
+	var histories []*NodeFenceHistory
+	if err := r.Engine.Where("node_id=?", nodeId).Desc("id").Find(&histories); err != nil {
+		return nil, err
+	}
+	records := make([]*NodeFenceRecordEntity, 0, len(histories))
+	for _, h := range histories {
+		record := &NodeFenceRecordEntity{
+			NodeId:  h.NodeId,
+			PrKey:   h.PrKey,
+			Action:  h.Action,
+			Reason:  h.Reason,
+			Volumes: make([]string, 0),
+			Created: h.Created,
+		}
+		if h.Volumes != "" {
+			record.Volumes = strings.Split(h.Volumes, ",")
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (r *NodeFenceRepositoryImpl) IsFenced(nodeId string) (bool, error) {
+	latest := &NodeFenceHistory{}
+	exist, err := r.Engine.Where("node_id=?", nodeId).Desc("id").Get(latest)
+	if err != nil {
+		return false, err
+	}
+	return exist && latest.Action == FenceActionFence, nil
+}
+
+func GetNodeFenceRepository() NodeFenceRepository {
+	_nodeFenceRepoOnce.Do(func() {
+		if _nodeFenceRepo == nil {
+			_nodeFenceRepo = &NodeFenceRepositoryImpl{
+				BaseDB: repository.GetBaseDB(),
+			}
+		}
+	})
+	return _nodeFenceRepo
+}
+
+//CheckNotFenced returns an error if the node is fenced, the fenced node can not register until unfenced
+func CheckNotFenced(nodeId string) error {
+	fenced, err := GetNodeFenceRepository().IsFenced(nodeId)
+	if err != nil {
+		return fmt.Errorf("can not check if node %s is fenced: %v", nodeId, err)
+	}
+	if fenced {
+		return fmt.Errorf("node %s is fenced, unfence it before registering", nodeId)
+	}
+	return nil
+}
+
+//RegisterKeyOf returns the pr key of the node to register with
+func RegisterKeyOf(node config.Node) (string, error) {
+	if err := CheckNotFenced(node.Name); err != nil {
+		return "", err
+	}
+	return KeyOf(node)
+}
+
+//IsNodeKey returns whether the key is nodeKey or nodeKey fenced by a generation
+func IsNodeKey(key, nodeKey string) bool {
+	value, err := parseKey(key)
+	if key == "" || err != nil {
+		return false
+	}
+	nodeValue, err := parseKey(nodeKey)
+	if nodeKey == "" || err != nil {
+		return false
+	}
+	return value == nodeValue || (nodeValue <= fenceMask && value&fenceMask == nodeValue)
+}
+
+var (
+	_nodeFenceRepo     NodeFenceRepository
+	_nodeFenceRepoOnce sync.Once
+)
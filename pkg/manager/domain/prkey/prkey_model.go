@@ -0,0 +1,29 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import "time"
+
+//NodePrKey is the pr key allocated to a node, a node keeps its key once allocated
+type NodePrKey struct {
+	Id         int       `xorm:"not null pk autoincr INT"`
+	NodeId     string    `xorm:"unique(node_id_UNIQUE) VARCHAR(128)"`
+	PrKey      string    `xorm:"unique(pr_key_UNIQUE) VARCHAR(45)"`
+	Scheme     string    `xorm:"VARCHAR(45)"`
+	Generation int       `xorm:"INT"`
+	Created    time.Time `xorm:"DATETIME created"`
+	Updated    time.Time `xorm:"DATETIME updated"`
+}
@@ -0,0 +1,162 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import (
+	"fmt"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
+	"sync"
+)
+
+//KeyRegistry keeps the pr key of each node, the key is allocated at the first use and persisted
+type KeyRegistry struct {
+	repo      NodePrKeyRepository
+	allocator Allocator
+	lock      sync.Mutex
+	byNode    map[string]*NodePrKeyEntity
+	byKey     map[string]*NodePrKeyEntity
+}
+
+func NewKeyRegistry(repo NodePrKeyRepository, allocator Allocator) *KeyRegistry {
+	return &KeyRegistry{
+		repo:      repo,
+		allocator: allocator,
+		byNode:    make(map[string]*NodePrKeyEntity),
+		byKey:     make(map[string]*NodePrKeyEntity),
+	}
+}
+
+//reload must be called with the lock held, the keys may be allocated by another manager
+func (r *KeyRegistry) reload() error {
+	keys, err := r.repo.QueryAll()
+	if err != nil {
+		return err
+	}
+	byNode := make(map[string]*NodePrKeyEntity)
+	byKey := make(map[string]*NodePrKeyEntity)
+	for _, k := range keys {
+		byNode[k.NodeId] = k
+		byKey[common.NormalizePrKey(k.PrKey)] = k
+	}
+	r.byNode, r.byKey = byNode, byKey
+	return nil
+}
+
+//KeyOf returns the pr key of the node, allocating one if the node has none
+func (r *KeyRegistry) KeyOf(node config.Node) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if k, ok := r.byNode[node.Name]; ok {
+		return k.PrKey, nil
+	}
+	if err := r.reload(); err != nil {
+		return "", fmt.Errorf("can not load the pr keys: %v", err)
+	}
+	if k, ok := r.byNode[node.Name]; ok {
+		return k.PrKey, nil
+	}
+
+	allocated := make(map[string]bool)
+	for key := range r.byKey {
+		allocated[key] = true
+	}
+	key, err := r.allocator.Allocate(node, allocated)
+	if err != nil {
+		return "", err
+	}
+	entity := &NodePrKeyEntity{
+		NodeId:     node.Name,
+		PrKey:      key,
+		Scheme:     r.allocator.Scheme(),
+		Generation: r.allocator.Generation(),
+	}
+	if err := r.repo.Create(entity); err != nil {
+		//another manager may allocate at the same time, the unique keys keep one of them
+		_ = r.reload()
+		if k, ok := r.byNode[node.Name]; ok {
+			return k.PrKey, nil
+		}
+		return "", fmt.Errorf("can not persist pr key %s of node %s: %v", key, node.Name, err)
+	}
+	smslog.Infof("allocate pr key %s for node %s by scheme %s", key, node.Name, entity.Scheme)
+	r.byNode[node.Name] = entity
+	r.byKey[common.NormalizePrKey(key)] = entity
+	return key, nil
+}
+
+//NodeOf returns the available node of the pr key, or nil.
+//the key may be fenced by FencedKey, and the key not allocated by the registry
+//is taken as an ip derived key of the old versions
+func (r *KeyRegistry) NodeOf(key string) *config.Node {
+	value, err := parseKey(key)
+	if key == "" || err != nil {
+		return nil
+	}
+	candidates := []string{formatKey(value)}
+	if value > fenceMask {
+		candidates = append(candidates, formatKey(value&fenceMask))
+	}
+	lookup := func() *NodePrKeyEntity {
+		for _, c := range candidates {
+			if k, ok := r.byKey[c]; ok {
+				return k
+			}
+		}
+		return nil
+	}
+	r.lock.Lock()
+	k := lookup()
+	if k == nil {
+		if err := r.reload(); err != nil {
+			smslog.Warnf("can not load the pr keys: %v", err)
+		}
+		k = lookup()
+	}
+	r.lock.Unlock()
+	if k != nil {
+		return config.GetNodeById(k.NodeId)
+	}
+	return config.GetNodeByIp(common.PrKeyToIpV4(formatKey(value & fenceMask)))
+}
+
+func GetKeyRegistry() *KeyRegistry {
+	_registryOnce.Do(func() {
+		allocator, err := NewAllocator(config.ReservationConf.PrKeyScheme, config.ReservationConf.PrKeyGeneration)
+		if err != nil {
+			smslog.Errorf("%v, use the ip derived pr key", err)
+			allocator = &ipAllocator{}
+		}
+		_registry = NewKeyRegistry(GetNodePrKeyRepository(), allocator)
+	})
+	return _registry
+}
+
+//KeyOf returns the pr key of the node
+func KeyOf(node config.Node) (string, error) {
+	return GetKeyRegistry().KeyOf(node)
+}
+
+//NodeOf returns the available node of the pr key, or nil
+func NodeOf(key string) *config.Node {
+	return GetKeyRegistry().NodeOf(key)
+}
+
+var (
+	_registry     *KeyRegistry
+	_registryOnce sync.Once
+)
@@ -0,0 +1,81 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import (
+	"polardb-sms/pkg/manager/domain"
+	"polardb-sms/pkg/manager/domain/repository"
+	"sync"
+)
+
+type NodePrKeyRepository interface {
+	Create(keyEntity *NodePrKeyEntity) error
+	QueryAll() ([]*NodePrKeyEntity, error)
+}
+
+type NodePrKeyRepositoryImpl struct {
+	dataConverter domain.Converter
+	*repository.BaseDB
+}
+
+func (r *NodePrKeyRepositoryImpl) Create(keyEntity *NodePrKeyEntity) error {
+	keyModel, err := r.dataConverter.ToModel(keyEntity)
+	if err != nil {
+		return err
+	}
+	_, err = r.Engine.Insert(keyModel)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *NodePrKeyRepositoryImpl) QueryAll() ([]*NodePrKeyEntity, error) {
+	var keys []*NodePrKey
+	err := r.Engine.Find(&keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var ks = make([]interface{}, len(keys))
+	for i, k := range keys {
+		ks[i] = k
+	}
+
+	var es []*NodePrKeyEntity
+	esi, _ := r.dataConverter.ToEntities(ks)
+	for _, e := range esi {
+		es = append(es, e.(*NodePrKeyEntity))
+	}
+	return es, nil
+}
+
+func GetNodePrKeyRepository() NodePrKeyRepository {
+	_keyRepoOnce.Do(func() {
+		if _keyRepo == nil {
+			_keyRepo = &NodePrKeyRepositoryImpl{
+				dataConverter: NewNodePrKeyConverter(),
+				BaseDB:        repository.GetBaseDB(),
+			}
+		}
+	})
+	return _keyRepo
+}
+
+var (
+	_keyRepo     NodePrKeyRepository
+	_keyRepoOnce sync.Once
+)
@@ -0,0 +1,148 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package prkey
+
+import (
+	"fmt"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+type memRepository struct {
+	keys []*NodePrKeyEntity
+}
+
+func (r *memRepository) Create(keyEntity *NodePrKeyEntity) error {
+	for _, k := range r.keys {
+		if k.NodeId == keyEntity.NodeId || k.PrKey == keyEntity.PrKey {
+			return fmt.Errorf("duplicate entry %s", keyEntity.PrKey)
+		}
+	}
+	r.keys = append(r.keys, keyEntity)
+	return nil
+}
+
+func (r *memRepository) QueryAll() ([]*NodePrKeyEntity, error) {
+	return r.keys, nil
+}
+
+func TestAllocator(t *testing.T) {
+	node := config.Node{Name: "node-1", Ip: "10.0.0.1"}
+	a, err := NewAllocator(config.PrKeySchemeIp, 0)
+	assert.NoError(t, err)
+	key, err := a.Allocate(node, map[string]bool{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x0a000001", key)
+	key, err = a.Allocate(config.Node{Name: "node-6", Ip: "fd00::1:2:3:4"}, map[string]bool{})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x1000200030004", key)
+	_, err = a.Allocate(node, map[string]bool{"0xa000001": true})
+	assert.Error(t, err)
+
+	a, err = NewAllocator(config.PrKeySchemeNodeId, 0)
+	assert.NoError(t, err)
+	first, err := a.Allocate(node, map[string]bool{})
+	assert.NoError(t, err)
+	second, err := a.Allocate(node, map[string]bool{first: true})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	a, err = NewAllocator(config.PrKeySchemeManager, 2)
+	assert.NoError(t, err)
+	key, err = a.Allocate(node, map[string]bool{"0x2000000000003": true, "0x3000000000009": true})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x2000000000004", key)
+
+	_, err = NewAllocator(config.PrKeySchemeManager, config.MaxPrKeyGeneration+1)
+	assert.Error(t, err)
+	_, err = NewAllocator("mac", 0)
+	assert.Error(t, err)
+}
+
+func TestKeyRegistry(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	oldNodes := config.ClusterConf.Nodes
+	defer func() {
+		config.ClusterConf.Nodes = oldNodes
+	}()
+	config.ClusterConf.Nodes = map[string]config.Node{
+		"node-1": {Name: "node-1", Ip: "10.0.0.1", LastHeartbeatTime: time.Now()},
+		"node-2": {Name: "node-2", Ip: "10.0.0.2", LastHeartbeatTime: time.Now()},
+	}
+	repo := &memRepository{}
+	allocator, _ := NewAllocator(config.PrKeySchemeManager, 1)
+	r := NewKeyRegistry(repo, allocator)
+
+	key1, err := r.KeyOf(config.ClusterConf.Nodes["node-1"])
+	assert.NoError(t, err)
+	assert.Equal(t, "0x1000000000001", key1)
+	key2, err := r.KeyOf(config.ClusterConf.Nodes["node-2"])
+	assert.NoError(t, err)
+	assert.Equal(t, "0x1000000000002", key2)
+	key, err := r.KeyOf(config.ClusterConf.Nodes["node-1"])
+	assert.NoError(t, err)
+	assert.Equal(t, key1, key)
+	assert.Equal(t, 2, len(repo.keys))
+
+	assert.Equal(t, "node-2", r.NodeOf("0x0001000000000002").Name)
+	//the ip derived key of the old versions
+	assert.Equal(t, "node-2", r.NodeOf("0x0a000002").Name)
+	assert.Nil(t, r.NodeOf("0x1000000000003"))
+	assert.Nil(t, r.NodeOf(""))
+
+	//the keys persisted by another manager are kept
+	reloaded := NewKeyRegistry(repo, &ipAllocator{})
+	key, err = reloaded.KeyOf(config.ClusterConf.Nodes["node-2"])
+	assert.NoError(t, err)
+	assert.Equal(t, key2, key)
+}
+
+func TestFencedKey(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	oldNodes := config.ClusterConf.Nodes
+	defer func() {
+		config.ClusterConf.Nodes = oldNodes
+	}()
+	config.ClusterConf.Nodes = map[string]config.Node{
+		"node-1": {Name: "node-1", Ip: "10.0.0.1", LastHeartbeatTime: time.Now()},
+	}
+	assert.Equal(t, "0x30a000001", FencedKey("0x0a000001", 3))
+	assert.Equal(t, "0x0a000001", FencedKey("0x0a000001", 0))
+	//the 64 bits keys have no room for the generation
+	assert.Equal(t, "0x1000000000001", FencedKey("0x1000000000001", 3))
+
+	allocator, _ := NewAllocator(config.PrKeySchemeIp, 0)
+	r := NewKeyRegistry(&memRepository{}, allocator)
+	key, err := r.KeyOf(config.ClusterConf.Nodes["node-1"])
+	assert.NoError(t, err)
+	assert.Equal(t, "node-1", r.NodeOf(FencedKey(key, 3)).Name)
+	assert.Equal(t, "node-1", r.NodeOf(FencedKey(key, 4)).Name)
+}
+
+func TestIsNodeKey(t *testing.T) {
+	assert.True(t, IsNodeKey("0xa000001", "0x0a000001"))
+	assert.True(t, IsNodeKey(FencedKey("0x0a000001", 3), "0x0a000001"))
+	assert.False(t, IsNodeKey("0x0a000002", "0x0a000001"))
+	assert.False(t, IsNodeKey(FencedKey("0x0a000002", 3), "0x0a000001"))
+	assert.True(t, IsNodeKey("0x1000000000001", "0x1000000000001"))
+	assert.False(t, IsNodeKey("0x1000000000002", "0x1000000000001"))
+	assert.False(t, IsNodeKey("", "0x0a000001"))
+}
@@ -30,6 +30,8 @@ const (
 type DmCreateRunner struct {
 	*Stage
 	DmDevice *device.DmDevice
+	//Nodes are the nodes the device may be created on, only they are compensated
+	Nodes []string `json:"nodes"`
 }
 
 func (s *DmCreateRunner) Run(ctx common.TraceContext) *StageExecResult {
@@ -37,13 +39,22 @@ func (s *DmCreateRunner) Run(ctx common.TraceContext) *StageExecResult {
 	if err != nil {
 		return StageExecFail(err.Error())
 	}
-	ret := sendToAllParallel(msg, DmExecTimeout, config.AvailableNodes())
+	ret, nodes := sendToNodesParallel(msg, DmExecTimeout, config.AvailableNodes(), config.GetAvailableNodes())
 	s.Result = ret
+	s.Nodes = nodes
 	return ret
 }
 
 func (s *DmCreateRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	dmCommand, err := toDmExecCommand(s.Content)
+	if err != nil {
+		return StageExecFail(err.Error())
+	}
+	return sendDmExecCommand(message.SmsMessageHead_CMD_DM_DELETE_REQ, &message.DmExecCommand{
+		CommandType: message.Delete,
+		DeviceName:  dmCommand.DeviceName,
+		Device:      dmCommand.Device,
+	}, DmExecTimeout, compensatedNodes(s.Result, s.Nodes), ctx)
 }
 
 func NewDmExecStage(name, content string) *DmCreateRunner {
@@ -57,6 +68,34 @@ func NewDmExecStage(name, content string) *DmCreateRunner {
 	}
 }
 
+func toDmExecCommand(content interface{}) (*message.DmExecCommand, error) {
+	switch c := content.(type) {
+	case *message.DmExecCommand:
+		return c, nil
+	case map[string]interface{}:
+		dmCommand := &message.DmExecCommand{}
+		if err := common.MapToStruct(c, dmCommand); err != nil {
+			return nil, err
+		}
+		return dmCommand, nil
+	}
+	return nil, fmt.Errorf("unexpected dm exec command %v", content)
+}
+
+//sendDmExecCommand sends the compensating dm command to the nodes, nothing to do if there is no node
+func sendDmExecCommand(msgType message.SmsMessageHead_SmsMsgType, dmCommand *message.DmExecCommand, timeout int64,
+	nodes map[string]config.Node, ctx common.TraceContext) *StageExecResult {
+	if len(nodes) == 0 {
+		return StageExecSuccess(nil)
+	}
+	msg, err := message.NewMessage(msgType, dmCommand, ctx)
+	if err != nil {
+		return StageExecFail(err.Error())
+	}
+	ret, _ := sendToNodesParallel(msg, timeout, len(nodes), nodes)
+	return ret
+}
+
 type DmExecStageConstructor struct {
 }
 
@@ -16,7 +16,6 @@
 package stage
 
 import (
-	"fmt"
 	"polardb-sms/pkg/common"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/network/message"
@@ -42,8 +41,9 @@ func (s *FsExpandStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//filesystem can not be shrunk after growfs
 func (s *FsExpandStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	return irreversibleRollback(s.Stage)
 }
 
 func (s *FsExpandStageRunner) timeout() int64 {
@@ -101,8 +101,9 @@ func (s *FsFormatStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//the data overwritten by mkfs can not be restored
 func (s *FsFormatStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs format rollback").Error())
+	return irreversibleRollback(s.Stage)
 }
 
 func (s *FsFormatStageRunner) timeout() int64 {
@@ -16,7 +16,6 @@
 package stage
 
 import (
-	"fmt"
 	"polardb-sms/pkg/common"
 	"polardb-sms/pkg/device"
 	"polardb-sms/pkg/manager/config"
@@ -25,6 +24,8 @@ import (
 
 type LvCreateStageRunner struct {
 	*Stage
+	//Nodes are the nodes the stage may have taken effect on, only they are compensated
+	Nodes []string `json:"nodes"`
 }
 
 func (s *LvCreateStageRunner) Run(ctx common.TraceContext) *StageExecResult {
@@ -32,13 +33,22 @@ func (s *LvCreateStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	if err != nil {
 		return StageExecFail(err.Error())
 	}
-	ret := sendToAllParallel(msg, BaseTimeout, config.AvailableNodes())
+	ret, nodes := sendToNodesParallel(msg, BaseTimeout, config.AvailableNodes(), config.GetAvailableNodes())
 	s.Result = ret
+	s.Nodes = nodes
 	return ret
 }
 
 func (s *LvCreateStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	dmCommand, err := toDmExecCommand(s.Content)
+	if err != nil {
+		return StageExecFail(err.Error())
+	}
+	return sendDmExecCommand(message.SmsMessageHead_CMD_DM_DELETE_REQ, &message.DmExecCommand{
+		CommandType: message.Delete,
+		DeviceName:  dmCommand.DeviceName,
+		Device:      dmCommand.Device,
+	}, BaseTimeout, compensatedNodes(s.Result, s.Nodes), ctx)
 }
 
 func NewLvCreateStage(core *device.DmDeviceCore) *LvCreateStageRunner {
@@ -60,11 +70,17 @@ type LvCreateStageConstructor struct {
 }
 
 func (c *LvCreateStageConstructor) Construct() interface{} {
-	return &LvCreateStageRunner{}
+	return &LvCreateStageRunner{
+		Stage: &Stage{
+			Content: &message.DmExecCommand{},
+		},
+	}
 }
 
 type LvDeleteStageRunner struct {
 	*Stage
+	//Nodes are the nodes the stage may have taken effect on, only they are compensated
+	Nodes []string `json:"nodes"`
 }
 
 func (s *LvDeleteStageRunner) Run(ctx common.TraceContext) *StageExecResult {
@@ -72,13 +88,22 @@ func (s *LvDeleteStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	if err != nil {
 		return StageExecFail(err.Error())
 	}
-	ret := sendToAllParallel(msg, BaseTimeout, config.AvailableNodes())
+	ret, nodes := sendToNodesParallel(msg, BaseTimeout, config.AvailableNodes(), config.GetAvailableNodes())
 	s.Result = ret
+	s.Nodes = nodes
 	return ret
 }
 
 func (s *LvDeleteStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	dmCommand, err := toDmExecCommand(s.Content)
+	if err != nil {
+		return StageExecFail(err.Error())
+	}
+	return sendDmExecCommand(message.SmsMessageHead_CMD_DM_CREAT_REQ, &message.DmExecCommand{
+		CommandType: message.Create,
+		DeviceName:  dmCommand.DeviceName,
+		Device:      dmCommand.Device,
+	}, BaseTimeout, compensatedNodes(s.Result, s.Nodes), ctx)
 }
 
 //todo fix this
@@ -101,11 +126,19 @@ type LvDeleteStageConstructor struct {
 }
 
 func (c *LvDeleteStageConstructor) Construct() interface{} {
-	return &LvDeleteStageRunner{}
+	return &LvDeleteStageRunner{
+		Stage: &Stage{
+			Content: &message.DmExecCommand{},
+		},
+	}
 }
 
 type LvExpandStageRunner struct {
 	*Stage
+	//Origin is the dm table before expanding, used to reload the device on rollback
+	Origin *device.DmDeviceCore `json:"origin"`
+	//Nodes are the nodes the device may be expanded on, only they are compensated
+	Nodes []string `json:"nodes"`
 }
 
 func (s *LvExpandStageRunner) Run(ctx common.TraceContext) *StageExecResult {
@@ -113,21 +146,30 @@ func (s *LvExpandStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	if err != nil {
 		return StageExecFail(err.Error())
 	}
-	ret := sendToAllParallel(msg, s.timeout(), config.AvailableNodes())
+	ret, nodes := sendToNodesParallel(msg, s.timeout(), config.AvailableNodes(), config.GetAvailableNodes())
 	s.Result = ret
+	s.Nodes = nodes
 	return ret
 }
 
 func (s *LvExpandStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	if s.Origin == nil {
+		return irreversibleRollback(s.Stage)
+	}
+	dmCommand, err := toDmExecCommand(s.Content)
+	if err != nil {
+		return StageExecFail(err.Error())
+	}
+	return sendDmExecCommand(message.SmsMessageHead_CMD_DM_UPDATE_REQ, &message.DmExecCommand{
+		CommandType: message.Expand,
+		DeviceName:  dmCommand.DeviceName,
+		Device:      s.Origin,
+	}, s.timeout(), compensatedNodes(s.Result, s.Nodes), ctx)
 }
 
 func (s *LvExpandStageRunner) timeout() int64 {
-	var (
-		dmCommand *message.DmExecCommand
-	)
-	command := s.Content.(map[string]interface{})
-	if err := common.MapToStruct(command, &dmCommand); err != nil {
+	dmCommand, err := toDmExecCommand(s.Content)
+	if err != nil || dmCommand.Device == nil {
 		return BaseTimeout
 	}
 	reqSizeIn100GiB := dmCommand.Device.SectorNum * int64(dmCommand.Device.SectorSize) / (100 * 1024 * 1024 * 1024)
@@ -135,7 +177,7 @@ func (s *LvExpandStageRunner) timeout() int64 {
 }
 
 //todo fix this
-func NewLvExpandStage(core *device.DmDeviceCore) *LvExpandStageRunner {
+func NewLvExpandStage(core, origin *device.DmDeviceCore) *LvExpandStageRunner {
 	return &LvExpandStageRunner{
 		Stage: &Stage{
 			Content: &message.DmExecCommand{
@@ -147,6 +189,7 @@ func NewLvExpandStage(core *device.DmDeviceCore) *LvExpandStageRunner {
 			StartTime: 0,
 			Result:    nil,
 		},
+		Origin: origin,
 	}
 }
 
@@ -154,5 +197,9 @@ type LvExpandStageConstructor struct {
 }
 
 func (c *LvExpandStageConstructor) Construct() interface{} {
-	return &LvExpandStageRunner{}
+	return &LvExpandStageRunner{
+		Stage: &Stage{
+			Content: &message.DmExecCommand{},
+		},
+	}
 }
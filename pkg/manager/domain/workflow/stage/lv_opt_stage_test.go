@@ -18,7 +18,13 @@ package stage
 import (
 	"fmt"
 	"polardb-sms/pkg/device"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestLvExpandStageTimeout(t *testing.T) {
@@ -27,5 +33,38 @@ func TestLvExpandStageTimeout(t *testing.T) {
 		SectorSize: 10,
 		SectorNum:  2,
 	}
-	fmt.Print(NewLvExpandStage(core).timeout())
+	fmt.Print(NewLvExpandStage(core, nil).timeout())
+}
+
+func TestCompensatedNodes(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	config.ClusterConf.Nodes = map[string]config.Node{
+		"node-1": {Name: "node-1", LastHeartbeatTime: time.Now()},
+		"node-2": {Name: "node-2", LastHeartbeatTime: time.Now()},
+	}
+	defer func() { config.ClusterConf.Nodes = nil }()
+
+	names := func(nodes map[string]config.Node) []string {
+		ret := make([]string, 0)
+		for name := range nodes {
+			ret = append(ret, name)
+		}
+		return ret
+	}
+	//never run
+	assert.Empty(t, compensatedNodes(nil, []string{"node-1"}))
+	//failed on every node
+	assert.Empty(t, compensatedNodes(StageExecFail("exist"), []string{}))
+	//run on part of the nodes
+	assert.ElementsMatch(t, []string{"node-1"}, names(compensatedNodes(StageExecTimeout("time out"), []string{"node-1", "node-3"})))
+	//persisted without the nodes
+	assert.ElementsMatch(t, []string{"node-1", "node-2"}, names(compensatedNodes(StageExecSuccess(nil), nil)))
+}
+
+func TestLvCreateStageRollback_NotRun(t *testing.T) {
+	s := NewLvCreateStage(&device.DmDeviceCore{VolumeId: "t"})
+	assert.True(t, s.Rollback(nil).IsSuccess())
+	s.Result = StageExecFail("failed to send msg")
+	s.Nodes = []string{}
+	assert.True(t, s.Rollback(nil).IsSuccess())
 }
@@ -20,31 +20,40 @@ import (
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/msgserver"
+	"polardb-sms/pkg/network"
 	"polardb-sms/pkg/network/message"
 	"time"
 )
 
+//StageTraceKey in the trace context identifies the running stage of a workflow
+const StageTraceKey = "stage"
+
 func sendAndWait(msg *message.SmsMessage, toId string, timeout int64) *StageExecResult {
 	smslog.Debugf("sendAndWait to %s timeout %d sec", toId, timeout)
-	ch := make(chan interface{})
-	defer close(ch)
-	msgserver.MsgServer.SendMessageTo(toId, msg, ch)
-	select {
-	case result := <-ch:
-		return FromMessageBody(result.(*message.MessageBody))
-	case <-time.After(time.Duration(timeout) * time.Second):
-		return StageExecFail(fmt.Sprintf("Timeout when agent process msg [%v], toId %s", msg, toId))
+	//the retries of a stage send the same msg id, so the agent answers the re-delivery from its journal
+	if key, ok := msg.Head.TraceContext[StageTraceKey]; ok {
+		msg.Head.MsgId = message.IdempotentId(key, toId, msg)
+	}
+	result, err := msgserver.MsgServer.Request(toId, msg, time.Duration(timeout)*time.Second)
+	if err == network.ErrRequestTimeout {
+		return StageExecTimeout(fmt.Sprintf("Timeout when agent process msg [%v], toId %s", msg, toId))
+	}
+	if err != nil {
+		return StageExecFail(fmt.Sprintf("failed to send msg %s to %s: %v", msg.Head.MsgId, toId, err))
 	}
+	return FromMessageBody(result)
 }
 
 func sendToAllSequential(msg *message.SmsMessage,
 	timeout int64, minSuc int) *StageExecResult {
-	var rets = make(chan *StageExecResult)
-	defer close(rets)
+	nodes := config.GetAvailableNodes()
+	//buffered for every node, so the result after the timeout never blocks nor hits a closed channel
+	var rets = make(chan *StageExecResult, len(nodes))
 	var sucCnt = 0
 	var returnVal *StageExecResult
 
-	for nodeName, _ := range config.GetAvailableNodes() {
+	for nodeName, _ := range nodes {
+		nodeName := nodeName
 		go func() {
 			defer smslog.LogPanic()
 			var toMsg = &message.SmsMessage{
@@ -70,7 +79,7 @@ func sendToAllSequential(msg *message.SmsMessage,
 				returnVal = ret
 			}
 		case <-time.After(time.Duration(timeout) * time.Second):
-			returnVal = StageExecFail("time out")
+			returnVal = StageExecTimeout("time out")
 		}
 		if sucCnt >= minSuc {
 			break
@@ -81,9 +90,21 @@ func sendToAllSequential(msg *message.SmsMessage,
 
 func sendToAllParallel(msg *message.SmsMessage,
 	timeout int64, minSuc int) *StageExecResult {
-	var rets = make(chan *StageExecResult)
-	defer close(rets)
-	for nodeName, _ := range config.GetAvailableNodes() {
+	ret, _ := sendToNodesParallel(msg, timeout, minSuc, config.GetAvailableNodes())
+	return ret
+}
+
+type nodeExecResult struct {
+	node string
+	ret  *StageExecResult
+}
+
+//sendToNodesParallel sends msg to the nodes in parallel, it also returns the nodes msg may have taken effect on,
+//which are the nodes not answered with failure when it returns
+func sendToNodesParallel(msg *message.SmsMessage,
+	timeout int64, minSuc int, nodes map[string]config.Node) (*StageExecResult, []string) {
+	var rets = make(chan *nodeExecResult, len(nodes))
+	for nodeName, _ := range nodes {
 		nodeName := nodeName
 		go func() {
 			defer smslog.LogPanic()
@@ -98,28 +119,62 @@ func sendToAllParallel(msg *message.SmsMessage,
 				Body: msg.Body,
 			}
 			ret := sendAndWait(toMsg, nodeName, timeout)
-			rets <- ret
+			rets <- &nodeExecResult{node: nodeName, ret: ret}
 		}()
 	}
 
 	var sucCnt = 0
 	var returnVal *StageExecResult
+	var failed = make(map[string]bool)
+	var ranNodes = func() []string {
+		ret := make([]string, 0, len(nodes))
+		for nodeName := range nodes {
+			if !failed[nodeName] {
+				ret = append(ret, nodeName)
+			}
+		}
+		return ret
+	}
 	for {
 		select {
-		case ret := <-rets:
+		case r := <-rets:
+			ret := r.ret
 			if ret.ExecStatus == StageSuccess {
 				sucCnt += 1
 				returnVal = ret
 			} else {
+				failed[r.node] = true
 				smslog.Debugf("sendToAllParallel: stage exec err %s", ret.ErrMsg)
 			}
 		case <-time.After(time.Duration(timeout) * time.Second):
-			returnVal = StageExecFail("time out")
-			return returnVal
+			returnVal = StageExecTimeout("time out")
+			return returnVal, ranNodes()
 		}
 		if sucCnt >= minSuc {
 			break
 		}
 	}
-	return returnVal
+	return returnVal, ranNodes()
+}
+
+//compensatedNodes are the nodes to undo the stage on: none if the stage was never run,
+//the ones it may have taken effect on, or all the available nodes for the stage persisted without them
+func compensatedNodes(result *StageExecResult, ranNodes []string) map[string]config.Node {
+	nodes := make(map[string]config.Node)
+	if result == nil {
+		return nodes
+	}
+	available := config.GetAvailableNodes()
+	if ranNodes == nil {
+		return available
+	}
+	for _, name := range ranNodes {
+		node, ok := available[name]
+		if !ok {
+			smslog.Warnf("node %s is not available to compensate", name)
+			continue
+		}
+		nodes[name] = node
+	}
+	return nodes
 }
@@ -26,7 +26,8 @@ import (
 )
 
 type DBPersistHandler struct {
-	handlerMap map[string]reflect.Value
+	handlerMap  map[string]reflect.Value
+	snapshotMap map[string]func(param interface{}) (interface{}, error)
 }
 
 var _handler *DBPersistHandler
@@ -42,6 +43,7 @@ const (
 	UpdateStatus   DbMethod = "update-status"
 	UpdatePr       DbMethod = "update-pr"
 	UpdateUsed     DbMethod = "update-used"
+	UpdateExtend   DbMethod = "update-extend"
 )
 
 const (
@@ -49,12 +51,15 @@ const (
 	TablePv        string = "pv"
 	TablePvc       string = "pvc"
 	TablePvcStatus string = "pvc-status"
+	TableLvFence   string = "lv-fence"
 )
 
 type DBPersistContext struct {
 	Table    string   `json:"table"`
 	DbMethod DbMethod `json:"db_method"`
 	Param    string   `json:"param"`
+	//Snapshot is the record before this stage run, used for rollback
+	Snapshot string `json:"snapshot"`
 }
 
 //TODO fine tune this ugly
@@ -62,14 +67,24 @@ func GetDBPersistHandler() *DBPersistHandler {
 	if _handler == nil {
 		_handlerOnce.Do(func() {
 			h := &DBPersistHandler{
-				handlerMap: make(map[string]reflect.Value),
+				handlerMap:  make(map[string]reflect.Value),
+				snapshotMap: make(map[string]func(param interface{}) (interface{}, error)),
 			}
 			lvRepo := lv.GetLvRepository()
 			h.handlerMap["lv-create"] = reflect.ValueOf(lvRepo.Create)
 			h.handlerMap["lv-update"] = reflect.ValueOf(lvRepo.Save)
 			h.handlerMap["lv-update-used"] = reflect.ValueOf(lvRepo.UpdateUsed)
 			h.handlerMap["lv-update-pr"] = reflect.ValueOf(lvRepo.UpdatePr)
+			h.handlerMap["lv-update-extend"] = reflect.ValueOf(lvRepo.UpdateExtend)
 			h.handlerMap["lv-delete"] = reflect.ValueOf(lvRepo.Delete)
+			h.snapshotMap[TableLv] = func(param interface{}) (interface{}, error) {
+				return lvRepo.FindByVolumeId(param.(*lv.LogicalVolumeEntity).VolumeId)
+			}
+
+			//the fence is claimed by the pr lock stage now, kept for the workflows persisted before
+			fenceRepo := lv.GetFenceHistoryRepository()
+			h.handlerMap["lv-fence-create"] = reflect.ValueOf(fenceRepo.Create)
+			h.handlerMap["lv-fence-delete"] = reflect.ValueOf(fenceRepo.Delete)
 
 			pvcRepo := k8spvc.GetPvcRepository()
 			h.handlerMap["pvc-update-pr"] = reflect.ValueOf(pvcRepo.UpdatePrKey)
@@ -77,6 +92,10 @@ func GetDBPersistHandler() *DBPersistHandler {
 			h.handlerMap["pvc-delete"] = reflect.ValueOf(pvcRepo.Delete)
 			h.handlerMap["pvc-update-capacity"] = reflect.ValueOf(pvcRepo.UpdateCapacity)
 			h.handlerMap["pvc-update-status"] = reflect.ValueOf(pvcRepo.UpdateStatus)
+			h.snapshotMap[TablePvc] = func(param interface{}) (interface{}, error) {
+				pvcEntity := param.(*k8spvc.PersistVolumeClaimEntity)
+				return pvcRepo.FindByPvcName(pvcEntity.Name, pvcEntity.Namespace)
+			}
 
 			pvRepo := k8spvc.GetPvRepository()
 			h.handlerMap["pv-create"] = reflect.ValueOf(pvRepo.CreateOrUpdate)
@@ -100,6 +119,8 @@ func newParam(table string) (interface{}, error) {
 		return &k8spvc.PersistVolumeClaimEntity{}, nil
 	case "pv":
 		return &k8spvc.PersistVolumeEntity{}, nil
+	case "lv-fence":
+		return &lv.FenceRecordEntity{}, nil
 	default:
 		return nil, fmt.Errorf("do not support table %s", table)
 	}
@@ -107,19 +128,79 @@ func newParam(table string) (interface{}, error) {
 
 //TODO refactor this ugly code
 func (c *DBPersistHandler) Run(mCtx *DBPersistContext) *StageExecResult {
-	param, err := newParam(mCtx.Table)
+	param, err := decodeParam(mCtx.Table, mCtx.Param)
 	if err != nil {
-		smslog.Infof("newParam err %s", err.Error())
 		return StageExecFail(err.Error())
 	}
-	err = common.BytesToStruct([]byte(mCtx.Param), param)
+	mCtx.Snapshot = c.snapshot(mCtx.Table, param)
+	return c.call(mCtx.Table, mCtx.DbMethod, param)
+}
+
+//Rollback restores the record by the reverse db method:
+//created records are deleted, deleted records are re-created from the snapshot,
+//and updated records are updated back to the snapshot
+func (c *DBPersistHandler) Rollback(mCtx *DBPersistContext) *StageExecResult {
+	var (
+		method   DbMethod
+		paramStr string
+	)
+	switch mCtx.DbMethod {
+	case Create:
+		method, paramStr = Delete, mCtx.Param
+	case Delete:
+		method, paramStr = Create, mCtx.Snapshot
+		if paramStr == "" {
+			paramStr = mCtx.Param
+		}
+	default:
+		if mCtx.Snapshot == "" {
+			smslog.Infof("no snapshot for table[%s] method[%s], skip rollback", mCtx.Table, mCtx.DbMethod)
+			return StageExecSuccess(nil)
+		}
+		method, paramStr = mCtx.DbMethod, mCtx.Snapshot
+	}
+	param, err := decodeParam(mCtx.Table, paramStr)
 	if err != nil {
-		smslog.Errorf("err when call Decode, %v", err)
 		return StageExecFail(err.Error())
 	}
-	refValue, ok := c.handlerMap[mCtx.Table+"-"+string(mCtx.DbMethod)]
+	return c.call(mCtx.Table, method, param)
+}
+
+func (c *DBPersistHandler) snapshot(table string, param interface{}) string {
+	snapshotFunc, ok := c.snapshotMap[table]
+	if !ok {
+		return ""
+	}
+	record, err := snapshotFunc(param)
+	if err != nil || record == nil || reflect.ValueOf(record).IsNil() {
+		smslog.Infof("can not snapshot table %s for %v", table, param)
+		return ""
+	}
+	recordBytes, err := common.StructToBytes(record)
+	if err != nil {
+		return ""
+	}
+	return string(recordBytes)
+}
+
+func decodeParam(table, paramStr string) (interface{}, error) {
+	param, err := newParam(table)
+	if err != nil {
+		smslog.Infof("newParam err %s", err.Error())
+		return nil, err
+	}
+	err = common.BytesToStruct([]byte(paramStr), param)
+	if err != nil {
+		smslog.Errorf("err when call Decode, %v", err)
+		return nil, err
+	}
+	return param, nil
+}
+
+func (c *DBPersistHandler) call(table string, method DbMethod, param interface{}) *StageExecResult {
+	refValue, ok := c.handlerMap[table+"-"+string(method)]
 	if !ok {
-		err := fmt.Errorf("can not find handler for %s", mCtx.Table)
+		err := fmt.Errorf("can not find handler for %s-%s", table, method)
 		smslog.Infof(err.Error())
 		return StageExecFail(err.Error())
 	}
@@ -127,9 +208,8 @@ func (c *DBPersistHandler) Run(mCtx *DBPersistContext) *StageExecResult {
 	callParam := reflect.ValueOf(param)
 	ret := refValue.Call([]reflect.Value{callParam})
 	if !ret[1].IsNil() {
-		errRef := ret[1].Interface()
-		err = errRef.(error)
-		smslog.Infof("err when call %s, %v", mCtx.DbMethod, err)
+		err := ret[1].Interface().(error)
+		smslog.Infof("err when call %s, %v", method, err)
 		return StageExecFail(err.Error())
 	}
 	return StageExecSuccess(nil)
@@ -148,7 +228,13 @@ func (s *DBPersistStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 }
 
 func (s *DBPersistStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	dbExecContext := s.Content.(*DBPersistContext)
+	smslog.Debugf("DBPersistStageRunner rollback: table[%s] method[%s]", dbExecContext.Table, dbExecContext.DbMethod)
+	//a failed db call does not change the record
+	if !s.Result.IsSuccess() {
+		return StageExecSuccess(nil)
+	}
+	return GetDBPersistHandler().Rollback(dbExecContext)
 }
 
 func NewDBPersistStage(dbMethod DbMethod, tableName string, param interface{}) (*DBPersistStageRunner, error) {
@@ -210,6 +296,10 @@ func NewDBPersistLvPrStage(param interface{}) (*DBPersistStageRunner, error) {
 	return NewDBPersistStage(UpdatePr, TableLv, param)
 }
 
+func NewDBPersistLvExtendStage(param interface{}) (*DBPersistStageRunner, error) {
+	return NewDBPersistStage(UpdateExtend, TableLv, param)
+}
+
 func NewDBPersistLvDeleteStage(param interface{}) (*DBPersistStageRunner, error) {
 	return NewDBPersistStage(Delete, TableLv, param)
 }
@@ -0,0 +1,228 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"encoding/json"
+	"fmt"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"strings"
+	"sync"
+)
+
+//ChildRunner is the stage run concurrently inside a parallel group
+type ChildRunner interface {
+	GetExecResult() *StageExecResult
+	Run(ctx common.TraceContext) *StageExecResult
+	Rollback(ctx common.TraceContext) *StageExecResult
+	ResetResult()
+	StageType() StageType
+}
+
+//groupChildConstructors are the stages allowed in a parallel group
+var groupChildConstructors = map[StageType]func() interface{}{
+	PrStage:         (&PrStageConstructor{}).Construct,
+	PrBatchStage:    (&PrBatchStageConstructor{}).Construct,
+	DmExecStage:     (&DmExecStageConstructor{}).Construct,
+	PvRescanStage:   (&PvRescanStageConstructor{}).Construct,
+	PvcReleaseStage: (&PvcReleaseStageConstructor{}).Construct,
+	FsExpandStage:   (&FsExpandStageConstructor{}).Construct,
+}
+
+type groupChild struct {
+	StageType    StageType       `json:"stage_type"`
+	StageContent json.RawMessage `json:"stage_content"`
+}
+
+//ParallelGroupStageRunner runs the children concurrently, it succeeds when at least Quorum children succeed,
+//otherwise the successful children are rolled back
+type ParallelGroupStageRunner struct {
+	*Stage
+	//Quorum <= 0 means all the children must succeed
+	Quorum   int           `json:"quorum"`
+	Children []ChildRunner `json:"-"`
+}
+
+func (s *ParallelGroupStageRunner) quorum() int {
+	if s.Quorum <= 0 || s.Quorum > len(s.Children) {
+		return len(s.Children)
+	}
+	return s.Quorum
+}
+
+//forEachChild calls f on the children concurrently and returns the results in order.
+//every child gets its own copy of ctx, for the messages built by the children write their ids into it
+func (s *ParallelGroupStageRunner) forEachChild(ctx common.TraceContext, f func(child ChildRunner, ctx common.TraceContext) *StageExecResult) []*StageExecResult {
+	rets := make([]*StageExecResult, len(s.Children))
+	var wg sync.WaitGroup
+	for i, child := range s.Children {
+		wg.Add(1)
+		go func(i int, child ChildRunner, ctx common.TraceContext) {
+			defer wg.Done()
+			defer smslog.LogPanic()
+			rets[i] = f(child, ctx)
+		}(i, child, ctx.Copy())
+	}
+	wg.Wait()
+	return rets
+}
+
+func (s *ParallelGroupStageRunner) Run(ctx common.TraceContext) *StageExecResult {
+	rets := s.forEachChild(ctx, func(child ChildRunner, ctx common.TraceContext) *StageExecResult {
+		//the child succeeded in the last attempt is not run again
+		if child.GetExecResult().IsSuccess() {
+			return child.GetExecResult()
+		}
+		return child.Run(ctx)
+	})
+	sucCnt := 0
+	var failed *StageExecResult
+	var errMsgs []string
+	for i, ret := range rets {
+		if ret.IsSuccess() {
+			sucCnt++
+			continue
+		}
+		if ret == nil {
+			ret = StageExecFail("panic when run the stage")
+		}
+		if failed == nil {
+			failed = ret
+		}
+		errMsgs = append(errMsgs, fmt.Sprintf("child %d %s: %s", i, s.Children[i].StageType(), ret.ErrMsg))
+	}
+	content, err := json.Marshal(rets)
+	if err != nil {
+		smslog.WithContext(ctx).Errorf("marshal parallel group results err %s", err.Error())
+	}
+	if sucCnt >= s.quorum() {
+		s.Result = StageExecSuccess(content)
+		return s.Result
+	}
+	smslog.WithContext(ctx).Errorf("parallel group %d/%d children succeeded, less than quorum %d", sucCnt, len(s.Children), s.quorum())
+	ret := s.Rollback(ctx)
+	if !ret.IsSuccess() {
+		errMsgs = append(errMsgs, fmt.Sprintf("rollback err: %s", ret.ErrMsg))
+	}
+	s.Result = &StageExecResult{
+		ExecStatus: StageFail,
+		ErrMsg: fmt.Sprintf("%d/%d children succeeded, less than quorum %d: %s",
+			sucCnt, len(s.Children), s.quorum(), strings.Join(errMsgs, "; ")),
+		ErrClass: failed.ErrClass,
+		Content:  content,
+	}
+	return s.Result
+}
+
+//Rollback rolls back the successful children concurrently
+func (s *ParallelGroupStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
+	rets := s.forEachChild(ctx, func(child ChildRunner, ctx common.TraceContext) *StageExecResult {
+		if !child.GetExecResult().IsSuccess() {
+			return StageExecSuccess(nil)
+		}
+		ret := child.Rollback(ctx)
+		if ret.IsSuccess() {
+			child.ResetResult()
+		}
+		return ret
+	})
+	var errMsgs []string
+	for i, ret := range rets {
+		if !ret.IsSuccess() {
+			errMsg := "panic when rollback the stage"
+			if ret != nil {
+				errMsg = ret.ErrMsg
+			}
+			errMsgs = append(errMsgs, fmt.Sprintf("child %d %s: %s", i, s.Children[i].StageType(), errMsg))
+		}
+	}
+	if len(errMsgs) > 0 {
+		return StageExecFail(strings.Join(errMsgs, "; "))
+	}
+	return StageExecSuccess(nil)
+}
+
+func (s *ParallelGroupStageRunner) MarshalJSON() ([]byte, error) {
+	children := make([]*groupChild, 0, len(s.Children))
+	for _, child := range s.Children {
+		content, err := json.Marshal(child)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, &groupChild{StageType: child.StageType(), StageContent: content})
+	}
+	return json.Marshal(&struct {
+		*Stage
+		Quorum   int           `json:"quorum"`
+		Children []*groupChild `json:"children"`
+	}{
+		Stage:    s.Stage,
+		Quorum:   s.Quorum,
+		Children: children,
+	})
+}
+
+func (s *ParallelGroupStageRunner) UnmarshalJSON(data []byte) error {
+	if s.Stage == nil {
+		s.Stage = &Stage{}
+	}
+	group := &struct {
+		*Stage
+		Quorum   int           `json:"quorum"`
+		Children []*groupChild `json:"children"`
+	}{
+		Stage: s.Stage,
+	}
+	if err := json.Unmarshal(data, group); err != nil {
+		return err
+	}
+	s.Quorum = group.Quorum
+	s.Children = make([]ChildRunner, 0, len(group.Children))
+	for _, c := range group.Children {
+		constructor, ok := groupChildConstructors[c.StageType]
+		if !ok {
+			return fmt.Errorf("stage %s is not allowed in parallel group", c.StageType)
+		}
+		child := constructor()
+		if err := json.Unmarshal(c.StageContent, child); err != nil {
+			return err
+		}
+		s.Children = append(s.Children, child.(ChildRunner))
+	}
+	return nil
+}
+
+func NewParallelGroupStage(quorum int, children ...ChildRunner) *ParallelGroupStageRunner {
+	return &ParallelGroupStageRunner{
+		Stage: &Stage{
+			SType:     ParallelGroupStage,
+			StartTime: 0,
+			Result:    nil,
+		},
+		Quorum:   quorum,
+		Children: children,
+	}
+}
+
+type ParallelGroupStageConstructor struct {
+}
+
+func (c *ParallelGroupStageConstructor) Construct() interface{} {
+	return &ParallelGroupStageRunner{
+		Stage: &Stage{},
+	}
+}
@@ -0,0 +1,118 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"encoding/json"
+	"fmt"
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/msgserver"
+	"polardb-sms/pkg/network/message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+type fakeChild struct {
+	*Stage
+	ret         *StageExecResult
+	rolledBack  bool
+	rollbackRet *StageExecResult
+}
+
+func (c *fakeChild) Run(ctx common.TraceContext) *StageExecResult {
+	c.Result = c.ret
+	return c.ret
+}
+
+func (c *fakeChild) Rollback(ctx common.TraceContext) *StageExecResult {
+	c.rolledBack = true
+	if c.rollbackRet != nil {
+		return c.rollbackRet
+	}
+	return StageExecSuccess(nil)
+}
+
+func newFakeChild(ret *StageExecResult) *fakeChild {
+	return &fakeChild{Stage: &Stage{SType: PrBatchStage}, ret: ret}
+}
+
+func TestParallelGroupStage_Quorum(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	a := newFakeChild(StageExecSuccess(nil))
+	b := newFakeChild(StageExecTimeout("time out"))
+	c := newFakeChild(StageExecSuccess(nil))
+	group := NewParallelGroupStage(2, a, b, c)
+	assert.True(t, group.Run(nil).IsSuccess())
+	assert.False(t, a.rolledBack)
+
+	a = newFakeChild(StageExecSuccess(nil))
+	b = newFakeChild(StageExecTimeout("time out"))
+	c = newFakeChild(StageExecFail("no path"))
+	group = NewParallelGroupStage(2, a, b, c)
+	ret := group.Run(nil)
+	assert.False(t, ret.IsSuccess())
+	assert.Equal(t, ErrTimeout, ret.ErrClass)
+	assert.True(t, a.rolledBack)
+	assert.Nil(t, a.GetExecResult())
+	assert.False(t, b.rolledBack)
+	assert.False(t, c.rolledBack)
+
+	var results []*StageExecResult
+	assert.NoError(t, json.Unmarshal(ret.Content, &results))
+	assert.Equal(t, 3, len(results))
+}
+
+func TestParallelGroupStage_JSON(t *testing.T) {
+	node := config.Node{Name: "node-1", Ip: "10.0.0.1"}
+	group, err := NewCheckPathNumGroupStage([]config.Node{node, {Name: "node-2", Ip: "10.0.0.2"}},
+		"36e00084100ee7ec9ab6a11cf00000dbb", common.MultipathVolume)
+	assert.NoError(t, err)
+	group.Children[0].(*PrStageRunner).Result = StageExecSuccess(nil)
+
+	bytes, err := json.Marshal(group)
+	assert.NoError(t, err)
+	decoded := (&ParallelGroupStageConstructor{}).Construct().(*ParallelGroupStageRunner)
+	assert.NoError(t, json.Unmarshal(bytes, decoded))
+	assert.Equal(t, StageType(ParallelGroupStage), decoded.StageType())
+	assert.Equal(t, 2, len(decoded.Children))
+	first := decoded.Children[0].(*PrStageRunner)
+	assert.Equal(t, node, first.TargetNode)
+	assert.True(t, first.GetExecResult().IsSuccess())
+	assert.Equal(t, message.PrPathNum, first.Content.(*message.PrCmd).CmdType)
+	assert.Nil(t, decoded.Children[1].GetExecResult())
+}
+
+func TestParallelGroupStage_TraceContext(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	_, err := msgserver.NewMessageServer(map[string]config.Node{})
+	assert.NoError(t, err)
+	nodes := make([]config.Node, 0)
+	for i := 0; i < 8; i++ {
+		nodes = append(nodes, config.Node{Name: fmt.Sprintf("node-%d", i), Ip: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	group, err := NewCheckPathNumGroupStage(nodes, "36e00084100ee7ec9ab6a11cf00000dbb", common.MultipathVolume)
+	assert.NoError(t, err)
+
+	//the children build their messages concurrently, run with -race to check they do not share ctx
+	ctx := common.TraceContext{"workflowId": "wfl-1"}
+	ret := group.Run(ctx)
+	assert.False(t, ret.IsSuccess())
+	assert.Equal(t, common.TraceContext{"workflowId": "wfl-1"}, ctx)
+}
@@ -0,0 +1,84 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/network/message"
+	"sort"
+)
+
+//ManagerTarget is the target of the stages executed by the manager itself
+const ManagerTarget = "manager"
+
+//StagePlan describes what a stage will do, without running it
+type StagePlan struct {
+	StageType   StageType    `json:"stage_type"`
+	TargetNodes []string     `json:"target_nodes"`
+	Content     interface{}  `json:"content"`
+	DmTable     string       `json:"dm_table,omitempty"`
+	Children    []*StagePlan `json:"children,omitempty"`
+}
+
+func allNodeNames() []string {
+	names := make([]string, 0)
+	for name := range config.GetAvailableNodes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Plan(s ChildRunner) *StagePlan {
+	p := &StagePlan{
+		StageType: s.StageType(),
+	}
+	if c, ok := s.(interface{ GetContent() interface{} }); ok {
+		p.Content = c.GetContent()
+	}
+	switch r := s.(type) {
+	case *PrStageRunner:
+		p.TargetNodes = []string{r.TargetNode.Name}
+	case *PrBatchStageRunner:
+		p.TargetNodes = []string{r.TargetNode.Name}
+	case *PvcCreateStageRunner:
+		p.TargetNodes = []string{r.TargetNode.Name}
+	case *FsExpandStageRunner:
+		if r.TargetNode != nil {
+			p.TargetNodes = []string{r.TargetNode.Name}
+		}
+	case *FsFormatStageRunner:
+		if r.TargetNode != nil {
+			p.TargetNodes = []string{r.TargetNode.Name}
+		}
+	case *DBPersistStageRunner:
+		p.TargetNodes = []string{ManagerTarget}
+	case *ParallelGroupStageRunner:
+		p.Content = nil
+		for _, child := range r.Children {
+			p.Children = append(p.Children, Plan(child))
+		}
+	default:
+		//the others are sent to all the available nodes
+		p.TargetNodes = allNodeNames()
+	}
+	if dmCommand, ok := p.Content.(*message.DmExecCommand); ok && dmCommand.Device != nil {
+		if table, err := dmCommand.Device.GetDmTableString(); err == nil {
+			p.DmTable = table
+		}
+	}
+	return p
+}
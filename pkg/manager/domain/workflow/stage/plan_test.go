@@ -0,0 +1,43 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"polardb-sms/pkg/common"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/network/message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	node := config.Node{Name: "node-1", Ip: "10.0.0.1"}
+	prStage, err := NewRegisterAndReserveCmdStage(node, "36e00084100ee7ec9ab6a11cf00000dbb", common.MultipathVolume, "0x1", message.WEAR)
+	assert.NoError(t, err)
+	p := Plan(prStage)
+	assert.Equal(t, StageType(PrBatchStage), p.StageType)
+	assert.Equal(t, []string{"node-1"}, p.TargetNodes)
+	assert.Equal(t, prStage.Content, p.Content)
+
+	group, err := NewCheckPathNumGroupStage([]config.Node{node, {Name: "node-2", Ip: "10.0.0.2"}},
+		"36e00084100ee7ec9ab6a11cf00000dbb", common.MultipathVolume)
+	assert.NoError(t, err)
+	p = Plan(group)
+	assert.Nil(t, p.Content)
+	assert.Equal(t, 2, len(p.Children))
+	assert.Equal(t, []string{"node-2"}, p.Children[1].TargetNodes)
+}
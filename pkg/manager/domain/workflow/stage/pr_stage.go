@@ -20,17 +20,24 @@ import (
 	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain/lv"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/network/message"
 )
 
-func NewPrLockStage(node config.Node, nodeIp, wwid, currentPrNodeIp string, volumeType common.LvType) (*PrBatchStageRunner, error) {
-	var (
-		cmdTypes     []int
-		preemptedKey string
-	)
-	if currentPrNodeIp != "" {
+const PrCapabilityTimeout = 60 // time.Second
+
+//NewPrLockStage lets the node hold the reservation of reserveType with its key fenced by the generation,
+//preempting currentPrKey if any
+func NewPrLockStage(node config.Node, wwid, currentPrKey string, generation int64, volumeType common.LvType, reserveType message.PrType) (*PrBatchStageRunner, error) {
+	var cmdTypes []int
+	nodeKey, err := prkey.RegisterKeyOf(node)
+	if err != nil {
+		return nil, err
+	}
+	registerKey := prkey.FencedKey(nodeKey, generation)
+	if currentPrKey != "" {
 		cmdTypes = []int{message.PrPreempt}
-		preemptedKey = common.IpV4ToPrKey(currentPrNodeIp)
 	} else {
 		cmdTypes = []int{message.PrRegister, message.PrReserve}
 	}
@@ -39,7 +46,7 @@ func NewPrLockStage(node config.Node, nodeIp, wwid, currentPrNodeIp string, volu
 		cmdTypes = append(cmdTypes, message.PathCanWrite)
 	}
 	//name string, volumeType common.LvType, registerKey, preemptedKey string, reserveType PrType
-	cmd, err := message.NewBatchCmd(wwid, volumeType, common.IpV4ToPrKey(nodeIp), preemptedKey, message.WEAR, cmdTypes)
+	cmd, err := message.NewBatchCmd(wwid, volumeType, registerKey, currentPrKey, reserveType, cmdTypes)
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +61,24 @@ func NewCheckPathNumCmdStage(node config.Node, volumeId string, volumeType commo
 	return NewPrStage(cmd, node), nil
 }
 
+//NewPrQueryStage reads the registered keys and reservation of the volume on the node
+func NewPrQueryStage(node config.Node, volumeId string, volumeType common.LvType) (*PrStageRunner, error) {
+	cmd, err := message.NewPrQueryCmd(volumeId, volumeType)
+	if err != nil {
+		return nil, err
+	}
+	return NewPrStage(cmd, node), nil
+}
+
+//NewPrCapabilityStage probes the pr capabilities of every path of the scratch lun on the node
+func NewPrCapabilityStage(node config.Node, volumeId string, volumeType common.LvType, registerKey string, reserveType message.PrType) (*PrStageRunner, error) {
+	cmd, err := message.NewPrCapabilityCmd(volumeId, volumeType, registerKey, reserveType)
+	if err != nil {
+		return nil, err
+	}
+	return NewPrStage(cmd, node), nil
+}
+
 func NewRegisterAndReserveCmdStage(node config.Node, volumeId string, volumeType common.LvType, registerKey string, reserveType message.PrType) (*PrBatchStageRunner, error) {
 	batchCmd, err := message.NewBatchCmd(volumeId, volumeType, registerKey, "", reserveType,
 		[]int{message.PrRegister, message.PrReserve, message.PathCanWrite})
@@ -63,6 +88,27 @@ func NewRegisterAndReserveCmdStage(node config.Node, volumeId string, volumeType
 	return NewPrBatchStage(batchCmd, node), nil
 }
 
+//NewRegisterCmdStage registers the key again, used to set aptpl of the registered key
+func NewRegisterCmdStage(node config.Node, volumeId string, volumeType common.LvType, registerKey string, reserveType message.PrType, aptpl bool) (*PrBatchStageRunner, error) {
+	batchCmd, err := message.NewBatchCmd(volumeId, volumeType, registerKey, "", reserveType,
+		[]int{message.PrRegister})
+	if err != nil {
+		return nil, err
+	}
+	return NewPrBatchStage(batchCmd, node).WithAptpl(aptpl), nil
+}
+
+//NewVerifyPathsCmdStage registers the key on the newly added paths and checks the node can write through every path
+func NewVerifyPathsCmdStage(node config.Node, volumeId string, volumeType common.LvType, registerKey string, reserveType message.PrType, aptpl bool) (*PrBatchStageRunner, error) {
+	batchCmd, err := message.NewBatchCmd(volumeId, volumeType, registerKey, "", reserveType,
+		[]int{message.PrRegister, message.PathCanWrite})
+	if err != nil {
+		return nil, err
+	}
+	batchCmd.SetAllPaths()
+	return NewPrBatchStage(batchCmd, node).WithAptpl(aptpl), nil
+}
+
 func NewReleaseAndClearCmdStage(node config.Node, volumeId string, volumeType common.LvType, registerKey string, reserveType message.PrType) (*PrBatchStageRunner, error) {
 	batchCmd, err := message.NewBatchCmd(volumeId, volumeType, registerKey, "", reserveType,
 		[]int{message.PrRegister, message.PrReserve, message.PrClear})
@@ -90,6 +136,122 @@ func NewPreemptAndClearCmdStage(node config.Node, volumeId string, volumeType co
 	return NewPrBatchStage(batchCmd, node), nil
 }
 
+//NewCheckPathNumGroupStage checks the path num of the volume on all the nodes concurrently
+func NewCheckPathNumGroupStage(nodes []config.Node, volumeId string, volumeType common.LvType) (*ParallelGroupStageRunner, error) {
+	children := make([]ChildRunner, 0, len(nodes))
+	for _, node := range nodes {
+		stageRunner, err := NewCheckPathNumCmdStage(node, volumeId, volumeType)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, stageRunner)
+	}
+	return NewParallelGroupStage(0, children...), nil
+}
+
+type prCompensation struct {
+	node config.Node
+	cmd  *message.BatchPrCheckCmd
+}
+
+//prCompensations returns the pr commands undoing cmds in reverse order:
+//a registration is undone by unregistering the key on the same node, a reservation by releasing it,
+//and a preempt is undone by letting the preempted node preempt back, except the abort one fencing off the node.
+//clear, release and the path checks only drop or read state, so nothing to undo.
+//nodeOf finds the node of the preempted key.
+func prCompensations(cmds []*message.PrCmd, execNode config.Node, nodeOf func(key string) *config.Node) ([]*prCompensation, error) {
+	var (
+		compensations    = make([]*prCompensation, 0)
+		unregisteredKeys = make(map[string]bool)
+	)
+	compensate := func(cmd *message.PrCmd, node config.Node, registerKey, preemptedKey string, reserveType message.PrType, cmdType int) error {
+		batchCmd, err := message.NewBatchCmd(cmd.VolumeId, cmd.VolumeType, registerKey, preemptedKey, reserveType,
+			[]int{cmdType})
+		if err != nil {
+			return err
+		}
+		compensations = append(compensations, &prCompensation{node: node, cmd: batchCmd})
+		return nil
+	}
+	unregister := func(cmd *message.PrCmd, registerKey string) error {
+		if unregisteredKeys[registerKey] {
+			return nil
+		}
+		unregisteredKeys[registerKey] = true
+		return compensate(cmd, execNode, registerKey, "", 0, message.PrUnregister)
+	}
+	for i := len(cmds) - 1; i >= 0; i-- {
+		cmd := cmds[i]
+		var err error
+		switch param := cmd.CmdParam.(type) {
+		case *message.PrRegisterCmdParam:
+			err = unregister(cmd, param.RegisterKey)
+		case *message.PrReserveCmdParam:
+			err = compensate(cmd, execNode, param.RegisterKey, "", param.ReserveType, message.PrRelease)
+		case *message.PrPreemptCmdParam:
+			//the preempt without a preempted key registers and reserves
+			if param.PreemptedKey == "" {
+				err = unregister(cmd, param.RegisterKey)
+				break
+			}
+			if param.Abort {
+				break
+			}
+			preemptedNode := nodeOf(param.PreemptedKey)
+			if preemptedNode == nil {
+				return nil, fmt.Errorf("can not find the node of preempted key %s", param.PreemptedKey)
+			}
+			err = compensate(cmd, *preemptedNode, param.PreemptedKey, param.RegisterKey, param.ReserveType, message.PrPreempt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return compensations, nil
+}
+
+//succeededPrCmds returns the cmds of a stage to compensate by its result: none if the stage was never run
+//or failed before the agent ran them, all if it succeeded or timed out for they may have been run,
+//and the leading ones the agent reports done if it failed in the middle of a batch
+func succeededPrCmds(cmds []*message.PrCmd, result *StageExecResult) []*message.PrCmd {
+	if result == nil {
+		return nil
+	}
+	if result.IsSuccess() || result.ErrClass == ErrTimeout {
+		return cmds
+	}
+	if result.ErrClass != ErrAgent || len(result.Content) == 0 {
+		return nil
+	}
+	batchResult := &message.PrBatchCheckCmdResult{}
+	if err := common.BytesToStruct(result.Content, batchResult); err != nil {
+		return cmds
+	}
+	if len(batchResult.Results) < len(cmds) {
+		return cmds[:len(batchResult.Results)]
+	}
+	return cmds
+}
+
+func rollbackPrCmds(cmds []*message.PrCmd, execNode config.Node, ctx common.TraceContext) *StageExecResult {
+	compensations, err := prCompensations(cmds, execNode, prkey.NodeOf)
+	if err != nil {
+		return StageExecFail(err.Error())
+	}
+	for _, c := range compensations {
+		msg, err := message.NewMessage(message.SmsMessageHead_CMD_PR_BATCH_REQ, c.cmd, ctx)
+		if err != nil {
+			return StageExecFail(err.Error())
+		}
+		ret := sendAndWait(msg, c.node.Name, 10)
+		if !ret.IsSuccess() {
+			smslog.WithContext(ctx).Errorf("rollback pr cmds %v on node %s err %s", c.cmd, c.node.Name, ret.ErrMsg)
+			return ret
+		}
+	}
+	return StageExecSuccess(nil)
+}
+
 type PrStageRunner struct {
 	*Stage
 	TargetNode config.Node
@@ -100,14 +262,23 @@ func (s *PrStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	if err != nil {
 		return StageExecFail(err.Error())
 	}
-	ret := sendAndWait(msg, s.TargetNode.Name, 5)
+	ret := sendAndWait(msg, s.TargetNode.Name, s.timeout())
 	s.Result = ret
 	smslog.Infof("finish run pr cmd %v, result %s", s.Content, string(s.Result.Content))
 	return ret
 }
 
+//timeout of the capability probe is longer, for the pr cmds are sent path by path
+func (s *PrStageRunner) timeout() int64 {
+	if cmd, ok := s.Content.(*message.PrCmd); ok && cmd.CmdType == message.PrCapability {
+		return PrCapabilityTimeout
+	}
+	return 5
+}
+
 func (s *PrStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	cmds := succeededPrCmds([]*message.PrCmd{s.Content.(*message.PrCmd)}, s.Result)
+	return rollbackPrCmds(cmds, s.TargetNode, ctx)
 }
 
 func NewPrStage(cmd *message.PrCmd,
@@ -138,9 +309,19 @@ func (c *PrStageConstructor) Construct() interface{} {
 type PrBatchStageRunner struct {
 	*Stage
 	TargetNode config.Node
+	//Fence is the generation claimed before the cmds are sent, nil if the stage does not bump it
+	Fence        *lv.FenceRecordEntity `json:"fence,omitempty"`
+	FenceClaimed bool                  `json:"fence_claimed,omitempty"`
 }
 
 func (s *PrBatchStageRunner) Run(ctx common.TraceContext) *StageExecResult {
+	if s.Fence != nil && !s.FenceClaimed {
+		if err := lv.GetFenceHistoryRepository().Claim(s.Fence); err != nil {
+			s.Result = StageExecFail(err.Error())
+			return s.Result
+		}
+		s.FenceClaimed = true
+	}
 	msg, err := message.NewMessage(message.SmsMessageHead_CMD_PR_BATCH_REQ, s.Content, ctx)
 	if err != nil {
 		return StageExecFail(err.Error())
@@ -151,7 +332,16 @@ func (s *PrBatchStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 }
 
 func (s *PrBatchStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	cmds := succeededPrCmds(s.Content.(*message.BatchPrCheckCmd).Cmds, s.Result)
+	ret := rollbackPrCmds(cmds, s.TargetNode, ctx)
+	if !ret.IsSuccess() || !s.FenceClaimed {
+		return ret
+	}
+	if err := lv.GetFenceHistoryRepository().Release(s.Fence); err != nil {
+		return StageExecFail(err.Error())
+	}
+	s.FenceClaimed = false
+	return ret
 }
 
 func NewPrBatchStage(batchPrCmd *message.BatchPrCheckCmd,
@@ -167,6 +357,25 @@ func NewPrBatchStage(batchPrCmd *message.BatchPrCheckCmd,
 	}
 }
 
+//WithAbort lets the preempt cmds of the stage abort the commands of the preempted key
+func (s *PrBatchStageRunner) WithAbort() *PrBatchStageRunner {
+	s.Content.(*message.BatchPrCheckCmd).SetAbort()
+	return s
+}
+
+//WithFence lets the stage claim the fence generation of the record before the cmds are sent,
+//so the racing write lock transfers computing the same generation fail before preempting
+func (s *PrBatchStageRunner) WithFence(record *lv.FenceRecordEntity) *PrBatchStageRunner {
+	s.Fence = record
+	return s
+}
+
+//WithAptpl lets the register cmds of the stage set aptpl
+func (s *PrBatchStageRunner) WithAptpl(aptpl bool) *PrBatchStageRunner {
+	s.Content.(*message.BatchPrCheckCmd).SetAptpl(aptpl)
+	return s
+}
+
 type PrBatchStageConstructor struct {
 }
 
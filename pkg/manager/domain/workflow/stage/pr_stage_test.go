@@ -0,0 +1,135 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"polardb-sms/pkg/common"
+	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/network/message"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrCompensations(t *testing.T) {
+	execNode := config.Node{Name: "node-1"}
+	preemptedNode := config.Node{Name: "node-2"}
+	nodeOf := func(key string) *config.Node {
+		if key == "0x2" {
+			return &preemptedNode
+		}
+		return nil
+	}
+	type compensation struct {
+		node        string
+		cmdType     int
+		registerKey string
+	}
+	cases := []struct {
+		name     string
+		cmdTypes []int
+		preempt  string
+		abort    bool
+		expected []compensation
+	}{
+		{
+			name:     "register",
+			cmdTypes: []int{message.PrRegister},
+			expected: []compensation{{"node-1", message.PrUnregister, "0x1"}},
+		},
+		{
+			name:     "register and reserve",
+			cmdTypes: []int{message.PrRegister, message.PrReserve, message.PathCanWrite},
+			expected: []compensation{
+				{"node-1", message.PrRelease, "0x1"},
+				{"node-1", message.PrUnregister, "0x1"},
+			},
+		},
+		{
+			name:     "register and preempt",
+			cmdTypes: []int{message.PrRegister, message.PrPreempt, message.PathCanWrite, message.PrClear},
+			preempt:  "0x2",
+			expected: []compensation{
+				{"node-2", message.PrPreempt, "0x2"},
+				{"node-1", message.PrUnregister, "0x1"},
+			},
+		},
+		{
+			name:     "preempt without preempted key",
+			cmdTypes: []int{message.PrPreempt},
+			expected: []compensation{{"node-1", message.PrUnregister, "0x1"}},
+		},
+		{
+			name:     "abort preempt",
+			cmdTypes: []int{message.PrPreempt},
+			preempt:  "0x2",
+			abort:    true,
+			expected: []compensation{},
+		},
+		{
+			name:     "read only",
+			cmdTypes: []int{message.PathCannotWrite, message.PrRelease, message.PrClear},
+			expected: []compensation{},
+		},
+	}
+	for _, c := range cases {
+		cmd, err := message.NewBatchCmd("wwid", common.MultipathVolume, "0x1", c.preempt, message.WE, c.cmdTypes)
+		assert.NoError(t, err, c.name)
+		if c.abort {
+			cmd.SetAbort()
+		}
+		compensations, err := prCompensations(cmd.Cmds, execNode, nodeOf)
+		assert.NoError(t, err, c.name)
+		actual := make([]compensation, 0)
+		for _, comp := range compensations {
+			assert.Len(t, comp.cmd.Cmds, 1, c.name)
+			prCmd := comp.cmd.Cmds[0]
+			var registerKey string
+			switch param := prCmd.CmdParam.(type) {
+			case *message.PrUnregisterCmdParam:
+				registerKey = param.RegisterKey
+			case *message.PrReleaseCmdParam:
+				registerKey = param.RegisterKey
+			case *message.PrPreemptCmdParam:
+				registerKey = param.RegisterKey
+				assert.Equal(t, "0x1", param.PreemptedKey, c.name)
+			}
+			actual = append(actual, compensation{comp.node.Name, prCmd.CmdType, registerKey})
+		}
+		assert.Equal(t, c.expected, actual, c.name)
+	}
+
+	cmd, _ := message.NewBatchCmd("wwid", common.MultipathVolume, "0x1", "0x3", message.WE, []int{message.PrPreempt})
+	_, err := prCompensations(cmd.Cmds, execNode, nodeOf)
+	assert.Error(t, err)
+}
+
+func TestSucceededPrCmds(t *testing.T) {
+	cmd, _ := message.NewBatchCmd("wwid", common.MultipathVolume, "0x1", "", message.WE,
+		[]int{message.PrRegister, message.PrReserve, message.PathCanWrite})
+	partial, _ := common.StructToBytes(&message.PrBatchCheckCmdResult{
+		Results: []*message.PrCheckCmdResult{{CheckType: message.PrRegister}},
+	})
+	agentFail := func(content []byte) *StageExecResult {
+		return &StageExecResult{ExecStatus: StageFail, ErrClass: ErrAgent, Content: content}
+	}
+	assert.Len(t, succeededPrCmds(cmd.Cmds, nil), 0)
+	assert.Len(t, succeededPrCmds(cmd.Cmds, StageExecSuccess(nil)), 3)
+	assert.Len(t, succeededPrCmds(cmd.Cmds, StageExecTimeout("time out")), 3)
+	assert.Len(t, succeededPrCmds(cmd.Cmds, StageExecFail("marshal err")), 0)
+	assert.Len(t, succeededPrCmds(cmd.Cmds, agentFail(nil)), 0)
+	assert.Equal(t, cmd.Cmds[:1], succeededPrCmds(cmd.Cmds, agentFail(partial)))
+}
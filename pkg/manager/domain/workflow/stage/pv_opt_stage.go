@@ -16,7 +16,6 @@
 package stage
 
 import (
-	"fmt"
 	"polardb-sms/pkg/common"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/network/message"
@@ -37,8 +36,10 @@ func (s *PvCreateStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//the stage grows the filesystem of the pv by CMD_EXPAND_FS_REQ like FsExpandStageRunner,
+//the agent can not shrink a filesystem nor has a cmd removing the pv, so it can not be undone
 func (s *PvCreateStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	return irreversibleRollback(s.Stage)
 }
 
 func (s *PvCreateStageRunner) timeout() int64 {
@@ -88,8 +89,9 @@ func (s *PvDeleteStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//it grows the filesystem like PvCreateStageRunner, which can not be undone
 func (s *PvDeleteStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	return irreversibleRollback(s.Stage)
 }
 
 func (s *PvDeleteStageRunner) timeout() int64 {
@@ -139,8 +141,9 @@ func (s *PvExpandStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//growfs can not be undone, see PvCreateStageRunner
 func (s *PvExpandStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	return irreversibleRollback(s.Stage)
 }
 
 func (s *PvExpandStageRunner) timeout() int64 {
@@ -190,8 +193,9 @@ func (s *PvRescanStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//rescan does not change any device state, nothing to undo
 func (s *PvRescanStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	return StageExecSuccess(nil)
 }
 
 //todo fix this
@@ -16,9 +16,10 @@
 package stage
 
 import (
-	"fmt"
 	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"polardb-sms/pkg/network/message"
 )
 
@@ -38,8 +39,13 @@ func (s *PvcCreateStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//pvc create only clears the stale pr info of the lun besides formatting
 func (s *PvcCreateStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	cmd := s.Content.(*message.PvcCreateCommand)
+	if cmd.Format {
+		return irreversibleRollback(s.Stage)
+	}
+	return StageExecSuccess(nil)
 }
 
 func (s *PvcCreateStageRunner) timeout() int64 {
@@ -54,6 +60,10 @@ func NewPvcCreateStage(volumeId string,
 	format bool,
 	reqSize int64,
 	execNode config.Node) *PvcCreateStageRunner {
+	prKey, err := prkey.KeyOf(execNode)
+	if err != nil {
+		smslog.Warnf("can not get pr key of node %s, the agent uses the ip derived key: %v", execNode.Name, err)
+	}
 	return &PvcCreateStageRunner{
 		Stage: &Stage{
 			Content: &message.PvcCreateCommand{
@@ -61,6 +71,7 @@ func NewPvcCreateStage(volumeId string,
 				VolumeType: volumeType,
 				VolumeId:   volumeId,
 				FsType:     fsType,
+				PrKey:      prKey,
 			},
 			SType:     PvcCreateStage,
 			StartTime: 0,
@@ -97,19 +108,30 @@ func (s *PvcReleaseStageRunner) Run(ctx common.TraceContext) *StageExecResult {
 	return ret
 }
 
+//release only drops the pr registrations, which the next lock workflow re-establishes
 func (s *PvcReleaseStageRunner) Rollback(ctx common.TraceContext) *StageExecResult {
-	return StageExecFail(fmt.Errorf("umimplement fs expand rollback").Error())
+	return StageExecSuccess(nil)
 }
 
 func NewPvcReleaseStage(volumeId string,
 	volumeType common.LvType,
 	volumeName string) *PvcReleaseStageRunner {
+	prKeys := make(map[string]string)
+	for _, node := range config.GetAvailableNodes() {
+		prKey, err := prkey.KeyOf(node)
+		if err != nil {
+			smslog.Warnf("can not get pr key of node %s, the agent uses the ip derived key: %v", node.Name, err)
+			continue
+		}
+		prKeys[node.Name] = prKey
+	}
 	return &PvcReleaseStageRunner{
 		Stage: &Stage{
 			Content: &message.PvcReleaseCommand{
 				Name:       volumeName,
 				VolumeType: volumeType,
 				VolumeId:   volumeId,
+				PrKeys:     prKeys,
 			},
 			SType:     PvcReleaseStage,
 			StartTime: 0,
@@ -0,0 +1,88 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"time"
+)
+
+type ErrClass string
+
+const (
+	//ErrInternal is the error of the manager itself, such as encoding or db errors
+	ErrInternal ErrClass = "internal"
+	//ErrTimeout is returned when the agent does not respond in time
+	ErrTimeout ErrClass = "timeout"
+	//ErrAgent is returned when the agent fails to execute the command
+	ErrAgent ErrClass = "agent"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int        `json:"max_attempts"`
+	BackoffMs      int64      `json:"backoff_ms"`
+	MaxBackoffMs   int64      `json:"max_backoff_ms"`
+	RetryableClass []ErrClass `json:"retryable_class"`
+}
+
+//noRetry is for the stages not listed in retryPolicies
+var noRetry = RetryPolicy{MaxAttempts: 1}
+
+//retryPolicies are the default policies by stage type, the commands retried on agent errors must be idempotent
+var retryPolicies = map[StageType]RetryPolicy{
+	PrStage:         {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout}},
+	PrBatchStage:    {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout}},
+	DmExecStage:     {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout}},
+	LvCreateStage:   {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout}},
+	LvDeleteStage:   {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout}},
+	LvExpandStage:   {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout}},
+	PvRescanStage:   {MaxAttempts: 3, BackoffMs: 2000, MaxBackoffMs: 10000, RetryableClass: []ErrClass{ErrTimeout, ErrAgent}},
+	PvcReleaseStage: {MaxAttempts: 3, BackoffMs: 1000, MaxBackoffMs: 5000, RetryableClass: []ErrClass{ErrTimeout, ErrAgent}},
+	FsExpandStage:   {MaxAttempts: 2, BackoffMs: 3000, MaxBackoffMs: 3000, RetryableClass: []ErrClass{ErrTimeout}},
+	DBPersistStage:  {MaxAttempts: 3, BackoffMs: 500, MaxBackoffMs: 2000, RetryableClass: []ErrClass{ErrInternal}},
+}
+
+func DefaultRetryPolicy(stageType StageType) *RetryPolicy {
+	policy, ok := retryPolicies[stageType]
+	if !ok {
+		policy = noRetry
+	}
+	return &policy
+}
+
+//Retryable returns whether to run again after the failed attempt
+func (p *RetryPolicy) Retryable(ret *StageExecResult, attempts int) bool {
+	if ret.IsSuccess() || attempts >= p.MaxAttempts {
+		return false
+	}
+	for _, class := range p.RetryableClass {
+		if class == ret.ErrClass {
+			return true
+		}
+	}
+	return false
+}
+
+//Backoff doubles the wait after each attempt, limited by MaxBackoffMs
+func (p *RetryPolicy) Backoff(attempts int) time.Duration {
+	backoff := p.BackoffMs
+	for i := 1; i < attempts && backoff < p.MaxBackoffMs; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoffMs > 0 && backoff > p.MaxBackoffMs {
+		backoff = p.MaxBackoffMs
+	}
+	return time.Duration(backoff) * time.Millisecond
+}
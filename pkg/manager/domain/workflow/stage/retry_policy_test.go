@@ -0,0 +1,43 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package stage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	policy := DefaultRetryPolicy(PrBatchStage)
+	assert.True(t, policy.Retryable(StageExecTimeout("time out"), 1))
+	assert.True(t, policy.Retryable(StageExecTimeout("time out"), 2))
+	assert.False(t, policy.Retryable(StageExecTimeout("time out"), 3))
+	assert.False(t, policy.Retryable(StageExecFail("marshal err"), 1))
+	assert.False(t, policy.Retryable(StageExecSuccess(nil), 1))
+
+	policy = DefaultRetryPolicy(FsFormatStage)
+	assert.False(t, policy.Retryable(StageExecTimeout("time out"), 1))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, BackoffMs: 1000, MaxBackoffMs: 5000}
+	assert.Equal(t, 1*time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+}
@@ -16,28 +16,30 @@
 package stage
 
 import (
+	"fmt"
 	"polardb-sms/pkg/network/message"
 )
 
 type StageType string
 
 const (
-	UnStageType     StageType = "Non"
-	FsExpandStage             = "fs-expand"
-	FsFormatStage             = "fs-format"
-	PrStage                   = "pr"
-	PrBatchStage              = "pr-batch"
-	DmExecStage               = "dm-exec"
-	LvCreateStage             = "lv-create"
-	LvDeleteStage             = "lv-delete"
-	LvExpandStage             = "lv-expand"
-	PvCreateStage             = "pv-create"
-	PvDeleteStage             = "pv-delete"
-	PvExpandStage             = "pv-expand"
-	PvRescanStage             = "pv-rescan"
-	PvcCreateStage            = "pvc-create"
-	PvcReleaseStage           = "pvc-release"
-	DBPersistStage            = "db-persist"
+	UnStageType        StageType = "Non"
+	FsExpandStage                = "fs-expand"
+	FsFormatStage                = "fs-format"
+	PrStage                      = "pr"
+	PrBatchStage                 = "pr-batch"
+	DmExecStage                  = "dm-exec"
+	LvCreateStage                = "lv-create"
+	LvDeleteStage                = "lv-delete"
+	LvExpandStage                = "lv-expand"
+	PvCreateStage                = "pv-create"
+	PvDeleteStage                = "pv-delete"
+	PvExpandStage                = "pv-expand"
+	PvRescanStage                = "pv-rescan"
+	PvcCreateStage               = "pvc-create"
+	PvcReleaseStage              = "pvc-release"
+	DBPersistStage               = "db-persist"
+	ParallelGroupStage           = "parallel-group"
 )
 
 type StageExecStatus int
@@ -61,6 +63,7 @@ type StageContext struct {
 type StageExecResult struct {
 	ExecStatus StageExecStatus
 	ErrMsg     string
+	ErrClass   ErrClass
 	Content    []byte
 }
 
@@ -75,6 +78,15 @@ func StageExecFail(errMsg string) *StageExecResult {
 	return &StageExecResult{
 		ExecStatus: StageFail,
 		ErrMsg:     errMsg,
+		ErrClass:   ErrInternal,
+	}
+}
+
+func StageExecTimeout(errMsg string) *StageExecResult {
+	return &StageExecResult{
+		ExecStatus: StageFail,
+		ErrMsg:     errMsg,
+		ErrClass:   ErrTimeout,
 	}
 }
 
@@ -85,20 +97,34 @@ func StageExecSuccess(content []byte) *StageExecResult {
 	}
 }
 
+//irreversibleRollback is used by the stages whose effect can not be undone,
+//rollback is only clean when the stage did not take effect
+func irreversibleRollback(s *Stage) *StageExecResult {
+	if !s.Result.IsSuccess() {
+		return StageExecSuccess(nil)
+	}
+	return StageExecFail(fmt.Sprintf("stage %s already took effect and can not be rolled back", s.SType))
+}
+
 func FromMessageBody(execResult *message.MessageBody) *StageExecResult {
 	result := &StageExecResult{
 		ExecStatus: StageExecStatus(execResult.ExecStatus),
 		ErrMsg:     execResult.ErrMsg,
 		Content:    execResult.Content,
 	}
+	if !result.IsSuccess() {
+		result.ErrClass = ErrAgent
+	}
 	return result
 }
 
 type Stage struct {
-	SType     StageType        `json:"s_type"`
-	StartTime int64            `json:"start_time"`
-	Result    *StageExecResult `json:"result"`
-	Content   interface{}      `json:"content"`
+	SType       StageType        `json:"s_type"`
+	StartTime   int64            `json:"start_time"`
+	Result      *StageExecResult `json:"result"`
+	Content     interface{}      `json:"content"`
+	RetryPolicy *RetryPolicy     `json:"retry_policy"`
+	Attempts    int              `json:"attempts"`
 }
 
 func (s Stage) StageType() StageType {
@@ -108,3 +134,30 @@ func (s Stage) StageType() StageType {
 func (s Stage) GetExecResult() *StageExecResult {
 	return s.Result
 }
+
+func (s Stage) GetContent() interface{} {
+	return s.Content
+}
+
+//ResetResult is called after the stage is rolled back, so that it is run again on retry.
+//the attempts are kept for the report
+func (s *Stage) ResetResult() {
+	s.Result = nil
+}
+
+//GetRetryPolicy falls back to the default policy of the stage type for the stages persisted without one
+func (s *Stage) GetRetryPolicy() *RetryPolicy {
+	if s.RetryPolicy == nil {
+		s.RetryPolicy = DefaultRetryPolicy(s.SType)
+	}
+	return s.RetryPolicy
+}
+
+func (s *Stage) GetAttempts() int {
+	return s.Attempts
+}
+
+func (s *Stage) AddAttempt() int {
+	s.Attempts++
+	return s.Attempts
+}
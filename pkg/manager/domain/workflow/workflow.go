@@ -34,4 +34,37 @@ type Workflow struct {
 	TraceContext string    `xorm:"TEXT"`
 	VolumeId     string    `xorm:"VARCHAR(45)"`
 	VolumeClass  string    `xorm:"VARCHAR(45)"`
+	Canceled     bool      `xorm:"TINYINT"`
+	CallbackUrl  string    `xorm:"VARCHAR(512)"`
+}
+
+//WorkflowVolumeLock is held by the unfinished workflow of a volume when the conflict policy is reject,
+//the unique key on volume_id makes the check and the creation of the workflow atomic among the managers
+type WorkflowVolumeLock struct {
+	Id         int       `xorm:"not null pk autoincr INT"`
+	VolumeId   string    `xorm:"not null unique VARCHAR(45)"`
+	WorkflowId string    `xorm:"not null VARCHAR(45)"`
+	Created    time.Time `xorm:"DATETIME created"`
+}
+
+//WorkflowArchive keeps the finished workflow removed by the retention policy,
+//Content is the gzip compressed json of the whole Workflow row
+type WorkflowArchive struct {
+	Id         int       `xorm:"not null pk autoincr INT"`
+	WorkflowId string    `xorm:"not null unique VARCHAR(45)"`
+	Type       int       `xorm:"not null INT"`
+	Status     int       `xorm:"INT"`
+	VolumeId   string    `xorm:"VARCHAR(45)"`
+	WflCreated time.Time `xorm:"DATETIME"`
+	Archived   time.Time `xorm:"DATETIME created"`
+	Content    []byte    `xorm:"LONGBLOB"`
+}
+
+//WorkflowQuery is the filter to query workflows, the zero value fields are ignored
+type WorkflowQuery struct {
+	Type      *int
+	Status    *int
+	VolumeId  string
+	StartTime time.Time
+	EndTime   time.Time
 }
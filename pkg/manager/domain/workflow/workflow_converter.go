@@ -51,6 +51,8 @@ func (c *WorkflowConverter) ToModel(t interface{}) (interface{}, error) {
 		TraceContext: e.TraceContext.String(),
 		VolumeId:     e.VolumeId,
 		VolumeClass:  e.VolumeClass,
+		Canceled:     e.Canceled,
+		CallbackUrl:  e.CallbackUrl,
 	}
 
 	innerSts := &innerStages{Stages: make([]*innerStage, 0)}
@@ -90,6 +92,8 @@ func (c *WorkflowConverter) ToEntity(t interface{}) (interface{}, error) {
 		TraceContext: common.ParseForTraceContext(m.TraceContext),
 		VolumeClass:  m.VolumeClass,
 		VolumeId:     m.VolumeId,
+		Canceled:     m.Canceled,
+		CallbackUrl:  m.CallbackUrl,
 	}
 
 	innerSts := &innerStages{Stages: make([]*innerStage, 0)}
@@ -146,21 +150,22 @@ type StageConstructor interface {
 func NewWorkflowConverter() domain.Converter {
 	return &WorkflowConverter{
 		stageConstructors: map[string]StageConstructor{
-			stage.FsExpandStage:   &stage.FsExpandStageConstructor{},
-			stage.FsFormatStage:   &stage.FsFormatStageConstructor{},
-			stage.PvcCreateStage:  &stage.PvcCreateStageConstructor{},
-			stage.PvcReleaseStage: &stage.PvcReleaseStageConstructor{},
-			stage.PvCreateStage:   &stage.PvCreateStageConstructor{},
-			stage.PvDeleteStage:   &stage.PvDeleteStageConstructor{},
-			stage.PvRescanStage:   &stage.PvRescanStageConstructor{},
-			stage.PvExpandStage:   &stage.PvExpandStageConstructor{},
-			stage.LvCreateStage:   &stage.LvCreateStageConstructor{},
-			stage.LvDeleteStage:   &stage.LvDeleteStageConstructor{},
-			stage.LvExpandStage:   &stage.LvExpandStageConstructor{},
-			stage.DmExecStage:     &stage.DmExecStageConstructor{},
-			stage.PrBatchStage:    &stage.PrBatchStageConstructor{},
-			stage.PrStage:         &stage.PrStageConstructor{},
-			stage.DBPersistStage:  &stage.DBPersistStageConstructor{},
+			stage.FsExpandStage:      &stage.FsExpandStageConstructor{},
+			stage.FsFormatStage:      &stage.FsFormatStageConstructor{},
+			stage.PvcCreateStage:     &stage.PvcCreateStageConstructor{},
+			stage.PvcReleaseStage:    &stage.PvcReleaseStageConstructor{},
+			stage.PvCreateStage:      &stage.PvCreateStageConstructor{},
+			stage.PvDeleteStage:      &stage.PvDeleteStageConstructor{},
+			stage.PvRescanStage:      &stage.PvRescanStageConstructor{},
+			stage.PvExpandStage:      &stage.PvExpandStageConstructor{},
+			stage.LvCreateStage:      &stage.LvCreateStageConstructor{},
+			stage.LvDeleteStage:      &stage.LvDeleteStageConstructor{},
+			stage.LvExpandStage:      &stage.LvExpandStageConstructor{},
+			stage.DmExecStage:        &stage.DmExecStageConstructor{},
+			stage.PrBatchStage:       &stage.PrBatchStageConstructor{},
+			stage.PrStage:            &stage.PrStageConstructor{},
+			stage.DBPersistStage:     &stage.DBPersistStageConstructor{},
+			stage.ParallelGroupStage: &stage.ParallelGroupStageConstructor{},
 		},
 	}
 }
@@ -17,6 +17,7 @@ package workflow
 
 import (
 	"encoding/json"
+	"fmt"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"polardb-sms/pkg/common"
 	smslog "polardb-sms/pkg/log"
@@ -67,6 +68,9 @@ const (
 	PvcFormat
 	PvcDelete
 	PvcBind
+	PrRepair
+	PrPathVerify
+	NodeFence
 )
 
 var DummyWorkflow = &WorkflowEntity{Id: domain.DummyWorkflowId}
@@ -91,6 +95,9 @@ type WorkflowEntity struct {
 	TraceContext common.TraceContext
 	VolumeId     string
 	VolumeClass  string
+	Canceled     bool
+	//CallbackUrl is notified when the workflow finishes, the global one in manager.conf is used if empty
+	CallbackUrl string
 }
 
 func (w *WorkflowEntity) SetTraceContext(value map[string]string) {
@@ -109,9 +116,64 @@ func (w *WorkflowEntity) GetTraceContext() map[string]string {
 	return w.TraceContext
 }
 
+//defaultWflTimeout is for the workflow types not listed in wflTimeouts
+const defaultWflTimeout = 10 * time.Minute
+
+//wflTimeouts is the max duration from creation a workflow is allowed to be started or resumed in
+var wflTimeouts = map[WflType]time.Duration{
+	Rescan:                  5 * time.Minute,
+	PrCheck:                 5 * time.Minute,
+	PrLock:                  2 * time.Minute,
+	ClusterLvCreate:         5 * time.Minute,
+	ClusterLvExpand:         5 * time.Minute,
+	ClusterLvFormat:         30 * time.Minute,
+	ClusterLvFsExpand:       10 * time.Minute,
+	ClusterLvDelete:         5 * time.Minute,
+	ClusterLunCreate:        5 * time.Minute,
+	ClusterLunExpand:        5 * time.Minute,
+	ClusterLunFsExpand:      10 * time.Minute,
+	ClusterLunFormat:        30 * time.Minute,
+	ClusterLunFormatAndLock: 30 * time.Minute,
+	PvcCreate:               30 * time.Minute,
+	PvcRelease:              2 * time.Minute,
+	PvcFormatAndLock:        30 * time.Minute,
+	PvcFsExpand:             10 * time.Minute,
+	PvcFormat:               30 * time.Minute,
+	PvcDelete:               5 * time.Minute,
+	PvcBind:                 2 * time.Minute,
+	PrRepair:                2 * time.Minute,
+	PrPathVerify:            2 * time.Minute,
+	NodeFence:               2 * time.Minute,
+}
+
+func (w *WorkflowEntity) Timeout() time.Duration {
+	if timeout, ok := wflTimeouts[w.WflType]; ok {
+		return timeout
+	}
+	return defaultWflTimeout
+}
+
+//queueableWfls do not build their stages from the pr keys, the writer or the fence generation of the volume,
+//so they are still valid when started after the workflows queued ahead of them
+var queueableWfls = map[WflType]bool{
+	DummyWfl:         true,
+	Rescan:           true,
+	PrCheck:          true,
+	ClusterLvCreate:  true,
+	ClusterLunCreate: true,
+	PvcCreate:        true,
+	PrPathVerify:     true,
+}
+
+//Queueable tells whether the workflow may wait behind another one of the same volume,
+//the others are rejected on a busy volume even in the queue policy
+func (w *WorkflowEntity) Queueable() bool {
+	return queueableWfls[w.WflType]
+}
+
 func (w *WorkflowEntity) Valid() bool {
 	now := time.Now()
-	overdue := w.CreateTime.Add(1 * time.Minute)
+	overdue := w.CreateTime.Add(w.Timeout())
 	if now.After(overdue) {
 		smslog.Debugf("workflow %s overdue, ignore", w.Id)
 		return false
@@ -119,8 +181,41 @@ func (w *WorkflowEntity) Valid() bool {
 	return true
 }
 
+//ResumeStep re-derives the step to continue running from the persisted stage results,
+//the stage which has no result yet may be interrupted and is run again
+func (w *WorkflowEntity) ResumeStep() int {
+	for i, s := range w.Stages {
+		if !s.GetExecResult().IsSuccess() {
+			return i
+		}
+	}
+	return len(w.Stages)
+}
+
+//Resume prepares a started workflow interrupted by manager failover to be processed again,
+//it continues running from the first unfinished stage, or rolls back if that stage
+//already failed or the workflow is overdue
+func (w *WorkflowEntity) Resume() {
+	if w.Mode != Run {
+		return
+	}
+	w.Step = w.ResumeStep()
+	if w.Step >= len(w.Stages) {
+		return
+	}
+	if ret := w.Stages[w.Step].GetExecResult(); ret != nil {
+		w.Mode = Rollback
+		w.LastErrMsg = ret.ErrMsg
+		return
+	}
+	if !w.Valid() {
+		w.Mode = Rollback
+		w.LastErrMsg = "workflow overdue after manager failover"
+	}
+}
+
 func (w *WorkflowEntity) IsFinished() bool {
-	return w.SuccessfullyRun() || w.SuccessfullyRollback() || w.Failed()
+	return w.SuccessfullyRun() || w.SuccessfullyRollback() || w.FailedRollback() || w.Failed()
 }
 
 func (w *WorkflowEntity) SuccessfullyRun() bool {
@@ -131,6 +226,10 @@ func (w *WorkflowEntity) SuccessfullyRollback() bool {
 	return w.Status == SuccessRollback && w.Step < 0
 }
 
+func (w *WorkflowEntity) FailedRollback() bool {
+	return w.Status == FailRollback
+}
+
 func (w *WorkflowEntity) Failed() bool {
 	return w.Status == Fail
 }
@@ -140,8 +239,14 @@ func (w *WorkflowEntity) GetExecResult() string {
 		return "success run"
 	}
 	if w.SuccessfullyRollback() {
+		if w.LastErrMsg != "" {
+			return fmt.Sprintf("success rollback after failure: %s", w.LastErrMsg)
+		}
 		return "success rollback"
 	}
+	if w.FailedRollback() {
+		return fmt.Sprintf("failed rollback at step %d: %s", w.Step, w.LastErrMsg)
+	}
 	if w.Failed() {
 		if w.Step >= 0 {
 			return w.Stages[w.Step].GetExecResult().ErrMsg
@@ -151,6 +256,52 @@ func (w *WorkflowEntity) GetExecResult() string {
 	return "unknown status"
 }
 
+//Retry builds a new workflow from a failed one, the stages already taken effect are skipped.
+//the workflow failed to roll back restarts from the stage whose rollback failed, for it is partly undone
+func (w *WorkflowEntity) Retry() (*WorkflowEntity, error) {
+	if !(w.Failed() || w.SuccessfullyRollback() || w.FailedRollback()) {
+		return nil, fmt.Errorf("workflow %s with status %d can not be retried", w.Id, w.Status)
+	}
+	stages, err := w.copyStages()
+	if err != nil {
+		return nil, fmt.Errorf("copy stages of workflow %s: %v", w.Id, err)
+	}
+	retry := NewWflBuilder().
+		WithType(w.WflType).
+		WithStageRunners(stages).
+		Build()
+	retry.Step = w.ResumeStep()
+	if w.FailedRollback() && w.Step >= 0 && w.Step < len(stages) {
+		retry.Step = w.Step
+		stages[w.Step].ResetResult()
+	}
+	retry.SetVolumeId(w.VolumeId)
+	retry.SetVolumeClass(w.VolumeClass)
+	retry.SetCallbackUrl(w.CallbackUrl)
+	traceContext := map[string]string{"retry": w.Id}
+	for k, v := range w.GetTraceContext() {
+		if k != "workflow" {
+			traceContext[k] = v
+		}
+	}
+	retry.SetTraceContext(traceContext)
+	return retry, nil
+}
+
+//copyStages deep copies the stages through their persisted form, so the retry shares none of them with w
+func (w *WorkflowEntity) copyStages() ([]StageRunner, error) {
+	c := NewWorkflowConverter()
+	m, err := c.ToModel(&WorkflowEntity{Stages: w.Stages})
+	if err != nil {
+		return nil, err
+	}
+	e, err := c.ToEntity(m)
+	if err != nil {
+		return nil, err
+	}
+	return e.(*WorkflowEntity).Stages, nil
+}
+
 func (w *WorkflowEntity) String() string {
 	msg, err := json.Marshal(w)
 	if err != nil {
@@ -171,6 +322,10 @@ func (w *WorkflowEntity) SetVolumeClass(volumeClass string) {
 	w.VolumeClass = volumeClass
 }
 
+func (w *WorkflowEntity) SetCallbackUrl(url string) {
+	w.CallbackUrl = url
+}
+
 func (w *WorkflowEntity) Run() {
 
 }
@@ -203,6 +358,10 @@ func (b *WflBuilder) WithStageRunners(stages []StageRunner) *WflBuilder {
 }
 
 func (b *WflBuilder) Build() *WorkflowEntity {
+	//fill the retry policies to be persisted with the workflow
+	for _, s := range b.stages {
+		s.GetRetryPolicy()
+	}
 	return &WorkflowEntity{
 		Id:         string(uuid.NewUUID()),
 		WflType:    b.wflType,
@@ -217,5 +376,9 @@ type StageRunner interface {
 	GetExecResult() *stage.StageExecResult
 	Run(ctx common.TraceContext) *stage.StageExecResult
 	Rollback(ctx common.TraceContext) *stage.StageExecResult
+	ResetResult()
+	GetRetryPolicy() *stage.RetryPolicy
+	GetAttempts() int
+	AddAttempt() int
 	StageType() stage.StageType
 }
@@ -0,0 +1,126 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package workflow
+
+import (
+	"polardb-sms/pkg/common"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+type fakeStage struct {
+	stage.Stage
+}
+
+func (s *fakeStage) Run(ctx common.TraceContext) *stage.StageExecResult {
+	return s.Result
+}
+
+func (s *fakeStage) Rollback(ctx common.TraceContext) *stage.StageExecResult {
+	return stage.StageExecSuccess(nil)
+}
+
+func newFakeStage(ret *stage.StageExecResult) StageRunner {
+	return &fakeStage{Stage: stage.Stage{SType: stage.DmExecStage, Result: ret}}
+}
+
+func TestWorkflowEntity_Resume(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	wfl := &WorkflowEntity{
+		WflType:    PvcFormat,
+		Step:       0,
+		CreateTime: time.Now(),
+		Status:     Started,
+		Stages: []StageRunner{
+			newFakeStage(stage.StageExecSuccess(nil)),
+			newFakeStage(nil),
+			newFakeStage(nil),
+		},
+	}
+	wfl.Resume()
+	assert.Equal(t, Run, wfl.Mode)
+	assert.Equal(t, 1, wfl.Step)
+
+	wfl.Stages[1] = newFakeStage(stage.StageExecFail("lost path"))
+	wfl.Resume()
+	assert.Equal(t, Rollback, wfl.Mode)
+	assert.Equal(t, 1, wfl.Step)
+	assert.Equal(t, "lost path", wfl.LastErrMsg)
+
+	wfl.Mode = Run
+	wfl.Stages[1] = newFakeStage(nil)
+	wfl.CreateTime = time.Now().Add(-wfl.Timeout() - time.Second)
+	wfl.Resume()
+	assert.Equal(t, Rollback, wfl.Mode)
+	assert.Equal(t, 1, wfl.Step)
+
+	wfl.Mode = Run
+	for i := range wfl.Stages {
+		wfl.Stages[i] = newFakeStage(stage.StageExecSuccess(nil))
+	}
+	wfl.Resume()
+	assert.Equal(t, Run, wfl.Mode)
+	assert.Equal(t, len(wfl.Stages), wfl.Step)
+}
+
+func TestWorkflowEntity_Retry(t *testing.T) {
+	wfl := &WorkflowEntity{
+		Id:          "wfl-1",
+		WflType:     PvcFormat,
+		Status:      Fail,
+		Step:        1,
+		VolumeId:    "vol-1",
+		CallbackUrl: "http://callback",
+		Stages: []StageRunner{
+			newFakeStage(stage.StageExecSuccess(nil)),
+			newFakeStage(stage.StageExecFail("lost path")),
+		},
+	}
+	retry, err := wfl.Retry()
+	assert.NoError(t, err)
+	assert.Equal(t, "vol-1", retry.VolumeId)
+	//the retried workflow notifies the same callback when it finishes
+	assert.Equal(t, "http://callback", retry.CallbackUrl)
+	assert.Equal(t, "wfl-1", retry.TraceContext["retry"])
+
+	assert.Equal(t, 1, retry.Step)
+	//the retry does not share the stages with the finished workflow
+	assert.NotSame(t, wfl.Stages[0], retry.Stages[0])
+	assert.True(t, retry.Stages[0].GetExecResult().IsSuccess())
+
+	//the stage failed to roll back is run again
+	wfl.Status = FailRollback
+	wfl.Step = 1
+	wfl.Stages = []StageRunner{
+		newFakeStage(stage.StageExecSuccess(nil)),
+		newFakeStage(stage.StageExecSuccess(nil)),
+		newFakeStage(nil),
+	}
+	retry, err = wfl.Retry()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retry.Step)
+	assert.Nil(t, retry.Stages[1].GetExecResult())
+	assert.True(t, wfl.Stages[1].GetExecResult().IsSuccess())
+
+	wfl.Status = Started
+	_, err = wfl.Retry()
+	assert.Error(t, err)
+}
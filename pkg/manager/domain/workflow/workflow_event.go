@@ -0,0 +1,144 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package workflow
+
+import (
+	"polardb-sms/pkg/manager/domain/workflow/stage"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type WorkflowEventType string
+
+const (
+	StageStarted     WorkflowEventType = "stage-started"
+	StageFinished    WorkflowEventType = "stage-finished"
+	WorkflowRollback WorkflowEventType = "rollback"
+	WorkflowFinished WorkflowEventType = "workflow-finished"
+)
+
+//slow subscribers lose events instead of blocking the workflow processors
+const eventBufferSize = 64
+
+type WorkflowEvent struct {
+	Type       WorkflowEventType `json:"type"`
+	WorkflowId string            `json:"workflow_id"`
+	WflType    WflType           `json:"workflow_type"`
+	VolumeId   string            `json:"volume_id"`
+	Step       int               `json:"step"`
+	StageType  string            `json:"stage_type,omitempty"`
+	Mode       WorkMode          `json:"mode"`
+	Status     ExecStatus        `json:"status"`
+	Success    bool              `json:"success"`
+	ErrMsg     string            `json:"err_msg,omitempty"`
+	Time       string            `json:"time"`
+}
+
+func NewWorkflowEvent(eventType WorkflowEventType, w *WorkflowEntity) *WorkflowEvent {
+	e := &WorkflowEvent{
+		Type:       eventType,
+		WorkflowId: w.Id,
+		WflType:    w.WflType,
+		VolumeId:   w.VolumeId,
+		Step:       w.Step,
+		Mode:       w.Mode,
+		Status:     w.Status,
+		Time:       strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if w.Step >= 0 && w.Step < len(w.Stages) {
+		e.StageType = string(w.Stages[w.Step].StageType())
+	}
+	switch eventType {
+	case WorkflowFinished:
+		e.Success = w.SuccessfullyRun()
+		e.ErrMsg = w.LastErrMsg
+	case WorkflowRollback:
+		e.ErrMsg = w.LastErrMsg
+	}
+	return e
+}
+
+type eventSubscriber struct {
+	workflowId string
+	ch         chan *WorkflowEvent
+}
+
+//WorkflowEventBroker dispatches the events of the workflows processed by this manager to the subscribers
+type WorkflowEventBroker struct {
+	lock        sync.RWMutex
+	nextId      int
+	subscribers map[int]*eventSubscriber
+}
+
+//Subscribe returns the events of the workflow, or of all the workflows if workflowId is empty,
+//the returned func must be called to unsubscribe
+func (b *WorkflowEventBroker) Subscribe(workflowId string) (<-chan *WorkflowEvent, func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	id := b.nextId
+	b.nextId++
+	sub := &eventSubscriber{
+		workflowId: workflowId,
+		ch:         make(chan *WorkflowEvent, eventBufferSize),
+	}
+	b.subscribers[id] = sub
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			delete(b.subscribers, id)
+			close(sub.ch)
+		})
+	}
+}
+
+//NewStageFinishedEvent carries the result of the stage run or rollback
+func NewStageFinishedEvent(w *WorkflowEntity, ret *stage.StageExecResult) *WorkflowEvent {
+	e := NewWorkflowEvent(StageFinished, w)
+	if ret != nil {
+		e.Success = ret.IsSuccess()
+		e.ErrMsg = ret.ErrMsg
+	}
+	return e
+}
+
+func (b *WorkflowEventBroker) Publish(e *WorkflowEvent) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, sub := range b.subscribers {
+		if sub.workflowId != "" && sub.workflowId != e.WorkflowId {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
+
+func NewWorkflowEventBroker() *WorkflowEventBroker {
+	return &WorkflowEventBroker{
+		subscribers: make(map[int]*eventSubscriber),
+	}
+}
+
+var _eventBroker = NewWorkflowEventBroker()
+
+func GetWorkflowEventBroker() *WorkflowEventBroker {
+	return _eventBroker
+}
@@ -0,0 +1,46 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package workflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkflowEventBroker(t *testing.T) {
+	b := NewWorkflowEventBroker()
+	one, unsubscribeOne := b.Subscribe("wfl-1")
+	all, unsubscribeAll := b.Subscribe("")
+	defer unsubscribeAll()
+
+	b.Publish(&WorkflowEvent{Type: StageStarted, WorkflowId: "wfl-2"})
+	b.Publish(&WorkflowEvent{Type: WorkflowFinished, WorkflowId: "wfl-1"})
+	assert.Equal(t, WorkflowFinished, (<-one).Type)
+	assert.Equal(t, "wfl-2", (<-all).WorkflowId)
+	assert.Equal(t, "wfl-1", (<-all).WorkflowId)
+
+	unsubscribeOne()
+	unsubscribeOne()
+	_, ok := <-one
+	assert.False(t, ok)
+
+	//the slow subscriber drops the events instead of blocking the publisher
+	for i := 0; i < eventBufferSize*2; i++ {
+		b.Publish(&WorkflowEvent{Type: StageStarted, WorkflowId: "wfl-3"})
+	}
+	assert.Equal(t, eventBufferSize, len(all))
+}
@@ -16,10 +16,17 @@
 package workflow
 
 import (
+	"errors"
 	"fmt"
 	"polardb-sms/pkg/manager/domain/repository"
+	"strings"
+	"time"
+	"xorm.io/xorm"
 )
 
+//ErrVolumeBusy is returned by CreateExclusive if an unfinished workflow holds the volume
+var ErrVolumeBusy = errors.New("volume is busy")
+
 type WorkflowRepo struct {
 	*repository.BaseDB
 }
@@ -31,7 +38,8 @@ func NewWorkflowRepo() *WorkflowRepo {
 }
 
 func (r *WorkflowRepo) Save(wfl *Workflow) (int64, error) {
-	result, err := r.Engine.Where("workflow_id=?", wfl.WorkflowId).Update(wfl)
+	//step/status/mode may be rolled back to zero values, which are skipped by default
+	result, err := r.Engine.Where("workflow_id=?", wfl.WorkflowId).MustCols("step", "status", "mode").Update(wfl)
 	if err != nil {
 		return 0, err
 	}
@@ -47,6 +55,59 @@ func (r *WorkflowRepo) Create(wfl *Workflow) (int64, error) {
 	return affected, nil
 }
 
+//CreateExclusive inserts wfl with the lock of its volume in one transaction. the lock left by a finished
+//or removed workflow is taken over, the unique key fails the managers racing for the same volume
+func (r *WorkflowRepo) CreateExclusive(wfl *Workflow) (int64, error) {
+	session := r.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+	if err := r.lockVolume(session, wfl); err != nil {
+		_ = session.Rollback()
+		return 0, err
+	}
+	affected, err := session.Insert(wfl)
+	if err != nil {
+		_ = session.Rollback()
+		return 0, err
+	}
+	return affected, session.Commit()
+}
+
+func (r *WorkflowRepo) lockVolume(session *xorm.Session, wfl *Workflow) error {
+	holder := WorkflowVolumeLock{}
+	exist, err := session.Where("volume_id=?", wfl.VolumeId).ForUpdate().Get(&holder)
+	if err != nil {
+		return err
+	}
+	if exist {
+		holding := Workflow{}
+		held, err := session.Where("workflow_id=?", holder.WorkflowId).In("status", int(NotStarted), int(Started)).Get(&holding)
+		if err != nil {
+			return err
+		}
+		if held {
+			return fmt.Errorf("%w: volume %s is processed by workflow %s of type %d",
+				ErrVolumeBusy, wfl.VolumeId, holding.WorkflowId, holding.Type)
+		}
+		if _, err = session.ID(holder.Id).Delete(&WorkflowVolumeLock{}); err != nil {
+			return err
+		}
+	}
+	_, err = session.Insert(&WorkflowVolumeLock{VolumeId: wfl.VolumeId, WorkflowId: wfl.WorkflowId})
+	if err != nil {
+		//the other manager inserts the lock in the same time
+		return fmt.Errorf("%w: lock volume %s: %v", ErrVolumeBusy, wfl.VolumeId, err)
+	}
+	return nil
+}
+
+//UnlockVolume releases the lock held by the finished workflow
+func (r *WorkflowRepo) UnlockVolume(volumeId, workflowId string) (int64, error) {
+	return r.Engine.Where("volume_id=? and workflow_id=?", volumeId, workflowId).Delete(&WorkflowVolumeLock{})
+}
+
 func (r *WorkflowRepo) Delete(wfl *Workflow) (int64, error) {
 	affected, err := r.Engine.Delete(wfl)
 	if err != nil {
@@ -92,3 +153,130 @@ func (r *WorkflowRepo) FindByConditionsAndLimit(c string, limit int) ([]*Workflo
 	err := r.Engine.Where(c).Limit(limit).Find(&wfls)
 	return wfls, err
 }
+
+func (r *WorkflowRepo) FindByConditions(c string) ([]*Workflow, error) {
+	var wfls []*Workflow
+	err := r.Engine.Where(c).Asc("created").Find(&wfls)
+	return wfls, err
+}
+
+func (r *WorkflowRepo) UpdateCanceled(wid string, canceled bool) (int64, error) {
+	return r.Engine.Where("workflow_id=?", wid).Cols("canceled").Update(&Workflow{Canceled: canceled})
+}
+
+func (r *WorkflowRepo) FindByQueryAndPage(q *WorkflowQuery, idx, pgSize int) ([]*Workflow, int64, error) {
+	var wfls []*Workflow
+	session := r.Engine.NewSession()
+	defer session.Close()
+	if q.Type != nil {
+		session.And("type=?", *q.Type)
+	}
+	if q.Status != nil {
+		session.And("status=?", *q.Status)
+	}
+	if q.VolumeId != "" {
+		session.And("volume_id=?", q.VolumeId)
+	}
+	if !q.StartTime.IsZero() {
+		session.And("created>=?", q.StartTime)
+	}
+	if !q.EndTime.IsZero() {
+		session.And("created<?", q.EndTime)
+	}
+	cnt, err := session.Desc("created").Limit(pgSize, idx*pgSize).FindAndCount(&wfls)
+	return wfls, cnt, err
+}
+
+func (r *WorkflowRepo) FindByStatusExcludingVolumesAndLimit(status int, volumeIds []string, limit int) ([]*Workflow, error) {
+	var wfls []*Workflow
+	session := r.Engine.NewSession()
+	defer session.Close()
+	session.Where("status=?", status)
+	if len(volumeIds) > 0 {
+		args := make([]interface{}, 0, len(volumeIds))
+		for _, id := range volumeIds {
+			args = append(args, id)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(volumeIds)), ",")
+		session.And(fmt.Sprintf("(volume_id is null or volume_id not in (%s))", placeholders), args...)
+	}
+	err := session.Asc("created").Limit(limit).Find(&wfls)
+	return wfls, err
+}
+
+func (r *WorkflowRepo) FindUnfinished(volumeId string) ([]*Workflow, error) {
+	var wfls []*Workflow
+	session := r.Engine.NewSession()
+	defer session.Close()
+	session.In("status", int(NotStarted), int(Started))
+	if volumeId != "" {
+		session.And("volume_id=?", volumeId)
+	}
+	err := session.Asc("created").Find(&wfls)
+	return wfls, err
+}
+
+var finishedStatus = []interface{}{int(Success), int(Fail), int(SuccessRollback), int(FailRollback)}
+
+func (r *WorkflowRepo) FindFinishedBefore(before time.Time, limit int) ([]*Workflow, error) {
+	var wfls []*Workflow
+	err := r.Engine.In("status", finishedStatus...).And("created<?", before).Asc("created").Limit(limit).Find(&wfls)
+	return wfls, err
+}
+
+//FindVolumesFinishedMoreThan returns the volumes with more than keep finished workflows
+func (r *WorkflowRepo) FindVolumesFinishedMoreThan(keep int) ([]string, error) {
+	var volumeIds []string
+	err := r.Engine.Table(&Workflow{}).Cols("volume_id").
+		In("status", finishedStatus...).
+		And("volume_id is not null and volume_id != ''").
+		GroupBy("volume_id").
+		Having(fmt.Sprintf("count(*) > %d", keep)).
+		Find(&volumeIds)
+	return volumeIds, err
+}
+
+//FindFinishedByVolumeSkipLatest skips the latest keep finished workflows of the volume
+func (r *WorkflowRepo) FindFinishedByVolumeSkipLatest(volumeId string, keep, limit int) ([]*Workflow, error) {
+	var wfls []*Workflow
+	err := r.Engine.In("status", finishedStatus...).And("volume_id=?", volumeId).Desc("created").Limit(limit, keep).Find(&wfls)
+	return wfls, err
+}
+
+//Archive moves the workflows to the archive table in one transaction
+func (r *WorkflowRepo) Archive(archives []*WorkflowArchive) (int64, error) {
+	if len(archives) == 0 {
+		return 0, nil
+	}
+	session := r.Engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+	wids := make([]interface{}, 0, len(archives))
+	for _, a := range archives {
+		wids = append(wids, a.WorkflowId)
+	}
+	if _, err := session.Insert(&archives); err != nil {
+		_ = session.Rollback()
+		return 0, err
+	}
+	affected, err := session.Unscoped().In("workflow_id", wids...).Delete(&Workflow{})
+	if err != nil {
+		_ = session.Rollback()
+		return 0, err
+	}
+	return affected, session.Commit()
+}
+
+func (r *WorkflowRepo) FindArchiveByWorkflowId(wid string) (*WorkflowArchive, error) {
+	archive := WorkflowArchive{}
+	exist, err := r.Engine.Where("workflow_id=?", wid).Get(&archive)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, fmt.Errorf("archived workflow %s not exist", wid)
+	}
+	return &archive, nil
+}
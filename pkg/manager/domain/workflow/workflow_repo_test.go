@@ -110,3 +110,18 @@ func TestWorkflowRepo_FindByConditionsAndLimit(t *testing.T) {
 		smslog.Infof("workflow %v", w)
 	}
 }
+
+func TestCompressWorkflow(t *testing.T) {
+	wfl := &Workflow{
+		Stages:       `[{"stage_type":"pr-batch","stage_content":"{}"}]`,
+		Status:       int(SuccessRollback),
+		WorkflowId:   "test_archive",
+		TraceContext: `{"trace_id":"1"}`,
+		VolumeId:     "36e00084100ee7ec9ab6a11cf00000dbb",
+	}
+	content, err := compressWorkflow(wfl)
+	assert.NoError(t, err)
+	decoded, err := decompressWorkflow(content)
+	assert.NoError(t, err)
+	assert.Equal(t, wfl, decoded)
+}
@@ -16,6 +16,9 @@
 package workflow
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"polardb-sms/pkg/manager/domain"
 	"polardb-sms/pkg/manager/domain/repository"
@@ -42,6 +45,25 @@ func (c *WorkflowRepositoryImpl) Create(workflowEntity *WorkflowEntity) (int64,
 	return 0, nil
 }
 
+//CreateExclusive fails with ErrVolumeBusy if an unfinished workflow holds the volume of workflowEntity
+func (c *WorkflowRepositoryImpl) CreateExclusive(workflowEntity *WorkflowEntity) (int64, error) {
+	mInf, err := c.dataConverter.ToModel(workflowEntity)
+	if err != nil {
+		return 0, err
+	}
+	m := mInf.(*Workflow)
+	m.Created = time.Now()
+
+	if _, err := c.dataWorkflowDAO.CreateExclusive(m); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (c *WorkflowRepositoryImpl) UnlockVolume(workflowEntity *WorkflowEntity) (int64, error) {
+	return c.dataWorkflowDAO.UnlockVolume(workflowEntity.VolumeId, workflowEntity.Id)
+}
+
 func (c *WorkflowRepositoryImpl) Save(workflowEntity *WorkflowEntity) (int64, error) {
 	mInf, err := c.dataConverter.ToModel(workflowEntity)
 	if err != nil {
@@ -139,6 +161,78 @@ func (c *WorkflowRepositoryImpl) FindByStatusAndLimit(status, limit int) ([]*Wor
 	return es, nil
 }
 
+func (c *WorkflowRepositoryImpl) FindByStatus(status int) ([]*WorkflowEntity, error) {
+	condition := fmt.Sprintf("status=%d", status)
+	workflows, err := c.dataWorkflowDAO.FindByConditions(condition)
+	if err != nil {
+		return nil, err
+	}
+	var wfs = make([]interface{}, len(workflows))
+	for i, d := range workflows {
+		wfs[i] = d
+	}
+	var es []*WorkflowEntity
+	esi, _ := c.dataConverter.ToEntities(wfs)
+	for _, e := range esi {
+		es = append(es, e.(*WorkflowEntity))
+	}
+	return es, nil
+}
+
+func (c *WorkflowRepositoryImpl) FindByQueryAndPage(q *WorkflowQuery, idx, pgSize int) ([]*WorkflowEntity, int64, error) {
+	workflows, cnt, err := c.dataWorkflowDAO.FindByQueryAndPage(q, idx, pgSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var wfs = make([]interface{}, len(workflows))
+	for i, d := range workflows {
+		wfs[i] = d
+	}
+
+	var es []*WorkflowEntity
+	esi, _ := c.dataConverter.ToEntities(wfs)
+	for _, e := range esi {
+		es = append(es, e.(*WorkflowEntity))
+	}
+
+	return es, cnt, nil
+}
+
+func (c *WorkflowRepositoryImpl) FindByStatusExcludingVolumesAndLimit(status int, volumeIds []string, limit int) ([]*WorkflowEntity, error) {
+	workflows, err := c.dataWorkflowDAO.FindByStatusExcludingVolumesAndLimit(status, volumeIds, limit)
+	if err != nil {
+		return nil, err
+	}
+	return c.toEntities(workflows), nil
+}
+
+//FindUnfinished returns the not started and started workflows in creation order, volumeId is optional
+func (c *WorkflowRepositoryImpl) FindUnfinished(volumeId string) ([]*WorkflowEntity, error) {
+	workflows, err := c.dataWorkflowDAO.FindUnfinished(volumeId)
+	if err != nil {
+		return nil, err
+	}
+	return c.toEntities(workflows), nil
+}
+
+func (c *WorkflowRepositoryImpl) toEntities(workflows []*Workflow) []*WorkflowEntity {
+	var wfs = make([]interface{}, len(workflows))
+	for i, d := range workflows {
+		wfs[i] = d
+	}
+	var es []*WorkflowEntity
+	esi, _ := c.dataConverter.ToEntities(wfs)
+	for _, e := range esi {
+		es = append(es, e.(*WorkflowEntity))
+	}
+	return es
+}
+
+func (c *WorkflowRepositoryImpl) Cancel(workflowId string) (int64, error) {
+	return c.dataWorkflowDAO.UpdateCanceled(workflowId, true)
+}
+
 func (c *WorkflowRepositoryImpl) FindByVolumeIdAndClass(volumeId string, volumeClass string, wflType int) (*WorkflowEntity, error) {
 	ret := &Workflow{}
 	ok, err := c.Engine.Alias("a").Unscoped().
@@ -158,6 +252,100 @@ func (c *WorkflowRepositoryImpl) FindByVolumeIdAndClass(volumeId string, volumeC
 	return wflEntity.(*WorkflowEntity), nil
 }
 
+//ArchiveFinishedBefore archives at most limit finished workflows created before the time
+func (c *WorkflowRepositoryImpl) ArchiveFinishedBefore(before time.Time, limit int) (int64, error) {
+	workflows, err := c.dataWorkflowDAO.FindFinishedBefore(before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return c.archive(workflows)
+}
+
+//ArchiveFinishedOverCount archives the finished workflows of each volume except the latest keep ones
+func (c *WorkflowRepositoryImpl) ArchiveFinishedOverCount(keep, limit int) (int64, error) {
+	volumeIds, err := c.dataWorkflowDAO.FindVolumesFinishedMoreThan(keep)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, volumeId := range volumeIds {
+		workflows, err := c.dataWorkflowDAO.FindFinishedByVolumeSkipLatest(volumeId, keep, limit)
+		if err != nil {
+			return total, err
+		}
+		affected, err := c.archive(workflows)
+		if err != nil {
+			return total, fmt.Errorf("archive workflows of volume %s err %v", volumeId, err)
+		}
+		total += affected
+	}
+	return total, nil
+}
+
+func (c *WorkflowRepositoryImpl) archive(workflows []*Workflow) (int64, error) {
+	archives := make([]*WorkflowArchive, 0, len(workflows))
+	for _, w := range workflows {
+		content, err := compressWorkflow(w)
+		if err != nil {
+			return 0, fmt.Errorf("compress workflow %s err %v", w.WorkflowId, err)
+		}
+		archives = append(archives, &WorkflowArchive{
+			WorkflowId: w.WorkflowId,
+			Type:       w.Type,
+			Status:     w.Status,
+			VolumeId:   w.VolumeId,
+			WflCreated: w.Created,
+			Content:    content,
+		})
+	}
+	return c.dataWorkflowDAO.Archive(archives)
+}
+
+func (c *WorkflowRepositoryImpl) FindArchivedByWorkflowId(workflowId string) (*WorkflowEntity, error) {
+	archive, err := c.dataWorkflowDAO.FindArchiveByWorkflowId(workflowId)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decompressWorkflow(archive.Content)
+	if err != nil {
+		return nil, fmt.Errorf("decompress archived workflow %s err %v", workflowId, err)
+	}
+	e, err := c.dataConverter.ToEntity(m)
+	if err != nil {
+		return nil, err
+	}
+	return e.(*WorkflowEntity), nil
+}
+
+func compressWorkflow(w *Workflow) ([]byte, error) {
+	content, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressWorkflow(content []byte) (*Workflow, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	w := &Workflow{}
+	if err = json.NewDecoder(zr).Decode(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
 func NewWorkflowRepository() WorkflowRepository {
 	workflowRepo := &WorkflowRepositoryImpl{
 		dataConverter:   NewWorkflowConverter(),
@@ -169,11 +357,21 @@ func NewWorkflowRepository() WorkflowRepository {
 
 type WorkflowRepository interface {
 	Create(workflowEntity *WorkflowEntity) (int64, error)
+	CreateExclusive(workflowEntity *WorkflowEntity) (int64, error)
+	UnlockVolume(workflowEntity *WorkflowEntity) (int64, error)
 	Save(workflowEntity *WorkflowEntity) (int64, error)
 	Delete(entity *WorkflowEntity) (int64, error)
 	FindByWorkflowId(workflowId string) (*WorkflowEntity, error)
 	FindAll() ([]*WorkflowEntity, error)
 	FindByPage(idx, pgSize int) ([]*WorkflowEntity, int64, error)
 	FindByStatusAndLimit(status, limit int) ([]*WorkflowEntity, error)
+	FindByStatus(status int) ([]*WorkflowEntity, error)
+	FindByQueryAndPage(q *WorkflowQuery, idx, pgSize int) ([]*WorkflowEntity, int64, error)
+	Cancel(workflowId string) (int64, error)
+	FindByStatusExcludingVolumesAndLimit(status int, volumeIds []string, limit int) ([]*WorkflowEntity, error)
+	FindUnfinished(volumeId string) ([]*WorkflowEntity, error)
 	FindByVolumeIdAndClass(volumeId, volumeClass string, wflType int) (*WorkflowEntity, error)
+	ArchiveFinishedBefore(before time.Time, limit int) (int64, error)
+	ArchiveFinishedOverCount(keep, limit int) (int64, error)
+	FindArchivedByWorkflowId(workflowId string) (*WorkflowEntity, error)
 }
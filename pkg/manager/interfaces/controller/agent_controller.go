@@ -16,6 +16,7 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	smslog "polardb-sms/pkg/log"
@@ -53,3 +54,49 @@ func (c *AgentController) Heartbeat(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, heartbeatResp)
 }
+
+// @Summary Query Agents
+// @Tags Agent 管理
+// @version 1.0
+// @Description 查询manager到所有agent的连接状态, 包括连接建立时间, ping往返时延, 最近错误和在途请求数
+// @Produce  json
+// @Success 200 array view.AgentStatus 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /agents [get]
+func (c *AgentController) QueryAgents(ctx *gin.Context) {
+	smslog.Debugf("call QueryAgents")
+	statuses, err := c.as.QueryAgentStatuses()
+	if err != nil {
+		smslog.Errorf("Could not query agents: %v", err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, statuses)
+}
+
+// @Summary Search Agent
+// @Tags Agent 管理
+// @version 1.0
+// @Description 查询manager到指定agent的连接状态
+// @Produce  json
+// @Param id path string true "node id"
+// @Success 200 object view.AgentStatus 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /agents/:id [get]
+func (c *AgentController) SearchAgent(ctx *gin.Context) {
+	smslog.Debugf("call SearchAgent")
+	nodeId := ctx.Param("id")
+	if nodeId == "" {
+		err := fmt.Errorf("request param not exist node id")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	status, err := c.as.QueryAgentStatus(nodeId)
+	if err != nil {
+		smslog.Errorf("Could not query agent %s: %v", nodeId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, status)
+}
@@ -26,6 +26,7 @@ import (
 	"polardb-sms/pkg/manager/application/service"
 	"polardb-sms/pkg/manager/application/view"
 	"polardb-sms/pkg/manager/config"
+	"polardb-sms/pkg/manager/domain/prkey"
 	"strings"
 )
 
@@ -126,7 +127,7 @@ func (h *SwitchOverHandler) constructSwitchItems(clusterTopo *ClusterTopology, s
 		ErrMsg:       "",
 	}
 
-	if prKey == common.IpV4ToPrKey(clusterTopo.RwPod.HostIp) {
+	if prNode := prkey.NodeOf(prKey); prNode != nil && prNode.Ip == clusterTopo.RwPod.HostIp {
 		switchOverTask.OrgStatus = SwitchModeRw
 	}
 
@@ -27,9 +27,10 @@ import (
 )
 
 type ClusterLvController struct {
-	lvRepo lv.LvRepository
-	as     assembler.ClusterLvAssembler
-	cs     *service.ClusterLvService
+	lvRepo    lv.LvRepository
+	fenceRepo lv.FenceHistoryRepository
+	as        assembler.ClusterLvAssembler
+	cs        *service.ClusterLvService
 }
 
 // @Summary 创建 Cluster LV
@@ -201,6 +202,62 @@ func (controller *ClusterLvController) ExpandClusterLvForFs(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, wflResp)
 }
 
+// @Summary 设置 Cluster LV APTPL
+// @Tags LV 管理
+// @version 1.0
+// @Description 用于设置指定 Cluster LV 的注册和预留在存储阵列掉电后是否保留, 写节点会重新注册使其生效
+// @Accept  json
+// @Produce  json
+// @Param clusterLv body view.ClusterLvAptplRequest true "请求参数"
+// @Success 200 object view.WorkflowIdResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /cluster-lvs/aptpl [post]
+func (controller *ClusterLvController) SetClusterLvAptpl(ctx *gin.Context) {
+	smslog.Info("call SetClusterLvAptpl")
+	var aptplRequest view.ClusterLvAptplRequest
+	if err := ParseParam(ctx, &aptplRequest); err != nil {
+		smslog.Errorf("Cloud not parse cluster lv aptpl request %v: %v", aptplRequest, err)
+		ReturnError(ctx, err)
+		return
+	}
+	wflResp, err := controller.cs.SetAptpl(GetTraceContextFromHeader(ctx), &aptplRequest)
+	if err != nil {
+		smslog.Errorf("Could not set aptpl of cluster lv %v: %v", aptplRequest, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, wflResp)
+}
+
+// @Summary 设置 Cluster LV 预留类型
+// @Tags LV 管理
+// @version 1.0
+// @Description 用于设置指定 Cluster LV 的PR预留类型, 支持7(Write Exclusive, all registrants)和8(Exclusive Access, all registrants), 写节点会抢占自身使其生效
+// @Accept  json
+// @Produce  json
+// @Param clusterLv body view.ClusterLvReserveTypeRequest true "请求参数"
+// @Success 200 object view.WorkflowIdResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /cluster-lvs/reserve-type [post]
+func (controller *ClusterLvController) SetClusterLvReserveType(ctx *gin.Context) {
+	smslog.Info("call SetClusterLvReserveType")
+	var reserveTypeRequest view.ClusterLvReserveTypeRequest
+	if err := ParseParam(ctx, &reserveTypeRequest); err != nil {
+		smslog.Errorf("Cloud not parse cluster lv reserve type request %v: %v", reserveTypeRequest, err)
+		ReturnError(ctx, err)
+		return
+	}
+	wflResp, err := controller.cs.SetReserveType(GetTraceContextFromHeader(ctx), &reserveTypeRequest)
+	if err != nil {
+		smslog.Errorf("Could not set reserve type of cluster lv %v: %v", reserveTypeRequest, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, wflResp)
+}
+
 // @Summary 删除 Cluster LV
 // @Tags LV 管理
 // @version 1.0
@@ -230,11 +287,41 @@ func (controller *ClusterLvController) DeleteClusterLv(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"tst": 0})
 }
 
+// @Summary 查询 Cluster LV 写锁 fencing 历史
+// @Tags LV 管理
+// @version 1.0
+// @Description 用于查询指定 Cluster LV 的 fencing generation 变更历史
+// @Accept  json
+// @Produce  json
+// @Param name query string true "lv name"
+// @Success 200 array lv.FenceRecordEntity 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /cluster-lvs/:name/fences [get]
+func (controller *ClusterLvController) QueryFenceHistory(ctx *gin.Context) {
+	smslog.Info("call QueryFenceHistory")
+	volumeId, exist := ctx.Params.Get("name")
+	if !exist {
+		err := fmt.Errorf("request param not exist lv name")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	records, err := controller.fenceRepo.QueryByVolumeId(volumeId)
+	if err != nil {
+		smslog.Errorf("Could not query fence history of lv %s: %v", volumeId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, records)
+}
+
 func NewClusterLvController() *ClusterLvController {
 	clusterLvController := &ClusterLvController{
-		lvRepo: lv.GetLvRepository(),
-		as:     assembler.NewClusterLvAssembler(),
-		cs:     service.NewClusterLvService(),
+		lvRepo:    lv.GetLvRepository(),
+		fenceRepo: lv.GetFenceHistoryRepository(),
+		as:        assembler.NewClusterLvAssembler(),
+		cs:        service.NewClusterLvService(),
 	}
 	return clusterLvController
 }
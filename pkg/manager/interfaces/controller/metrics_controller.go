@@ -0,0 +1,51 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"polardb-sms/pkg/manager/application/service"
+)
+
+//MetricsWriter writes its metrics in the prometheus text format
+type MetricsWriter interface {
+	WriteMetrics(w io.Writer)
+}
+
+type MetricsController struct {
+	writers []MetricsWriter
+}
+
+func NewMetricsController() *MetricsController {
+	return &MetricsController{writers: []MetricsWriter{service.GetPrReconciler()}}
+}
+
+// @Summary Metrics
+// @Tags Metrics
+// @version 1.0
+// @Description prometheus格式的监控指标
+// @Produce  plain
+// @Success 200 string string 成功后返回值
+// @Router /metrics [get]
+func (c *MetricsController) Metrics(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/plain; version=0.0.4")
+	ctx.Status(http.StatusOK)
+	for _, w := range c.writers {
+		w.WriteMetrics(ctx.Writer)
+	}
+}
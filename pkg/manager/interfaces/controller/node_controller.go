@@ -0,0 +1,112 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/application/service"
+	"polardb-sms/pkg/manager/application/view"
+)
+
+type NodeController struct {
+	fs *service.NodeFenceService
+}
+
+func NewNodeController() *NodeController {
+	return &NodeController{fs: service.NewNodeFenceService()}
+}
+
+// @Summary Fence Node
+// @Tags Node 管理
+// @version 1.0
+// @Description 隔离疑似宕机的节点: 由健康节点对该节点注册的所有使用中卷发起PREEMPT AND ABORT, 移除其注册, 该节点为写节点时由接管节点获得写锁, 在解除隔离前该节点不能再注册
+// @Accept  json
+// @Produce  json
+// @Param id path string true "node id"
+// @Param fenceReq body view.NodeFenceRequest false "请求参数"
+// @Success 200 object view.NodeFenceResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /nodes/:id/fence [post]
+func (c *NodeController) FenceNode(ctx *gin.Context) {
+	smslog.Info("call FenceNode")
+	nodeId := ctx.Param("id")
+	var req view.NodeFenceRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ParseParam(ctx, &req); err != nil {
+			smslog.Errorf("Could not parse node fence request %v: %v", req, err)
+			ReturnError(ctx, err)
+			return
+		}
+	}
+	resp, err := c.fs.Fence(GetTraceContextFromHeader(ctx), nodeId, &req)
+	if err != nil {
+		smslog.Errorf("Could not fence node %s: %v", nodeId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// @Summary Unfence Node
+// @Tags Node 管理
+// @version 1.0
+// @Description 解除节点隔离, 之后的加锁流程可以再次注册该节点
+// @Produce  json
+// @Param id path string true "node id"
+// @Success 200 object view.BoolResult 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /nodes/:id/unfence [post]
+func (c *NodeController) UnfenceNode(ctx *gin.Context) {
+	smslog.Info("call UnfenceNode")
+	nodeId := ctx.Param("id")
+	if err := c.fs.Unfence(nodeId); err != nil {
+		smslog.Errorf("Could not unfence node %s: %v", nodeId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ReturnBool(ctx, true)
+}
+
+// @Summary Query Node Fence History
+// @Tags Node 管理
+// @version 1.0
+// @Description 查询节点的隔离和解除隔离记录, 最新的在前
+// @Produce  json
+// @Param id path string true "node id"
+// @Success 200 array prkey.NodeFenceRecordEntity 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /nodes/:id/fences [get]
+func (c *NodeController) QueryNodeFenceHistory(ctx *gin.Context) {
+	smslog.Info("call QueryNodeFenceHistory")
+	nodeId := ctx.Param("id")
+	if nodeId == "" {
+		err := fmt.Errorf("request param not exist node id")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	records, err := c.fs.QueryFenceHistory(nodeId)
+	if err != nil {
+		smslog.Errorf("Could not query fence history of node %s: %v", nodeId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, records)
+}
@@ -123,3 +123,50 @@ func (c *PrCheckController) CheckOverallCapabilities(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, ret)
 }
+
+// @Summary Pr Capability Profile Probe
+// @Tags PR Check 接入管理
+// @version 1.0
+// @Description 用于在空闲 LUN 的每条路径上执行完整 PR 命令序列，生成并保存该阵列型号的 PR 兼容性档案
+// @Accept  json
+// @Produce  json
+// @Param capabilityReq body view.PrCapabilityRequest true "请求参数"
+// @Success 200 object prcap.PrCapabilityProfileEntity 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /pr-check/capability [post]
+func (c *PrCheckController) CheckCapability(ctx *gin.Context) {
+	smslog.Infof("call CheckCapability")
+	var request view.PrCapabilityRequest
+	if err := ParseParam(ctx, &request); err != nil {
+		smslog.Errorf("Cloud not parse pr capability request %v: %v", request, err)
+		ReturnError(ctx, err)
+		return
+	}
+	profile, err := c.cs.CheckCapability(&request)
+	if err != nil {
+		smslog.Errorf("Could not probe pr capability for %v: %v", request, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, profile)
+}
+
+// @Summary Pr Capability Profiles
+// @Tags PR Check 接入管理
+// @version 1.0
+// @Description 用于查询已保存的各阵列型号 PR 兼容性档案
+// @Accept  json
+// @Produce  json
+// @Success 200 array prcap.PrCapabilityProfileEntity 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /pr-check/profiles [get]
+func (c *PrCheckController) QueryCapabilityProfiles(ctx *gin.Context) {
+	profiles, err := c.cs.QueryCapabilityProfiles()
+	if err != nil {
+		smslog.Errorf("Could not query pr capability profiles: %v", err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, profiles)
+}
@@ -0,0 +1,100 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/application/service"
+	"polardb-sms/pkg/manager/application/view"
+)
+
+type PrDriftController struct {
+	r *service.PrReconciler
+}
+
+func NewPrDriftController() *PrDriftController {
+	return &PrDriftController{r: service.GetPrReconciler()}
+}
+
+// @Summary Query Pr Drift
+// @Tags PR Check 接入管理
+// @version 1.0
+// @Description 查询最近一次PR状态巡检发现的与数据库记录不一致的情况
+// @Produce  json
+// @Success 200 object view.PrDriftReport 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /pr-drift [get]
+func (c *PrDriftController) QueryPrDrift(ctx *gin.Context) {
+	report := c.r.LastReport()
+	if report == nil {
+		err := fmt.Errorf("pr state is not reconciled yet")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+// @Summary Reconcile Pr
+// @Tags PR Check 接入管理
+// @version 1.0
+// @Description 立即巡检使用中卷的PR状态, repair为true时对不一致的卷提交PREEMPT修复流程
+// @Accept  json
+// @Produce  json
+// @Param reconcileReq body view.PrReconcileRequest true "请求参数"
+// @Success 200 object view.PrDriftReport 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /pr-drift/reconcile [post]
+func (c *PrDriftController) ReconcilePr(ctx *gin.Context) {
+	smslog.Infof("call ReconcilePr")
+	var req view.PrReconcileRequest
+	if err := ParseParam(ctx, &req); err != nil {
+		smslog.Errorf("Could not parse pr reconcile request %v: %v", req, err)
+		ReturnError(ctx, err)
+		return
+	}
+	report, err := c.r.Reconcile(req.Repair)
+	if err != nil {
+		smslog.Errorf("Could not reconcile pr: %v", err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+// @Summary Restore Pr
+// @Tags PR Check 接入管理
+// @version 1.0
+// @Description 存储阵列重启后调用, 对丢失注册或预留的卷由数据库记录的写节点重新注册并预留
+// @Produce  json
+// @Success 200 object view.PrDriftReport 成功后返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /pr-drift/restore [post]
+func (c *PrDriftController) RestorePr(ctx *gin.Context) {
+	smslog.Infof("call RestorePr")
+	report, err := c.r.Restore()
+	if err != nil {
+		smslog.Errorf("Could not restore pr: %v", err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
@@ -17,17 +17,143 @@ package controller
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/application/assembler"
+	"polardb-sms/pkg/manager/application/service"
+	"polardb-sms/pkg/manager/application/view"
 	"polardb-sms/pkg/manager/domain/workflow"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+//keep the idle event streams alive through the proxies
+const eventKeepaliveInterval = 15 * time.Second
+
 type WorkflowController struct {
-	workflowRepo workflow.WorkflowRepository
-	as           assembler.WorkflowAssembler
+	workflowRepo    workflow.WorkflowRepository
+	workflowService *service.WorkflowService
+	as              assembler.WorkflowAssembler
+}
+
+// @Summary 分页查询 WorkflowEntity
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 按类型、状态、卷ID、创建时间范围分页查询 WorkflowEntity
+// @Accept  json
+// @Produce  json
+// @Param page_num query int false "页码, 从0开始"
+// @Param page_size query int false "每页数量, 默认20, 最大100"
+// @Param type query int false "workflow 类型"
+// @Param status query int false "workflow 状态"
+// @Param volume_id query string false "卷ID"
+// @Param start_time query int false "创建时间起始, unix 秒"
+// @Param end_time query int false "创建时间截止, unix 秒"
+// @Success 200 object view.WorkflowListResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /workflows [get]
+func (controller *WorkflowController) QueryWorkflows(ctx *gin.Context) {
+	smslog.Infof("call QueryWorkflows")
+
+	var req = view.WorkflowQueryRequest{}
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		smslog.Errorf("Could not parse query param: %v", err)
+		ctx.JSON(http.StatusBadRequest, view.ErrorResult{Err: err.Error()})
+		return
+	}
+	resp, err := controller.workflowService.QueryWorkflows(&req)
+	if err != nil {
+		smslog.Errorf("Could not query workflows by %v: %v", req, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// @Summary 查询卷上的 workflow 队列
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 同一个卷上的 workflow 串行执行, 用于查询正在执行及排队中的 workflow
+// @Accept  json
+// @Produce  json
+// @Param volume_id query string false "卷ID, 为空时返回所有有 workflow 的卷"
+// @Success 200 {array} view.VolumeWorkflowQueueResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /workflow-queues [get]
+func (controller *WorkflowController) QueryWorkflowQueues(ctx *gin.Context) {
+	smslog.Infof("call QueryWorkflowQueues")
+
+	volumeId := ctx.Query("volume_id")
+	resp, err := controller.workflowService.QueryVolumeQueues(volumeId)
+	if err != nil {
+		smslog.Errorf("Could not query workflow queues of volume [%s]: %v", volumeId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// @Summary 取消 WorkflowEntity
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 在下一个 stage 开始前停止运行中的 workflow 并回滚
+// @Accept  json
+// @Produce  json
+// @Param workflowId path string true "workflow ID"
+// @Success 200 object view.WorkflowIdResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /workflows/:workflowId/cancel [post]
+func (controller *WorkflowController) CancelWorkflow(ctx *gin.Context) {
+	smslog.Infof("call CancelWorkflow")
+
+	workflowId, exist := ctx.Params.Get("workflowId")
+	if !exist {
+		err := fmt.Errorf("request param not exist workflowId")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	if err := controller.workflowService.CancelWorkflow(workflowId); err != nil {
+		smslog.Errorf("Could not cancel workflow %s: %v", workflowId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, view.WorkflowIdResponse{WorkflowId: workflowId})
+}
+
+// @Summary 重试 WorkflowEntity
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 从失败的 stage 开始重新提交失败的 workflow, 返回新的 workflow ID
+// @Accept  json
+// @Produce  json
+// @Param workflowId path string true "workflow ID"
+// @Success 200 object view.WorkflowIdResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /workflows/:workflowId/retry [post]
+func (controller *WorkflowController) RetryWorkflow(ctx *gin.Context) {
+	smslog.Infof("call RetryWorkflow")
+
+	workflowId, exist := ctx.Params.Get("workflowId")
+	if !exist {
+		err := fmt.Errorf("request param not exist workflowId")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	resp, err := controller.workflowService.RetryWorkflow(workflowId)
+	if err != nil {
+		smslog.Errorf("Could not retry workflow %s: %v", workflowId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
 }
 
 // @Summary 查询 WorkflowEntity
@@ -61,10 +187,128 @@ func (controller *WorkflowController) FindWorkflowById(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resp)
 }
 
+// @Summary 查询已归档的 WorkflowEntity
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 已结束的 workflow 按保留策略归档后, 用于查询归档的 workflow
+// @Accept  json
+// @Produce  json
+// @Param workflowId path string true "workflow ID"
+// @Success 200 object view.WorkflowResponse 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /workflow-archives/:workflowId [get]
+func (controller *WorkflowController) FindArchivedWorkflow(ctx *gin.Context) {
+	smslog.Infof("call FindArchivedWorkflow")
+
+	workflowId, exist := ctx.Params.Get("workflowId")
+	if !exist {
+		err := fmt.Errorf("request param not exist workflowId")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	resp, err := controller.workflowService.FindArchivedWorkflow(workflowId)
+	if err != nil {
+		smslog.Errorf("Could not query archived workflow by %s: %v", workflowId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// @Summary 订阅 WorkflowEntity 事件
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 以 Server-Sent Events 推送 workflow 的 stage-started, stage-finished, rollback, workflow-finished 事件, workflow 结束后关闭
+// @Produce  text/event-stream
+// @Param workflowId path string true "workflow ID"
+// @Success 200 object workflow.WorkflowEvent 成功后返回值
+// @Failure 400 object view.ErrorResult 参数异常返回值
+// @Failure 500 object view.ErrorResult 服务异常返回值
+// @Router /workflows/:workflowId/events [get]
+func (controller *WorkflowController) WatchWorkflowEvents(ctx *gin.Context) {
+	smslog.Infof("call WatchWorkflowEvents")
+
+	workflowId, exist := ctx.Params.Get("workflowId")
+	if !exist {
+		err := fmt.Errorf("request param not exist workflowId")
+		smslog.Errorf(err.Error())
+		ReturnError(ctx, err)
+		return
+	}
+	//subscribe before loading the workflow, so that the finish event is not missed
+	events, unsubscribe := workflow.GetWorkflowEventBroker().Subscribe(workflowId)
+	defer unsubscribe()
+	wfl, err := controller.workflowRepo.FindByWorkflowId(workflowId)
+	if err != nil {
+		smslog.Errorf("Could not query workflow by %s: %v", workflowId, err)
+		ReturnError(ctx, err)
+		return
+	}
+	if wfl.IsFinished() {
+		ctx.SSEvent(string(workflow.WorkflowFinished), workflow.NewWorkflowEvent(workflow.WorkflowFinished, wfl))
+		return
+	}
+	//the finish event may be dropped for the slow subscriber, so the status is also checked on every keepalive
+	streamWorkflowEvents(ctx, events, func() *workflow.WorkflowEntity {
+		latest, err := controller.workflowRepo.FindByWorkflowId(workflowId)
+		if err != nil || !latest.IsFinished() {
+			return nil
+		}
+		return latest
+	})
+}
+
+// @Summary 订阅所有 WorkflowEntity 事件
+// @Tags Workflow 管理
+// @version 1.0
+// @Description 以 Server-Sent Events 推送本 manager 上所有 workflow 的事件
+// @Produce  text/event-stream
+// @Success 200 object workflow.WorkflowEvent 成功后返回值
+// @Router /events/workflows [get]
+func (controller *WorkflowController) WatchAllWorkflowEvents(ctx *gin.Context) {
+	smslog.Infof("call WatchAllWorkflowEvents")
+
+	events, unsubscribe := workflow.GetWorkflowEventBroker().Subscribe("")
+	defer unsubscribe()
+	streamWorkflowEvents(ctx, events, nil)
+}
+
+//streamWorkflowEvents streams the events until the client leaves, or until the workflow finishes if finished is set.
+//finished returns the workflow once it is finished, or nil
+func streamWorkflowEvents(ctx *gin.Context, events <-chan *workflow.WorkflowEvent, finished func() *workflow.WorkflowEntity) {
+	untilFinished := finished != nil
+	ticker := time.NewTicker(eventKeepaliveInterval)
+	defer ticker.Stop()
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			if untilFinished {
+				if wfl := finished(); wfl != nil {
+					ctx.SSEvent(string(workflow.WorkflowFinished), workflow.NewWorkflowEvent(workflow.WorkflowFinished, wfl))
+					return false
+				}
+			}
+			ctx.SSEvent("ping", "")
+			return true
+		case e, ok := <-events:
+			if !ok {
+				return false
+			}
+			ctx.SSEvent(string(e.Type), e)
+			return !(untilFinished && e.Type == workflow.WorkflowFinished)
+		}
+	})
+}
+
 func NewClusterTaskController() *WorkflowController {
 	clusterTaskController := &WorkflowController{
-		workflowRepo: workflow.NewWorkflowRepository(),
-		as:           assembler.NewWorkflowAssembler(),
+		workflowRepo:    workflow.NewWorkflowRepository(),
+		workflowService: service.NewWorkflowService(),
+		as:              assembler.NewWorkflowAssembler(),
 	}
 	return clusterTaskController
 }
@@ -83,9 +83,12 @@ func registerRoutes() {
 	router.POST("/cluster-lvs", clusterLvController.CreateClusterLv)
 	router.GET("/cluster-lvs", clusterLvController.QueryClusterLvs)
 	router.GET("/cluster-lvs/:name", clusterLvController.SearchClusterLv)
+	router.GET("/cluster-lvs/:name/fences", clusterLvController.QueryFenceHistory)
 	router.POST("/cluster-lvs/format", clusterLvController.FormatClusterLv)
 	router.POST("/cluster-lvs/expand", clusterLvController.ExpandClusterLv)
 	router.POST("/cluster-lvs/fs-expand", clusterLvController.ExpandClusterLvForFs)
+	router.POST("/cluster-lvs/aptpl", clusterLvController.SetClusterLvAptpl)
+	router.POST("/cluster-lvs/reserve-type", clusterLvController.SetClusterLvReserveType)
 	router.DELETE("/cluster-lvs/:name", clusterLvController.DeleteClusterLv)
 
 	eventController := controller.NewEventController()
@@ -96,12 +99,34 @@ func registerRoutes() {
 	router.POST("/scsi/rescan", volumeController.Rescan)
 
 	clusterTaskController := controller.NewClusterTaskController()
+	router.GET("/workflows", clusterTaskController.QueryWorkflows)
 	router.GET("/workflows/:workflowId", clusterTaskController.FindWorkflowById)
+	router.POST("/workflows/:workflowId/cancel", clusterTaskController.CancelWorkflow)
+	router.POST("/workflows/:workflowId/retry", clusterTaskController.RetryWorkflow)
+	router.GET("/workflows/:workflowId/events", clusterTaskController.WatchWorkflowEvents)
+	router.GET("/events/workflows", clusterTaskController.WatchAllWorkflowEvents)
+	router.GET("/workflow-queues", clusterTaskController.QueryWorkflowQueues)
+	router.GET("/workflow-archives/:workflowId", clusterTaskController.FindArchivedWorkflow)
 
 	prCheckController := controller.NewPrCheckController()
 	router.POST("/pr-check/overall", prCheckController.CheckOverallCapabilities)
 	router.POST("/pr-check/detail", prCheckController.CheckDetailCapabilities)
 	router.GET("/pr-check/detail", prCheckController.QueryDetailCapabilities)
+	router.POST("/pr-check/capability", prCheckController.CheckCapability)
+	router.GET("/pr-check/profiles", prCheckController.QueryCapabilityProfiles)
+
+	prDriftController := controller.NewPrDriftController()
+	router.GET("/pr-drift", prDriftController.QueryPrDrift)
+	router.POST("/pr-drift/reconcile", prDriftController.ReconcilePr)
+	router.POST("/pr-drift/restore", prDriftController.RestorePr)
+
+	metricsController := controller.NewMetricsController()
+	router.GET("/metrics", metricsController.Metrics)
+
+	nodeController := controller.NewNodeController()
+	router.POST("/nodes/:id/fence", nodeController.FenceNode)
+	router.POST("/nodes/:id/unfence", nodeController.UnfenceNode)
+	router.GET("/nodes/:id/fences", nodeController.QueryNodeFenceHistory)
 
 	pvcController := controller.NewPvcController()
 	router.GET("/pvcs", pvcController.QueryPvcs)
@@ -132,6 +157,8 @@ func registerRoutes() {
 
 	agentController := controller.NewAgentController()
 	router.POST("/agent/heartbeat", agentController.Heartbeat)
+	router.GET("/agents", agentController.QueryAgents)
+	router.GET("/agents/:id", agentController.SearchAgent)
 
 	dmController := controller.NewDeviceMapperController()
 	router.POST("/cluster-lvs/dm-conf", dmController.GeneratePreviewConf)
@@ -0,0 +1,56 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package msgserver
+
+import (
+	"errors"
+	"time"
+)
+
+type AgentState string
+
+const (
+	AgentConnecting   AgentState = "connecting"
+	AgentConnected    AgentState = "connected"
+	AgentDisconnected AgentState = "disconnected"
+)
+
+const (
+	PingInterval = 10 * time.Second
+	PingTimeout  = 5 * time.Second
+	//MaxPingFailures in a row closes the connection, the agent host is likely gone without a FIN
+	MaxPingFailures = 3
+)
+
+var ErrAgentDisconnected = errors.New("agent is disconnected")
+
+//AgentStatus is a snapshot of the connection to one agent
+type AgentStatus struct {
+	NodeId string
+	Addr   string
+	State  AgentState
+	//Since is when the agent entered the State
+	Since        time.Time
+	FrameVersion byte
+	//Rtt is measured by the last answered ping
+	Rtt          time.Duration
+	LastPing     time.Time
+	PingFailures int
+	LastError    string
+	LastErrorAt  time.Time
+	InFlight     int
+	Reconnects   int
+}
@@ -16,12 +16,12 @@
 package msgserver
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"net"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/network"
+	"sync"
 	"time"
 
 	"polardb-sms/pkg/network/message"
@@ -39,14 +39,26 @@ type SmsClient struct {
 	conn   *network.SmsConnection
 	RecvCh chan *message.SmsMessage
 	SendCh chan *message.SmsMessage
-	ready  bool
+	//reloader is nil for the plain tcp
+	reloader *network.CertReloader
+	lock     sync.Mutex
+	status   AgentStatus
+	//legacy is set once the agent does not answer hello, the connections after it skip the hello
+	legacy bool
 }
 
-func NewClient(conf *network.SmsServerConfig, ch chan *message.SmsMessage) *SmsClient {
+func NewClient(nodeId string, conf *network.SmsServerConfig, ch chan *message.SmsMessage, reloader *network.CertReloader) *SmsClient {
 	return &SmsClient{
 		SmsServerConfig: *conf,
 		RecvCh:          ch,
 		SendCh:          make(chan *message.SmsMessage),
+		reloader:        reloader,
+		status: AgentStatus{
+			NodeId: nodeId,
+			Addr:   conf.Ip + ":" + conf.Port,
+			State:  AgentDisconnected,
+			Since:  time.Now(),
+		},
 	}
 }
 
@@ -57,7 +69,68 @@ func (c *SmsClient) Run() {
 	go c.receive()
 	go c.send()
 	smslog.Infof("request started %s:%s", c.Ip, c.Port)
-	c.ready = true
+}
+
+func (c *SmsClient) Status() AgentStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.status
+}
+
+func (c *SmsClient) Connected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.status.State == AgentConnected
+}
+
+func (c *SmsClient) setState(state AgentState) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.status.State == state {
+		return
+	}
+	if state == AgentConnecting && c.status.State == AgentConnected {
+		c.status.Reconnects++
+	}
+	c.status.State = state
+	c.status.Since = time.Now()
+	smslog.Infof("agent %s %s is %s", c.status.NodeId, c.String(), state)
+}
+
+func (c *SmsClient) recordError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.status.LastError = err.Error()
+	c.status.LastErrorAt = time.Now()
+}
+
+func (c *SmsClient) addInFlight(delta int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.status.InFlight += delta
+}
+
+//recordPing closes the connection after MaxPingFailures, unless the agent predates the ping handler,
+//such a legacy agent never answers and is only tracked by the tcp connection
+func (c *SmsClient) recordPing(rtt time.Duration, err error) {
+	c.lock.Lock()
+	c.status.LastPing = time.Now()
+	if err == nil {
+		c.status.Rtt = rtt
+		c.status.PingFailures = 0
+		c.lock.Unlock()
+		return
+	}
+	c.status.PingFailures++
+	c.status.LastError = fmt.Sprintf("ping: %v", err)
+	c.status.LastErrorAt = c.status.LastPing
+	broken := c.status.PingFailures >= MaxPingFailures && c.status.FrameVersion != network.FrameVersionLegacy
+	conn := c.conn
+	c.lock.Unlock()
+	if broken && conn != nil {
+		smslog.Errorf("agent %s %s misses %d pings, close the connection", c.status.NodeId, c.String(), MaxPingFailures)
+		conn.Close()
+	}
 }
 
 func (c *SmsClient) String() string {
@@ -87,7 +160,10 @@ func (c *SmsClient) receive() {
 			continue
 		}
 		smslog.Errorf("received message err %s", err.Error())
-		if err == io.EOF {
+		//a net error is a closed or reset connection as well, e.g. closed after the missed pings
+		if _, ok := err.(net.Error); ok || err == io.EOF {
+			c.recordError(err)
+			c.setState(AgentDisconnected)
 			c.reconnect()
 		}
 	}
@@ -95,38 +171,44 @@ func (c *SmsClient) receive() {
 
 func (c *SmsClient) reconnect() {
 	smslog.Infof("start to reconnect to %s", c.Ip)
+	//the agent may have been upgraded while disconnected
+	c.legacy = false
 	c.connect()
 }
 
 func (c *SmsClient) connect() {
 	connFun := func() error {
-		tcpAddr, err := net.ResolveTCPAddr("tcp4", c.Ip+":"+c.Port)
+		addr := c.Ip + ":" + c.Port
+		conn, err := network.Dial(addr, c.reloader)
 		if err != nil {
-			smslog.Fatalf("Invalid tcp address for response : %s:%s, err %v", c.Ip, c.Port, err)
+			smslog.Errorf("could not dial %s for response: %v", addr, err)
+			c.recordError(err)
 			return err
 		}
-		conn, err := net.DialTCP("tcp", nil, tcpAddr)
-		if err != nil {
-			smslog.Errorf("could not dial TCP %s for response: %v", tcpAddr, err)
+		smslog.Infof("connecting dial %s for response, tls %v", addr, c.reloader != nil)
+
+		smsConn := network.NewSmsConnection(conn)
+		if c.legacy {
+			smslog.Infof("%s does not answer hello, keep the legacy frame", addr)
+		} else if err = smsConn.Negotiate(network.NegotiateTimeout); err != nil {
+			smslog.Errorf("could not negotiate frame version with %s: %v", addr, err)
+			smsConn.Close()
+			c.recordError(err)
+			c.legacy = err == network.ErrNegotiateTimeout
 			return err
 		}
-		smslog.Infof("connecting dial TCP %s for response", tcpAddr)
-
-		_ = conn.SetKeepAlive(true)
 		if c.conn != nil {
 			c.conn.Close()
 		}
-		c.conn = &network.SmsConnection{
-			Conn: conn,
-			Receiver: &network.SmsMessageReceiver{
-				Reader: bufio.NewReader(conn),
-			},
-			Sender: &network.SmsMessageSender{
-				Writer: bufio.NewWriter(conn),
-			},
-		}
+		c.lock.Lock()
+		c.conn = smsConn
+		c.status.FrameVersion = smsConn.FrameVersion()
+		c.status.PingFailures = 0
+		c.lock.Unlock()
+		c.setState(AgentConnected)
 		return nil
 	}
+	c.setState(AgentConnecting)
 	sleepTime := SleepBase
 	for {
 		err := connFun()
@@ -0,0 +1,100 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package msgserver
+
+import (
+	"errors"
+	"net"
+	smslog "polardb-sms/pkg/log"
+	"polardb-sms/pkg/manager/msgserver/handler"
+	"polardb-sms/pkg/network"
+	"polardb-sms/pkg/network/message"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAgentStatus(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	testCase := assert.New(t)
+
+	//a fake agent answering the pings
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	testCase.NoError(err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		agentConn := network.NewSmsConnection(conn)
+		for {
+			msg, err := agentConn.Receive()
+			if err != nil {
+				return
+			}
+			_ = agentConn.Send(message.SuccessRespMessage(message.SmsMessageHead_DUMMY_RESP, msg.Head.MsgId, nil))
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	s := &MessageServer{
+		msgService: handler.NewRespMsgHandleService(),
+		agentMap:   make(map[string]*SmsClient),
+		recvCh:     make(chan *message.SmsMessage),
+		correlator: network.NewCorrelator(),
+	}
+	s.agentMap["node1"] = NewClient("node1", &network.SmsServerConfig{Ip: "127.0.0.1", Port: port}, s.recvCh, nil)
+	s.agentMap["node2"] = NewClient("node2", &network.SmsServerConfig{Ip: "127.0.0.1", Port: "1"}, s.recvCh, nil)
+	go s.receive()
+
+	//the stage fails fast on the disconnected agent instead of waiting for the timeout
+	start := time.Now()
+	_, err = s.Request("node1", message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_DUMMY_REQ).Build(), time.Minute)
+	testCase.True(errors.Is(err, ErrAgentDisconnected))
+	testCase.True(time.Since(start) < time.Second)
+
+	s.agentMap["node1"].Run()
+	status, ok := s.AgentStatus("node1")
+	testCase.True(ok)
+	testCase.Equal(AgentConnected, status.State)
+	testCase.Equal(network.FrameVersionLatest, status.FrameVersion)
+
+	ping := message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_DUMMY_REQ).Build()
+	_, err = s.exchange(s.agentMap["node1"], ping, time.Second)
+	s.agentMap["node1"].recordPing(time.Millisecond, err)
+	testCase.NoError(err)
+	status, _ = s.AgentStatus("node1")
+	testCase.Equal(time.Millisecond, status.Rtt)
+	testCase.Equal(0, status.PingFailures)
+
+	//a legacy agent never answers the ping, it is not disconnected for that
+	legacy := s.agentMap["node2"]
+	legacy.setState(AgentConnected)
+	for i := 0; i < MaxPingFailures; i++ {
+		legacy.recordPing(0, network.ErrRequestTimeout)
+	}
+	status, _ = s.AgentStatus("node2")
+	testCase.Equal(MaxPingFailures, status.PingFailures)
+	testCase.Equal(AgentConnected, status.State)
+	testCase.Contains(status.LastError, "timeout")
+
+	statuses := s.AgentStatuses()
+	testCase.Len(statuses, 2)
+	testCase.Equal("node1", statuses[0].NodeId)
+}
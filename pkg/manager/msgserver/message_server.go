@@ -16,12 +16,14 @@
 package msgserver
 
 import (
+	"fmt"
 	smslog "polardb-sms/pkg/log"
 	"polardb-sms/pkg/manager/config"
 	"polardb-sms/pkg/manager/msgserver/handler"
 	"polardb-sms/pkg/network"
 	"polardb-sms/pkg/network/message"
-	"sync"
+	"sort"
+	"time"
 )
 
 type MessageServerConfig struct {
@@ -35,75 +37,133 @@ type MessageServer struct {
 	agentMap   map[string]*SmsClient
 	msgService *handler.RespMsgHandleService
 	recvCh     chan *message.SmsMessage
-	waitingMsg map[string]chan interface{}
-	sync.Mutex
+	correlator *network.Correlator
 }
 
-func NewMessageServer(agentMap map[string]config.Node) *MessageServer {
+//NewMessageServer connects to the agents with the mutual tls if config.TLSConf has the cert
+func NewMessageServer(agentMap map[string]config.Node) (*MessageServer, error) {
+	reloader, err := network.NewCertReloader(config.TLSConf)
+	if err != nil {
+		return nil, err
+	}
 	MsgServer = &MessageServer{
 		msgService: handler.NewRespMsgHandleService(),
 		agentMap:   make(map[string]*SmsClient),
-		waitingMsg: make(map[string]chan interface{}),
+		correlator: network.NewCorrelator(),
 		recvCh:     make(chan *message.SmsMessage),
 	}
 	for key, val := range agentMap {
-		MsgServer.agentMap[key] = NewClient(&network.SmsServerConfig{
+		MsgServer.agentMap[key] = NewClient(key, &network.SmsServerConfig{
 			Ip:   val.Ip,
 			Port: val.Port,
-		}, MsgServer.recvCh)
+		}, MsgServer.recvCh, reloader)
 	}
-	return MsgServer
+	return MsgServer, nil
 }
 
 func (s *MessageServer) Run() {
 	for name, c := range s.agentMap {
 		go c.Run()
+		go s.keepalive(c)
 		smslog.Infof("Connect to agent %s started", name)
 	}
 	go s.receive()
 }
 
-func (s *MessageServer) SendMessageTo(name string, msg *message.SmsMessage, ch chan interface{}) {
+//Request sends msg to the agent name and waits for the response until timeout,
+//the agent is told to abort the request once the manager gives up on it
+func (s *MessageServer) Request(name string, msg *message.SmsMessage, timeout time.Duration) (*message.MessageBody, error) {
 	c, ok := s.agentMap[name]
 	if !ok {
 		//TODO add new agent
 		smslog.WithContext(msg.Head.TraceContext).Errorf("can not find the agent client for %s, agentMap %v", name, s.agentMap)
+		return nil, fmt.Errorf("can not find the agent client for %s", name)
+	}
+	if !c.Connected() {
+		status := c.Status()
+		return nil, fmt.Errorf("%w: %s %s is %s since %s, last error: %s", ErrAgentDisconnected,
+			name, status.Addr, status.State, status.Since.Format(time.RFC3339), status.LastError)
+	}
+	c.addInFlight(1)
+	defer c.addInFlight(-1)
+	resp, err := s.exchange(c, msg, timeout)
+	if err != nil {
+		if err == network.ErrRequestTimeout {
+			s.cancel(c, msg)
+		}
+		return nil, err
+	}
+	return s.msgService.Handle(resp)
+}
+
+func (s *MessageServer) exchange(c *SmsClient, msg *message.SmsMessage, timeout time.Duration) (*message.SmsMessage, error) {
+	deadline := time.Now().Add(timeout)
+	message.SetTimeout(msg.Head, timeout)
+	ch := s.correlator.Register(msg.Head.MsgId)
+	select {
+	case c.SendCh <- msg:
+	case <-time.After(timeout):
+		s.correlator.Forget(msg.Head.MsgId)
+		return nil, network.ErrRequestTimeout
+	}
+	return s.correlator.Wait(msg.Head.MsgId, ch, deadline)
+}
+
+//keepalive measures the rtt with the application level ping, which also detects the half open connection
+func (s *MessageServer) keepalive(c *SmsClient) {
+	defer smslog.LogPanic()
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !c.Connected() {
+			continue
+		}
+		ping := message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_DUMMY_REQ).Build()
+		start := time.Now()
+		_, err := s.exchange(c, ping, PingTimeout)
+		c.recordPing(time.Since(start), err)
+	}
+}
+
+func (s *MessageServer) AgentStatus(name string) (AgentStatus, bool) {
+	c, ok := s.agentMap[name]
+	if !ok {
+		return AgentStatus{}, false
+	}
+	return c.Status(), true
+}
+
+func (s *MessageServer) AgentStatuses() []AgentStatus {
+	statuses := make([]AgentStatus, 0, len(s.agentMap))
+	for _, c := range s.agentMap {
+		statuses = append(statuses, c.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NodeId < statuses[j].NodeId
+	})
+	return statuses
+}
+
+func (s *MessageServer) cancel(c *SmsClient, msg *message.SmsMessage) {
+	cancelMsg, err := message.NewCancelMessage(msg.Head.MsgId, msg.Head.TraceContext)
+	if err != nil {
+		smslog.WithContext(msg.Head.TraceContext).Errorf("failed to build the cancel of msg %s: %v", msg.Head.MsgId, err)
 		return
 	}
-	s.Lock()
-	defer s.Unlock()
-	s.waitingMsg[msg.Head.MsgId] = ch
-	c.SendCh <- msg
+	select {
+	case c.SendCh <- cancelMsg:
+		smslog.WithContext(msg.Head.TraceContext).Infof("cancel msg %s sent to %s", msg.Head.MsgId, c.String())
+	case <-time.After(time.Second):
+		smslog.WithContext(msg.Head.TraceContext).Warnf("could not send the cancel of msg %s to %s", msg.Head.MsgId, c.String())
+	}
 }
 
 func (s *MessageServer) receive() {
 	defer smslog.LogPanic()
-	var sg sync.WaitGroup
 	for {
 		msg := <-s.recvCh
-		sg.Add(1)
-		go func() {
-			defer smslog.LogPanic()
-			defer sg.Done()
-			defer func() {
-				s.Lock()
-				delete(s.waitingMsg, msg.Head.AckMsgId)
-				s.Unlock()
-			}()
-
-			ch, ok := s.waitingMsg[msg.Head.AckMsgId]
-			if !ok {
-				smslog.WithContext(msg.Head.TraceContext).Errorf("received msg %v, but cannot find the callback", msg)
-				return
-			}
-			result, err := s.msgService.Handle(msg)
-			if err != nil {
-				smslog.WithContext(msg.Head.TraceContext).Errorf("handle msg error: %v", err)
-				return
-			}
-			ch <- result
-			smslog.Debugf("finished process msg %s", msg)
-		}()
-		sg.Wait()
+		if !s.correlator.Deliver(msg) {
+			smslog.WithContext(msg.Head.TraceContext).Warnf("drop the late response %s of msg %s", msg.Head.MsgId, msg.Head.AckMsgId)
+		}
 	}
 }
@@ -18,6 +18,7 @@ package network
 import (
 	"bufio"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"google.golang.org/protobuf/proto"
 	"io"
@@ -35,13 +36,53 @@ type SmsServerConfig struct {
 
 const (
 	SmsMessageEnd byte = 0x1d
+	//NegotiateTimeout bounds the wait for the hello answer of a peer
+	NegotiateTimeout = 3 * time.Second
 )
 
+//ErrNegotiateTimeout is returned when the peer does not answer hello in time, a legacy peer never does
+var ErrNegotiateTimeout = errors.New("hello is not answered")
+
 type SmsMessageReceiver struct {
 	Reader *bufio.Reader
+	//version is the negotiated frame version, legacy until the peer says hello
+	version byte
+}
+
+//receive returns the version negotiated by a hello frame instead of a message
+func (r *SmsMessageReceiver) receive() (*message.SmsMessage, byte, error) {
+	if r.version == FrameVersionLegacy {
+		prefix, err := r.Reader.Peek(len(FrameMagic))
+		if err != nil {
+			return nil, FrameVersionLegacy, err
+		}
+		if !IsFrameMagic(prefix) {
+			msg, err := r.receiveLegacy()
+			return msg, FrameVersionLegacy, err
+		}
+	}
+	header, payload, err := ReadFrame(r.Reader)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil, FrameVersionLegacy, err
+		}
+		//the stream can not be resynchronized after a broken frame, treat it as closed
+		smslog.Errorf("received frame err %s", err.Error())
+		return nil, FrameVersionLegacy, io.EOF
+	}
+	if header.Kind == FrameKindHello {
+		version, err := parseHello(payload)
+		return nil, version, err
+	}
+	msg := &message.SmsMessage{}
+	if err = proto.Unmarshal(payload, msg); err != nil {
+		smslog.Errorf("failed parse frame of %d bytes to message: %v", len(payload), err)
+		return nil, FrameVersionLegacy, err
+	}
+	return msg, FrameVersionLegacy, nil
 }
 
-func (r *SmsMessageReceiver) receive() (*message.SmsMessage, error) {
+func (r *SmsMessageReceiver) receiveLegacy() (*message.SmsMessage, error) {
 	msgLine, err := r.Reader.ReadString(SmsMessageEnd)
 	if err != nil {
 		smslog.Errorf("received message err %s", err.Error())
@@ -61,6 +102,8 @@ func (r *SmsMessageReceiver) receive() (*message.SmsMessage, error) {
 
 type SmsMessageSender struct {
 	Writer *bufio.Writer
+	//version is the negotiated frame version, legacy until the peer says hello
+	version byte
 }
 
 func (s *SmsMessageSender) Send(msg *message.SmsMessage) {
@@ -70,14 +113,24 @@ func (s *SmsMessageSender) Send(msg *message.SmsMessage) {
 		smslog.WithContext(msg.Head.TraceContext).Errorf("could not send message: %v", err)
 		return
 	}
-	sEnc := base64.StdEncoding.EncodeToString(output)
-	output = append([]byte(sEnc), SmsMessageEnd)
-	length, err := s.Writer.Write(output)
-	if err = s.Writer.Flush(); err != nil {
+	if s.version == FrameVersionLegacy {
+		sEnc := base64.StdEncoding.EncodeToString(output)
+		output = append([]byte(sEnc), SmsMessageEnd)
+	} else {
+		output = EncodeFrame(s.version, FrameKindMessage, output)
+	}
+	if err = s.write(output); err != nil {
 		smslog.WithContext(msg.Head.TraceContext).Errorf("could not write tcp: %v", err)
 		return
 	}
-	smslog.Infof("successfully send message: [%v], length: %d", msg, length)
+	smslog.Infof("successfully send message: [%v], length: %d", msg, len(output))
+}
+
+func (s *SmsMessageSender) write(data []byte) error {
+	if _, err := s.Writer.Write(data); err != nil {
+		return err
+	}
+	return s.Writer.Flush()
 }
 
 func Parse(line string) (*message.SmsMessage, error) {
@@ -104,8 +157,77 @@ type SmsConnection struct {
 	Sender   *SmsMessageSender
 }
 
+func NewSmsConnection(conn net.Conn) *SmsConnection {
+	return &SmsConnection{
+		Conn: conn,
+		Receiver: &SmsMessageReceiver{
+			Reader: bufio.NewReader(conn),
+		},
+		Sender: &SmsMessageSender{
+			Writer: bufio.NewWriter(conn),
+		},
+	}
+}
+
 func (c *SmsConnection) Receive() (*message.SmsMessage, error) {
-	return c.Receiver.receive()
+	for {
+		msg, version, err := c.Receiver.receive()
+		if err != nil || version == FrameVersionLegacy {
+			return msg, err
+		}
+		//the peer asks for the binary frame, answer with the version both sides speak
+		if err = c.acceptHello(version); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *SmsConnection) acceptHello(version byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.Sender.write(helloFrame(version)); err != nil {
+		return err
+	}
+	c.Receiver.version = version
+	c.Sender.version = version
+	smslog.Infof("conn %s switches to frame version %d", c.Conn.RemoteAddr().String(), version)
+	return nil
+}
+
+//Negotiate is called by the dialing side before any message. the connection must be closed on error,
+//for the answer may still come after the timeout, so dial again without hello to speak to a legacy peer
+func (c *SmsConnection) Negotiate(timeout time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.Sender.write(helloFrame(FrameVersionLatest)); err != nil {
+		return err
+	}
+	if err := c.Conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	}()
+	msg, version, err := c.Receiver.receive()
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return ErrNegotiateTimeout
+		}
+		return err
+	}
+	if msg != nil || version == FrameVersionLegacy {
+		return fmt.Errorf("unexpected message from %s before hello", c.Conn.RemoteAddr().String())
+	}
+	c.Receiver.version = version
+	c.Sender.version = version
+	smslog.Infof("conn %s negotiated frame version %d", c.Conn.RemoteAddr().String(), version)
+	return nil
+}
+
+func (c *SmsConnection) FrameVersion() byte {
+	c.Lock()
+	defer c.Unlock()
+	return c.Sender.version
 }
 
 func (c *SmsConnection) Send(msg *message.SmsMessage) error {
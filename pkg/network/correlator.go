@@ -0,0 +1,91 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package network
+
+import (
+	"errors"
+	"polardb-sms/pkg/network/message"
+	"sync"
+	"time"
+)
+
+var ErrRequestTimeout = errors.New("request timeout")
+
+//Correlator matches the responses with the requests by the ack msg id,
+//a response arriving after its request is forgotten is dropped instead of blocking the receiver
+type Correlator struct {
+	lock    sync.Mutex
+	pending map[string]chan *message.SmsMessage
+}
+
+func NewCorrelator() *Correlator {
+	return &Correlator{
+		pending: make(map[string]chan *message.SmsMessage),
+	}
+}
+
+//Register must be called before the request is sent, the channel never blocks the delivery
+func (c *Correlator) Register(msgId string) <-chan *message.SmsMessage {
+	ch := make(chan *message.SmsMessage, 1)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending[msgId] = ch
+	return ch
+}
+
+//Deliver returns false for a late response or the one nobody asked for
+func (c *Correlator) Deliver(resp *message.SmsMessage) bool {
+	c.lock.Lock()
+	ch, ok := c.pending[resp.Head.AckMsgId]
+	delete(c.pending, resp.Head.AckMsgId)
+	c.lock.Unlock()
+	if !ok {
+		return false
+	}
+	ch <- resp
+	return true
+}
+
+//Forget returns false if the response is already delivered
+func (c *Correlator) Forget(msgId string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.pending[msgId]
+	delete(c.pending, msgId)
+	return ok
+}
+
+//Wait blocks until the response of msgId or the deadline, the request is forgotten on timeout
+func (c *Correlator) Wait(msgId string, ch <-chan *message.SmsMessage, deadline time.Time) (*message.SmsMessage, error) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-timer.C:
+		if !c.Forget(msgId) {
+			//the response raced with the deadline and is already on its way
+			return <-ch, nil
+		}
+		return nil, ErrRequestTimeout
+	}
+}
+
+func (c *Correlator) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.pending)
+}
@@ -0,0 +1,65 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package network
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"polardb-sms/pkg/network/message"
+)
+
+func TestCorrelator(t *testing.T) {
+	testCase := assert.New(t)
+	c := NewCorrelator()
+
+	req := testMessage()
+	ch := c.Register(req.Head.MsgId)
+	resp := message.SuccessRespMessage(message.SmsMessageHead_CMD_DM_CREAT_RESP, req.Head.MsgId, nil)
+	testCase.True(c.Deliver(resp))
+	got, err := c.Wait(req.Head.MsgId, ch, time.Now().Add(time.Second))
+	testCase.NoError(err)
+	testCase.Equal(resp, got)
+	testCase.False(c.Deliver(resp))
+
+	//the late response is dropped without blocking the receiver
+	req = testMessage()
+	ch = c.Register(req.Head.MsgId)
+	_, err = c.Wait(req.Head.MsgId, ch, time.Now().Add(10*time.Millisecond))
+	testCase.Equal(ErrRequestTimeout, err)
+	testCase.False(c.Deliver(message.SuccessRespMessage(message.SmsMessageHead_CMD_DM_CREAT_RESP, req.Head.MsgId, nil)))
+	testCase.Equal(0, c.Pending())
+
+	//the response racing with the deadline is either returned or dropped, never lost halfway
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		req := testMessage()
+		ch := c.Register(req.Head.MsgId)
+		wg.Add(1)
+		var delivered bool
+		go func() {
+			defer wg.Done()
+			delivered = c.Deliver(message.SuccessRespMessage(message.SmsMessageHead_CMD_DM_CREAT_RESP, req.Head.MsgId, nil))
+		}()
+		got, err := c.Wait(req.Head.MsgId, ch, time.Now())
+		wg.Wait()
+		testCase.Equal(delivered, err == nil)
+		testCase.Equal(delivered, got != nil)
+	}
+	testCase.Equal(0, c.Pending())
+}
@@ -0,0 +1,141 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+//a binary frame is laid out as
+//  magic(2) | version(1) | kind(1) | length(4, big endian) | payload(length)
+//the first magic byte is never produced by base64, so the receiver tells it from a legacy message
+var FrameMagic = [2]byte{0xf5, 0x53}
+
+const (
+	//FrameVersionLegacy is the base64 text terminated by SmsMessageEnd
+	FrameVersionLegacy byte = 0
+	FrameVersion1      byte = 1
+	//FrameVersionLatest is the highest version this side speaks
+	FrameVersionLatest = FrameVersion1
+
+	FrameKindMessage byte = 0
+	//FrameKindHello negotiates the frame version on connect
+	FrameKindHello byte = 1
+
+	FrameHeaderLen = 8
+	MaxFrameLen    = 64 << 20
+)
+
+type FrameHeader struct {
+	Version byte
+	Kind    byte
+	Length  uint32
+}
+
+func EncodeFrame(version, kind byte, payload []byte) []byte {
+	frame := make([]byte, FrameHeaderLen+len(payload))
+	copy(frame, FrameMagic[:])
+	frame[2] = version
+	frame[3] = kind
+	binary.BigEndian.PutUint32(frame[4:FrameHeaderLen], uint32(len(payload)))
+	copy(frame[FrameHeaderLen:], payload)
+	return frame
+}
+
+//hello is always framed as version 1 and carries the highest version of the sender,
+//it ends with SmsMessageEnd, so a legacy agent drops it as one undecodable message
+func helloFrame(version byte) []byte {
+	return EncodeFrame(FrameVersion1, FrameKindHello, []byte{version, SmsMessageEnd})
+}
+
+func parseHello(payload []byte) (byte, error) {
+	if len(payload) == 0 || payload[0] == FrameVersionLegacy {
+		return FrameVersionLegacy, fmt.Errorf("invalid hello %x", payload)
+	}
+	return NegotiateVersion(payload[0]), nil
+}
+
+func IsFrameMagic(prefix []byte) bool {
+	return len(prefix) >= len(FrameMagic) && bytes.Equal(prefix[:len(FrameMagic)], FrameMagic[:])
+}
+
+func DecodeFrameHeader(data []byte) (*FrameHeader, error) {
+	if len(data) < FrameHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if !IsFrameMagic(data) {
+		return nil, fmt.Errorf("invalid frame magic %x", data[:len(FrameMagic)])
+	}
+	header := &FrameHeader{
+		Version: data[2],
+		Kind:    data[3],
+		Length:  binary.BigEndian.Uint32(data[4:FrameHeaderLen]),
+	}
+	if header.Version == FrameVersionLegacy || header.Version > FrameVersionLatest {
+		return nil, fmt.Errorf("unsupported frame version %d", header.Version)
+	}
+	if header.Kind != FrameKindMessage && header.Kind != FrameKindHello {
+		return nil, fmt.Errorf("unknown frame kind %d", header.Kind)
+	}
+	if header.Length > MaxFrameLen {
+		return nil, fmt.Errorf("frame length %d exceeds %d", header.Length, MaxFrameLen)
+	}
+	return header, nil
+}
+
+//DecodeFrame decodes the first frame in data and returns the bytes consumed
+func DecodeFrame(data []byte) (*FrameHeader, []byte, int, error) {
+	header, err := DecodeFrameHeader(data)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	end := FrameHeaderLen + int(header.Length)
+	if len(data) < end {
+		return nil, nil, 0, io.ErrUnexpectedEOF
+	}
+	return header, data[FrameHeaderLen:end], end, nil
+}
+
+//ReadFrame blocks until a whole frame is read, a short read never yields a partial payload
+func ReadFrame(r io.Reader) (*FrameHeader, []byte, error) {
+	headerBuf := make([]byte, FrameHeaderLen)
+	if _, err := io.ReadFull(r, headerBuf); err != nil {
+		return nil, nil, err
+	}
+	header, err := DecodeFrameHeader(headerBuf)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := make([]byte, header.Length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
+
+//NegotiateVersion picks the frame version both sides speak
+func NegotiateVersion(peer byte) byte {
+	if peer > FrameVersionLatest {
+		return FrameVersionLatest
+	}
+	return peer
+}
@@ -0,0 +1,82 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	smslog "polardb-sms/pkg/log"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func FuzzDecodeFrame(f *testing.F) {
+	f.Add(EncodeFrame(FrameVersion1, FrameKindMessage, []byte("payload")))
+	f.Add(helloFrame(FrameVersionLatest))
+	f.Add(EncodeFrame(FrameVersion1, FrameKindMessage, nil)[:FrameHeaderLen-1])
+	f.Add([]byte{0xf5, 0x53, 0x01, 0x00, 0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, payload, n, err := DecodeFrame(data)
+		if err != nil {
+			if n != 0 || payload != nil {
+				t.Fatalf("consumed %d bytes of a bad frame", n)
+			}
+			return
+		}
+		if n != FrameHeaderLen+len(payload) || int(header.Length) != len(payload) {
+			t.Fatalf("frame length %d mismatches payload %d consumed %d", header.Length, len(payload), n)
+		}
+		if !bytes.Equal(EncodeFrame(header.Version, header.Kind, payload), data[:n]) {
+			t.Fatalf("frame %x is not encoded back", data[:n])
+		}
+		readHeader, readPayload, err := ReadFrame(bytes.NewReader(data))
+		if err != nil || *readHeader != *header || !bytes.Equal(readPayload, payload) {
+			t.Fatalf("read frame mismatches decoded one: %v", err)
+		}
+	})
+}
+
+func FuzzReceive(f *testing.F) {
+	smslog.InitLogger(f.TempDir(), "test.log", zapcore.DebugLevel)
+	msg := testMessage()
+	legacy := &bytes.Buffer{}
+	sender := &SmsMessageSender{Writer: bufio.NewWriter(legacy)}
+	sender.Send(msg)
+	binary := &bytes.Buffer{}
+	sender = &SmsMessageSender{Writer: bufio.NewWriter(binary), version: FrameVersion1}
+	sender.Send(msg)
+	f.Add(legacy.Bytes(), false)
+	f.Add(binary.Bytes(), true)
+	f.Add(helloFrame(FrameVersionLatest), false)
+	f.Fuzz(func(t *testing.T, data []byte, framed bool) {
+		receiver := &SmsMessageReceiver{Reader: bufio.NewReader(bytes.NewReader(data))}
+		if framed {
+			receiver.version = FrameVersion1
+		}
+		//every call consumes the stream, so the decoder reaches the end whatever it is fed
+		for i := 0; i <= len(data); i++ {
+			if _, _, err := receiver.receive(); err == io.EOF {
+				return
+			}
+		}
+		t.Fatalf("receiver does not stop on %x", data)
+	})
+}
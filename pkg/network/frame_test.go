@@ -0,0 +1,161 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	smslog "polardb-sms/pkg/log"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/proto"
+	"polardb-sms/pkg/network/message"
+)
+
+func testMessage() *message.SmsMessage {
+	return message.NewSmsMessageBuilder().
+		WithType(message.SmsMessageHead_CMD_DM_CREAT_REQ).
+		WithContent([]byte(`{"dm_lines":"0 1048576 linear /dev/loop0 8"}`)).
+		Build()
+}
+
+func TestFrame(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	testCase := assert.New(t)
+	payload := []byte{0x1d, 0x0a, 0x00, 0xff}
+	frame := EncodeFrame(FrameVersion1, FrameKindMessage, payload)
+	testCase.Len(frame, FrameHeaderLen+len(payload))
+
+	//a reader handing out one byte at a time never yields a partial frame
+	header, got, err := ReadFrame(iotest.OneByteReader(bytes.NewReader(append(frame, frame...))))
+	testCase.NoError(err)
+	testCase.Equal(FrameKindMessage, header.Kind)
+	testCase.Equal(payload, got)
+
+	_, _, err = ReadFrame(bytes.NewReader(frame[:len(frame)-1]))
+	testCase.Equal(io.ErrUnexpectedEOF, err)
+	_, _, n, err := DecodeFrame(frame[:FrameHeaderLen])
+	testCase.Equal(io.ErrUnexpectedEOF, err)
+	testCase.Equal(0, n)
+
+	tooLarge := EncodeFrame(FrameVersion1, FrameKindMessage, nil)
+	tooLarge[4] = 0xff
+	_, err = DecodeFrameHeader(tooLarge)
+	testCase.Error(err)
+	unknown := EncodeFrame(FrameVersionLatest+1, FrameKindMessage, nil)
+	_, err = DecodeFrameHeader(unknown)
+	testCase.Error(err)
+
+	//the hello is never mistaken for a legacy message nor split by one
+	hello := helloFrame(FrameVersionLatest)
+	testCase.Equal(1, bytes.Count(hello, []byte{SmsMessageEnd}))
+	testCase.Equal(SmsMessageEnd, hello[len(hello)-1])
+	_, err = Parse(string(hello))
+	testCase.Error(err)
+}
+
+func TestNegotiate(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	testCase := assert.New(t)
+
+	t.Run("binary", func(t *testing.T) {
+		serverConn, clientConn := net.Pipe()
+		defer serverConn.Close()
+		server := NewSmsConnection(serverConn)
+		go func() {
+			for {
+				msg, err := server.Receive()
+				if err != nil {
+					return
+				}
+				_ = server.Send(msg)
+			}
+		}()
+		client := NewSmsConnection(clientConn)
+		defer client.Close()
+		testCase.NoError(client.Negotiate(time.Second))
+		testCase.Equal(FrameVersionLatest, client.FrameVersion())
+
+		msg := testMessage()
+		testCase.NoError(client.Send(msg))
+		echo, err := client.Receive()
+		testCase.NoError(err)
+		testCase.Equal(msg.Head.MsgId, echo.Head.MsgId)
+		testCase.Equal(FrameVersionLatest, server.FrameVersion())
+	})
+
+	t.Run("legacy peer", func(t *testing.T) {
+		//a legacy agent only speaks base64 lines and drops what it can not parse
+		legacyPeer := func(serverConn net.Conn) {
+			reader := bufio.NewReader(serverConn)
+			for {
+				line, err := reader.ReadString(SmsMessageEnd)
+				if err != nil {
+					return
+				}
+				msg, err := Parse(line)
+				if err != nil {
+					continue
+				}
+				output, _ := proto.Marshal(msg)
+				_, _ = serverConn.Write(append([]byte(base64.StdEncoding.EncodeToString(output)), SmsMessageEnd))
+			}
+		}
+		serverConn, clientConn := net.Pipe()
+		go legacyPeer(serverConn)
+		client := NewSmsConnection(clientConn)
+		testCase.Equal(ErrNegotiateTimeout, client.Negotiate(100*time.Millisecond))
+		client.Close()
+		serverConn.Close()
+
+		//the connection dialed again skips the hello
+		serverConn, clientConn = net.Pipe()
+		defer serverConn.Close()
+		go legacyPeer(serverConn)
+		client = NewSmsConnection(clientConn)
+		defer client.Close()
+		testCase.Equal(FrameVersionLegacy, client.FrameVersion())
+
+		msg := testMessage()
+		testCase.NoError(client.Send(msg))
+		echo, err := client.Receive()
+		testCase.NoError(err)
+		testCase.Equal(msg.Head.MsgId, echo.Head.MsgId)
+	})
+
+	t.Run("legacy client", func(t *testing.T) {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		server := NewSmsConnection(serverConn)
+		defer server.Close()
+		msg := testMessage()
+		go func() {
+			output, _ := proto.Marshal(msg)
+			_, _ = clientConn.Write(append([]byte(base64.StdEncoding.EncodeToString(output)), SmsMessageEnd))
+		}()
+		got, err := server.Receive()
+		testCase.NoError(err)
+		testCase.Equal(msg.Head.MsgId, got.Head.MsgId)
+		testCase.Equal(FrameVersionLegacy, server.FrameVersion())
+	})
+}
@@ -38,10 +38,36 @@ func ExecSuccess(contents []byte) MessageBody {
 }
 
 type PrCheckCmdResult struct {
-	CheckType   int           `json:"check_type"`
-	CheckResult int           `json:"check_result"`
-	VolumeType  common.LvType `json:"volume_type"`
-	Name        string        `json:"name"`
+	CheckType   int                 `json:"check_type"`
+	CheckResult int                 `json:"check_result"`
+	VolumeType  common.LvType       `json:"volume_type"`
+	Name        string              `json:"name"`
+	PrInfo      *PrQueryInfo        `json:"pr_info,omitempty"`
+	Capability  []*PrPathCapability `json:"capability,omitempty"`
+}
+
+//PrQueryInfo is the persistent reservation read from the device, keys are mapped to their registration count
+type PrQueryInfo struct {
+	Generation      string         `json:"generation"`
+	Keys            map[string]int `json:"keys"`
+	ReservationKey  string         `json:"reservation_key"`
+	ReservationType string         `json:"reservation_type"`
+}
+
+//PrPathCapability is what one path of the lun supports, Steps are in the order they are run
+type PrPathCapability struct {
+	Path             string          `json:"path"`
+	ReservationTypes []PrType        `json:"reservation_types"`
+	PtplCapable      bool            `json:"ptpl_c"`
+	PtplActive       bool            `json:"ptpl_a"`
+	AtpCapable       bool            `json:"atp_c"`
+	Steps            []*PrStepResult `json:"steps"`
+}
+
+type PrStepResult struct {
+	Step    string `json:"step"`
+	Success bool   `json:"success"`
+	ErrMsg  string `json:"err_msg,omitempty"`
 }
 
 type PrBatchCheckCmdResult struct {
@@ -68,6 +68,7 @@ const (
 	SmsMessageHead_CMD_PVC_CREATE_RESP  SmsMessageHead_SmsMsgType = 801
 	SmsMessageHead_CMD_PVC_RELEASE_REQ  SmsMessageHead_SmsMsgType = 900
 	SmsMessageHead_CMD_PVC_RELEASE_RESP SmsMessageHead_SmsMsgType = 901
+	SmsMessageHead_CMD_CANCEL_REQ       SmsMessageHead_SmsMsgType = 1000
 	SmsMessageHead_DUMMY_REQ            SmsMessageHead_SmsMsgType = 10000
 	SmsMessageHead_DUMMY_RESP           SmsMessageHead_SmsMsgType = 10001
 )
@@ -100,6 +101,7 @@ var (
 		801:   "CMD_PVC_CREATE_RESP",
 		900:   "CMD_PVC_RELEASE_REQ",
 		901:   "CMD_PVC_RELEASE_RESP",
+		1000:  "CMD_CANCEL_REQ",
 		10000: "DUMMY_REQ",
 		10001: "DUMMY_RESP",
 	}
@@ -129,6 +131,7 @@ var (
 		"CMD_PVC_CREATE_RESP":  801,
 		"CMD_PVC_RELEASE_REQ":  900,
 		"CMD_PVC_RELEASE_RESP": 901,
+		"CMD_CANCEL_REQ":       1000,
 		"DUMMY_REQ":            10000,
 		"DUMMY_RESP":           10001,
 	}
@@ -217,6 +220,9 @@ type SmsMessageHead struct {
 	MsgLen       int32                     `protobuf:"varint,3,opt,name=msgLen,proto3" json:"msgLen,omitempty"`
 	AckMsgId     string                    `protobuf:"bytes,4,opt,name=ackMsgId,proto3" json:"ackMsgId,omitempty"`
 	TraceContext map[string]string         `protobuf:"bytes,5,rep,name=traceContext,proto3" json:"traceContext,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	//milliseconds the sender waits from sending, 0 means no timeout.
+	//it is relative for the clocks of the peers may differ
+	Timeout int64 `protobuf:"varint,7,opt,name=timeout,proto3" json:"timeout,omitempty"`
 }
 
 func (x *SmsMessageHead) Reset() {
@@ -286,6 +292,13 @@ func (x *SmsMessageHead) GetTraceContext() map[string]string {
 	return nil
 }
 
+func (x *SmsMessageHead) GetTimeout() int64 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
 type MessageBody struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -408,7 +421,7 @@ var File_message_proto protoreflect.FileDescriptor
 
 var file_message_proto_rawDesc = []byte{
 	0x0a, 0x0d, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
-	0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x9f, 0x07, 0x0a, 0x0e, 0x53, 0x6d, 0x73,
+	0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0xd4, 0x07, 0x0a, 0x0e, 0x53, 0x6d, 0x73,
 	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x48, 0x65, 0x61, 0x64, 0x12, 0x3c, 0x0a, 0x07, 0x6d,
 	0x73, 0x67, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x22, 0x2e, 0x6d,
 	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x53, 0x6d, 0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
@@ -423,67 +436,70 @@ var file_message_proto_rawDesc = []byte{
 	0x61, 0x67, 0x65, 0x2e, 0x53, 0x6d, 0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x48, 0x65,
 	0x61, 0x64, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x45,
 	0x6e, 0x74, 0x72, 0x79, 0x52, 0x0c, 0x74, 0x72, 0x61, 0x63, 0x65, 0x43, 0x6f, 0x6e, 0x74, 0x65,
-	0x78, 0x74, 0x1a, 0x3f, 0x0a, 0x11, 0x54, 0x72, 0x61, 0x63, 0x65, 0x43, 0x6f, 0x6e, 0x74, 0x65,
-	0x78, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a,
-	0x02, 0x38, 0x01, 0x22, 0xf4, 0x04, 0x0a, 0x0a, 0x53, 0x6d, 0x73, 0x4d, 0x73, 0x67, 0x54, 0x79,
-	0x70, 0x65, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x43, 0x4b, 0x10, 0x00, 0x12, 0x13, 0x0a, 0x0f, 0x43,
-	0x4d, 0x44, 0x5f, 0x50, 0x52, 0x5f, 0x45, 0x58, 0x45, 0x43, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x0a,
-	0x12, 0x14, 0x0a, 0x10, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x52, 0x5f, 0x45, 0x58, 0x45, 0x43, 0x5f,
-	0x52, 0x45, 0x53, 0x50, 0x10, 0x0b, 0x12, 0x14, 0x0a, 0x10, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x52,
-	0x5f, 0x42, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x14, 0x12, 0x15, 0x0a, 0x11,
-	0x43, 0x4d, 0x44, 0x5f, 0x50, 0x52, 0x5f, 0x42, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x52, 0x45, 0x53,
-	0x50, 0x10, 0x15, 0x12, 0x14, 0x0a, 0x10, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x43, 0x52,
-	0x45, 0x41, 0x54, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x64, 0x12, 0x15, 0x0a, 0x11, 0x43, 0x4d, 0x44,
-	0x5f, 0x44, 0x4d, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x65,
-	0x12, 0x15, 0x0a, 0x11, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x55, 0x50, 0x44, 0x41, 0x54,
-	0x45, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x66, 0x12, 0x16, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x44,
-	0x4d, 0x5f, 0x55, 0x50, 0x44, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x67, 0x12,
-	0x15, 0x0a, 0x11, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45,
-	0x5f, 0x52, 0x45, 0x51, 0x10, 0x68, 0x12, 0x16, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d,
-	0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x69, 0x12, 0x13,
-	0x0a, 0x0e, 0x43, 0x4d, 0x44, 0x5f, 0x52, 0x45, 0x53, 0x43, 0x41, 0x4e, 0x5f, 0x52, 0x45, 0x51,
-	0x10, 0xac, 0x02, 0x12, 0x14, 0x0a, 0x0f, 0x43, 0x4d, 0x44, 0x5f, 0x52, 0x45, 0x53, 0x43, 0x41,
-	0x4e, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xad, 0x02, 0x12, 0x16, 0x0a, 0x11, 0x43, 0x4d, 0x44,
-	0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e, 0x44, 0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x90,
-	0x03, 0x12, 0x17, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e, 0x44, 0x5f,
-	0x46, 0x53, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x91, 0x03, 0x12, 0x16, 0x0a, 0x11, 0x43, 0x4d,
-	0x44, 0x5f, 0x46, 0x4f, 0x52, 0x4d, 0x41, 0x54, 0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45, 0x51, 0x10,
-	0xf4, 0x03, 0x12, 0x17, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x46, 0x4f, 0x52, 0x4d, 0x41, 0x54,
-	0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xf5, 0x03, 0x12, 0x17, 0x0a, 0x12, 0x43,
-	0x4d, 0x44, 0x5f, 0x4c, 0x55, 0x4e, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45,
-	0x51, 0x10, 0xd8, 0x04, 0x12, 0x18, 0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x4c, 0x55, 0x4e, 0x5f,
-	0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xd9, 0x04, 0x12, 0x17,
-	0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x4c, 0x55, 0x4e, 0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e, 0x44,
-	0x5f, 0x52, 0x45, 0x51, 0x10, 0xbc, 0x05, 0x12, 0x18, 0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x4c,
-	0x55, 0x4e, 0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e, 0x44, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xbd,
-	0x05, 0x12, 0x17, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f, 0x43, 0x52, 0x45,
-	0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x51, 0x10, 0xa0, 0x06, 0x12, 0x18, 0x0a, 0x13, 0x43, 0x4d,
-	0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x53,
-	0x50, 0x10, 0xa1, 0x06, 0x12, 0x18, 0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f,
-	0x52, 0x45, 0x4c, 0x45, 0x41, 0x53, 0x45, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x84, 0x07, 0x12, 0x19,
-	0x0a, 0x14, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f, 0x52, 0x45, 0x4c, 0x45, 0x41, 0x53,
-	0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x85, 0x07, 0x12, 0x0e, 0x0a, 0x09, 0x44, 0x55, 0x4d,
-	0x4d, 0x59, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x90, 0x4e, 0x12, 0x0f, 0x0a, 0x0a, 0x44, 0x55, 0x4d,
-	0x4d, 0x59, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x91, 0x4e, 0x22, 0x9d, 0x01, 0x0a, 0x0b, 0x4d,
-	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x12, 0x3b, 0x0a, 0x0a, 0x65, 0x78,
-	0x65, 0x63, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1b,
-	0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x42, 0x6f, 0x64, 0x79, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x0a, 0x65, 0x78, 0x65,
-	0x63, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x72, 0x72, 0x4d, 0x73,
-	0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x65, 0x72, 0x72, 0x4d, 0x73, 0x67, 0x12,
-	0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c,
-	0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x22, 0x1f, 0x0a, 0x06, 0x53, 0x74, 0x61,
-	0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x10, 0x00,
-	0x12, 0x08, 0x0a, 0x04, 0x46, 0x61, 0x69, 0x6c, 0x10, 0x01, 0x22, 0x63, 0x0a, 0x0a, 0x53, 0x6d,
-	0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2b, 0x0a, 0x04, 0x68, 0x65, 0x61, 0x64,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x2e, 0x53, 0x6d, 0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x48, 0x65, 0x61, 0x64, 0x52,
-	0x04, 0x68, 0x65, 0x61, 0x64, 0x12, 0x28, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4d, 0x65,
-	0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x78, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x07, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x1a, 0x3f, 0x0a, 0x11,
+	0x54, 0x72, 0x61, 0x63, 0x65, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x78, 0x74, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x89, 0x05,
+	0x0a, 0x0a, 0x53, 0x6d, 0x73, 0x4d, 0x73, 0x67, 0x54, 0x79, 0x70, 0x65, 0x12, 0x07, 0x0a, 0x03,
+	0x41, 0x43, 0x4b, 0x10, 0x00, 0x12, 0x13, 0x0a, 0x0f, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x52, 0x5f,
+	0x45, 0x58, 0x45, 0x43, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x0a, 0x12, 0x14, 0x0a, 0x10, 0x43, 0x4d,
+	0x44, 0x5f, 0x50, 0x52, 0x5f, 0x45, 0x58, 0x45, 0x43, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x0b,
+	0x12, 0x14, 0x0a, 0x10, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x52, 0x5f, 0x42, 0x41, 0x54, 0x43, 0x48,
+	0x5f, 0x52, 0x45, 0x51, 0x10, 0x14, 0x12, 0x15, 0x0a, 0x11, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x52,
+	0x5f, 0x42, 0x41, 0x54, 0x43, 0x48, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x15, 0x12, 0x14, 0x0a,
+	0x10, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x5f, 0x52, 0x45,
+	0x51, 0x10, 0x64, 0x12, 0x15, 0x0a, 0x11, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x43, 0x52,
+	0x45, 0x41, 0x54, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x65, 0x12, 0x15, 0x0a, 0x11, 0x43, 0x4d,
+	0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x55, 0x50, 0x44, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x51, 0x10,
+	0x66, 0x12, 0x16, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x55, 0x50, 0x44, 0x41,
+	0x54, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x67, 0x12, 0x15, 0x0a, 0x11, 0x43, 0x4d, 0x44,
+	0x5f, 0x44, 0x4d, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x68,
+	0x12, 0x16, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x44, 0x4d, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54,
+	0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x69, 0x12, 0x13, 0x0a, 0x0e, 0x43, 0x4d, 0x44, 0x5f,
+	0x52, 0x45, 0x53, 0x43, 0x41, 0x4e, 0x5f, 0x52, 0x45, 0x51, 0x10, 0xac, 0x02, 0x12, 0x14, 0x0a,
+	0x0f, 0x43, 0x4d, 0x44, 0x5f, 0x52, 0x45, 0x53, 0x43, 0x41, 0x4e, 0x5f, 0x52, 0x45, 0x53, 0x50,
+	0x10, 0xad, 0x02, 0x12, 0x16, 0x0a, 0x11, 0x43, 0x4d, 0x44, 0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e,
+	0x44, 0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x90, 0x03, 0x12, 0x17, 0x0a, 0x12, 0x43,
+	0x4d, 0x44, 0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e, 0x44, 0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45, 0x53,
+	0x50, 0x10, 0x91, 0x03, 0x12, 0x16, 0x0a, 0x11, 0x43, 0x4d, 0x44, 0x5f, 0x46, 0x4f, 0x52, 0x4d,
+	0x41, 0x54, 0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45, 0x51, 0x10, 0xf4, 0x03, 0x12, 0x17, 0x0a, 0x12,
+	0x43, 0x4d, 0x44, 0x5f, 0x46, 0x4f, 0x52, 0x4d, 0x41, 0x54, 0x5f, 0x46, 0x53, 0x5f, 0x52, 0x45,
+	0x53, 0x50, 0x10, 0xf5, 0x03, 0x12, 0x17, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f, 0x4c, 0x55, 0x4e,
+	0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x51, 0x10, 0xd8, 0x04, 0x12, 0x18,
+	0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x4c, 0x55, 0x4e, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45,
+	0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xd9, 0x04, 0x12, 0x17, 0x0a, 0x12, 0x43, 0x4d, 0x44, 0x5f,
+	0x4c, 0x55, 0x4e, 0x5f, 0x45, 0x58, 0x50, 0x41, 0x4e, 0x44, 0x5f, 0x52, 0x45, 0x51, 0x10, 0xbc,
+	0x05, 0x12, 0x18, 0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x4c, 0x55, 0x4e, 0x5f, 0x45, 0x58, 0x50,
+	0x41, 0x4e, 0x44, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xbd, 0x05, 0x12, 0x17, 0x0a, 0x12, 0x43,
+	0x4d, 0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45,
+	0x51, 0x10, 0xa0, 0x06, 0x12, 0x18, 0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f,
+	0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0xa1, 0x06, 0x12, 0x18,
+	0x0a, 0x13, 0x43, 0x4d, 0x44, 0x5f, 0x50, 0x56, 0x43, 0x5f, 0x52, 0x45, 0x4c, 0x45, 0x41, 0x53,
+	0x45, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x84, 0x07, 0x12, 0x19, 0x0a, 0x14, 0x43, 0x4d, 0x44, 0x5f,
+	0x50, 0x56, 0x43, 0x5f, 0x52, 0x45, 0x4c, 0x45, 0x41, 0x53, 0x45, 0x5f, 0x52, 0x45, 0x53, 0x50,
+	0x10, 0x85, 0x07, 0x12, 0x13, 0x0a, 0x0e, 0x43, 0x4d, 0x44, 0x5f, 0x43, 0x41, 0x4e, 0x43, 0x45,
+	0x4c, 0x5f, 0x52, 0x45, 0x51, 0x10, 0xe8, 0x07, 0x12, 0x0e, 0x0a, 0x09, 0x44, 0x55, 0x4d, 0x4d,
+	0x59, 0x5f, 0x52, 0x45, 0x51, 0x10, 0x90, 0x4e, 0x12, 0x0f, 0x0a, 0x0a, 0x44, 0x55, 0x4d, 0x4d,
+	0x59, 0x5f, 0x52, 0x45, 0x53, 0x50, 0x10, 0x91, 0x4e, 0x4a, 0x04, 0x08, 0x06, 0x10, 0x07, 0x22,
+	0x9d, 0x01, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x12,
+	0x3b, 0x0a, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x1b, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x16, 0x0a, 0x06,
+	0x65, 0x72, 0x72, 0x4d, 0x73, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x65, 0x72,
+	0x72, 0x4d, 0x73, 0x67, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x22, 0x1f,
+	0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x75, 0x63, 0x63,
+	0x65, 0x73, 0x73, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x46, 0x61, 0x69, 0x6c, 0x10, 0x01, 0x22,
+	0x63, 0x0a, 0x0a, 0x53, 0x6d, 0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2b, 0x0a,
+	0x04, 0x68, 0x65, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x53, 0x6d, 0x73, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x48, 0x65, 0x61, 0x64, 0x52, 0x04, 0x68, 0x65, 0x61, 0x64, 0x12, 0x28, 0x0a, 0x04, 0x62, 0x6f,
+	0x64, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x6f, 0x64, 0x79, 0x52, 0x04,
+	0x62, 0x6f, 0x64, 0x79, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
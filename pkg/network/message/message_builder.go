@@ -16,8 +16,12 @@
 package message
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"polardb-sms/pkg/common"
+	"time"
 )
 
 type SmsMessageBuilder struct {
@@ -99,3 +103,30 @@ func FailRespMessage(t SmsMessageHead_SmsMsgType, ackMsgId, errMsg string) *SmsM
 		WithAckMsgId(ackMsgId).
 		Build()
 }
+
+//NewCancelMessage tells the agent the sender gave up on the request msgId
+func NewCancelMessage(msgId string, ctx common.TraceContext) (*SmsMessage, error) {
+	return NewMessage(SmsMessageHead_CMD_CANCEL_REQ, &CancelCommand{MsgId: msgId}, ctx)
+}
+
+//SetTimeout tells the receiver how long the sender waits for the response
+func SetTimeout(head *SmsMessageHead, timeout time.Duration) {
+	head.Timeout = timeout.Milliseconds()
+}
+
+//Deadline is when the sender stops waiting by the clock of the receiver, which received the message at received.
+//returns false if the sender of the message waits forever
+func Deadline(head *SmsMessageHead, received time.Time) (time.Time, bool) {
+	if head.GetTimeout() <= 0 {
+		return time.Time{}, false
+	}
+	return received.Add(time.Duration(head.GetTimeout()) * time.Millisecond), true
+}
+
+//IdempotentId derives the msg id from key and what is sent, so every retry under key has the same id
+func IdempotentId(key, toId string, msg *SmsMessage) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%d\x00", key, toId, msg.Head.MsgType)
+	_, _ = h.Write(msg.Body.GetContent())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -18,9 +18,34 @@ package message
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 func TestNewMessage(t *testing.T) {
 	msg, _ := NewMessage(SmsMessageHead_CMD_PVC_RELEASE_RESP, "a", map[string]string{"a": "b"})
 	fmt.Printf("%v", msg.Head.TraceContext)
 }
+
+func TestDeadline(t *testing.T) {
+	msg := NewSmsMessageBuilder().WithType(SmsMessageHead_DUMMY_REQ).Build()
+	if _, ok := Deadline(msg.Head, time.Now()); ok {
+		t.Fatal("no deadline expected without timeout")
+	}
+	SetTimeout(msg.Head, 3*time.Second)
+	bytes, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := &SmsMessage{}
+	if err = proto.Unmarshal(bytes, received); err != nil {
+		t.Fatal(err)
+	}
+	//the deadline is from the clock of the receiver, whatever the clock of the sender is
+	at := time.Unix(1000, 0)
+	deadline, ok := Deadline(received.Head, at)
+	if !ok || !deadline.Equal(at.Add(3*time.Second)) {
+		t.Fatalf("unexpected deadline %v", deadline)
+	}
+}
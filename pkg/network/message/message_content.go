@@ -16,6 +16,7 @@
 package message
 
 import (
+	"fmt"
 	"polardb-sms/pkg/common"
 	"polardb-sms/pkg/device"
 )
@@ -24,6 +25,8 @@ type PvcReleaseCommand struct {
 	Name       string        `json:"name"`
 	VolumeType common.LvType `json:"volume_type"`
 	VolumeId   string        `json:"volume_id"`
+	//PrKeys is the pr key of each node id, the agent not in it uses the ip derived key
+	PrKeys map[string]string `json:"pr_keys,omitempty"`
 }
 
 type PvcCreateCommand struct {
@@ -31,6 +34,8 @@ type PvcCreateCommand struct {
 	VolumeType common.LvType `json:"volume_type"`
 	VolumeId   string        `json:"volume_id"`
 	FsType     common.FsType `json:"fs_type"`
+	//PrKey is the pr key of the exec node, empty for the ip derived key
+	PrKey string `json:"pr_key,omitempty"`
 }
 
 type DmExecCommandType string
@@ -79,6 +84,11 @@ type FsFormatCommand struct {
 	ReqSize    int64         `json:"req_size"`
 }
 
+//cancel command aborts the processing of the request msg_id on the agent
+type CancelCommand struct {
+	MsgId string `json:"msg_id"`
+}
+
 type PrType int
 
 const (
@@ -89,6 +99,34 @@ const (
 	WEAR PrType = 7 //Write Exclusive, All Registrants
 	EAAR PrType = 8 //Exclusive Access, All Registrants
 )
+
+//prTypeNames are the names printed by sg_persist/mpathpersist
+var prTypeNames = map[PrType]string{
+	WE:   "Write Exclusive",
+	EA:   "Exclusive Access",
+	WERO: "Write Exclusive, registrants only",
+	EARO: "Exclusive Access, registrants only",
+	WEAR: "Write Exclusive, all registrants",
+	EAAR: "Exclusive Access, all registrants",
+}
+
+//ExclusiveAccess returns whether the nodes not registered can not read either
+func (t PrType) ExclusiveAccess() bool {
+	return t == EA || t == EARO || t == EAAR
+}
+
+//AllRegistrants returns whether every registered key holds the reservation
+func (t PrType) AllRegistrants() bool {
+	return t == WEAR || t == EAAR
+}
+
+func (t PrType) String() string {
+	if name, ok := prTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Obsolete [%d]", int(t))
+}
+
 const (
 	PrRegister int = iota
 	PrReserve
@@ -98,6 +136,9 @@ const (
 	PrPathNum
 	PathCanWrite
 	PathCannotWrite
+	PrQuery
+	PrCapability
+	PrUnregister
 )
 
 const (
@@ -146,6 +187,12 @@ func (cmd *PrCmd) UnmarshalJSON(b []byte) error {
 		tempCmd.CmdParam = &PrCanWriteCmdParam{}
 	case PathCannotWrite:
 		tempCmd.CmdParam = &PrCannotWriteCmdParam{}
+	case PrQuery:
+		tempCmd.CmdParam = &PrQueryCmdParam{}
+	case PrCapability:
+		tempCmd.CmdParam = &PrCapabilityCmdParam{}
+	case PrUnregister:
+		tempCmd.CmdParam = &PrUnregisterCmdParam{}
 	}
 	err = common.BytesToStruct(b, &tempCmd)
 	if err != nil {
@@ -173,6 +220,10 @@ func ParseForPrCheckCmd(bytes []byte) (*PrCmd, error) {
 
 type PrRegisterCmdParam struct {
 	RegisterKey string `json:"register_key"`
+	//Aptpl lets the registrations and reservation persist through power loss of the array
+	Aptpl bool `json:"aptpl,omitempty"`
+	//ReserveType is the type the key reserves with, used to release the key on rollback
+	ReserveType PrType `json:"reserve_type,omitempty"`
 }
 
 type PrReserveCmdParam struct {
@@ -183,6 +234,11 @@ type PrReleaseCmdParam struct {
 	RegisterKey string `json:"register_key"`
 	ReserveType PrType `json:"reserve_type"`
 }
+
+//PrUnregisterCmdParam removes the registration of RegisterKey of this host, and its reservation with it
+type PrUnregisterCmdParam struct {
+	RegisterKey string `json:"register_key"`
+}
 type PrClearCmdParam struct {
 	RegisterKey string `json:"register_key"`
 }
@@ -190,12 +246,25 @@ type PrPreemptCmdParam struct {
 	RegisterKey  string `json:"register_key"`
 	ReserveType  PrType `json:"reserve_type"`
 	PreemptedKey string `json:"preempted_key"`
+	//Abort also aborts the commands queued by the preempted key, used to fence off a dead node
+	Abort bool `json:"abort,omitempty"`
 }
 type PrCheckPathCmdParam struct {
 }
 type PrCanWriteCmdParam struct {
+	//AllPaths writes through every active path of the multipath device
+	AllPaths    bool   `json:"all_paths,omitempty"`
+	ReserveType PrType `json:"reserve_type,omitempty"`
 }
 type PrCannotWriteCmdParam struct {
+	//ReserveType of exclusive access checks the node can not read either
+	ReserveType PrType `json:"reserve_type,omitempty"`
+}
+type PrQueryCmdParam struct {
+}
+type PrCapabilityCmdParam struct {
+	RegisterKey string `json:"register_key"`
+	ReserveType PrType `json:"reserve_type"`
 }
 
 func newPrCmd(volumeId string, volumeType common.LvType, cmdType int, param interface{}) *PrCmd {
@@ -233,6 +302,14 @@ func newPrReleaseCmd(volumeId string, volumeType common.LvType, registerKey stri
 	return newPrCmd(volumeId, volumeType, PrRelease, param), nil
 }
 
+func newPrUnregisterCmd(volumeId string, volumeType common.LvType, registerKey string) (*PrCmd, error) {
+	param := &PrUnregisterCmdParam{
+		RegisterKey: registerKey,
+	}
+
+	return newPrCmd(volumeId, volumeType, PrUnregister, param), nil
+}
+
 func newPrClearCmd(volumeId string, volumeType common.LvType, registerKey string) (*PrCmd, error) {
 	param := &PrClearCmdParam{
 		RegisterKey: registerKey,
@@ -251,18 +328,38 @@ func NewPrPreemptCmd(volumeId string, volumeType common.LvType, registerKey, pre
 	return newPrCmd(volumeId, volumeType, PrPreempt, param), nil
 }
 
-func newPathCanWriteCmd(volumeId string, volumeType common.LvType) (*PrCmd, error) {
-	return newPrCmd(volumeId, volumeType, PathCanWrite, nil), nil
+func newPathCanWriteCmd(volumeId string, volumeType common.LvType, reserveType PrType) (*PrCmd, error) {
+	param := &PrCanWriteCmdParam{
+		ReserveType: reserveType,
+	}
+	return newPrCmd(volumeId, volumeType, PathCanWrite, param), nil
 }
 
-func newPathCannotWriteCmd(volumeId string, volumeType common.LvType) (*PrCmd, error) {
-	return newPrCmd(volumeId, volumeType, PathCannotWrite, nil), nil
+func newPathCannotWriteCmd(volumeId string, volumeType common.LvType, reserveType PrType) (*PrCmd, error) {
+	param := &PrCannotWriteCmdParam{
+		ReserveType: reserveType,
+	}
+	return newPrCmd(volumeId, volumeType, PathCannotWrite, param), nil
 }
 
 func NewCheckPathNumCmd(volumeId string, volumeType common.LvType) (*PrCmd, error) {
 	return newPrCmd(volumeId, volumeType, PrPathNum, nil), nil
 }
 
+//NewPrQueryCmd reads the registered keys and reservation, the result is in PrCheckCmdResult.PrInfo
+func NewPrQueryCmd(volumeId string, volumeType common.LvType) (*PrCmd, error) {
+	return newPrCmd(volumeId, volumeType, PrQuery, &PrQueryCmdParam{}), nil
+}
+
+//NewPrCapabilityCmd runs the whole pr sequence on every path of a scratch lun, the result is in PrCheckCmdResult.Capability
+func NewPrCapabilityCmd(volumeId string, volumeType common.LvType, registerKey string, reserveType PrType) (*PrCmd, error) {
+	param := &PrCapabilityCmdParam{
+		RegisterKey: registerKey,
+		ReserveType: reserveType,
+	}
+	return newPrCmd(volumeId, volumeType, PrCapability, param), nil
+}
+
 type BatchPrCheckCmd struct {
 	Cmds []*PrCmd `json:"cmds"`
 }
@@ -278,6 +375,33 @@ func (bc *BatchPrCheckCmd) Bytes() ([]byte, error) {
 	return common.StructToBytes(bc)
 }
 
+//SetAptpl sets the aptpl of all the register cmds
+func (bc *BatchPrCheckCmd) SetAptpl(aptpl bool) {
+	for _, cmd := range bc.Cmds {
+		if param, ok := cmd.CmdParam.(*PrRegisterCmdParam); ok {
+			param.Aptpl = aptpl
+		}
+	}
+}
+
+//SetAbort lets all the preempt cmds abort the commands of the preempted key
+func (bc *BatchPrCheckCmd) SetAbort() {
+	for _, cmd := range bc.Cmds {
+		if param, ok := cmd.CmdParam.(*PrPreemptCmdParam); ok {
+			param.Abort = true
+		}
+	}
+}
+
+//SetAllPaths lets all the can write cmds check every active path
+func (bc *BatchPrCheckCmd) SetAllPaths() {
+	for _, cmd := range bc.Cmds {
+		if param, ok := cmd.CmdParam.(*PrCanWriteCmdParam); ok {
+			param.AllPaths = true
+		}
+	}
+}
+
 func ParseForBatchPrCmd(bytes []byte) (*BatchPrCheckCmd, error) {
 	cmd := &BatchPrCheckCmd{}
 	err := common.BytesToStruct(bytes, cmd)
@@ -297,6 +421,7 @@ func NewBatchCmd(volumeId string, volumeType common.LvType, registerKey, preempt
 			if err != nil {
 				return nil, err
 			}
+			cmd.CmdParam.(*PrRegisterCmdParam).ReserveType = reserveType
 			cmds = append(cmds, cmd)
 		case PrReserve:
 			cmd, err := newPrReserveCmd(volumeId, volumeType, registerKey, reserveType)
@@ -310,6 +435,12 @@ func NewBatchCmd(volumeId string, volumeType common.LvType, registerKey, preempt
 				return nil, err
 			}
 			cmds = append(cmds, cmd)
+		case PrUnregister:
+			cmd, err := newPrUnregisterCmd(volumeId, volumeType, registerKey)
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, cmd)
 		case PrClear:
 			cmd, err := newPrClearCmd(volumeId, volumeType, registerKey)
 			if err != nil {
@@ -323,7 +454,13 @@ func NewBatchCmd(volumeId string, volumeType common.LvType, registerKey, preempt
 			}
 			cmds = append(cmds, cmd)
 		case PathCanWrite:
-			cmd, err := newPathCanWriteCmd(volumeId, volumeType)
+			cmd, err := newPathCanWriteCmd(volumeId, volumeType, reserveType)
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, cmd)
+		case PathCannotWrite:
+			cmd, err := newPathCannotWriteCmd(volumeId, volumeType, reserveType)
 			if err != nil {
 				return nil, err
 			}
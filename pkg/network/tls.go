@@ -0,0 +1,223 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	smslog "polardb-sms/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	//the cert files are checked for change at most once in reloadCheckInterval
+	reloadCheckInterval = 10 * time.Second
+	DialTimeout         = 10 * time.Second
+	HandshakeTimeout    = 10 * time.Second
+)
+
+//TLSConfig is the mutual tls of the message channel between the manager and the agents,
+//the channel is plain tcp if CertFile is empty
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	//ServerName is the name the agent certificates are issued to, only the CA is verified if empty
+	ServerName string
+}
+
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+//CertReloader keeps the certificate and the CA loaded from the files, the new connections use
+//the reloaded ones once the files change, so the certificates are rotated without restart
+type CertReloader struct {
+	conf      TLSConfig
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTime   time.Time
+	checkTime time.Time
+}
+
+//NewCertReloader returns nil if the tls is not enabled
+func NewCertReloader(conf TLSConfig) (*CertReloader, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+	if conf.KeyFile == "" || conf.CAFile == "" {
+		return nil, fmt.Errorf("tls needs the cert file, the key file and the ca file")
+	}
+	r := &CertReloader{conf: conf}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("can not load cert %s and key %s: %v", r.conf.CertFile, r.conf.KeyFile, err)
+	}
+	caPem, err := ioutil.ReadFile(r.conf.CAFile)
+	if err != nil {
+		return fmt.Errorf("can not read ca %s: %v", r.conf.CAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return fmt.Errorf("no certificate found in ca %s", r.conf.CAFile)
+	}
+	r.lock.Lock()
+	r.cert, r.pool, r.modTime = &cert, pool, modTime
+	r.lock.Unlock()
+	return nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.conf.CertFile, r.conf.KeyFile, r.conf.CAFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+//maybeReload reloads the files if they changed, the loaded ones are kept if the new ones are invalid,
+//for the files may be in the middle of rotating
+func (r *CertReloader) maybeReload() {
+	r.lock.Lock()
+	if time.Since(r.checkTime) < reloadCheckInterval {
+		r.lock.Unlock()
+		return
+	}
+	r.checkTime = time.Now()
+	loaded := r.modTime
+	r.lock.Unlock()
+
+	modTime, err := r.latestModTime()
+	if err != nil || !modTime.After(loaded) {
+		return
+	}
+	if err = r.reload(); err != nil {
+		smslog.Errorf("reload tls cert err %s, keep the loaded one", err.Error())
+		return
+	}
+	smslog.Infof("reloaded tls cert %s and ca %s", r.conf.CertFile, r.conf.CAFile)
+}
+
+func (r *CertReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.maybeReload()
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, r.pool
+}
+
+//ServerConfig requires the clients to present a certificate issued by the CA
+func (r *CertReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
+
+//ClientConfig presents the certificate and verifies the server by the CA loaded at the handshake,
+//the default verification is skipped for it can not use the reloaded CA
+func (r *CertReloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyPeer(state.PeerCertificates, pool, r.conf.ServerName)
+		},
+	}
+}
+
+func verifyPeer(certs []*x509.Certificate, pool *x509.CertPool, serverName string) error {
+	if len(certs) == 0 {
+		return fmt.Errorf("no certificate presented by the peer")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
+
+//Listen listens on the addr, the connections are wrapped by the mutual tls if reloader is not nil
+func Listen(addr string, reloader *CertReloader) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil || reloader == nil {
+		return l, err
+	}
+	return tls.NewListener(l, reloader.ServerConfig()), nil
+}
+
+//Dial connects to the addr, with the mutual tls handshake finished if reloader is not nil
+func Dial(addr string, reloader *CertReloader) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: DialTimeout, KeepAlive: 15 * time.Second}
+	if reloader == nil {
+		return dialer.Dial("tcp", addr)
+	}
+	return tls.DialWithDialer(dialer, "tcp", addr, reloader.ClientConfig())
+}
+
+//Handshake finishes the tls handshake of the accepted conn, so the unauthenticated peer is rejected
+//before any message is read. It does nothing for the plain tcp conn
+func Handshake(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	_ = tlsConn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer func() {
+		_ = tlsConn.SetDeadline(time.Time{})
+	}()
+	return tlsConn.Handshake()
+}
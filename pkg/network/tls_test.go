@@ -0,0 +1,172 @@
+/*
+*Copyright (c) 2019-2021, Alibaba Group Holding Limited;
+*Licensed under the Apache License, Version 2.0 (the "License");
+*you may not use this file except in compliance with the License.
+*You may obtain a copy of the License at
+
+*   http://www.apache.org/licenses/LICENSE-2.0
+
+*Unless required by applicable law or agreed to in writing, software
+*distributed under the License is distributed on an "AS IS" BASIS,
+*WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+*See the License for the specific language governing permissions and
+*limitations under the License.
+ */
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	smslog "polardb-sms/pkg/log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"polardb-sms/pkg/network/message"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+//writeConf writes the cert issued by the ca and the trusted ca into dir
+func (ca *testCA) writeConf(t *testing.T, dir string, trusted *testCA) TLSConfig {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "sms"},
+		DNSNames:     []string{"sms"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	conf := TLSConfig{
+		CertFile:   filepath.Join(dir, "tls.crt"),
+		KeyFile:    filepath.Join(dir, "tls.key"),
+		CAFile:     filepath.Join(dir, "ca.crt"),
+		ServerName: "sms",
+	}
+	assert.NoError(t, ioutil.WriteFile(conf.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(conf.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	assert.NoError(t, ioutil.WriteFile(conf.CAFile, trusted.pem, 0600))
+	return conf
+}
+
+func TestMutualTLS(t *testing.T) {
+	smslog.InitLogger(t.TempDir(), "test.log", zapcore.DebugLevel)
+	ca, otherCa := newTestCA(t, "ca"), newTestCA(t, "other-ca")
+	server, err := NewCertReloader(ca.writeConf(t, t.TempDir(), ca))
+	assert.NoError(t, err)
+	l, err := Listen("127.0.0.1:0", server)
+	assert.NoError(t, err)
+	defer l.Close()
+	accepted := make(chan error, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := Handshake(conn); err != nil {
+					accepted <- err
+					return
+				}
+				smsConn := NewSmsConnection(conn)
+				msg, err := smsConn.Receive()
+				if err == nil {
+					err = smsConn.Send(msg)
+				}
+				accepted <- err
+			}()
+		}
+	}()
+
+	//the client trusted by the server gets its message echoed
+	clientDir := t.TempDir()
+	client, err := NewCertReloader(ca.writeConf(t, clientDir, ca))
+	assert.NoError(t, err)
+	conn, err := Dial(l.Addr().String(), client)
+	assert.NoError(t, err)
+	smsConn := NewSmsConnection(conn)
+	msg := message.NewSmsMessageBuilder().WithType(message.SmsMessageHead_CMD_PR_EXEC_REQ).WithContent([]byte("{}")).Build()
+	assert.NoError(t, smsConn.Send(msg))
+	echo, err := smsConn.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, msg.Head.MsgId, echo.Head.MsgId)
+	assert.NoError(t, <-accepted)
+	smsConn.Close()
+
+	//the client of another CA is rejected by the server
+	untrusted, err := NewCertReloader(otherCa.writeConf(t, t.TempDir(), ca))
+	assert.NoError(t, err)
+	if conn, err = Dial(l.Addr().String(), untrusted); err == nil {
+		_, _ = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	assert.Error(t, <-accepted)
+
+	//the plain tcp client is rejected
+	conn, err = net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	_, _ = conn.Write([]byte("plain\n"))
+	assert.Error(t, <-accepted)
+	conn.Close()
+
+	//the client does not trust the server of another CA
+	otherServer, err := NewCertReloader(otherCa.writeConf(t, t.TempDir(), ca))
+	assert.NoError(t, err)
+	otherLeaf, err := x509.ParseCertificate(otherServer.cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Error(t, verifyPeer([]*x509.Certificate{otherLeaf}, client.pool, "sms"))
+
+	//the rotated cert is reloaded once the files change
+	rotated := otherCa.writeConf(t, clientDir, otherCa)
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{rotated.CertFile, rotated.KeyFile, rotated.CAFile} {
+		assert.NoError(t, os.Chtimes(f, later, later))
+	}
+	client.checkTime = time.Time{}
+	cert, _ := client.current()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "other-ca", leaf.Issuer.CommonName)
+}
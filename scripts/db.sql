@@ -63,6 +63,7 @@ create TABLE IF NOT EXISTS `logical_volume`(
   `fs_size` bigint DEFAULT NULL,
   `pr_status` mediumtext,
   `pr_node_id` varchar(45) DEFAULT NULL,
+  `fence_generation` bigint DEFAULT 0,
   `used_size` bigint DEFAULT NULL,
   `related_pvc` varchar(45) DEFAULT NULL,
   `volume_id` varchar(45) DEFAULT NULL,
@@ -74,6 +75,38 @@ create TABLE IF NOT EXISTS `logical_volume`(
   UNIQUE KEY `name_UNIQUE` (`volume_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
 
+drop table IF EXISTS `lv_fence_history` ;
+
+create TABLE IF NOT EXISTS `lv_fence_history`(
+  `id`         int          NOT NULL AUTO_INCREMENT,
+  `volume_id`  varchar(45)  NOT NULL,
+  `generation` bigint       NOT NULL,
+  `node_id`    varchar(128) DEFAULT NULL,
+  `pr_key`     varchar(45)  DEFAULT NULL,
+  `created`    datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `volume_generation_UNIQUE` (`volume_id`, `generation`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+drop table IF EXISTS `pr_capability_profile` ;
+
+create TABLE IF NOT EXISTS `pr_capability_profile`(
+  `id`                int          NOT NULL AUTO_INCREMENT,
+  `vendor`            varchar(45)  NOT NULL,
+  `product`           varchar(45)  NOT NULL,
+  `volume_id`         varchar(45)  DEFAULT NULL,
+  `probed_type`       int          DEFAULT NULL,
+  `reservation_types` varchar(45)  DEFAULT NULL,
+  `ptpl_capable`      tinyint(1)   DEFAULT NULL,
+  `atp_capable`       tinyint(1)   DEFAULT NULL,
+  `steps`             text,
+  `report`            mediumtext,
+  `created`           datetime     DEFAULT NULL,
+  `updated`           datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `vendor_product_UNIQUE` (`vendor`, `product`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
 drop table IF EXISTS `workflow` ;
 
 create TABLE IF NOT EXISTS `workflow` (
@@ -91,6 +124,35 @@ create TABLE IF NOT EXISTS `workflow` (
   `trace_context`    text,
   `volume_id` varchar(45) DEFAULT NULL,
   `volume_class` varchar(45) DEFAULT NULL,
+  `canceled` tinyint DEFAULT NULL,
+  `callback_url` varchar(512) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `workflowId_UNIQUE` (`workflow_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+
+drop table IF EXISTS `workflow_volume_lock` ;
+
+create TABLE IF NOT EXISTS `workflow_volume_lock`(
+  `id`          int         NOT NULL AUTO_INCREMENT,
+  `volume_id`   varchar(45) NOT NULL,
+  `workflow_id` varchar(45) NOT NULL,
+  `created`     datetime    DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `volume_id_UNIQUE` (`volume_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+drop table IF EXISTS `workflow_archive` ;
+
+create TABLE IF NOT EXISTS `workflow_archive` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `workflow_id` varchar(45) NOT NULL,
+  `type` int NOT NULL,
+  `status` int DEFAULT NULL,
+  `volume_id` varchar(45) DEFAULT NULL,
+  `wfl_created` datetime DEFAULT NULL,
+  `archived` datetime DEFAULT NULL,
+  `content` longblob,
   PRIMARY KEY (`id`),
   UNIQUE KEY `workflowId_UNIQUE` (`workflow_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
@@ -111,6 +173,35 @@ create TABLE IF NOT EXISTS `cluster_agent`(
   UNIQUE KEY `agent_id_UNIQUE` (`agent_id`, `cluster_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
 
+drop table IF EXISTS `node_pr_key` ;
+
+create TABLE IF NOT EXISTS `node_pr_key`(
+  `id`         int          NOT NULL AUTO_INCREMENT,
+  `node_id`    varchar(128) NOT NULL,
+  `pr_key`     varchar(45)  NOT NULL,
+  `scheme`     varchar(45)  DEFAULT NULL,
+  `generation` int          DEFAULT NULL,
+  `created`    datetime     DEFAULT NULL,
+  `updated`    datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `node_id_UNIQUE` (`node_id`),
+  UNIQUE KEY `pr_key_UNIQUE` (`pr_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+drop table IF EXISTS `node_fence_history` ;
+
+create TABLE IF NOT EXISTS `node_fence_history`(
+  `id`         int          NOT NULL AUTO_INCREMENT,
+  `node_id`    varchar(128) NOT NULL,
+  `pr_key`     varchar(45)  DEFAULT NULL,
+  `action`     varchar(16)  NOT NULL,
+  `reason`     varchar(255) DEFAULT NULL,
+  `volumes`    text,
+  `created`    datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `node_id_INDEX` (`node_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
 drop table IF EXISTS `idempotent` ;
 create TABLE IF NOT EXISTS `idempotent` (
   `id`            int         NOT NULL AUTO_INCREMENT,
@@ -0,0 +1,83 @@
+/*
+upgrade the schema of an existing deployment, db.sql creates the tables from scratch
+*/
+
+ALTER TABLE `workflow` ADD COLUMN `canceled` tinyint DEFAULT NULL;
+ALTER TABLE `workflow` ADD COLUMN `callback_url` varchar(512) DEFAULT NULL;
+
+create TABLE IF NOT EXISTS `workflow_volume_lock`(
+  `id`          int         NOT NULL AUTO_INCREMENT,
+  `volume_id`   varchar(45) NOT NULL,
+  `workflow_id` varchar(45) NOT NULL,
+  `created`     datetime    DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `volume_id_UNIQUE` (`volume_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+ALTER TABLE `logical_volume` ADD COLUMN `fence_generation` bigint DEFAULT 0;
+
+create TABLE IF NOT EXISTS `lv_fence_history`(
+  `id`         int          NOT NULL AUTO_INCREMENT,
+  `volume_id`  varchar(45)  NOT NULL,
+  `generation` bigint       NOT NULL,
+  `node_id`    varchar(128) DEFAULT NULL,
+  `pr_key`     varchar(45)  DEFAULT NULL,
+  `created`    datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `volume_generation_UNIQUE` (`volume_id`, `generation`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+create TABLE IF NOT EXISTS `workflow_archive` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `workflow_id` varchar(45) NOT NULL,
+  `type` int NOT NULL,
+  `status` int DEFAULT NULL,
+  `volume_id` varchar(45) DEFAULT NULL,
+  `wfl_created` datetime DEFAULT NULL,
+  `archived` datetime DEFAULT NULL,
+  `content` longblob,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `workflowId_UNIQUE` (`workflow_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+create TABLE IF NOT EXISTS `node_pr_key`(
+  `id`         int          NOT NULL AUTO_INCREMENT,
+  `node_id`    varchar(128) NOT NULL,
+  `pr_key`     varchar(45)  NOT NULL,
+  `scheme`     varchar(45)  DEFAULT NULL,
+  `generation` int          DEFAULT NULL,
+  `created`    datetime     DEFAULT NULL,
+  `updated`    datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `node_id_UNIQUE` (`node_id`),
+  UNIQUE KEY `pr_key_UNIQUE` (`pr_key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+create TABLE IF NOT EXISTS `pr_capability_profile`(
+  `id`                int          NOT NULL AUTO_INCREMENT,
+  `vendor`            varchar(45)  NOT NULL,
+  `product`           varchar(45)  NOT NULL,
+  `volume_id`         varchar(45)  DEFAULT NULL,
+  `probed_type`       int          DEFAULT NULL,
+  `reservation_types` varchar(45)  DEFAULT NULL,
+  `ptpl_capable`      tinyint(1)   DEFAULT NULL,
+  `atp_capable`       tinyint(1)   DEFAULT NULL,
+  `steps`             text,
+  `report`            mediumtext,
+  `created`           datetime     DEFAULT NULL,
+  `updated`           datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `vendor_product_UNIQUE` (`vendor`, `product`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;
+
+create TABLE IF NOT EXISTS `node_fence_history`(
+  `id`         int          NOT NULL AUTO_INCREMENT,
+  `node_id`    varchar(128) NOT NULL,
+  `pr_key`     varchar(45)  DEFAULT NULL,
+  `action`     varchar(16)  NOT NULL,
+  `reason`     varchar(255) DEFAULT NULL,
+  `volumes`    text,
+  `created`    datetime     DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `node_id_INDEX` (`node_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_general_ci;